@@ -9,3 +9,14 @@ var (
 	// ErrInvalidAPIKey is returned when an API key is provided but not found in the token store.
 	ErrInvalidAPIKey = errors.New("invalid api key")
 )
+
+// Code is a stable, machine-readable error identifier. The pdf-renderer uses the same problem
+// format, so clients see one set of codes behind the gateway.
+type Code string
+
+const (
+	CodeAPIKeyRequired  Code = "API_KEY_REQUIRED" // /ops without an API key
+	CodeInvalidAPIKey   Code = "INVALID_API_KEY"  // unknown key, or key without the required scope
+	CodeRateLimited     Code = "RATE_LIMITED"     // per-key or per-client request limit reached
+	CodeAuthUnavailable Code = "AUTH_UNAVAILABLE" // token store not loaded yet
+)
@@ -2,12 +2,14 @@ package middleware
 
 import (
 	"errors"
+	"path"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/keyauth"
 
 	"auth-service/internal/domain"
+	"auth-service/internal/http/problem"
 	"auth-service/internal/infra/logging"
 )
 
@@ -53,20 +55,15 @@ func OptionalAPIKeyAuth(tokens TokenStore) fiber.Handler {
 			return false
 		},
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			status := fiber.StatusUnauthorized
-			if err == nil {
-				err = fiber.ErrUnauthorized
+			status, code, detail := fiber.StatusUnauthorized, domain.CodeInvalidAPIKey, "Invalid API key"
+			switch {
+			case err == nil || errors.Is(err, keyauth.ErrMissingOrMalformedAPIKey):
+				code, detail = domain.CodeAPIKeyRequired, "API key required"
+			case errors.Is(err, domain.ErrTokenStoreNotReady):
+				status, code, detail = fiber.StatusServiceUnavailable, domain.CodeAuthUnavailable, "Authentication is not available yet; try again later"
 			}
-			if errors.Is(err, domain.ErrTokenStoreNotReady) {
-				status = fiber.StatusServiceUnavailable
-			}
-			logging.Warn("Auth error", "status", status, "message", err.Error(), "method", c.Method(), "path", c.Path())
-			return c.Status(status).JSON(fiber.Map{
-				"error": fiber.Map{
-					"code":    status,
-					"message": err.Error(),
-				},
-			})
+			logging.Warn("Auth error", "status", status, "code", code, "method", c.Method(), "path", c.Path())
+			return problem.Write(c, status, code, detail)
 		},
 	})
 }
@@ -81,12 +78,14 @@ func redactToken(token string) string {
 	return token[:4] + "..." + token[len(token)-4:]
 }
 
-func isOpsPathFromRequest(path string) bool {
-	if strings.HasPrefix(path, "/ext-authz") {
-		path = strings.TrimPrefix(path, "/ext-authz")
-		if path == "" {
-			path = "/"
-		}
+// isOpsPathFromRequest reports whether a request reaches the renderer's /ops routes. ext_authz
+// forwards the original path behind /ext-authz, before Envoy rewrites the /api prefix to /, and
+// the renderer matches routes case-insensitively, so all three are undone before matching.
+func isOpsPathFromRequest(p string) bool {
+	p = strings.TrimPrefix(p, "/ext-authz")
+	if rest, ok := strings.CutPrefix(p, "/api"); ok {
+		p = "/" + rest
 	}
-	return path == "/ops" || strings.HasPrefix(path, "/ops/")
+	p = strings.ToLower(path.Clean("/" + p))
+	return p == "/ops" || strings.HasPrefix(p, "/ops/")
 }
@@ -1,13 +1,30 @@
 package middleware
 
 import (
+	"encoding/json"
 	"net/http"
 	"testing"
 
+	"auth-service/internal/domain"
+	"auth-service/internal/http/problem"
 	"auth-service/internal/tokens"
 	"github.com/gofiber/fiber/v2"
 )
 
+func assertProblem(t *testing.T, resp *http.Response, code domain.Code) {
+	t.Helper()
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != problem.MIMEProblemJSON {
+		t.Fatalf("expected %s, got %q", problem.MIMEProblemJSON, ct)
+	}
+	var p problem.Details
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if p.Code != code || p.Status != resp.StatusCode {
+		t.Fatalf("expected code %s / status %d, got %+v", code, resp.StatusCode, p)
+	}
+}
+
 func TestOptionalAPIKeyAuth_PublicAccess(t *testing.T) {
 	app := fiber.New()
 	cache := tokens.NewCache() // not ready, but should be OK for public
@@ -41,6 +58,7 @@ func TestOptionalAPIKeyAuth_TokenStoreNotReady(t *testing.T) {
 	if resp.StatusCode != fiber.StatusServiceUnavailable {
 		t.Fatalf("expected 503, got %d", resp.StatusCode)
 	}
+	assertProblem(t, resp, domain.CodeAuthUnavailable)
 }
 
 func TestOptionalAPIKeyAuth_InvalidAndValidKey(t *testing.T) {
@@ -72,6 +90,7 @@ func TestOptionalAPIKeyAuth_InvalidAndValidKey(t *testing.T) {
 	if resp1.StatusCode != fiber.StatusUnauthorized {
 		t.Fatalf("expected 401, got %d", resp1.StatusCode)
 	}
+	assertProblem(t, resp1, domain.CodeInvalidAPIKey)
 
 	// valid
 	req2, _ := http.NewRequest(http.MethodGet, "/", nil)
@@ -84,3 +103,61 @@ func TestOptionalAPIKeyAuth_InvalidAndValidKey(t *testing.T) {
 		t.Fatalf("expected 200, got %d", resp2.StatusCode)
 	}
 }
+
+func TestIsOpsPathFromRequest(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/ops/cache":                 true,
+		"/ext-authz/ops":             true,
+		"/ext-authz/ops/cache/stats": true,
+		"/ext-authz/api/ops/cache":   true, // Envoy rewrites /api/ to /
+		"/ext-authz/apiops/cache":    true, // ... and /api to /
+		"/ext-authz/api//ops/cache":  true,
+		"/ext-authz/api/OPS/cache":   true, // the renderer routes case-insensitively
+		"/ext-authz/api/x/../ops":    true,
+		"/ext-authz/api/v0/pdf":      false,
+		"/ext-authz/api/v0/ops":      false,
+		"/ext-authz/opsx":            false,
+	} {
+		if got := isOpsPathFromRequest(path); got != want {
+			t.Errorf("isOpsPathFromRequest(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestOptionalAPIKeyAuth_OpsThroughAPIPrefix(t *testing.T) {
+	app := fiber.New()
+	cache := tokens.NewCache()
+	cache.Replace(map[string]tokens.Entry{
+		"api": {RateLimit: 1, Scope: tokens.Scope{"api": true}},
+		"ops": {RateLimit: 1, Scope: tokens.Scope{"api": true, "ops": true}},
+	})
+
+	app.Use(OptionalAPIKeyAuth(cache))
+	app.All("/ext-authz/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	for _, tt := range []struct {
+		method, key string
+		status      int
+		code        domain.Code
+	}{
+		{http.MethodDelete, "", fiber.StatusUnauthorized, domain.CodeAPIKeyRequired},
+		{http.MethodGet, "", fiber.StatusUnauthorized, domain.CodeAPIKeyRequired},
+		{http.MethodDelete, "api", fiber.StatusUnauthorized, domain.CodeInvalidAPIKey},
+		{http.MethodDelete, "ops", fiber.StatusOK, ""},
+	} {
+		req, _ := http.NewRequest(tt.method, "/ext-authz/api/ops/cache", nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Fatalf("%s with key %q: expected %d, got %d", tt.method, tt.key, tt.status, resp.StatusCode)
+		}
+		if tt.code != "" {
+			assertProblem(t, resp, tt.code)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 
+	"auth-service/internal/domain"
+	"auth-service/internal/http/problem"
 	"auth-service/internal/infra/logging"
 )
 
@@ -54,12 +56,7 @@ func (lc *LimiterCache) GetOrCreate(max int, interval time.Duration, store fiber
 		LimitReached: func(c *fiber.Ctx) error {
 			token, _ := c.Locals("api_key").(string)
 			logging.Warn("Rate limit exceeded", "token", token, "path", c.Path())
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": fiber.Map{
-					"code":    fiber.StatusTooManyRequests,
-					"message": "Too many requests",
-				},
-			})
+			return problem.Write(c, fiber.StatusTooManyRequests, domain.CodeRateLimited, "Too many requests")
 		},
 	}
 
@@ -107,12 +104,7 @@ func UserRateLimit(cfg RateLimitConfig, store fiber.Storage) fiber.Handler {
 			sum := sha256.Sum256([]byte(c.IP() + c.Get("User-Agent")))
 			key := hex.EncodeToString(sum[:])
 			logging.Warn("Rate limit exceeded", "user", key, "path", c.Path())
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": fiber.Map{
-					"code":    fiber.StatusTooManyRequests,
-					"message": "Too many requests",
-				},
-			})
+			return problem.Write(c, fiber.StatusTooManyRequests, domain.CodeRateLimited, "Too many requests")
 		},
 	}
 
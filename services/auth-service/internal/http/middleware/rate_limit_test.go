@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"auth-service/internal/domain"
 	"github.com/gofiber/fiber/v2"
 	memoryStorage "github.com/gofiber/storage/memory/v2"
 )
@@ -47,6 +48,7 @@ func TestTokenRateLimit_Enforced(t *testing.T) {
 	if resp2.StatusCode != fiber.StatusTooManyRequests {
 		t.Fatalf("expected 429, got %d", resp2.StatusCode)
 	}
+	assertProblem(t, resp2, domain.CodeRateLimited)
 }
 
 func TestTokenRateLimit_Disabled(t *testing.T) {
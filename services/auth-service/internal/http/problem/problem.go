@@ -0,0 +1,44 @@
+// Package problem writes RFC 7807 problem details (application/problem+json) in the same shape
+// as the pdf-renderer, so Envoy's ext_authz denials look like any other API error.
+package problem
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"auth-service/internal/domain"
+)
+
+// MIMEProblemJSON is the content type of problem responses.
+const MIMEProblemJSON = "application/problem+json"
+
+// Details is an RFC 7807 problem document with the service's extension members.
+type Details struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      domain.Code `json:"code"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// Write responds with a problem document. The instance is the client's original path, without
+// the /ext-authz prefix Envoy adds.
+func Write(c *fiber.Ctx, status int, code domain.Code, detail string) error {
+	instance := strings.TrimPrefix(c.Path(), "/ext-authz")
+	if instance == "" {
+		instance = "/"
+	}
+	return c.Status(status).JSON(Details{
+		Type:      "urn:html2pdf:error:" + string(code),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  instance,
+		Code:      code,
+		RequestID: c.Get(fiber.HeaderXRequestID),
+	}, MIMEProblemJSON)
+}
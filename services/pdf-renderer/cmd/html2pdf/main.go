@@ -11,6 +11,7 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/http/handlers"
 	"pdf-renderer/internal/http/server"
 	"pdf-renderer/internal/infra/logging"
 )
@@ -43,15 +44,22 @@ func main() {
 	})
 	RedisClient = rdb // optional, kept for potential global usage
 
-	app := server.New(server.Deps{Config: cfg, Redis: rdb})
+	svc := handlers.NewPDFService(cfg, rdb)
+	svc.StartJanitor()
+	app := server.New(server.Deps{Config: cfg, Redis: rdb, PDF: svc})
 
 	idleConnsClosed := make(chan struct{})
-	startServer(app, cfg, idleConnsClosed)
+	startServer(app, svc, cfg, idleConnsClosed)
 	<-idleConnsClosed
+
+	_ = rdb.Close()
 }
 
 // startServer starts the Fiber app and listens for shutdown signals.
-func startServer(app *fiber.App, cfg config.Config, idleConnsClosed chan struct{}) {
+//
+// Shutdown is render-aware: readiness flips first and new renders are rejected, then in-flight
+// renders get up to server.drain_timeout to finish before the listener and the Chrome pool close.
+func startServer(app *fiber.App, svc *handlers.PDFService, cfg config.Config, idleConnsClosed chan struct{}) {
 	go func() {
 		if err := app.Listen(cfg.Server.Host + cfg.Server.Port); err != nil {
 			logging.Error("Server error", "error", err)
@@ -63,9 +71,18 @@ func startServer(app *fiber.App, cfg config.Config, idleConnsClosed chan struct{
 	signal.Notify(sigint, syscall.SIGINT, syscall.SIGTERM)
 	<-sigint
 
-	logging.Warn("Shutdown signal received, closing server...")
+	timeout := drainTimeout(cfg)
+	logging.Warn("Shutdown signal received, draining in-flight renders...", "drain_timeout", timeout.String())
+
+	svc.BeginDrain()
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), timeout)
+	if err := svc.WaitForInflight(drainCtx); err != nil {
+		logging.Error("Drain timeout reached, aborting in-flight renders", "error", err)
+	}
+	drainCancel()
 
-	// Graceful shutdown with timeout.
+	// Renders are done (or given up on); closing connections should be quick.
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -73,6 +90,18 @@ func startServer(app *fiber.App, cfg config.Config, idleConnsClosed chan struct{
 		logging.Error("Server forced to shutdown", "error", err)
 	}
 
+	// Kill Chromium and remove its profile directory from user_data_dir.
+	svc.Close()
+
 	close(idleConnsClosed)
 	logging.Info("Server stopped cleanly")
 }
+
+// drainTimeout returns the configured drain timeout, defaulting to the render timeout plus a
+// grace period so a render that just started can still finish.
+func drainTimeout(cfg config.Config) time.Duration {
+	if cfg.Server.DrainTimeout > 0 {
+		return cfg.Server.DrainTimeout
+	}
+	return time.Duration(cfg.PDF.TimeoutSecs)*time.Second + 5*time.Second
+}
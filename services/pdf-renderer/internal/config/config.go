@@ -14,6 +14,10 @@ type Config struct {
 		Host    string `yaml:"host"`    // Host address to bind the service to
 		Port    string `yaml:"port"`    // Port on which the service listens
 		Prefork bool   `yaml:"prefork"` // Enable Fiber prefork mode (multi-process)
+
+		// DrainTimeout bounds how long shutdown waits for in-flight renders before the Chrome
+		// pool is closed. If 0, pdf.timeout_secs plus a small grace period is used.
+		DrainTimeout time.Duration `yaml:"drain_timeout"`
 	} `yaml:"server"`
 
 	Limits struct {
@@ -36,6 +40,30 @@ type Config struct {
 		RedisHost       string        `yaml:"redis_host"`        // Redis server host (optional)
 		RateLimitDB     int           `yaml:"redis_rate_db"`     // Redis DB for rate limiting
 		PDFCacheDB      int           `yaml:"redis_pdf_db"`      // Redis DB for PDF caching
+		PDFCacheMinTTL  time.Duration `yaml:"pdf_cache_min_ttl"` // Lower bound for the per-request cache_ttl override (0 = 10s)
+		PDFCacheMaxTTL  time.Duration `yaml:"pdf_cache_max_ttl"` // Upper bound for the per-request cache_ttl override (0 = 1h)
+
+		// Cross-replica stampede protection: one replica renders a missing document while the
+		// others wait for it to appear in the cache.
+		RenderLockEnabled bool          `yaml:"render_lock_enabled"` // Take a Redis lock per cache key before rendering
+		RenderLockTTL     time.Duration `yaml:"render_lock_ttl"`     // Lock lease (0 = pdf.timeout_secs + 10s)
+		RenderLockWait    time.Duration `yaml:"render_lock_wait"`    // How long followers wait before rendering themselves (0 = pdf.timeout_secs)
+
+		// PDF cache storage: redis (default), memory, filesystem, or tiered (memory L1 + redis L2).
+		Backend string `yaml:"backend"`
+		Redis   struct {
+			MaxEntryBytes int64  `yaml:"max_entry_bytes"` // PDFs larger than this (after compression) are not cached in Redis (0 = no limit)
+			Compression   string `yaml:"compression"`     // Codec for stored PDFs: none, gzip or zstd; empty = none (config/html2pdf.yaml ships zstd)
+		} `yaml:"redis"`
+		Memory struct {
+			MaxBytes   int64         `yaml:"max_bytes"`   // Total size cap for the in-memory LRU (0 = no limit)
+			MaxEntries int           `yaml:"max_entries"` // Entry count cap for the in-memory LRU (0 = no limit)
+			MaxTTL     time.Duration `yaml:"max_ttl"`     // Tiered only: lifetime cap for L1 copies (0 = same as L2)
+		} `yaml:"memory"`
+		Filesystem struct {
+			Dir      string `yaml:"dir"`       // Cache directory (empty = <tmp>/html2pdf-cache)
+			MaxBytes int64  `yaml:"max_bytes"` // Total size cap; least recently used files are evicted (0 = no limit)
+		} `yaml:"filesystem"`
 	} `yaml:"cache"`
 
 	PDF struct {
@@ -46,7 +74,66 @@ type Config struct {
 		ChromeNoSandbox bool                 `yaml:"chrome_no_sandbox"` // Whether to launch Chrome with --no-sandbox
 		ChromePoolSize  int                  `yaml:"chrome_pool_size"`  // Number of preloaded Chrome tabs (0 = disabled)
 		UserDataDir     string               `yaml:"user_data_dir"`     // Optional fixed user data dir (recommended when pooling)
+
+		// Janitor for profile directories and Chromium processes left behind by crashed runs.
+		ProfileGCInterval time.Duration `yaml:"profile_gc_interval"` // How often to sweep user_data_dir (0 = 10m)
+		ProfileGCMinAge   time.Duration `yaml:"profile_gc_min_age"`  // Never remove profile dirs younger than this (0 = 2m)
 	} `yaml:"pdf"`
+
+	// Storage is the S3-compatible bucket used by output=storage.
+	Storage struct {
+		Enabled        bool          `yaml:"enabled"`         // Whether output=storage is available
+		Endpoint       string        `yaml:"endpoint"`        // S3 endpoint as host[:port] (e.g. minio:9000, s3.eu-central-1.amazonaws.com)
+		PublicEndpoint string        `yaml:"public_endpoint"` // Host used in presigned URLs if clients reach storage differently (optional)
+		UseSSL         bool          `yaml:"use_ssl"`         // Use HTTPS for the endpoint(s)
+		Region         string        `yaml:"region"`          // Bucket region (empty = us-east-1)
+		Bucket         string        `yaml:"bucket"`          // Target bucket; must already exist
+		AccessKey      string        `yaml:"access_key"`      // Access key ID
+		SecretKey      string        `yaml:"secret_key"`      // Secret access key
+		KeyTemplate    string        `yaml:"key_template"`    // Object key template (empty = {date}/{id}.pdf), see README
+		PresignExpiry  time.Duration `yaml:"presign_expiry"`  // Lifetime of presigned download URLs (0 = 15m)
+		UploadTimeout  time.Duration `yaml:"upload_timeout"`  // Upload deadline (0 = 30s)
+
+		// TokenPrefixes maps the SHA-256 (hex) of an API key to a key prefix, so each tenant's
+		// objects live under their own path. Requests without a mapping use no prefix.
+		TokenPrefixes map[string]string `yaml:"token_prefixes"`
+	} `yaml:"storage"`
+
+	// Signing holds the certificates PDFs can be signed with (PAdES), one per profile.
+	Signing struct {
+		Profiles map[string]SigningProfile `yaml:"profiles"` // Profile name -> certificate and signature defaults
+
+		// TokenProfiles maps the SHA-256 (hex) of an API key to the profile used when its requests
+		// ask for a signature without naming one. The key may always use that profile.
+		TokenProfiles map[string]string `yaml:"token_profiles"`
+	} `yaml:"signing"`
+
+	// Templates holds the PDF forms POST /v0/pdf/fill can fill by name instead of an upload.
+	Templates struct {
+		Dir string `yaml:"dir"` // Directory of <name>.pdf files (empty = no stored templates)
+	} `yaml:"templates"`
+
+	// Preview holds what output=png needs to rasterize PDFs in Chrome.
+	Preview struct {
+		PDFJSDir string `yaml:"pdfjs_dir"` // Unpacked pdfjs-dist package (build/, standard_fonts/, cmaps/); empty = output=png disabled
+	} `yaml:"preview"`
+}
+
+// SigningProfile is a signing certificate with its private key, either as PEM files or as a
+// PKCS #12 bundle, and the defaults for the signatures made with it.
+type SigningProfile struct {
+	CertFile       string `yaml:"cert_file"`       // PEM certificate, optionally followed by its chain
+	KeyFile        string `yaml:"key_file"`        // PEM private key (PKCS #8, PKCS #1 or SEC 1)
+	PKCS12File     string `yaml:"pkcs12_file"`     // PKCS #12 bundle, instead of cert_file and key_file
+	PKCS12Password string `yaml:"pkcs12_password"` // Password of the PKCS #12 bundle
+
+	Reason      string `yaml:"reason"`       // Default reason for signing
+	Location    string `yaml:"location"`     // Default signing location
+	ContactInfo string `yaml:"contact_info"` // Default contact information of the signer
+
+	// Tokens are the SHA-256 (hex) digests of the API keys allowed to use the profile, besides the
+	// keys TokenProfiles maps to it. Other keys, and requests without a key, can never sign with it.
+	Tokens []string `yaml:"tokens"`
 }
 
 // PaperSize defines width and height in inches for a specific paper format.
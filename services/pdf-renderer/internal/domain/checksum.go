@@ -0,0 +1,13 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Checksum returns the hex SHA-256 of data. It names API keys wherever they must not be stored
+// (cache tags, storage prefixes, signing profiles) and checksums stored PDFs.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
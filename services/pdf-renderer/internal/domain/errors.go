@@ -0,0 +1,136 @@
+package domain
+
+import "strings"
+
+// Code is a stable, machine-readable error identifier. Clients may switch on it; the message
+// next to it is meant for humans and may change.
+type Code string
+
+// Request validation.
+const (
+	CodeInvalidRequest       Code = "INVALID_REQUEST" // several fields are invalid, see the field list
+	CodeInvalidJSON          Code = "INVALID_JSON"
+	CodeUnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE"
+	CodeUnsupportedVersion   Code = "UNSUPPORTED_VERSION"
+	CodeInvalidSource        Code = "INVALID_SOURCE"
+	CodeInvalidURL           Code = "INVALID_URL"
+	CodeInvalidHTML          Code = "INVALID_HTML"
+	CodeHTMLTooLarge         Code = "HTML_TOO_LARGE"
+	CodeInvalidFormat        Code = "INVALID_FORMAT"
+	CodeInvalidOrientation   Code = "INVALID_ORIENTATION"
+	CodeInvalidMargin        Code = "INVALID_MARGIN"
+	CodeInvalidFilename      Code = "INVALID_FILENAME"
+	CodeInvalidCacheTTL      Code = "INVALID_CACHE_TTL"
+	CodeInvalidOutput        Code = "INVALID_OUTPUT"
+	CodeInvalidWait          Code = "INVALID_WAIT"
+	CodeInvalidEmulation     Code = "INVALID_EMULATION"
+	CodeInvalidMetadata      Code = "INVALID_METADATA"
+	CodeInvalidPDFA          Code = "INVALID_PDFA"
+	CodeInvalidEncryption    Code = "INVALID_ENCRYPTION"
+	CodeInvalidWatermark     Code = "INVALID_WATERMARK"
+	CodeInvalidSignature     Code = "INVALID_SIGNATURE"
+	CodeSignatureForbidden   Code = "SIGNATURE_FORBIDDEN" // the API key may not use the signing profile
+	CodeInvalidOptimization  Code = "INVALID_OPTIMIZATION"
+	CodeInvalidSplit         Code = "INVALID_SPLIT"
+	CodeInvalidOutline       Code = "INVALID_OUTLINE"
+	CodeInvalidAttachment    Code = "INVALID_ATTACHMENT"
+	CodeInvalidForm          Code = "INVALID_FORM" // the form fields or their values do not fit the PDF
+	CodeInvalidPreview       Code = "INVALID_PREVIEW"
+	CodeInvalidToken         Code = "INVALID_TOKEN"
+)
+
+// Rendering.
+const (
+	CodePDFTooLarge       Code = "PDF_TOO_LARGE"
+	CodeRenderTimeout     Code = "RENDER_TIMEOUT"
+	CodePoolSaturated     Code = "POOL_SATURATED"     // no Chrome tab became free in time
+	CodeChromeCrashed     Code = "CHROME_CRASHED"     // the browser session died during the render
+	CodeChromeUnavailable Code = "CHROME_UNAVAILABLE" // the browser could not be started
+	CodeNavigationFailed  Code = "NAVIGATION_FAILED"  // the page could not be loaded (net::ERR_*)
+	CodeRenderFailed      Code = "RENDER_FAILED"
+	CodePostProcessFailed Code = "POSTPROCESS_FAILED"  // editing Chrome's PDF in Go failed
+	CodePDFANotConformant Code = "PDFA_NOT_CONFORMANT" // the page cannot be made PDF/A (e.g. unembedded fonts)
+)
+
+// Service state and dependencies.
+const (
+	CodeShuttingDown        Code = "SHUTTING_DOWN"
+	CodeCacheDisabled       Code = "CACHE_DISABLED"
+	CodeCacheUnavailable    Code = "CACHE_UNAVAILABLE"
+	CodeStorageDisabled     Code = "STORAGE_DISABLED"
+	CodeStorageUploadFailed Code = "STORAGE_UPLOAD_FAILED"
+	CodeSigningUnavailable  Code = "SIGNING_UNAVAILABLE" // the signing profile's certificate failed to load
+	CodePreviewDisabled     Code = "PREVIEW_DISABLED"    // output=png without pdf.js
+)
+
+// Generic codes for errors raised outside the handlers (routing, body limits, bugs).
+const (
+	CodeBadRequest       Code = "BAD_REQUEST"
+	CodeNotFound         Code = "NOT_FOUND"
+	CodeMethodNotAllowed Code = "METHOD_NOT_ALLOWED"
+	CodeRequestTooLarge  Code = "REQUEST_TOO_LARGE"
+	CodeInternal         Code = "INTERNAL"
+)
+
+// Error is a failure with a stable code and a message that is safe to show to clients. Err keeps
+// the internal cause for logs; it is never sent to clients.
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+// NewError returns an Error without an internal cause.
+func NewError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// WrapError returns an Error that keeps err as its internal cause.
+func WrapError(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// FieldError describes one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError carries every field error of a request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "Invalid request: " + strings.Join(msgs, "; ")
+}
+
+// Code is the code shared by all field errors, or CodeInvalidRequest if they differ.
+func (e *ValidationError) Code() Code {
+	for _, f := range e.Fields[1:] {
+		if f.Code != e.Fields[0].Code {
+			return CodeInvalidRequest
+		}
+	}
+	return e.Fields[0].Code
+}
+
+// First returns the first field error as a plain Error.
+func (e *ValidationError) First() *Error {
+	f := e.Fields[0]
+	return NewError(f.Code, f.Message)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/infra/logging"
+)
+
+const (
+	defaultMinCacheTTL = 10 * time.Second
+	defaultMaxCacheTTL = 1 * time.Hour
+)
+
+var (
+	errCacheDisabled    = domain.NewError(domain.CodeCacheDisabled, "PDF cache is not enabled")
+	errCacheUnavailable = domain.NewError(domain.CodeCacheUnavailable, "PDF cache unavailable")
+)
+
+// cacheWrite describes how a freshly rendered PDF is stored in the cache.
+type cacheWrite struct {
+	TTL     time.Duration
+	Tags    []string // cache tags (see cache.URLTag, cache.TokenTag) used for bulk purges
+	Refresh bool     // client asked for a fresh render (Cache-Control: no-cache)
+}
+
+// cacheTags returns the tags a rendered PDF is registered under.
+func cacheTags(params *PDFRequestParams, token string) []string {
+	var tags []string
+	if params.URL != "" {
+		tags = append(tags, cache.URLTag(params.URL))
+	}
+	if token != "" {
+		tags = append(tags, cache.TokenTag(token))
+	}
+	return tags
+}
+
+// requestsNoCache reports whether the client asked to bypass cached copies.
+func requestsNoCache(c *fiber.Ctx) bool {
+	for _, directive := range strings.Split(c.Get(fiber.HeaderCacheControl), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return strings.EqualFold(strings.TrimSpace(c.Get(fiber.HeaderPragma)), "no-cache")
+}
+
+// parseCacheTTL validates the optional cache_ttl request parameter. It accepts a Go duration
+// ("90s", "10m") or plain seconds, bounded by cache.pdf_cache_min_ttl / pdf_cache_max_ttl.
+// An empty value returns 0, meaning the configured pdf_cache_ttl applies.
+func parseCacheTTL(raw string, cfg config.Config) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(raw)
+	if err != nil {
+		secs, convErr := strconv.Atoi(raw)
+		if convErr != nil {
+			return 0, domain.NewError(domain.CodeInvalidCacheTTL, "Invalid cache_ttl: must be a duration (e.g. 10m) or seconds")
+		}
+		ttl = time.Duration(secs) * time.Second
+	}
+
+	minTTL, maxTTL := cacheTTLBounds(cfg)
+	if ttl < minTTL || ttl > maxTTL {
+		return 0, domain.NewError(domain.CodeInvalidCacheTTL, fmt.Sprintf("Invalid cache_ttl: must be between %s and %s", minTTL, maxTTL))
+	}
+	return ttl, nil
+}
+
+func cacheTTLBounds(cfg config.Config) (time.Duration, time.Duration) {
+	minTTL, maxTTL := cfg.Cache.PDFCacheMinTTL, cfg.Cache.PDFCacheMaxTTL
+	if minTTL <= 0 {
+		minTTL = defaultMinCacheTTL
+	}
+	if maxTTL <= 0 {
+		maxTTL = defaultMaxCacheTTL
+	}
+	return minTTL, maxTTL
+}
+
+// HandleCacheStats reports the backend's entry count, stored bytes, size limits, evictions and
+// this instance's hit ratio (per tier for the tiered backend).
+func (svc *PDFService) HandleCacheStats(c *fiber.Ctx) error {
+	out := fiber.Map{
+		"enabled":   svc.cacheEnabled(),
+		"backend":   "",
+		"entries":   0,
+		"bytes":     0,
+		"hits":      0,
+		"misses":    0,
+		"hit_ratio": 0.0,
+		"evictions": 0,
+		"ttl":       cacheTTL(svc.Config.Cache.PDFCacheTTL).String(),
+	}
+	if !svc.cacheEnabled() {
+		return c.JSON(out)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	s, err := svc.Cache.Stats(ctx)
+	if err != nil {
+		logging.Error("PDF cache stats failed", "error", err)
+		return errCacheUnavailable
+	}
+
+	out["backend"] = s.Backend
+	out["entries"] = s.Entries
+	out["bytes"] = s.Bytes
+	out["hits"] = s.Hits
+	out["misses"] = s.Misses
+	out["hit_ratio"] = hitRatio(s.Hits, s.Misses)
+	out["evictions"] = s.Evictions
+	if s.MaxBytes > 0 {
+		out["max_bytes"] = s.MaxBytes
+	}
+	if s.MaxEntries > 0 {
+		out["max_entries"] = s.MaxEntries
+	}
+	if s.Compression != "" {
+		out["compression"] = s.Compression
+		out["compression_ratio"] = s.CompressionRatio
+	}
+	if len(s.Tiers) > 0 {
+		out["tiers"] = s.Tiers
+	}
+	return c.JSON(out)
+}
+
+func hitRatio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// HandlePurgeEntry removes the entry addressed by the same parameters as /v0/pdf
+// (url as query parameter, or html as form field, plus format/orientation/margin).
+func (svc *PDFService) HandlePurgeEntry(c *fiber.Ctx) error {
+	if !svc.cacheEnabled() {
+		return errCacheDisabled
+	}
+
+	var params *PDFRequestParams
+	var err error
+	if c.Query("url") != "" {
+		params, err = validateAndExtractURLParams(c, *svc.Config)
+	} else {
+		params, err = validateAndExtractPDFParams(c, *svc.Config)
+	}
+	if err != nil {
+		return err
+	}
+
+	key := computePDFCacheKey(params)
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	n, err := svc.Cache.Delete(ctx, key)
+	if err != nil {
+		logging.Error("PDF cache purge failed", "error", err)
+		return errCacheUnavailable
+	}
+	logging.Info("PDF cache entry purged", "key", key, "purged", n)
+	return c.JSON(fiber.Map{"purged": n, "key": key})
+}
+
+// HandlePurgeURL removes every cached variant (format, margin, ...) rendered from ?url=.
+func (svc *PDFService) HandlePurgeURL(c *fiber.Ctx) error {
+	url := c.Query("url")
+	if url == "" {
+		return domain.NewError(domain.CodeInvalidURL, "Invalid URL: missing")
+	}
+	return svc.purgeTag(c, cache.URLTag(url), "url", url)
+}
+
+// HandlePurgeToken removes every entry rendered for an API token. The token is read from the
+// form body (never the query string) so it does not end up in access logs.
+func (svc *PDFService) HandlePurgeToken(c *fiber.Ctx) error {
+	token := strings.TrimSpace(c.FormValue("token"))
+	if token == "" {
+		return domain.NewError(domain.CodeInvalidToken, "Invalid token: missing")
+	}
+	return svc.purgeTag(c, cache.TokenTag(token), "token_hash", domain.Checksum([]byte(token))[:12])
+}
+
+// HandleFlushCache removes all cached PDFs and their tags.
+func (svc *PDFService) HandleFlushCache(c *fiber.Ctx) error {
+	if !svc.cacheEnabled() {
+		return errCacheDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 30*time.Second)
+	defer cancel()
+
+	purged, err := svc.Cache.Flush(ctx)
+	if err != nil {
+		logging.Error("PDF cache flush failed", "error", err)
+		return errCacheUnavailable
+	}
+
+	logging.Warn("PDF cache flushed", "purged", purged)
+	return c.JSON(fiber.Map{"purged": purged})
+}
+
+func (svc *PDFService) cacheEnabled() bool {
+	return svc.Cache != nil
+}
+
+// purgeTag deletes every cache entry registered under tag.
+func (svc *PDFService) purgeTag(c *fiber.Ctx, tag, logKey, logValue string) error {
+	if !svc.cacheEnabled() {
+		return errCacheDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	n, err := svc.Cache.PurgeTag(ctx, tag)
+	if err != nil {
+		logging.Error("PDF cache purge failed", "error", err)
+		return errCacheUnavailable
+	}
+
+	logging.Info("PDF cache entries purged", logKey, logValue, "purged", n)
+	return c.JSON(fiber.Map{"purged": n})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseCacheTTL(t *testing.T) {
+	cfg := testConfig()
+	cfg.Cache.PDFCacheMinTTL = 30 * time.Second
+	cfg.Cache.PDFCacheMaxTTL = 10 * time.Minute
+
+	ttl, err := parseCacheTTL("", cfg)
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+
+	ttl, err = parseCacheTTL("5m", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, ttl)
+
+	ttl, err = parseCacheTTL("120", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, ttl)
+
+	for _, raw := range []string{"10s", "1h", "soon"} {
+		_, err = parseCacheTTL(raw, cfg)
+		assert.Error(t, err, raw)
+	}
+}
+
+func Test_requestsNoCache(t *testing.T) {
+	app := newTestApp()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if requestsNoCache(c) {
+			return c.SendString("fresh")
+		}
+		return c.SendString("cached")
+	})
+
+	for header, want := range map[string]string{
+		"no-cache":            "fresh",
+		"max-age=0, no-cache": "fresh",
+		"max-age=60":          "cached",
+		"":                    "cached",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Cache-Control", header)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, want, string(body), header)
+	}
+}
+
+type cacheAdminFixture struct {
+	app *fiber.App
+	srv *miniredis.Miniredis
+	svc *PDFService
+}
+
+func newCacheAdminFixture(t *testing.T) *cacheAdminFixture {
+	t.Helper()
+	svc, srv := newRedisTestService(t, nil)
+
+	app := newTestApp()
+	app.Get("/ops/cache/stats", svc.HandleCacheStats)
+	app.Delete("/ops/cache/entry", svc.HandlePurgeEntry)
+	app.Delete("/ops/cache/url", svc.HandlePurgeURL)
+	app.Delete("/ops/cache/token", svc.HandlePurgeToken)
+	app.Delete("/ops/cache", svc.HandleFlushCache)
+	return &cacheAdminFixture{app: app, srv: srv, svc: svc}
+}
+
+// store caches a PDF for params as the render path would.
+func (f *cacheAdminFixture) store(t *testing.T, params *PDFRequestParams, token, body string) string {
+	t.Helper()
+	key := computePDFCacheKey(params)
+	storeCachedPDF(context.Background(), f.svc.Cache, key, newCachedPDF([]byte(body), time.Minute), time.Minute, cacheTags(params, token)...)
+	return key
+}
+
+func (f *cacheAdminFixture) do(t *testing.T, method, target, form string) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if form != "" {
+		req = httptest.NewRequest(method, target, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := f.app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var out map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return out
+}
+
+func TestCacheAdmin_PurgeByURL(t *testing.T) {
+	f := newCacheAdminFixture(t)
+	a4 := f.store(t, &PDFRequestParams{URL: "https://example.com/a", Format: "A4", Margin: 0.4}, "", "%PDF a4")
+	letter := f.store(t, &PDFRequestParams{URL: "https://example.com/a", Format: "LETTER", Margin: 0.4}, "", "%PDF letter")
+	other := f.store(t, &PDFRequestParams{URL: "https://example.com/b", Margin: 0.4}, "", "%PDF other")
+
+	out := f.do(t, "DELETE", "/ops/cache/url?url="+url.QueryEscape("https://example.com/a"), "")
+	assert.EqualValues(t, 2, out["purged"])
+
+	assert.False(t, f.srv.Exists(a4))
+	assert.False(t, f.srv.Exists(a4+":meta"))
+	assert.False(t, f.srv.Exists(letter))
+	assert.True(t, f.srv.Exists(other))
+}
+
+func TestCacheAdmin_PurgeByToken(t *testing.T) {
+	f := newCacheAdminFixture(t)
+	mine := f.store(t, &PDFRequestParams{HTML: "<p>mine</p>", Margin: 0.4}, "token-a", "%PDF mine")
+	theirs := f.store(t, &PDFRequestParams{HTML: "<p>theirs</p>", Margin: 0.4}, "token-b", "%PDF theirs")
+
+	out := f.do(t, "DELETE", "/ops/cache/token", "token=token-a")
+	assert.EqualValues(t, 1, out["purged"])
+	assert.False(t, f.srv.Exists(mine))
+	assert.True(t, f.srv.Exists(theirs))
+
+	for _, k := range f.srv.Keys() {
+		assert.NotContains(t, k, "token-a", "raw tokens must not be stored")
+	}
+}
+
+func TestCacheAdmin_PurgeEntryByParams(t *testing.T) {
+	f := newCacheAdminFixture(t)
+	key := f.store(t, &PDFRequestParams{URL: "https://example.com/a", Format: "A4", Orientation: "landscape", Margin: 0.5}, "", "%PDF")
+
+	out := f.do(t, "DELETE", "/ops/cache/entry?url="+url.QueryEscape("https://example.com/a")+"&format=a4&orientation=landscape&margin=0.5", "")
+	assert.EqualValues(t, 1, out["purged"])
+	assert.Equal(t, key, out["key"])
+	assert.False(t, f.srv.Exists(key))
+}
+
+func TestCacheAdmin_StatsAndFlush(t *testing.T) {
+	f := newCacheAdminFixture(t)
+	f.store(t, &PDFRequestParams{URL: "https://example.com/a", Margin: 0.4}, "tok", "12345")
+	f.store(t, &PDFRequestParams{HTML: "<p>x</p>", Margin: 0.4}, "", "1234567890")
+
+	stats := f.do(t, "GET", "/ops/cache/stats", "")
+	assert.Equal(t, true, stats["enabled"])
+	assert.EqualValues(t, 2, stats["entries"])
+	assert.EqualValues(t, 15, stats["bytes"])
+
+	out := f.do(t, "DELETE", "/ops/cache", "")
+	assert.EqualValues(t, 2, out["purged"])
+	assert.Empty(t, f.srv.Keys())
+}
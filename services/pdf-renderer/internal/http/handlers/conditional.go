@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/pdf"
+)
+
+// newCachedPDF wraps freshly rendered bytes. ttl is the cache lifetime (0 if not cached).
+func newCachedPDF(data []byte, ttl time.Duration) *cache.Entry {
+	now := time.Now().UTC().Truncate(time.Second)
+	meta := cache.Meta{
+		ETag:      contentETag(data),
+		Size:      len(data),
+		Pages:     pageCount(data),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		meta.ExpiresAt = now.Add(ttl)
+	}
+	return &cache.Entry{Data: data, Meta: meta}
+}
+
+// pageCount returns the number of pages of data, or 0 if it cannot be determined.
+func pageCount(data []byte) int {
+	n, err := pdf.PageCount(data)
+	if err != nil {
+		logging.Warn("PDF page count unavailable", "error", err)
+		return 0
+	}
+	return n
+}
+
+// contentETag returns a strong ETag derived from the PDF bytes.
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// setConditionalHeaders sets ETag (unless meta has none), Last-Modified and Cache-Control for a
+// PDF response.
+func setConditionalHeaders(c *fiber.Ctx, meta cache.Meta) {
+	if meta.ETag != "" {
+		c.Set(fiber.HeaderETag, meta.ETag)
+	}
+	if !meta.CreatedAt.IsZero() {
+		c.Set(fiber.HeaderLastModified, meta.CreatedAt.UTC().Format(http.TimeFormat))
+	}
+
+	// PDFs are requested with per-user API keys, so shared caches must not store them.
+	if meta.ExpiresAt.IsZero() {
+		c.Set(fiber.HeaderCacheControl, "private, no-cache")
+		return
+	}
+	maxAge := int(time.Until(meta.ExpiresAt).Seconds())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(maxAge))
+}
+
+// etagMatches reports whether an If-None-Match header matches etag (weak comparison, RFC 9110).
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified answers a conditional request with 304 and the validator headers only.
+func notModified(c *fiber.Ctx, meta cache.Meta) error {
+	setConditionalHeaders(c, meta)
+	return c.SendStatus(fiber.StatusNotModified)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/infra/cache"
+)
+
+func Test_etagMatches(t *testing.T) {
+	etag := `"abc"`
+	assert.True(t, etagMatches(`"abc"`, etag))
+	assert.True(t, etagMatches(`W/"abc"`, etag))
+	assert.True(t, etagMatches(`"x", "abc"`, etag))
+	assert.True(t, etagMatches(`*`, etag))
+	assert.False(t, etagMatches(`"abd"`, etag))
+	assert.False(t, etagMatches(``, etag))
+}
+
+func newConditionalTestApp(t *testing.T) (*fiber.App, *PDFService, *miniredis.Miniredis) {
+	t.Helper()
+	svc, srv := newRedisTestService(t, nil)
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	return app, svc, srv
+}
+
+func postHello(t *testing.T, app *fiber.App, ifNoneMatch string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/pdf", strings.NewReader("html=<b>Hello World!</b>"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestProcessPDFGeneration_CacheHitSetsValidators(t *testing.T) {
+	app, svc, _ := newConditionalTestApp(t)
+	entry := seedCache(t, svc, helloParams(), []byte("%PDF-1.4 cached"))
+
+	resp, body := postHello(t, app, "")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "%PDF-1.4 cached", body)
+	assert.Equal(t, entry.Meta.ETag, resp.Header.Get("ETag"))
+	assert.NotEmpty(t, resp.Header.Get("Last-Modified"))
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Cache-Control"), "private, max-age="))
+}
+
+func TestProcessPDFGeneration_IfNoneMatchUsesMetadataOnly(t *testing.T) {
+	app, _, srv := newConditionalTestApp(t)
+	key := computePDFCacheKey(helloParams())
+
+	// Only the metadata exists: a 304 proves the PDF body was never read (or rendered).
+	meta := cache.Meta{ETag: `"deadbeef"`, Size: 10, CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().Add(time.Minute)}
+	raw, err := json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, srv.Set(key+":meta", string(raw)))
+
+	resp, body := postHello(t, app, `"deadbeef"`)
+	assert.Equal(t, fiber.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, body)
+	assert.Equal(t, `"deadbeef"`, resp.Header.Get("ETag"))
+}
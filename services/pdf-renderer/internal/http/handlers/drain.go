@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/logging"
+)
+
+// errDraining is returned for render requests that arrive after shutdown started.
+var errDraining = domain.NewError(domain.CodeShuttingDown, "Service is shutting down")
+
+// Ready reports whether the service accepts new render requests.
+// It flips to false as soon as BeginDrain is called.
+func (svc *PDFService) Ready() bool {
+	svc.lifeMu.Lock()
+	defer svc.lifeMu.Unlock()
+	return !svc.draining
+}
+
+// admit registers a new in-flight render. It returns false once the service is draining;
+// callers that were admitted must call svc.inflight.Done when finished.
+func (svc *PDFService) admit() bool {
+	svc.lifeMu.Lock()
+	defer svc.lifeMu.Unlock()
+	if svc.draining {
+		return false
+	}
+	svc.inflight.Add(1)
+	return true
+}
+
+// BeginDrain stops admitting new renders. In-flight renders keep running.
+func (svc *PDFService) BeginDrain() {
+	svc.lifeMu.Lock()
+	defer svc.lifeMu.Unlock()
+	svc.draining = true
+}
+
+// WaitForInflight blocks until all admitted renders finished or ctx is done.
+func (svc *PDFService) WaitForInflight(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		svc.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close shuts down the Chrome pool (killing Chromium and removing its profile directory) and
+// the janitor. Renders still running at this point fail with a session error.
+func (svc *PDFService) Close() {
+	svc.poolMu.Lock()
+	pool, janitor := svc.pool, svc.janitor
+	svc.pool = nil
+	svc.closed = true
+	svc.poolMu.Unlock()
+
+	if janitor != nil {
+		janitor.Stop()
+	}
+	if pool != nil {
+		pool.Close()
+		logging.Info("Chrome pool closed")
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/pdf"
+)
+
+// maxFormFields bounds the number of field values in one fill request.
+const maxFormFields = 1000
+
+var templatePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// FormFill is a PDF form filled in Go instead of an HTML page printed by Chrome (POST
+// /v0/pdf/fill). The filled PDF takes the same output pipeline as a rendered one.
+type FormFill struct {
+	PDF []byte
+	pdf.Form
+}
+
+// fillRequest is the form part of a fill request, before validation.
+type fillRequest struct {
+	PDF     []byte
+	Fields  string // JSON object of field name to value
+	Flatten bool
+}
+
+// HandleFill fills the form fields of an uploaded or stored PDF and returns it like a rendered
+// one: cached, post-processed, encrypted or uploaded as the output parameters ask.
+func (svc *PDFService) HandleFill(c *fiber.Ctx) error {
+	if !svc.admit() {
+		return errDraining
+	}
+	defer svc.inflight.Done()
+
+	params, err := validateAndExtractFillParams(c, *svc.Config)
+	if err != nil {
+		return err
+	}
+	return svc.processPDFGeneration(c, params)
+}
+
+// validateAndExtractFillParams reads the PDF (an upload or a stored template), the field values
+// and the v0 output parameters of a fill request.
+func validateAndExtractFillParams(c *fiber.Ctx, cfg config.Config) (*PDFRequestParams, error) {
+	req := v0Request(func(key string) string { return c.FormValue(key) })
+	req.Source.HTML, req.Source.URL = "", ""
+	req.fill = &fillRequest{Fields: c.FormValue("fields"), Flatten: parseFlag(c.FormValue("flatten"))}
+
+	fh, err := c.FormFile("pdf")
+	template := c.FormValue("template")
+	switch {
+	case err == nil && template != "":
+		return nil, domain.NewError(domain.CodeInvalidForm, "Invalid form: set either pdf or template, not both")
+	case err == nil:
+		// One byte over the limit is enough for the validator to reject it.
+		if req.fill.PDF, err = readFormFile(fh, int64(cfg.Limits.MaxPDFBytes)+1); err != nil {
+			return nil, domain.WrapError(domain.CodeInvalidForm, "Invalid form: the PDF could not be read", err)
+		}
+	case template != "":
+		if req.fill.PDF, err = readTemplate(cfg, template); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, domain.NewError(domain.CodeInvalidForm, "Invalid form: upload a pdf or name a template")
+	}
+
+	if err := readUploads(c, req); err != nil {
+		return nil, err
+	}
+	return validateV0(req, cfg)
+}
+
+// readTemplate reads the stored template name from templates.dir. Templates are read for each
+// request, so replacing a file takes effect without a restart.
+func readTemplate(cfg config.Config, name string) ([]byte, error) {
+	if cfg.Templates.Dir == "" {
+		return nil, domain.NewError(domain.CodeInvalidForm, "Invalid form: no templates are configured; upload the pdf")
+	}
+	if !templatePattern.MatchString(name) {
+		return nil, domain.NewError(domain.CodeInvalidForm, "Invalid form: template contains invalid characters")
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.Templates.Dir, name+".pdf"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, domain.NewError(domain.CodeInvalidForm, fmt.Sprintf("Invalid form: unknown template %q", name))
+	}
+	if err != nil {
+		return nil, domain.WrapError(domain.CodeInternal, "Reading the template failed", err)
+	}
+	return data, nil
+}
+
+// validateFill checks a fill request: a PDF within limits.max_pdf_bytes, field values as a JSON
+// object, and none of the options that only apply to printing HTML.
+func validateFill(req *PDFRequestV1, cfg config.Config, params *PDFRequestParams, errs *fieldErrors) {
+	invalid := func(field, msg string) {
+		errs.add(field, domain.CodeInvalidForm, "Invalid form: "+msg)
+	}
+	f := req.fill
+	switch {
+	case len(f.PDF) > cfg.Limits.MaxPDFBytes:
+		errs.add("pdf", domain.CodePDFTooLarge, fmt.Sprintf("PDF input exceeds %d bytes", cfg.Limits.MaxPDFBytes))
+	case !bytes.Contains(f.PDF[:min(len(f.PDF), 1024)], []byte("%PDF-")):
+		// The header may follow up to 1 KiB of other data (ISO 32000-1, annex H.3).
+		invalid("pdf", "pdf is not a PDF document")
+	}
+	values, err := parseFormFields(f.Fields)
+	if err != nil {
+		invalid("fields", err.Error())
+	}
+	if req.Page.Format != "" || req.Page.Orientation != "" || req.Page.Margin != "" {
+		invalid("page", "format, orientation and margin apply to HTML only")
+	}
+	if req.Output.Outline || req.Output.Tagged || req.Output.InteractiveForms {
+		invalid("output.outline", "outline, tagged and interactive_forms apply to HTML only")
+	}
+	params.Fill = &FormFill{PDF: f.PDF, Form: pdf.Form{Values: values, Flatten: f.Flatten}}
+}
+
+// parseFormFields reads the field values of a fill request: a JSON object mapping each fully
+// qualified field name to a string, a boolean (checkboxes), a number or an array of strings
+// (multi-select list boxes).
+func parseFormFields(raw string) (map[string][]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil || fields == nil {
+		return nil, errors.New("fields must be a JSON object")
+	}
+	if len(fields) > maxFormFields {
+		return nil, fmt.Errorf("at most %d fields", maxFormFields)
+	}
+	values := make(map[string][]string, len(fields))
+	for name, v := range fields {
+		switch v := v.(type) {
+		case string:
+			values[name] = []string{v}
+		case bool:
+			values[name] = []string{strconv.FormatBool(v)}
+		case json.Number:
+			values[name] = []string{v.String()}
+		case []any:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%q must be an array of strings", name)
+				}
+				values[name] = append(values[name], s)
+			}
+		default:
+			return nil, fmt.Errorf("%q must be a string, boolean, number or array of strings", name)
+		}
+	}
+	return values, nil
+}
+
+// fillPDF fills params.Fill and applies the edits requested in params, like renderPDF does for
+// Chrome's PDF.
+func fillPDF(params *PDFRequestParams) ([]byte, renderTiming, error) {
+	start := time.Now()
+	filled, err := pdf.FillForm(params.Fill.PDF, params.Fill.Form)
+	if err != nil {
+		return nil, renderTiming{}, fillError(err)
+	}
+	timing := renderTiming{Render: time.Since(start)}
+	out, err := postProcess(filled, params)
+	if err == nil && !params.Optimize.IsZero() {
+		timing.OriginalSize = len(filled)
+	}
+	return out, timing, err
+}
+
+// fillError maps a failure to fill the form onto a domain error. Field values can only be
+// checked against the PDF, so unknown fields and unfit values are reported here.
+func fillError(err error) *domain.Error {
+	switch {
+	case errors.Is(err, pdf.ErrNoForm):
+		return domain.WrapError(domain.CodeInvalidForm, "Invalid form: the PDF has no form fields", err)
+	case errors.Is(err, pdf.ErrUnknownField), errors.Is(err, pdf.ErrInvalidFieldValue):
+		// The pdf package names the field and what it takes; drop its "pdf: " prefix.
+		return domain.WrapError(domain.CodeInvalidForm, "Invalid form: "+strings.TrimPrefix(err.Error(), "pdf: "), err)
+	}
+	return domain.WrapError(domain.CodeInvalidForm, "Invalid form: the PDF could not be filled", err)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/config"
+)
+
+// formPDF returns a one-page PDF form with a text field "name" and a checkbox "agree", with a
+// correct xref table.
+func formPDF() []byte {
+	const checked = "0 0 12 12 re f"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [4 0 R 5 0 R] /DR << /Font << /Helv 7 0 R >> >> /DA (/Helv 0 Tf 0 g) >> >>",
+		"<< /Type /Pages /Count 1 /Kids [3 0 R] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << >> /Annots [4 0 R 5 0 R] >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Tx /T (name) /Rect [50 700 250 720] /DA (/Helv 12 Tf 0 g) /F 4 /P 3 0 R >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Btn /T (agree) /Rect [50 650 62 662] /V /Off /AS /Off /AP << /N << /Yes 6 0 R >> >> /F 4 /P 3 0 R >>",
+		fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 12 12] /Length %d >>\nstream\n%s\nendstream", len(checked), checked),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// postFill posts a fill request with the given form values and, if pdfData is not nil, the PDF.
+func postFill(t *testing.T, cfg config.Config, pdfData []byte, values map[string]string) (int, string) {
+	t.Helper()
+	app := newTestApp()
+	app.Post("/fill", NewPDFService(cfg, nil).HandleFill)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range values {
+		require.NoError(t, mw.WriteField(k, v))
+	}
+	if pdfData != nil {
+		fw, err := mw.CreateFormFile("pdf", "form.pdf")
+		require.NoError(t, err)
+		_, _ = fw.Write(pdfData)
+	}
+	require.NoError(t, mw.Close())
+	req := httptest.NewRequest("POST", "/fill", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(out)
+}
+
+// filledName returns the document title and the value of the "name" field of a filled form.
+func filledName(t *testing.T, data string) (title, name string) {
+	t.Helper()
+	ctx, err := api.ReadAndValidate(bytes.NewReader([]byte(data)), model.NewDefaultConfiguration())
+	require.NoError(t, err)
+	g, ok, err := form.ExportForm(ctx.XRefTable, "")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, g.Forms[0].TextFields, 1)
+	return ctx.Title, g.Forms[0].TextFields[0].Value
+}
+
+func TestHandleFill(t *testing.T) {
+	cfg := testConfig()
+	fields := `{"name": "Jane Doe", "agree": true}`
+
+	status, body := postFill(t, cfg, formPDF(), map[string]string{"fields": fields, "title": "Application"})
+	require.Equal(t, fiber.StatusOK, status, body)
+	title, name := filledName(t, body)
+	assert.Equal(t, "Jane Doe", name)
+	assert.Equal(t, "Application", title, "metadata is written like for rendered PDFs")
+
+	status, body = postFill(t, cfg, formPDF(), map[string]string{"fields": fields, "flatten": "true"})
+	require.Equal(t, fiber.StatusOK, status, body)
+	assert.NotContains(t, body, "/AcroForm")
+	assert.NotContains(t, body, "/Widget")
+
+	status, body = postFill(t, cfg, formPDF(), map[string]string{"fields": fields, "user_password": "secret"})
+	require.Equal(t, fiber.StatusOK, status, body)
+	assert.Contains(t, body, "/Encrypt")
+}
+
+func TestHandleFill_Template(t *testing.T) {
+	cfg := testConfig()
+	cfg.Templates.Dir = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Templates.Dir, "application.pdf"), formPDF(), 0o600))
+
+	status, body := postFill(t, cfg, nil, map[string]string{"template": "application", "fields": `{"name": "Jane Doe"}`})
+	require.Equal(t, fiber.StatusOK, status, body)
+	_, name := filledName(t, body)
+	assert.Equal(t, "Jane Doe", name)
+
+	for _, name := range []string{"missing", "../application"} {
+		status, body = postFill(t, cfg, nil, map[string]string{"template": name})
+		assert.Equal(t, fiber.StatusBadRequest, status, name)
+		assert.Contains(t, body, "INVALID_FORM", name)
+	}
+
+	cfg.Templates.Dir = ""
+	status, body = postFill(t, cfg, nil, map[string]string{"template": "application"})
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Contains(t, body, "no templates are configured")
+}
+
+func TestHandleFill_Errors(t *testing.T) {
+	cfg := testConfig()
+	cfg.Templates.Dir = t.TempDir()
+	for _, tc := range []struct {
+		name   string
+		pdf    []byte
+		values map[string]string
+		want   string
+	}{
+		{"no pdf", nil, nil, "upload a pdf or name a template"},
+		{"pdf and template", formPDF(), map[string]string{"template": "application"}, "not both"},
+		{"not a pdf", []byte("<html></html>"), nil, "not a PDF document"},
+		{"fields not an object", formPDF(), map[string]string{"fields": `["Jane"]`}, "fields must be a JSON object"},
+		{"nested value", formPDF(), map[string]string{"fields": `{"name": {"first": "Jane"}}`}, `\"name\" must be a string`},
+		{"unknown field", formPDF(), map[string]string{"fields": `{"surname": "Doe"}`}, `unknown form field: \"surname\"`},
+		{"invalid checkbox", formPDF(), map[string]string{"fields": `{"agree": "maybe"}`}, `\"agree\" takes true or false`},
+		{"no form", validPDF(), map[string]string{"fields": `{"name": "Jane"}`}, "the PDF has no form fields"},
+		{"page format", formPDF(), map[string]string{"format": "A4"}, "apply to HTML only"},
+	} {
+		status, body := postFill(t, cfg, tc.pdf, tc.values)
+		assert.Equal(t, fiber.StatusBadRequest, status, tc.name)
+		assert.Contains(t, body, "INVALID_FORM", tc.name)
+		assert.Contains(t, body, tc.want, tc.name)
+	}
+}
+
+func TestFillIsPartOfTheCacheKey(t *testing.T) {
+	params := func(data []byte, fields string, flatten bool) *PDFRequestParams {
+		req := &PDFRequestV1{fill: &fillRequest{PDF: data, Fields: fields, Flatten: flatten}}
+		p, err := validatePDFRequest(req, testConfig())
+		require.NoError(t, err)
+		return p
+	}
+	base := computePDFCacheKey(params(formPDF(), `{"name": "Jane", "agree": true}`, false))
+	assert.Equal(t, base, computePDFCacheKey(params(formPDF(), `{"agree": true, "name": "Jane"}`, false)), "field order")
+	assert.NotEqual(t, base, computePDFCacheKey(params(formPDF(), `{"name": "John", "agree": true}`, false)))
+	assert.NotEqual(t, base, computePDFCacheKey(params(formPDF(), `{"name": "Jane", "agree": true}`, true)))
+	assert.NotEqual(t, base, computePDFCacheKey(params(validPDF(), `{"name": "Jane", "agree": true}`, false)))
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/pdf"
+)
+
+const (
+	// maxFormControls bounds the form controls turned into fields per document.
+	maxFormControls = 500
+
+	// Chrome prints 96 CSS pixels per inch; PDF coordinates are in points, 72 per inch.
+	cssPixelsPerInch = 96
+	pointsPerInch    = 72
+
+	// formObjectGroup holds the remote objects resolved while measuring, released together.
+	formObjectGroup = "html2pdf-forms"
+)
+
+// formControlScript reads the state of a form control, called on the element. Live properties
+// are read instead of attributes, so values set by scripts or restored by the browser count.
+const formControlScript = `function() {
+	const style = getComputedStyle(this);
+	return {
+		tag: this.localName,
+		type: (this.type || "").toLowerCase(),
+		name: this.name || "",
+		id: this.id || "",
+		value: this.value || "",
+		checked: !!this.checked,
+		read_only: !!this.readOnly || !!this.disabled,
+		required: !!this.required,
+		multiple: !!this.multiple,
+		size: this.localName === "select" ? this.size : 0,
+		max_length: this.maxLength > 0 ? this.maxLength : 0,
+		font_size: parseFloat(style.fontSize) || 0,
+		visible: style.visibility === "visible",
+		options: Array.from(this.options || [], o => ({value: o.value, text: o.text, selected: o.selected})),
+		scroll_x: window.scrollX,
+		scroll_y: window.scrollY,
+	};
+}`
+
+// hideFormControlsScript hides what Chrome would print of the controls underneath their fields:
+// text, placeholders and the checkboxes and radio buttons, which the fields draw whole. Boxes and
+// backgrounds stay, as the fields have none.
+const hideFormControlsScript = `(() => {
+	const style = document.createElement("style");
+	style.textContent = "input, textarea, select { color: transparent !important; -webkit-text-fill-color: transparent !important; }" +
+		" input::placeholder, textarea::placeholder { color: transparent !important; }" +
+		" input[type=checkbox], input[type=radio] { opacity: 0 !important; }";
+	(document.head || document.documentElement).appendChild(style);
+})()`
+
+// formControl is the state of an HTML form control as formControlScript reads it.
+type formControl struct {
+	Tag       string  `json:"tag"`
+	Type      string  `json:"type"`
+	Name      string  `json:"name"`
+	ID        string  `json:"id"`
+	Value     string  `json:"value"`
+	Checked   bool    `json:"checked"`
+	ReadOnly  bool    `json:"read_only"`
+	Required  bool    `json:"required"`
+	Multiple  bool    `json:"multiple"`
+	Size      int     `json:"size"`
+	MaxLength int     `json:"max_length"`
+	FontSize  float64 `json:"font_size"` // CSS pixels
+	Visible   bool    `json:"visible"`
+	Options   []struct {
+		Value    string `json:"value"`
+		Text     string `json:"text"`
+		Selected bool   `json:"selected"`
+	} `json:"options"`
+	ScrollX float64 `json:"scroll_x"`
+	ScrollY float64 `json:"scroll_y"`
+}
+
+// measureFormFields lays the page out as it will be printed, at the printable width of the paper,
+// and returns a form field for each rendered input, textarea and select element, placed from its
+// CDP box model. The controls' own text is hidden afterwards, so only the fields show values.
+//
+// A control's page is derived from its offset in the continuous layout, which matches the printed
+// pages as long as the document does not force page breaks (break-before, break-after); controls
+// after a forced break are misplaced.
+func measureFormFields(ctx context.Context, params *PDFRequestParams) ([]pdf.FormField, error) {
+	paper, margin := params.Paper, params.Margin
+	width := int64(math.Round((paper.Width - 2*margin) * cssPixelsPerInch))
+	height := int64(math.Round((paper.Height - 2*margin) * cssPixelsPerInch))
+	if params.Emulation.Media == "" {
+		if err := emulation.SetEmulatedMedia().WithMedia("print").Do(ctx); err != nil {
+			return nil, err
+		}
+		// Pooled tabs are reused; printing applies print styles on its own.
+		defer emulation.SetEmulatedMedia().Do(ctx)
+	}
+	if err := emulation.SetDeviceMetricsOverride(width, height, 1, false).Do(ctx); err != nil {
+		return nil, err
+	}
+	defer emulation.ClearDeviceMetricsOverride().Do(ctx)
+	defer runtime.ReleaseObjectGroup(formObjectGroup).Do(ctx)
+
+	root, err := dom.GetDocument().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := dom.QuerySelectorAll(root.NodeID, "input, textarea, select").Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var fields []pdf.FormField
+	for _, node := range nodes {
+		box, err := dom.GetBoxModel().WithNodeID(node).Do(ctx)
+		if err != nil {
+			// Not rendered, e.g. hidden inputs or display: none.
+			continue
+		}
+		c, err := readFormControl(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		field, ok := c.field()
+		if !ok || !c.Visible {
+			continue
+		}
+		if field.Page, field.Rect, ok = placeOnPage(box.Border, c.ScrollX, c.ScrollY, paper, margin); !ok {
+			continue
+		}
+		if len(fields) == maxFormControls {
+			logging.Warn("Too many form controls; the rest stay static", "max", maxFormControls)
+			break
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) > 0 {
+		if err := chromedp.Evaluate(hideFormControlsScript, nil).Do(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// readFormControl runs formControlScript on the element node.
+func readFormControl(ctx context.Context, node cdp.NodeID) (formControl, error) {
+	var c formControl
+	obj, err := dom.ResolveNode().WithNodeID(node).WithObjectGroup(formObjectGroup).Do(ctx)
+	if err != nil {
+		return c, err
+	}
+	res, exc, err := runtime.CallFunctionOn(formControlScript).
+		WithObjectID(obj.ObjectID).
+		WithReturnByValue(true).
+		Do(ctx)
+	if err != nil {
+		return c, err
+	}
+	if exc != nil {
+		return c, errors.New("reading a form control failed: " + exc.Text)
+	}
+	err = json.Unmarshal(res.Value, &c)
+	return c, err
+}
+
+// field returns the form field for c, or false for controls that take no value (buttons, file
+// inputs, …). Password inputs become text fields without their value.
+func (c formControl) field() (pdf.FormField, bool) {
+	f := pdf.FormField{
+		Name:     cmp.Or(c.Name, c.ID),
+		ReadOnly: c.ReadOnly,
+		Required: c.Required,
+		FontSize: c.FontSize * pointsPerInch / cssPixelsPerInch,
+	}
+	switch c.Tag {
+	case "textarea":
+		f.Kind, f.Value, f.MaxLen = pdf.FieldTextArea, c.Value, c.MaxLength
+	case "select":
+		f.Kind, f.Multiple = pdf.FieldComboBox, c.Multiple
+		if c.Multiple || c.Size > 1 {
+			f.Kind = pdf.FieldListBox
+		}
+		for _, o := range c.Options {
+			f.Options = append(f.Options, pdf.Option{Value: o.Value, Text: o.Text, Selected: o.Selected})
+		}
+	case "input":
+		switch c.Type {
+		case "hidden", "submit", "reset", "button", "image", "file", "range", "color":
+			return f, false
+		case "checkbox":
+			f.Kind, f.Checked = pdf.FieldCheckBox, c.Checked
+		case "radio":
+			f.Kind, f.Value, f.Checked = pdf.FieldRadio, c.Value, c.Checked
+		case "password":
+			f.Kind, f.MaxLen = pdf.FieldText, c.MaxLength
+		default:
+			f.Kind, f.Value, f.MaxLen = pdf.FieldText, c.Value, c.MaxLength
+		}
+	default:
+		return f, false
+	}
+	return f, true
+}
+
+// placeOnPage maps a border box in CSS pixels of the continuous layout onto the printed page it
+// lands on (1-based) and its rectangle there in points. A box crossing a page boundary is moved
+// to the next page, as Chrome does with form controls.
+func placeOnPage(quad dom.Quad, scrollX, scrollY float64, paper config.PaperSize, margin float64) (int, [4]float64, bool) {
+	if len(quad) != 8 {
+		return 0, [4]float64{}, false
+	}
+	left, top, right, bottom := quad[0], quad[1], quad[0], quad[1]
+	for i := 2; i < len(quad); i += 2 {
+		left, right = min(left, quad[i]), max(right, quad[i])
+		top, bottom = min(top, quad[i+1]), max(bottom, quad[i+1])
+	}
+	left, right, top, bottom = left+scrollX, right+scrollX, top+scrollY, bottom+scrollY
+	w, h := right-left, bottom-top
+	pageHeight := (paper.Height - 2*margin) * cssPixelsPerInch
+	if w <= 0 || h <= 0 || top < 0 || pageHeight <= 0 {
+		return 0, [4]float64{}, false
+	}
+
+	page := math.Floor(top / pageHeight)
+	top -= page * pageHeight
+	if top+h > pageHeight && h <= pageHeight {
+		page, top = page+1, 0
+	}
+	const scale = float64(pointsPerInch) / cssPixelsPerInch
+	x := margin*pointsPerInch + left*scale
+	y := (paper.Height-margin)*pointsPerInch - top*scale
+	return int(page) + 1, [4]float64{x, y - h*scale, x + w*scale, y}, true
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/chromedp/cdproto/dom"
+	"github.com/stretchr/testify/assert"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/pdf"
+)
+
+func TestPlaceOnPage(t *testing.T) {
+	// US Letter with 0.5in margins: pages of 7.5in × 10in, 720 × 960 CSS pixels.
+	letter := config.PaperSize{Width: 8.5, Height: 11}
+	box := func(x, y, w, h float64) dom.Quad {
+		return dom.Quad{x, y, x + w, y, x + w, y + h, x, y + h}
+	}
+	for _, tc := range []struct {
+		name    string
+		quad    dom.Quad
+		scrollY float64
+		page    int
+		rect    [4]float64
+	}{
+		{"first page", box(0, 0, 200, 20), 0, 1, [4]float64{36, 741, 186, 756}},
+		{"second page", box(100, 1000, 200, 20), 0, 2, [4]float64{111, 711, 261, 726}},
+		{"across a page break", box(0, 950, 200, 20), 0, 2, [4]float64{36, 741, 186, 756}},
+		{"scrolled", box(0, -960, 200, 20), 960, 1, [4]float64{36, 741, 186, 756}},
+	} {
+		page, rect, ok := placeOnPage(tc.quad, 0, tc.scrollY, letter, 0.5)
+		assert.True(t, ok, tc.name)
+		assert.Equal(t, tc.page, page, tc.name)
+		assert.InDeltaSlice(t, tc.rect[:], rect[:], 0.001, tc.name)
+	}
+
+	_, _, ok := placeOnPage(box(0, 0, 0, 20), 0, 0, letter, 0.5)
+	assert.False(t, ok, "empty box")
+	_, _, ok = placeOnPage(box(0, -30, 200, 20), 0, 0, letter, 0.5)
+	assert.False(t, ok, "above the document")
+}
+
+func TestFormControlField(t *testing.T) {
+	field := func(c formControl) pdf.FormField {
+		f, ok := c.field()
+		assert.True(t, ok, c.Tag+" "+c.Type)
+		return f
+	}
+	f := field(formControl{Tag: "input", Type: "email", ID: "mail", Value: "jane@example.com", MaxLength: 80, FontSize: 16, Required: true})
+	assert.Equal(t, pdf.FormField{Kind: pdf.FieldText, Name: "mail", Value: "jane@example.com", MaxLen: 80, FontSize: 12, Required: true}, f)
+
+	f = field(formControl{Tag: "input", Type: "password", Name: "pin", Value: "1234"})
+	assert.Equal(t, pdf.FieldText, f.Kind)
+	assert.Empty(t, f.Value, "passwords are not printed")
+
+	f = field(formControl{Tag: "input", Type: "radio", Name: "size", Value: "M", Checked: true, ReadOnly: true})
+	assert.Equal(t, pdf.FormField{Kind: pdf.FieldRadio, Name: "size", Value: "M", Checked: true, ReadOnly: true}, f)
+
+	assert.Equal(t, pdf.FieldTextArea, field(formControl{Tag: "textarea", Name: "notes"}).Kind)
+	assert.Equal(t, pdf.FieldCheckBox, field(formControl{Tag: "input", Type: "checkbox", Name: "agree"}).Kind)
+	assert.Equal(t, pdf.FieldComboBox, field(formControl{Tag: "select", Name: "color"}).Kind)
+	assert.Equal(t, pdf.FieldListBox, field(formControl{Tag: "select", Name: "color", Size: 4}).Kind)
+	list := field(formControl{Tag: "select", Name: "toppings", Multiple: true})
+	assert.Equal(t, pdf.FieldListBox, list.Kind)
+	assert.True(t, list.Multiple)
+
+	for _, typ := range []string{"hidden", "submit", "button", "file"} {
+		_, ok := formControl{Tag: "input", Type: typ}.field()
+		assert.False(t, ok, typ)
+	}
+}
@@ -1,27 +1,39 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	neturl "net/url"
+	"io"
+	"io/fs"
+	"mime/multipart"
 	"os"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/chromedp/cdproto/emulation"
+	cdpio "github.com/chromedp/cdproto/io"
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 	"github.com/gofiber/fiber/v2"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 
 	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
 	"pdf-renderer/internal/infra/chrome"
 	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/infra/storage"
+	"pdf-renderer/internal/pdf"
 )
 
 // PDFRequestParams holds validated input parameters.
@@ -33,18 +45,87 @@ type PDFRequestParams struct {
 	Margin      float64
 	Filename    string
 	Paper       config.PaperSize
+
+	// CacheTTL overrides cache.pdf_cache_ttl for this request (0 = default). Not part of the cache key.
+	CacheTTL time.Duration
+	// Output selects the response: the PDF itself (default), a storage upload (outputStorage) or
+	// PNG images of its pages (outputPNG).
+	Output string
+	// DryRun renders (or looks up) the PDF but responds with its metadata headers only.
+	DryRun bool
+
+	// Metadata is written into the PDF after printing (see postProcess).
+	Metadata pdf.Metadata
+	// PDFA converts the PDF to a PDF/A conformance level after printing ("", pdf.PDFA2B or
+	// pdf.PDFA3B).
+	PDFA string
+	// Encryption is applied to each response; the cache keeps the unencrypted PDF, so it is not
+	// part of the cache key.
+	Encryption pdf.Encryption
+	// Watermark is stamped on the pages after printing (nil for none).
+	Watermark *pdf.Watermark
+	// Signature signs the PDF after all other edits (nil for none). Its signer and defaults come
+	// from the signing profile, which resolveSignature picks per API key.
+	Signature        *pdf.Signature
+	SignatureProfile string // the profile named in the request, then the one resolved
+	// Attachments are embedded as associated files; FacturX embeds an e-invoice and describes it
+	// in the XMP metadata (PDFA is pdf.PDFA3B then).
+	Attachments []pdf.Attachment
+	FacturX     *pdf.FacturX
+	// Optimize shrinks or linearizes the PDF after the edits above, before signing.
+	Optimize pdf.Optimization
+	// Tagged has Chrome write a tagged (accessible) PDF with a structure tree. OutlineDepth > 0
+	// also has it generate a document outline from the h1 to h<OutlineDepth> headings, which
+	// requires Tagged.
+	Tagged       bool
+	OutlineDepth int
+	// Split cuts the PDF into parts returned as a ZIP archive. Like Encryption it is applied to
+	// each response and not part of the cache key.
+	Split pdf.Split
+	// PreviewPages (a page range such as "1-3,5"; all pages if empty) are rasterized at PreviewDPI
+	// for outputPNG. Like Split they apply to each response and are not part of the cache key.
+	PreviewPages string
+	PreviewDPI   int
+	// Fill is the PDF form filled instead of printing HTML or URL (POST /v0/pdf/fill).
+	Fill *FormFill
+	// InteractiveForms turns the HTML form controls into AcroForm fields. FormFields are the
+	// fields measured in the page while printing; renderPDF sets them for postProcess.
+	InteractiveForms bool
+	FormFields       []pdf.FormField
+
+	// Wait and Emulation are set through /v1 only; v0 requests use the defaults.
+	Wait      WaitOptions
+	Emulation EmulationOptions
 }
 
 // PDFService bundles configuration and dependencies for PDF rendering.
 type PDFService struct {
-	Config *config.Config
-	Redis  *redis.Client
+	Config  *config.Config
+	Redis   *redis.Client
+	Cache   cache.PDFCache         // nil when PDF caching is disabled
+	Storage storage.ObjectStore    // nil when output=storage is not configured
+	Signers map[string]*pdf.Signer // signing profiles whose certificate loaded, by name
+	PDFJS   fs.FS                  // pdf.js for output=png; nil when not configured or unusable
 
 	poolMu  sync.Mutex
 	pool    *chrome.Pool
 	poolErr error
+	closed  bool
+	janitor *chrome.Janitor // nil until StartJanitor
+
+	lifeMu   sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+
+	flight singleflight.Group // dedupes concurrent renders of the same cache key
 }
 
+// errPDFTooLarge is returned when the rendered PDF exceeds limits.max_pdf_bytes.
+var errPDFTooLarge = domain.NewError(domain.CodePDFTooLarge, "PDF exceeds allowed size")
+
+// netErrorPattern extracts Chrome's network error (e.g. net::ERR_NAME_NOT_RESOLVED) from a failed navigation.
+var netErrorPattern = regexp.MustCompile(`net::ERR_[A-Z0-9_]+`)
+
 // HandlePDFConversion returns a Fiber handler for PDF conversion requests.
 func HandlePDFConversion(cfg config.Config, rdb *redis.Client) fiber.Handler {
 	svc := NewPDFService(cfg, rdb)
@@ -58,11 +139,40 @@ func HandlePDFURL(cfg config.Config, rdb *redis.Client) fiber.Handler {
 }
 
 // NewPDFService creates a new PDFService instance.
+// The PDF cache backend is built from cfg.Cache; if that fails, caching is disabled.
 func NewPDFService(cfg config.Config, rdb *redis.Client) *PDFService {
-	return &PDFService{
+	svc := &PDFService{
 		Config: &cfg, // convert value to pointer
 		Redis:  rdb,
 	}
+	if cfg.Cache.PDFCacheEnabled {
+		pc, err := cache.New(cfg, rdb)
+		if err != nil {
+			logging.Error("PDF cache unavailable; caching disabled", "backend", cfg.Cache.Backend, "error", err)
+		} else {
+			svc.Cache = pc
+		}
+	}
+	if cfg.Storage.Enabled {
+		s3, err := storage.NewS3(cfg)
+		if err != nil {
+			logging.Error("Object storage unavailable; output=storage disabled", "error", err)
+		} else {
+			svc.Storage = s3
+		}
+	}
+	if len(cfg.Signing.Profiles) > 0 {
+		svc.Signers = loadSigners(cfg)
+	}
+	if cfg.Preview.PDFJSDir != "" {
+		files, err := loadPDFJS(cfg.Preview.PDFJSDir)
+		if err != nil {
+			logging.Error("pdf.js unavailable; output=png disabled", "dir", cfg.Preview.PDFJSDir, "error", err)
+		} else {
+			svc.PDFJS = files
+		}
+	}
+	return svc
 }
 
 func (svc *PDFService) getChromePool() (*chrome.Pool, error) {
@@ -72,6 +182,9 @@ func (svc *PDFService) getChromePool() (*chrome.Pool, error) {
 	if svc.Config.PDF.ChromePoolSize <= 0 {
 		return nil, nil
 	}
+	if svc.closed {
+		return nil, errors.New("chrome pool is closed")
+	}
 	if svc.pool != nil {
 		return svc.pool, nil
 	}
@@ -84,8 +197,45 @@ func (svc *PDFService) getChromePool() (*chrome.Pool, error) {
 	return svc.pool, nil
 }
 
+// StartJanitor reclaims the profile directories and Chromium processes earlier runs left in
+// user_data_dir, now and then periodically, whether or not the Chrome pool is ever created.
+func (svc *PDFService) StartJanitor() {
+	j := chrome.NewJanitor(*svc.Config, svc.liveProfileDir)
+	svc.poolMu.Lock()
+	svc.janitor = j
+	svc.poolMu.Unlock()
+	j.Start()
+}
+
+// liveProfileDir returns the profile directory of the pool's Chromium, "" before the first render.
+func (svc *PDFService) liveProfileDir() string {
+	svc.poolMu.Lock()
+	pool := svc.pool
+	svc.poolMu.Unlock()
+	if pool == nil {
+		return ""
+	}
+	return pool.ProfileDir()
+}
+
+// janitorStats reports what the janitor reclaimed, zero if it was never started.
+func (svc *PDFService) janitorStats() chrome.JanitorStats {
+	svc.poolMu.Lock()
+	j := svc.janitor
+	svc.poolMu.Unlock()
+	if j == nil {
+		return chrome.JanitorStats{}
+	}
+	return j.Stats()
+}
+
 // HandleConversion generates a new PDF or serves a cached copy.
 func (svc *PDFService) HandleConversion(c *fiber.Ctx) error {
+	if !svc.admit() {
+		return errDraining
+	}
+	defer svc.inflight.Done()
+
 	params, err := validateAndExtractPDFParams(c, *svc.Config)
 	if err != nil {
 		return err
@@ -95,6 +245,11 @@ func (svc *PDFService) HandleConversion(c *fiber.Ctx) error {
 
 // HandleURLConversion fetches HTML from a URL and generates a PDF.
 func (svc *PDFService) HandleURLConversion(c *fiber.Ctx) error {
+	if !svc.admit() {
+		return errDraining
+	}
+	defer svc.inflight.Done()
+
 	params, err := validateAndExtractURLParams(c, *svc.Config)
 	if err != nil {
 		return err
@@ -102,224 +257,415 @@ func (svc *PDFService) HandleURLConversion(c *fiber.Ctx) error {
 	return svc.processPDFGeneration(c, params)
 }
 
-// processPDFGeneration handles caching and PDF rendering.
-func (svc *PDFService) processPDFGeneration(c *fiber.Ctx, params *PDFRequestParams) error {
-	cacheKey := computePDFCacheKey(params)
+// HandleConversionV1 renders a PDF from a JSON request (PDFRequestV1). Unlike v0, every invalid
+// field is reported at once.
+func (svc *PDFService) HandleConversionV1(c *fiber.Ctx) error {
+	if !svc.admit() {
+		return errDraining
+	}
+	defer svc.inflight.Done()
 
-	// Try to serve from Redis cache
-	if svc.Redis != nil && svc.Config.Cache.PDFCacheEnabled {
-		if cached, err := getCachedPDF(c, svc.Redis, cacheKey, params.Filename); err == nil && cached != nil {
-			return c.Send(cached)
-		}
+	if !strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), fiber.MIMEApplicationJSON) {
+		return domain.NewError(domain.CodeUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req PDFRequestV1
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return domain.WrapError(domain.CodeInvalidJSON, jsonErrorMessage(err), err)
 	}
 
-	// Generate PDF
-	pdfBuf, err := svc.renderPDF(params)
+	params, err := validatePDFRequest(&req, *svc.Config)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			// Log the underlying error so we can distinguish between:
-			// - Chrome pool init warmup timeout
-			// - Pool acquire timeout (no free tab)
-			// - Actual render timeout
-			logging.Error("PDF generation timeout", "timeout_secs", svc.Config.PDF.TimeoutSecs, "error", err.Error())
-			return fiber.NewError(fiber.StatusRequestTimeout, "PDF rendering took too long")
+		return err
+	}
+	return svc.processPDFGeneration(c, params)
+}
+
+// processPDFGeneration handles caching, conditional requests and PDF rendering.
+func (svc *PDFService) processPDFGeneration(c *fiber.Ctx, params *PDFRequestParams) error {
+	if err := svc.resolveSignature(c, params); err != nil {
+		return err
+	}
+	cacheKey := computePDFCacheKey(params)
+	ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch)
+	toPreview := params.Output == outputPNG
+	if !params.Encryption.IsZero() || !params.Split.IsZero() || toPreview {
+		// Every encryption differs and the validator of the cached PDF would match copies
+		// encrypted with other passwords, split differently or rasterized: such responses are
+		// never 304.
+		ifNoneMatch = ""
+	}
+	noCache := requestsNoCache(c)
+	dryRun := isDryRun(c, params)
+	// A dry run only reports on the PDF; it never uploads it.
+	toStorage := params.Output == outputStorage && !dryRun
+
+	if toStorage && svc.Storage == nil {
+		return errStorageDisabled
+	}
+	if toPreview && svc.PDFJS == nil {
+		return errPreviewDisabled
+	}
+
+	if svc.cacheEnabled() && !noCache {
+		// Uploads always go through: the client wants a fresh object, not a 304.
+		if toStorage {
+			ctxCache, cancel := context.WithTimeout(c.Context(), 1*time.Second)
+			cached, err := readCachedPDF(ctxCache, svc.Cache, cacheKey)
+			cancel()
+			if err == nil && cached != nil {
+				logging.Info("PDF cache hit", "key", cacheKey)
+				setCacheHitHeaders(c, cached.Meta)
+				if cached, err = protect(cached, params); err != nil {
+					return err
+				}
+				return svc.sendToStorage(c, params, cached)
+			}
 		}
-		if chrome.IsSessionInterrupted(err) {
-			logging.Error("Chrome session interrupted", "error", err.Error())
-			return fiber.NewError(fiber.StatusServiceUnavailable, "Chrome session interrupted")
+
+		// Answer If-None-Match from the metadata alone, without reading the PDF body.
+		if ifNoneMatch != "" && !toStorage {
+			ctxCache, cancel := context.WithTimeout(c.Context(), 1*time.Second)
+			meta, err := svc.Cache.GetMeta(ctxCache, cacheKey)
+			cancel()
+			if err == nil && meta != nil && etagMatches(ifNoneMatch, meta.ETag) {
+				logging.Info("PDF not modified", "key", cacheKey)
+				setCacheHitHeaders(c, *meta)
+				return notModified(c, *meta)
+			}
+		}
+
+		// Try to serve from the PDF cache
+		if !toStorage {
+			if cached, err := getCachedPDF(c, svc.Cache, cacheKey); err == nil && cached != nil {
+				if !params.Split.IsZero() {
+					return svc.sendParts(c, cached, params, dryRun)
+				}
+				if toPreview {
+					return svc.sendPreview(c, cached, params, dryRun)
+				}
+				if cached, err = protect(cached, params); err != nil {
+					return err
+				}
+				if dryRun {
+					return sendDryRun(c, cached, params.Filename)
+				}
+				return sendPDF(c, cached, params.Filename)
+			}
 		}
-		logging.Error("PDF generation failed", "error", err.Error())
-		return fiber.NewError(fiber.StatusInternalServerError, "PDF generation failed: "+err.Error())
 	}
 
-	if len(pdfBuf) > svc.Config.Limits.MaxPDFBytes {
-		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "PDF exceeds allowed size")
+	// Without a cache the PDF is not kept, so stream it straight from Chrome to the client.
+	// Conditional requests, dry runs and post-processed PDFs still take the buffered path: the
+	// ETag, the page count and the Go-side edits need the whole PDF.
+	if !svc.cacheEnabled() && !toStorage && !toPreview && ifNoneMatch == "" && !dryRun && !params.needsPostProcessing() {
+		return svc.streamPDF(c, params)
 	}
 
-	// Cache PDF
-	if svc.Redis != nil && svc.Config.Cache.PDFCacheEnabled {
-		setCachedPDF(c, svc.Redis, cacheKey, pdfBuf, svc.Config.Cache.PDFCacheTTL)
+	write := cacheWrite{
+		TTL:     params.CacheTTL,
+		Tags:    cacheTags(params, c.Get("X-API-Key")),
+		Refresh: noCache,
 	}
 
-	requestID := c.Get("X-Request-ID")
-	logging.Info("PDF generated", "filename", params.Filename, "request_id", requestID)
+	// Generate PDF (shared with concurrent requests for the same document; cached on success)
+	result, err := svc.renderShared(cacheKey, write, func() ([]byte, renderTiming, error) {
+		return svc.renderPDF(params)
+	})
+	if err != nil {
+		rerr := renderError(err)
+		logging.Error("PDF generation failed", "code", rerr.Code, "timeout_secs", svc.Config.PDF.TimeoutSecs, "error", err.Error())
+		return rerr
+	}
+	setResultHeaders(c, result)
 
-	c.Set("Content-Type", "application/pdf")
-	c.Set("Content-Disposition", "attachment; filename="+params.Filename)
-	return c.Send(pdfBuf)
-}
+	// Split archives are never uploaded (see validateSplit).
+	if !params.Split.IsZero() {
+		return svc.sendParts(c, result.Entry, params, dryRun)
+	}
+	if toPreview {
+		return svc.sendPreview(c, result.Entry, params, dryRun)
+	}
 
-func (svc *PDFService) renderPDF(params *PDFRequestParams) ([]byte, error) {
-	pool, err := svc.getChromePool()
+	entry, err := protect(result.Entry, params)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if pool == nil {
-		// Fallback: start a new Chrome instance per request.
-		return renderPDFWithChrome(params.HTML, params.URL, params.Paper, params.Margin, *svc.Config)
+	if toStorage {
+		return svc.sendToStorage(c, params, entry)
 	}
 
-	timeout := time.Duration(svc.Config.PDF.TimeoutSecs) * time.Second
-
-	runOnce := func() ([]byte, error) {
-		acquireCtx, acquireCancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer acquireCancel()
-
-		tab, err := pool.Acquire(acquireCtx)
-		if err != nil {
-			return nil, err
-		}
-
-		ctx, cancel := context.WithTimeout(tab.Ctx, timeout)
-		pdfBuf, renderErr := renderPDFInExistingTab(ctx, params.HTML, params.URL, params.Paper, params.Margin)
-		cancel()
-
-		pool.Release(tab, renderErr)
-		return pdfBuf, renderErr
+	// Without a cache hit the render already happened, but a matching client copy still
+	// saves transferring the body.
+	if etagMatches(ifNoneMatch, entry.Meta.ETag) {
+		return notModified(c, entry.Meta)
 	}
 
-	pdfBuf, renderErr := runOnce()
-	if renderErr != nil && chrome.IsSessionInterrupted(renderErr) {
-		logging.Warn("Chrome session interrupted; restarting pool and retrying once", "error", renderErr)
-		_ = pool.Restart()
-		return runOnce()
+	requestID := c.Get("X-Request-ID")
+	if dryRun {
+		logging.Info("PDF dry run", "filename", params.Filename, "pages", entry.Meta.Pages, "request_id", requestID)
+		return sendDryRun(c, entry, params.Filename)
 	}
+	logging.Info("PDF generated", "filename", params.Filename, "request_id", requestID)
+	return sendPDF(c, entry, params.Filename)
+}
 
-	return pdfBuf, renderErr
+// sendPDF sends entry as the PDF response.
+func sendPDF(c *fiber.Ctx, entry *cache.Entry, filename string) error {
+	setConditionalHeaders(c, entry.Meta)
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", "attachment; filename="+filename)
+	return c.Send(entry.Data)
 }
 
-// validateAndExtractPDFParams validates and parses input parameters from the HTTP request.
-func validateAndExtractPDFParams(c *fiber.Ctx, cfg config.Config) (*PDFRequestParams, error) {
-	html := c.FormValue("html")
+// renderError maps a render failure onto a client-safe domain error. The raw error stays
+// available as the cause for logs.
+func renderError(err error) *domain.Error {
+	var de *domain.Error
+	switch {
+	case errors.As(err, &de):
+		return de
+	case errors.Is(err, context.DeadlineExceeded):
+		return domain.WrapError(domain.CodeRenderTimeout, "PDF rendering took too long", err)
+	case netErrorPattern.MatchString(err.Error()):
+		return domain.WrapError(domain.CodeNavigationFailed, "Navigation failed: "+netErrorPattern.FindString(err.Error()), err)
+	case chrome.IsSessionInterrupted(err):
+		return domain.WrapError(domain.CodeChromeCrashed, "Chrome session interrupted", err)
+	}
+	return domain.WrapError(domain.CodeRenderFailed, "PDF generation failed", err)
+}
 
-	if len(html) < 10 {
-		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid HTML: content too short or missing")
-	}
+// jsonErrorMessage describes a request body decoding error without Go type names.
+func jsonErrorMessage(err error) string {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("Invalid JSON: syntax error at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("Invalid JSON: %s must be a %s", typeErr.Field, jsonTypeName(typeErr.Type.Kind()))
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "Invalid JSON: body is empty or truncated"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "Invalid JSON: unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	}
+	return "Invalid JSON"
+}
 
-	if len(html) > cfg.Limits.MaxHTMLBytes {
-		return nil, fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("HTML input exceeds %d bytes", cfg.Limits.MaxHTMLBytes))
-	}
+func jsonTypeName(k reflect.Kind) string {
+	switch k {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Struct, reflect.Map, reflect.Pointer:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "number"
+}
 
-	format := strings.ToUpper(c.FormValue("format"))
-	if format != "" {
-		if _, ok := cfg.PDF.PaperSizes[format]; !ok {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid format: not supported")
+// renderPDF renders params into memory, e.g. for the cache. The PDF is read from Chrome in
+// chunks and the render is aborted as soon as it exceeds limits.max_pdf_bytes.
+func (svc *PDFService) renderPDF(params *PDFRequestParams) ([]byte, renderTiming, error) {
+	if params.Fill != nil {
+		return fillPDF(params)
+	}
+	var fields []pdf.FormField
+	runOnce := func() ([]byte, renderTiming, error) {
+		stream, err := svc.printPDF(params)
+		if err != nil {
+			return nil, renderTiming{}, err
+		}
+		var buf bytes.Buffer
+		_, err = stream.CopyTo(&buf, svc.Config.Limits.MaxPDFBytes)
+		stream.Close(err)
+		if err != nil {
+			return nil, stream.timing, err
 		}
+		fields = stream.formFields
+		return buf.Bytes(), stream.timing, nil
 	}
 
-	orientation := strings.ToLower(c.FormValue("orientation"))
-	if orientation != "" && orientation != "portrait" && orientation != "landscape" {
-		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid orientation: must be 'portrait' or 'landscape'")
+	pdfBuf, timing, renderErr := runOnce()
+	if svc.restartAfter(renderErr) {
+		pdfBuf, timing, renderErr = runOnce()
+		timing.Restarted = true
 	}
-
-	margin := 0.4
-	if marginStr := c.FormValue("margin"); marginStr != "" {
-		m, err := strconv.ParseFloat(marginStr, 64)
-		if err != nil || m < 0.1 || m > 2.0 {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid margin: must be a float between 0.1 and 2.0")
-		}
-		margin = m
+	if renderErr != nil {
+		return nil, timing, renderErr
+	}
+	if len(fields) > 0 {
+		// The fields belong to this render; params stay as the request gave them.
+		withFields := *params
+		withFields.FormFields = fields
+		params = &withFields
+	}
+	out, err := postProcess(pdfBuf, params)
+	if err == nil && !params.Optimize.IsZero() {
+		timing.OriginalSize = len(pdfBuf)
 	}
+	return out, timing, err
+}
 
-	filename := c.FormValue("filename")
-	if filename == "" {
-		filename = "output.pdf"
-	} else {
-		if !strings.HasSuffix(filename, ".pdf") {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Filename must end with .pdf")
-		}
-		if matched := regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`).MatchString(filename); !matched {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Filename contains invalid characters")
+// openPDFStream prints params and returns the untransferred PDF, retrying once on a fresh pool if
+// the Chrome session broke. The caller must Close the stream.
+func (svc *PDFService) openPDFStream(params *PDFRequestParams) (*pdfStream, error) {
+	stream, err := svc.printPDF(params)
+	if svc.restartAfter(err) {
+		stream, err = svc.printPDF(params)
+		if err == nil {
+			stream.timing.Restarted = true
 		}
 	}
+	return stream, err
+}
 
-	paper, ok := cfg.PDF.PaperSizes[format]
-	if !ok {
-		paper, ok = cfg.PDF.PaperSizes[cfg.PDF.DefaultPaper]
-		if !ok {
-			return nil, fiber.NewError(fiber.StatusInternalServerError, "Default paper size not configured")
-		}
+// restartAfter restarts the Chrome pool if err means its session is broken, and reports whether
+// the render should be retried.
+func (svc *PDFService) restartAfter(err error) bool {
+	if err == nil || !chrome.IsSessionInterrupted(err) {
+		return false
+	}
+	var de *domain.Error
+	if errors.As(err, &de) {
+		// Pool saturation and startup failures are not fixed by a restart.
+		return false
 	}
+	pool, poolErr := svc.getChromePool()
+	if poolErr != nil || pool == nil {
+		return false
+	}
+	logging.Warn("Chrome session interrupted; restarting pool and retrying once", "error", err)
+	_ = pool.Restart()
+	return true
+}
 
-	if orientation == "landscape" {
-		paper.Width, paper.Height = paper.Height, paper.Width
+// printPDF renders params in a pooled tab (or a per-request Chrome if the pool is disabled) and
+// returns the PDF as a Chrome stream. The tab stays reserved until the stream is closed.
+func (svc *PDFService) printPDF(params *PDFRequestParams) (*pdfStream, error) {
+	start := time.Now()
+	ctx, release, err := svc.openTab()
+	if err != nil {
+		return nil, err
 	}
 
-	return &PDFRequestParams{
-		HTML:        html,
-		Format:      format,
-		Orientation: orientation,
-		Margin:      margin,
-		Filename:    filename,
-		Paper:       paper,
-	}, nil
-}
+	timing := renderTiming{QueueWait: time.Since(start)}
 
-// validateAndExtractURLParams validates query parameters and fetches HTML from the provided URL.
-func validateAndExtractURLParams(c *fiber.Ctx, cfg config.Config) (*PDFRequestParams, error) {
-	urlStr := c.Query("url")
-	if urlStr == "" {
-		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid URL: missing")
+	printStart := time.Now()
+	handle, fields, err := printToStream(ctx, params)
+	if err != nil {
+		release(err)
+		return nil, err
 	}
+	timing.Render = time.Since(printStart)
+	return &pdfStream{ctx: ctx, handle: handle, release: release, timing: timing, formFields: fields}, nil
+}
 
-	parsed, err := neturl.ParseRequestURI(urlStr)
-	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
-		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid URL: must be HTTP or HTTPS")
+// openTab reserves a pooled tab, or starts a Chrome for this request if the pool is disabled, for
+// one render of at most pdf.timeout_secs.
+func (svc *PDFService) openTab() (context.Context, func(error), error) {
+	pool, err := svc.getChromePool()
+	if err != nil {
+		return nil, nil, domain.WrapError(domain.CodeChromeUnavailable, "Chrome is not available", err)
 	}
+	timeout := time.Duration(svc.Config.PDF.TimeoutSecs) * time.Second
+	if pool == nil {
+		// Fallback: start a new Chrome instance per request.
+		return newChromeSession(*svc.Config, timeout)
+	}
+	return acquireTab(pool, timeout)
+}
+
+// acquireTab reserves a pooled tab for one render of at most timeout.
+func acquireTab(pool *chrome.Pool, timeout time.Duration) (context.Context, func(error), error) {
+	acquireCtx, acquireCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer acquireCancel()
 
-	format := strings.ToUpper(c.Query("format"))
-	if format != "" {
-		if _, ok := cfg.PDF.PaperSizes[format]; !ok {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid format: not supported")
+	tab, err := pool.Acquire(acquireCtx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil, domain.WrapError(domain.CodePoolSaturated, "No Chrome tab became available; try again later", err)
 		}
+		return nil, nil, domain.WrapError(domain.CodeChromeUnavailable, "Chrome is not available", err)
 	}
 
-	orientation := strings.ToLower(c.Query("orientation"))
-	if orientation != "" && orientation != "portrait" && orientation != "landscape" {
-		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid orientation: must be 'portrait' or 'landscape'")
+	ctx, cancel := context.WithTimeout(tab.Ctx, timeout)
+	return ctx, func(err error) {
+		cancel()
+		pool.Release(tab, err)
+	}, nil
+}
+
+// validateAndExtractPDFParams validates and parses v0 form values from the HTTP request.
+func validateAndExtractPDFParams(c *fiber.Ctx, cfg config.Config) (*PDFRequestParams, error) {
+	req := v0Request(func(key string) string { return c.FormValue(key) })
+	req.Source.URL = ""
+	if err := readUploads(c, req); err != nil {
+		return nil, err
 	}
+	return validateV0(req, cfg)
+}
 
-	margin := 0.4
-	if marginStr := c.Query("margin"); marginStr != "" {
-		m, err := strconv.ParseFloat(marginStr, 64)
-		if err != nil || m < 0.1 || m > 2.0 {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid margin: must be a float between 0.1 and 2.0")
+// readUploads reads the files of a multipart request into req: a watermark image, attachments
+// and a Factur-X invoice. c.FormFile and c.MultipartForm fail for any other body.
+func readUploads(c *fiber.Ctx, req *PDFRequestV1) error {
+	if fh, err := c.FormFile("watermark_image"); err == nil {
+		// One byte over the limit is enough for the validator to reject it.
+		if req.Watermark.Image, err = readFormFile(fh, maxWatermarkImageBytes+1); err != nil {
+			return domain.WrapError(domain.CodeInvalidWatermark, "Invalid watermark: image could not be read", err)
 		}
-		margin = m
 	}
-
-	filename := c.Query("filename")
-	if filename == "" {
-		filename = "output.pdf"
-	} else {
-		if !strings.HasSuffix(filename, ".pdf") {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Filename must end with .pdf")
+	if form, err := c.MultipartForm(); err == nil {
+		for _, fh := range form.File["attachment"] {
+			a := AttachmentV1{Filename: fh.Filename, Relationship: c.FormValue("attachment_relationship")}
+			// Clients send application/octet-stream for any file they do not know; the
+			// validator derives a better type from the extension.
+			if t := fh.Header.Get("Content-Type"); t != "application/octet-stream" {
+				a.MIMEType = t
+			}
+			if a.Content, err = readFormFile(fh, maxAttachmentBytes+1); err != nil {
+				return domain.WrapError(domain.CodeInvalidAttachment, "Invalid attachment: file could not be read", err)
+			}
+			req.Attachments = append(req.Attachments, a)
 		}
-		if matched := regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`).MatchString(filename); !matched {
-			return nil, fiber.NewError(fiber.StatusBadRequest, "Filename contains invalid characters")
+		if files := form.File["facturx_xml"]; len(files) > 0 {
+			req.FacturX = &FacturXV1{}
+			if req.FacturX.XML, err = readFormFile(files[0], maxAttachmentBytes+1); err != nil {
+				return domain.WrapError(domain.CodeInvalidAttachment, "Invalid attachment: Factur-X invoice could not be read", err)
+			}
 		}
 	}
+	return nil
+}
 
-	paper, ok := cfg.PDF.PaperSizes[format]
-	if !ok {
-		paper, ok = cfg.PDF.PaperSizes[cfg.PDF.DefaultPaper]
-		if !ok {
-			return nil, fiber.NewError(fiber.StatusInternalServerError, "Default paper size not configured")
-		}
+// readFormFile reads at most limit bytes of an uploaded file.
+func readFormFile(fh *multipart.FileHeader, limit int64) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
 
-	if orientation == "landscape" {
-		paper.Width, paper.Height = paper.Height, paper.Width
+// validateAndExtractURLParams validates v0 query parameters for URL rendering.
+func validateAndExtractURLParams(c *fiber.Ctx, cfg config.Config) (*PDFRequestParams, error) {
+	req := v0Request(func(key string) string { return c.Query(key) })
+	req.Source.HTML = ""
+	if req.Source.URL == "" {
+		return nil, domain.NewError(domain.CodeInvalidURL, "Invalid URL: missing")
 	}
-
-	return &PDFRequestParams{
-		URL:         urlStr,
-		Format:      format,
-		Orientation: orientation,
-		Margin:      margin,
-		Filename:    filename,
-		Paper:       paper,
-	}, nil
+	// Query strings end up in proxy and browser logs.
+	if req.Encryption.UserPassword != "" || req.Encryption.OwnerPassword != "" {
+		return nil, domain.NewError(domain.CodeInvalidEncryption, "Invalid encryption: passwords are not accepted in the query string; use POST /v1/pdf")
+	}
+	return validateV0(req, cfg)
 }
 
 // computePDFCacheKey creates a SHA256-based cache key based on input parameters.
@@ -333,51 +679,67 @@ func computePDFCacheKey(params *PDFRequestParams) string {
 	h.Write([]byte(params.Format))
 	h.Write([]byte(params.Orientation))
 	h.Write([]byte(strconv.FormatFloat(params.Margin, 'f', 2, 64)))
-	return "pdfcache:" + hex.EncodeToString(h.Sum(nil))
+	if opts := params.renderOptionsKey(); opts != "" {
+		h.Write([]byte(opts))
+	}
+	return cache.KeyPrefix + hex.EncodeToString(h.Sum(nil))
 }
 
-// getCachedPDF attempts to retrieve a cached PDF from Redis.
-func getCachedPDF(c *fiber.Ctx, rdb *redis.Client, key, filename string) ([]byte, error) {
-	ctxRedis, cancel := context.WithTimeout(c.Context(), 1*time.Second)
+// getCachedPDF attempts to retrieve a cached PDF and describes the hit in the response headers.
+func getCachedPDF(c *fiber.Ctx, pc cache.PDFCache, key string) (*cache.Entry, error) {
+	ctxCache, cancel := context.WithTimeout(c.Context(), 1*time.Second)
 	defer cancel()
 
-	cached, err := rdb.Get(ctxRedis, key).Bytes()
-	if err == redis.Nil {
-		return nil, nil
-	}
-	if err != nil {
-		logging.Warn("Redis read failed", "error", err)
+	cached, err := readCachedPDF(ctxCache, pc, key)
+	if err != nil || cached == nil {
 		return nil, err
 	}
 
 	logging.Info("PDF cache hit", "key", key)
-	c.Set("Content-Type", "application/pdf")
-	c.Set("Content-Disposition", "attachment; filename="+filename)
+	setCacheHitHeaders(c, cached.Meta)
 	return cached, nil
 }
 
-// setCachedPDF stores a PDF in Redis for 24 hours.
-func setCachedPDF(c *fiber.Ctx, rdb *redis.Client, key string, data []byte, ttl time.Duration) {
-	ctxRedis, cancel := context.WithTimeout(c.Context(), 1*time.Second)
-	defer cancel()
-
-	if ttl <= 0 {
-		ttl = 1 * time.Minute
+// readCachedPDF returns the cached PDF for key, or (nil, nil) on a cache miss.
+// Entries written before metadata (or the page count) was stored get it derived from the bytes.
+func readCachedPDF(ctx context.Context, pc cache.PDFCache, key string) (*cache.Entry, error) {
+	cached, err := pc.Get(ctx, key)
+	if err != nil || cached == nil {
+		return nil, err
+	}
+	switch {
+	case cached.Meta.ETag == "":
+		cached.Meta = newCachedPDF(cached.Data, 0).Meta
+	case cached.Meta.Pages == 0:
+		cached.Meta.Pages = pageCount(cached.Data)
 	}
+	return cached, nil
+}
 
-	if err := rdb.Set(ctxRedis, key, data, ttl).Err(); err != nil {
-		logging.Warn("Redis write failed", "error", err)
+// storeCachedPDF writes the PDF and its metadata under key, tagged for bulk purges
+// (see cacheTags). A ttl <= 0 falls back to one minute. Failures are logged, not returned:
+// a cache write never fails the request.
+func storeCachedPDF(ctx context.Context, pc cache.PDFCache, key string, entry *cache.Entry, ttl time.Duration, tags ...string) {
+	if err := pc.Set(ctx, key, entry, cacheTTL(ttl), tags...); err != nil {
+		logging.Warn("PDF cache write failed", "error", err)
 	}
 }
 
-// renderPDFWithChrome uses headless Chrome via chromedp to render the HTML to PDF.
-func renderPDFWithChrome(html, url string, paper config.PaperSize, margin float64, cfg config.Config) ([]byte, error) {
+// cacheTTL applies the default TTL used when pdf_cache_ttl is not configured.
+func cacheTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 1 * time.Minute
+	}
+	return ttl
+}
 
+// newChromeSession starts a dedicated headless Chrome for one render of at most timeout. The
+// returned release func shuts it down and removes its profile directory.
+func newChromeSession(cfg config.Config, timeout time.Duration) (context.Context, func(error), error) {
 	tmpDir, err := os.MkdirTemp("", "chromedata-*")
 	if err != nil {
-		return nil, fmt.Errorf("cannot create temp profile dir: %w", err)
+		return nil, nil, fmt.Errorf("cannot create temp profile dir: %w", err)
 	}
-	defer os.RemoveAll(tmpDir)
 
 	allocatorOptions := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.UserDataDir(tmpDir),
@@ -395,30 +757,43 @@ func renderPDFWithChrome(html, url string, paper config.PaperSize, margin float6
 		allocatorOptions = append(allocatorOptions, chromedp.Flag("no-sandbox", true))
 	}
 
-	allocCtx, _ := chromedp.NewExecAllocator(context.Background(), allocatorOptions...)
-	chromeCtx, cancel := chromedp.NewContext(allocCtx)
-	defer cancel()
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), allocatorOptions...)
+	chromeCtx, chromeCancel := chromedp.NewContext(allocCtx)
+	ctx, cancel := context.WithTimeout(chromeCtx, timeout)
 
-	timeout := time.Duration(cfg.PDF.TimeoutSecs) * time.Second
-	chromeCtx, cancel = context.WithTimeout(chromeCtx, timeout)
-	defer cancel()
+	return ctx, func(error) {
+		cancel()
+		chromeCancel()
+		allocCancel()
+		os.RemoveAll(tmpDir)
+	}, nil
+}
 
-	pdfBuf, err := renderPDFInExistingTab(chromeCtx, html, url, paper, margin)
+// printToStream renders either raw HTML or a remote URL into PDF within a pre-existing chromedp
+// tab. Chrome keeps the PDF and hands out a stream handle; read it with a pdfStream. With
+// params.InteractiveForms it also returns the form fields measured in the page.
+func printToStream(ctx context.Context, params *PDFRequestParams) (cdpio.StreamHandle, []pdf.FormField, error) {
+	var (
+		handle  cdpio.StreamHandle
+		fields  []pdf.FormField
+		actions []chromedp.Action
+	)
+	paper, margin := params.Paper, params.Margin
 
-	if err != nil {
-		return nil, err
+	if media := params.Emulation.Media; media != "" {
+		actions = append(actions, emulation.SetEmulatedMedia().WithMedia(media))
+	}
+	if e := params.Emulation; e.ViewportWidth > 0 && e.ViewportHeight > 0 {
+		scale := e.DeviceScaleFactor
+		if scale == 0 {
+			scale = 1
+		}
+		actions = append(actions, emulation.SetDeviceMetricsOverride(e.ViewportWidth, e.ViewportHeight, scale, false))
 	}
-	return pdfBuf, nil
-}
-
-// renderPDFInExistingTab renders either raw HTML or a remote URL into PDF within a pre-existing chromedp tab.
-func renderPDFInExistingTab(ctx context.Context, html, url string, paper config.PaperSize, margin float64) ([]byte, error) {
-	var pdfBuf []byte
-	var actions []chromedp.Action
 
-	if url != "" {
+	if params.URL != "" {
 		actions = append(actions,
-			chromedp.Navigate(url),
+			chromedp.Navigate(params.URL),
 			chromedp.WaitReady("body", chromedp.ByQuery),
 		)
 	} else {
@@ -429,19 +804,27 @@ func renderPDFInExistingTab(ctx context.Context, html, url string, paper config.
 				if err != nil {
 					return err
 				}
-				return page.SetDocumentContent(frame.Frame.ID, html).Do(ctx)
+				return page.SetDocumentContent(frame.Frame.ID, params.HTML).Do(ctx)
 			}),
 			chromedp.WaitReady("body", chromedp.ByQuery),
 		)
 	}
 
+	actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+		return waitForPage(ctx, params.Wait)
+	}))
+	if params.InteractiveForms {
+		actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			fields, err = measureFormFields(ctx, params)
+			return err
+		}))
+	}
 	actions = append(actions,
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			return waitForRenderReady(ctx, 15*time.Second)
-		}),
 		chromedp.ActionFunc(func(ctx context.Context) error {
 			var err error
-			pdfBuf, _, err = page.PrintToPDF().
+			_, handle, err = page.PrintToPDF().
+				WithTransferMode(page.PrintToPDFTransferModeReturnAsStream).
 				WithPrintBackground(true).
 				WithPaperWidth(paper.Width).
 				WithPaperHeight(paper.Height).
@@ -449,23 +832,57 @@ func renderPDFInExistingTab(ctx context.Context, html, url string, paper config.
 				WithMarginBottom(margin).
 				WithMarginLeft(margin).
 				WithMarginRight(margin).
+				WithGenerateTaggedPDF(params.Tagged).
+				WithGenerateDocumentOutline(params.OutlineDepth > 0).
 				Do(ctx)
 			return err
 		}),
 	)
 
 	if err := chromedp.Run(ctx, actions...); err != nil {
-		return nil, err
+		return "", nil, err
 	}
-	return pdfBuf, nil
+	return handle, fields, nil
 }
 
-// waitForRenderReady waits until the page finished loading and critical assets are available.
-// This avoids rendering PDFs before CDN assets (CSS/fonts/images) are loaded.
-func waitForRenderReady(ctx context.Context, timeout time.Duration) error {
-	deadline := time.Now().Add(timeout)
+// waitForPage applies the request's wait strategy, then the optional extra delay.
+func waitForPage(ctx context.Context, w WaitOptions) error {
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = defaultWaitTimeout
+	}
 
-	// 1) Document readyState
+	switch w.Strategy {
+	case waitLoad:
+		if err := waitForReadyState(ctx, time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	case waitSelector:
+		// Unlike the best-effort checks of the other strategies, a selector that never shows up fails the render.
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := chromedp.WaitVisible(w.Selector, chromedp.ByQuery).Do(waitCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("wait for selector %q: %w", w.Selector, err)
+		}
+	default:
+		if err := waitForRenderReady(ctx, timeout); err != nil {
+			return err
+		}
+	}
+
+	if w.Delay > 0 {
+		select {
+		case <-time.After(w.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// waitForReadyState polls document.readyState until it is "complete" or the deadline passes.
+func waitForReadyState(ctx context.Context, deadline time.Time) error {
 	for time.Now().Before(deadline) {
 		var state string
 		if err := chromedp.Evaluate(`document.readyState`, &state).Do(ctx); err != nil {
@@ -476,6 +893,18 @@ func waitForRenderReady(ctx context.Context, timeout time.Duration) error {
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
+	return nil
+}
+
+// waitForRenderReady waits until the page finished loading and critical assets are available.
+// This avoids rendering PDFs before CDN assets (CSS/fonts/images) are loaded.
+func waitForRenderReady(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	// 1) Document readyState
+	if err := waitForReadyState(ctx, deadline); err != nil {
+		return err
+	}
 
 	// 2) Optional explicit hook: allow examples to signal "I'm ready"
 	// If the flag is undefined, we don't block on it.
@@ -524,7 +953,7 @@ func waitForRenderReady(ctx context.Context, timeout time.Duration) error {
 func (svc *PDFService) HandleChromeStats(c *fiber.Ctx) error {
 	pool, err := svc.getChromePool()
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Chrome pool init failed: "+err.Error())
+		return domain.WrapError(domain.CodeChromeUnavailable, "Chrome pool init failed", err)
 	}
 
 	// Pool disabled.
@@ -538,6 +967,7 @@ func (svc *PDFService) HandleChromeStats(c *fiber.Ctx) error {
 			"profile_dir":    "",
 			"timeout_secs":   svc.Config.PDF.TimeoutSecs,
 			"restarts":       0,
+			"janitor":        svc.janitorStats(),
 		})
 	}
 
@@ -552,5 +982,6 @@ func (svc *PDFService) HandleChromeStats(c *fiber.Ctx) error {
 		"timeout_secs":   svc.Config.PDF.TimeoutSecs,
 		"restarts":       s.Restarts,
 		"last_restart":   s.LastRestart,
+		"janitor":        svc.janitorStats(),
 	})
 }
@@ -1,9 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/http/problem"
+	"pdf-renderer/internal/infra/cache"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +21,55 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// newTestApp returns a Fiber app that answers errors like the server does.
+func newTestApp() *fiber.App {
+	return fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+}
+
+// testConfig returns a minimal config with an A4 default paper and small limits.
+func testConfig() config.Config {
+	var cfg config.Config
+	cfg.Limits.MaxHTMLBytes = 1024
+	cfg.Limits.MaxPDFBytes = 1024 * 1024
+	cfg.PDF.DefaultPaper = "A4"
+	cfg.PDF.PaperSizes = map[string]config.PaperSize{
+		"A4": {Width: 8.27, Height: 11.69},
+	}
+	return cfg
+}
+
+// newRedisTestService returns a PDFService caching PDFs for a minute in a miniredis server,
+// after configure (if not nil) adjusted the config.
+func newRedisTestService(t *testing.T, configure func(*config.Config)) (*PDFService, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	cfg := testConfig()
+	cfg.Cache.PDFCacheEnabled = true
+	cfg.Cache.PDFCacheTTL = time.Minute
+	if configure != nil {
+		configure(&cfg)
+	}
+	return NewPDFService(cfg, rdb), srv
+}
+
+// helloParams returns the parameters of a form request with only html=<b>Hello World!</b>.
+func helloParams() *PDFRequestParams {
+	return &PDFRequestParams{HTML: "<b>Hello World!</b>", Margin: 0.4}
+}
+
+// seedCache caches data as the PDF of params for a minute, so requests for it need no Chrome.
+func seedCache(t *testing.T, svc *PDFService, params *PDFRequestParams, data []byte) *cache.Entry {
+	t.Helper()
+	entry := newCachedPDF(data, time.Minute)
+	if err := svc.Cache.Set(context.Background(), computePDFCacheKey(params), entry, time.Minute); err != nil {
+		t.Fatalf("seeding the cache failed: %v", err)
+	}
+	return entry
+}
+
 // ------------------------------
 // TEST: computePDFCacheKey
 // ------------------------------
@@ -60,36 +117,31 @@ func Test_computePDFCacheKey_differs(t *testing.T) {
 }
 
 // ------------------------------
-// TEST: setCachedPDF & getCachedPDF
+// TEST: getCachedPDF
 // ------------------------------
-func Test_setAndGetCachedPDF(t *testing.T) {
-	// Start in-memory Redis server
-	srv, err := miniredis.Run()
-	if err != nil {
-		t.Fatalf("failed to start miniredis: %v", err)
-	}
-	defer srv.Close()
-
-	rdb := redis.NewClient(&redis.Options{
-		Addr: srv.Addr(),
-	})
+func Test_getCachedPDF(t *testing.T) {
+	svc, _ := newRedisTestService(t, nil)
+	pc := svc.Cache
 
-	app := fiber.New()
+	app := newTestApp()
 
 	app.Get("/test", func(c *fiber.Ctx) error {
 		key := "testcachekey"
 		data := []byte("PDFDATA123")
 
-		setCachedPDF(c, rdb, key, data, 1*time.Minute)
+		if err := pc.Set(c.Context(), key, newCachedPDF(data, time.Minute), time.Minute); err != nil {
+			t.Errorf("unexpected error on Set: %v", err)
+			return err
+		}
 
 		// Retrieve immediately
-		result, err := getCachedPDF(c, rdb, key, "test.pdf")
+		result, err := getCachedPDF(c, pc, key)
 		if err != nil {
 			t.Errorf("unexpected error on getCachedPDF: %v", err)
 			return err
 		}
-		if string(result) != string(data) {
-			t.Errorf("cached data mismatch: got %s, expected %s", string(result), string(data))
+		if string(result.Data) != string(data) {
+			t.Errorf("cached data mismatch: got %s, expected %s", string(result.Data), string(data))
 		}
 		return nil
 	})
@@ -106,31 +158,9 @@ func Test_setAndGetCachedPDF(t *testing.T) {
 }
 
 func Test_validateAndExtractPDFParams_valid(t *testing.T) {
-	cfg := config.Config{
-		Limits: struct {
-			MaxHTMLBytes int `yaml:"max_html_bytes"`
-			MaxPDFBytes  int `yaml:"max_pdf_bytes"`
-		}{
-			MaxHTMLBytes: 1024,
-			MaxPDFBytes:  1024 * 1024,
-		},
-		PDF: struct {
-			DefaultPaper    string                      `yaml:"default_paper"`
-			PaperSizes      map[string]config.PaperSize `yaml:"paper_sizes"`
-			TimeoutSecs     int                         `yaml:"timeout_secs"`
-			ChromePath      string                      `yaml:"chrome_path"`
-			ChromeNoSandbox bool                        `yaml:"chrome_no_sandbox"`
-			ChromePoolSize  int                         `yaml:"chrome_pool_size"`
-			UserDataDir     string                      `yaml:"user_data_dir"`
-		}{
-			DefaultPaper: "A4",
-			PaperSizes: map[string]config.PaperSize{
-				"A4": {Width: 8.27, Height: 11.69},
-			},
-		},
-	}
-
-	app := fiber.New()
+	cfg := testConfig()
+
+	app := newTestApp()
 	app.Post("/validate", func(c *fiber.Ctx) error {
 		params, err := validateAndExtractPDFParams(c, cfg)
 		if err != nil {
@@ -153,31 +183,9 @@ func Test_validateAndExtractPDFParams_valid(t *testing.T) {
 }
 
 func Test_validateAndExtractPDFParams_invalidMargin(t *testing.T) {
-	cfg := config.Config{
-		Limits: struct {
-			MaxHTMLBytes int `yaml:"max_html_bytes"`
-			MaxPDFBytes  int `yaml:"max_pdf_bytes"`
-		}{
-			MaxHTMLBytes: 1024,
-			MaxPDFBytes:  1024 * 1024,
-		},
-		PDF: struct {
-			DefaultPaper    string                      `yaml:"default_paper"`
-			PaperSizes      map[string]config.PaperSize `yaml:"paper_sizes"`
-			TimeoutSecs     int                         `yaml:"timeout_secs"`
-			ChromePath      string                      `yaml:"chrome_path"`
-			ChromeNoSandbox bool                        `yaml:"chrome_no_sandbox"`
-			ChromePoolSize  int                         `yaml:"chrome_pool_size"`
-			UserDataDir     string                      `yaml:"user_data_dir"`
-		}{
-			DefaultPaper: "A4",
-			PaperSizes: map[string]config.PaperSize{
-				"A4": {Width: 8.27, Height: 11.69},
-			},
-		},
-	}
-
-	app := fiber.New()
+	cfg := testConfig()
+
+	app := newTestApp()
 	app.Post("/validate", func(c *fiber.Ctx) error {
 		_, err := validateAndExtractPDFParams(c, cfg)
 		if err == nil {
@@ -248,32 +256,10 @@ func Test_validateAndExtractURLParams_valid(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	cfg := config.Config{
-		Limits: struct {
-			MaxHTMLBytes int `yaml:"max_html_bytes"`
-			MaxPDFBytes  int `yaml:"max_pdf_bytes"`
-		}{
-			MaxHTMLBytes: 1024,
-			MaxPDFBytes:  1024 * 1024,
-		},
-		PDF: struct {
-			DefaultPaper    string                      `yaml:"default_paper"`
-			PaperSizes      map[string]config.PaperSize `yaml:"paper_sizes"`
-			TimeoutSecs     int                         `yaml:"timeout_secs"`
-			ChromePath      string                      `yaml:"chrome_path"`
-			ChromeNoSandbox bool                        `yaml:"chrome_no_sandbox"`
-			ChromePoolSize  int                         `yaml:"chrome_pool_size"`
-			UserDataDir     string                      `yaml:"user_data_dir"`
-		}{
-			DefaultPaper: "A4",
-			PaperSizes: map[string]config.PaperSize{
-				"A4": {Width: 8.27, Height: 11.69},
-			},
-			TimeoutSecs: 5,
-		},
-	}
-
-	app := fiber.New()
+	cfg := testConfig()
+	cfg.PDF.TimeoutSecs = 5
+
+	app := newTestApp()
 	app.Get("/validate", func(c *fiber.Ctx) error {
 		params, err := validateAndExtractURLParams(c, cfg)
 		if err != nil {
@@ -299,7 +285,7 @@ func Test_validateAndExtractURLParams_invalidURL(t *testing.T) {
 		"A4": {Width: 8.27, Height: 11.69},
 	}
 
-	app := fiber.New()
+	app := newTestApp()
 	app.Get("/validate", func(c *fiber.Ctx) error {
 		_, err := validateAndExtractURLParams(c, cfg)
 		if err == nil {
@@ -314,3 +300,111 @@ func Test_validateAndExtractURLParams_invalidURL(t *testing.T) {
 		t.Errorf("expected status 400, got %d", resp.StatusCode)
 	}
 }
+
+func TestPDFService_BeginDrain_RejectsNewRenders(t *testing.T) {
+	var cfg config.Config
+	svc := NewPDFService(cfg, nil)
+
+	if !svc.Ready() {
+		t.Fatal("expected service to be ready before drain")
+	}
+	svc.BeginDrain()
+	if svc.Ready() {
+		t.Fatal("expected service to be not ready after BeginDrain")
+	}
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	app.Get("/pdf", svc.HandleURLConversion)
+
+	req := httptest.NewRequest("POST", "/pdf", strings.NewReader("html=<b>Hello World!</b>"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("POST: expected status 503, got %d", resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/pdf?url=https://example.com", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("GET: expected status 503, got %d", resp.StatusCode)
+	}
+}
+
+func TestPDFService_WaitForInflight(t *testing.T) {
+	var cfg config.Config
+	svc := NewPDFService(cfg, nil)
+
+	if !svc.admit() {
+		t.Fatal("expected render to be admitted")
+	}
+	svc.BeginDrain()
+	if svc.admit() {
+		t.Fatal("expected render to be rejected while draining")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := svc.WaitForInflight(ctx); err == nil {
+		t.Fatal("expected timeout while a render is in flight")
+	}
+
+	svc.inflight.Done()
+	if err := svc.WaitForInflight(context.Background()); err != nil {
+		t.Fatalf("expected drain to complete, got %v", err)
+	}
+
+	svc.Close()
+	if _, err := svc.getChromePool(); err != nil {
+		t.Fatalf("disabled pool should not error after Close, got %v", err)
+	}
+}
+
+func Test_renderError(t *testing.T) {
+	tests := []struct {
+		err     error
+		code    domain.Code
+		message string
+	}{
+		{fmt.Errorf("wait: %w", context.DeadlineExceeded), domain.CodeRenderTimeout, "PDF rendering took too long"},
+		{errors.New("page load error net::ERR_NAME_NOT_RESOLVED"), domain.CodeNavigationFailed, "Navigation failed: net::ERR_NAME_NOT_RESOLVED"},
+		{errors.New("websocket: close 1006 (abnormal closure)"), domain.CodeChromeCrashed, "Chrome session interrupted"},
+		{errPDFTooLarge, domain.CodePDFTooLarge, "PDF exceeds allowed size"},
+		{errors.New("exception \"Uncaught\" (0:0): secret stack"), domain.CodeRenderFailed, "PDF generation failed"},
+	}
+	for _, tt := range tests {
+		got := renderError(tt.err)
+		if got.Code != tt.code || got.Message != tt.message {
+			t.Errorf("renderError(%q) = %s %q, want %s %q", tt.err, got.Code, got.Message, tt.code, tt.message)
+		}
+	}
+}
+
+func TestStartJanitor_SweepsWithoutPool(t *testing.T) {
+	cfg := testConfig()
+	cfg.PDF.UserDataDir = t.TempDir()
+	stale := filepath.Join(cfg.PDF.UserDataDir, "html2pdf-chrome-profile-crashed")
+	if err := os.MkdirAll(stale, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewPDFService(cfg, nil) // chrome_pool_size 0: the pool is never created
+	svc.StartJanitor()
+	defer svc.Close()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected the startup sweep to remove %s, got %v", stale, err)
+	}
+	if s := svc.janitorStats(); s.Runs != 1 || s.DirsRemoved != 1 {
+		t.Fatalf("expected one sweep removing one dir, got %+v", s)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/pdf"
+)
+
+// needsPostProcessing reports whether Chrome's PDF is edited, encrypted or split before it is
+// returned, or a form is filled instead, which requires the whole document in memory. Form
+// fields are only known once printed, so InteractiveForms needs it too.
+func (p *PDFRequestParams) needsPostProcessing() bool {
+	return !p.postProcessOptions().IsZero() || !p.Encryption.IsZero() || !p.Split.IsZero() || p.Fill != nil ||
+		p.InteractiveForms
+}
+
+func (p *PDFRequestParams) postProcessOptions() pdf.Options {
+	opts := pdf.Options{
+		Metadata:    p.Metadata,
+		PDFA:        p.PDFA,
+		Watermark:   p.Watermark,
+		FormFields:  p.FormFields,
+		Attachments: p.Attachments,
+		FacturX:     p.FacturX,
+		Optimize:    p.Optimize,
+		Signature:   p.Signature,
+	}
+	// Chrome's outline has all heading levels; shallower ones are cut after printing.
+	if p.OutlineDepth < pdf.MaxOutlineDepth {
+		opts.OutlineDepth = p.OutlineDepth
+	}
+	return opts
+}
+
+// postProcess applies the edits requested in params to a PDF printed by Chrome.
+func postProcess(data []byte, params *PDFRequestParams) ([]byte, error) {
+	opts := params.postProcessOptions()
+	if opts.IsZero() {
+		return data, nil
+	}
+	out, err := pdf.Process(data, opts)
+	switch {
+	case errors.Is(err, pdf.ErrFontNotEmbedded):
+		return nil, domain.WrapError(domain.CodePDFANotConformant, "The page uses fonts that cannot be embedded, as PDF/A requires", err)
+	case err != nil && opts.PDFA != "":
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Converting the PDF to PDF/A failed", err)
+	case err != nil && !opts.Watermark.IsZero():
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Adding the watermark failed", err)
+	case err != nil && len(opts.FormFields) > 0:
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Adding the form fields failed", err)
+	case err != nil && opts.Signature != nil:
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Signing the PDF failed", err)
+	case err != nil && (len(opts.Attachments) > 0 || opts.FacturX != nil):
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Embedding the attachments failed", err)
+	case err != nil && opts.OutlineDepth > 0:
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Limiting the outline depth failed", err)
+	case err != nil && !opts.Optimize.IsZero():
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Optimizing the PDF failed", err)
+	case err != nil:
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Setting PDF metadata failed", err)
+	}
+	return out, nil
+}
+
+// protect encrypts a rendered (or cached) PDF for one response if params ask for it. The result
+// is a copy without an ETag: the cache keeps the unencrypted PDF, and each encryption uses a
+// fresh salt.
+func protect(entry *cache.Entry, params *PDFRequestParams) (*cache.Entry, error) {
+	if params.Encryption.IsZero() {
+		return entry, nil
+	}
+	data, err := pdf.Encrypt(entry.Data, params.Encryption)
+	if err != nil {
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Encrypting the PDF failed", err)
+	}
+	meta := entry.Meta
+	meta.ETag = ""
+	meta.Size = len(data)
+	return &cache.Entry{Data: data, Meta: meta}, nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/pdf"
+)
+
+// validPDF returns a one-page PDF with a correct xref table, which pdfcpu can edit.
+func validPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Count 1 /Kids [3 0 R] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << >> >>",
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestPostProcess(t *testing.T) {
+	data := []byte("%PDF-1.4 not really")
+
+	out, err := postProcess(data, &PDFRequestParams{})
+	require.NoError(t, err)
+	assert.Equal(t, data, out, "nothing requested, nothing parsed")
+
+	_, err = postProcess(data, &PDFRequestParams{Metadata: pdf.Metadata{Title: "Report"}})
+	var de *domain.Error
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, domain.CodePostProcessFailed, de.Code)
+
+	_, err = postProcess(data, &PDFRequestParams{PDFA: pdf.PDFA2B})
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, domain.CodePostProcessFailed, de.Code)
+	assert.Contains(t, de.Message, "PDF/A")
+
+	_, err = postProcess(data, &PDFRequestParams{Watermark: &pdf.Watermark{Text: "DRAFT"}})
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, "Adding the watermark failed", de.Message)
+
+	_, err = postProcess(data, &PDFRequestParams{Attachments: []pdf.Attachment{{Name: "data.csv", Data: []byte("a,b")}}})
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, "Embedding the attachments failed", de.Message)
+
+	_, err = postProcess(data, &PDFRequestParams{Optimize: pdf.Optimization{Deduplicate: true}})
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, "Optimizing the PDF failed", de.Message)
+}
+
+func TestPostProcess_Optimize(t *testing.T) {
+	for _, o := range []pdf.Optimization{{Linearize: true}, {Compress: true, Deduplicate: true}} {
+		out, err := postProcess(validPDF(), &PDFRequestParams{Optimize: o})
+		require.NoError(t, err, "%+v", o)
+		assert.Equal(t, 1, newCachedPDF(out, 0).Meta.Pages, "%+v", o)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	entry := newCachedPDF(validPDF(), time.Minute)
+
+	same, err := protect(entry, &PDFRequestParams{})
+	require.NoError(t, err)
+	assert.Same(t, entry, same)
+
+	protected, err := protect(entry, &PDFRequestParams{Encryption: pdf.Encryption{UserPassword: "secret"}})
+	require.NoError(t, err)
+	assert.Contains(t, string(protected.Data), "/Encrypt")
+	assert.Empty(t, protected.Meta.ETag)
+	assert.Equal(t, len(protected.Data), protected.Meta.Size)
+	assert.Equal(t, 1, protected.Meta.Pages)
+	assert.NotEmpty(t, entry.Meta.ETag, "the cached entry is unchanged")
+}
+
+// TestEncryptedResponses checks that the cache holds the unencrypted PDF and each response is
+// encrypted on the way out.
+func TestEncryptedResponses(t *testing.T) {
+	svc := NewPDFService(testConfig(), nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+	entry := seedCache(t, svc, helloParams(), validPDF())
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	app.Get("/pdf", svc.HandleURLConversion)
+
+	req := httptest.NewRequest("POST", "/pdf", strings.NewReader("html=<b>Hello World!</b>&user_password=secret&permissions=print"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(fiber.HeaderIfNoneMatch, entry.Meta.ETag)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode, "encrypted responses are never 304")
+	assert.Equal(t, "HIT", resp.Header.Get(headerCache), "passwords are not part of the cache key")
+	assert.Empty(t, resp.Header.Get(fiber.HeaderETag))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "/Encrypt")
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/pdf?url=https://example.com&user_password=secret", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "passwords are not accepted in query strings")
+}
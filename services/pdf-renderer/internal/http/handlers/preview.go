@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/pdf"
+)
+
+const (
+	defaultPreviewDPI = 96
+	minPreviewDPI     = 10
+	maxPreviewDPI     = 600
+
+	// maxPreviewPages bounds the pages rasterized for one response.
+	maxPreviewPages = 100
+	// maxPreviewPixels bounds one image, so a large page at a high dpi cannot exhaust the tab's
+	// memory. A4 at 600 dpi is 35 megapixels.
+	maxPreviewPixels = 40_000_000
+
+	// previewOrigin serves the preview page, pdf.js and the PDF to the tab. Its requests are
+	// answered from memory through the Fetch domain; .invalid never resolves, so nothing
+	// reaches the network.
+	previewOrigin       = "https://preview.html2pdf.invalid"
+	previewDocumentPath = "/document.pdf"
+	pdfjsPathPrefix     = "/pdfjs/" // followed by a path within preview.pdfjs_dir
+)
+
+var errPreviewDisabled = domain.NewError(domain.CodePreviewDisabled, "PNG output is not enabled")
+
+// pdfjsFiles are the files of the pdfjs-dist package previewLoadScript imports.
+var pdfjsFiles = []string{"build/pdf.min.mjs", "build/pdf.worker.min.mjs"}
+
+// previewPage is the empty page previewLoadScript runs in.
+const previewPage = `<!DOCTYPE html><html><head><meta charset="utf-8"><title>PDF preview</title></head><body></body></html>`
+
+// previewLoadScript loads pdf.js and the PDF into window.preview. Only the page makes
+// requests: the worker is started from a blob and the main thread fetches the PDF, fonts and
+// CMaps (useWorkerFetch).
+const previewLoadScript = `(async () => {
+	const pdfjs = await import("` + pdfjsPathPrefix + `build/pdf.min.mjs");
+	const worker = await (await fetch("` + pdfjsPathPrefix + `build/pdf.worker.min.mjs")).blob();
+	pdfjs.GlobalWorkerOptions.workerPort = new Worker(URL.createObjectURL(worker), {type: "module"});
+	const response = await fetch("` + previewDocumentPath + `");
+	const doc = await pdfjs.getDocument({
+		data: new Uint8Array(await response.arrayBuffer()),
+		standardFontDataUrl: "` + pdfjsPathPrefix + `standard_fonts/",
+		cMapUrl: "` + pdfjsPathPrefix + `cmaps/",
+		cMapPacked: true,
+		useWorkerFetch: false,
+		isEvalSupported: false,
+	}).promise;
+	window.preview = {pdfjs, doc};
+})()`
+
+// previewPageScript renders a page (%d) at a scale (%g, pixels per point) onto a canvas and
+// returns it as a PNG data URL, or "" if it would exceed a number of pixels (%d). Annotations
+// are drawn with their appearance streams, form fields included.
+const previewPageScript = `(async (number, scale, maxPixels) => {
+	const page = await window.preview.doc.getPage(number);
+	const viewport = page.getViewport({scale});
+	const width = Math.max(1, Math.floor(viewport.width));
+	const height = Math.max(1, Math.floor(viewport.height));
+	if (width * height > maxPixels) {
+		return "";
+	}
+	const canvas = document.createElement("canvas");
+	canvas.width = width;
+	canvas.height = height;
+	await page.render({
+		canvasContext: canvas.getContext("2d"),
+		viewport,
+		annotationMode: window.preview.pdfjs.AnnotationMode.ENABLE,
+	}).promise;
+	page.cleanup();
+	return canvas.toDataURL("image/png");
+})(%d, %g, %d)`
+
+// loadPDFJS opens dir, an unpacked pdfjs-dist package, and checks that it has the files a
+// preview imports.
+func loadPDFJS(dir string) (fs.FS, error) {
+	files := os.DirFS(dir)
+	for _, name := range pdfjsFiles {
+		if _, err := fs.Stat(files, name); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// sendPreview answers with the pages of entry params.PreviewPages selects, rasterized at
+// params.PreviewDPI: one PNG image, or a ZIP archive of them for several pages. Like split
+// archives, images are made for each response and carry no ETag. Dry runs other than HEAD are
+// answered without rasterizing.
+func (svc *PDFService) sendPreview(c *fiber.Ctx, entry *cache.Entry, params *PDFRequestParams, dryRun bool) error {
+	meta := entry.Meta
+	meta.ETag = ""
+	if dryRun && c.Method() != fiber.MethodHead {
+		setConditionalHeaders(c, meta)
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	pages, pageCount, err := previewPages(entry, params.PreviewPages)
+	if err != nil {
+		return err
+	}
+	images, err := svc.rasterize(entry.Data, pages, params.PreviewDPI)
+	if err != nil {
+		return err
+	}
+
+	name, contentType, body := previewName(params.Filename, pages[0], pageCount), "image/png", images[0]
+	if len(images) > 1 {
+		name, contentType = archiveName(params.Filename), "application/zip"
+		if body, err = previewArchive(images, pages, pageCount, params.Filename, entry.Meta.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if len(body) > svc.Config.Limits.MaxPDFBytes {
+		return errPDFTooLarge
+	}
+	logging.Info("PDF preview", "filename", name, "pages", len(pages), "dpi", params.PreviewDPI, "request_id", c.Get("X-Request-ID"))
+
+	setConditionalHeaders(c, meta)
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename="+name)
+	return c.Send(body)
+}
+
+// previewPages returns the pages of entry in the page range s (all for "") and its page count.
+func previewPages(entry *cache.Entry, s string) ([]int, int, error) {
+	pageCount := entry.Meta.Pages
+	if pageCount == 0 {
+		var err error
+		if pageCount, err = pdf.PageCount(entry.Data); err != nil {
+			return nil, 0, domain.WrapError(domain.CodePostProcessFailed, "Reading the PDF failed", err)
+		}
+	}
+	pages, err := pdf.SelectPages(s, pageCount)
+	switch {
+	case err != nil:
+		return nil, 0, domain.WrapError(domain.CodeInvalidPreview, "Invalid preview: pages must be a page range such as '1-3,5'", err)
+	case len(pages) == 0:
+		return nil, 0, domain.NewError(domain.CodeInvalidPreview, fmt.Sprintf("Invalid preview: no page lies within the document's %d pages", pageCount))
+	case len(pages) > maxPreviewPages:
+		return nil, 0, domain.NewError(domain.CodeInvalidPreview, fmt.Sprintf("Invalid preview: %d pages selected, more than %d; select fewer with pages", len(pages), maxPreviewPages))
+	}
+	return pages, pageCount, nil
+}
+
+// previewArchive zips the images of pages, named like single images (see previewName). PNG is
+// compressed already, so the images are stored as they are.
+func previewArchive(images [][]byte, pages []int, pageCount int, filename string, modified time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, image := range images {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     previewName(filename, pages[i], pageCount),
+			Method:   zip.Store,
+			Modified: modified,
+		})
+		if err == nil {
+			_, err = w.Write(image)
+		}
+		if err != nil {
+			return nil, domain.WrapError(domain.CodePostProcessFailed, "Archiving the preview failed", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, domain.WrapError(domain.CodePostProcessFailed, "Archiving the preview failed", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// previewName names the image of a page like partName names a part: "labels-07.png".
+func previewName(filename string, page, pageCount int) string {
+	return strings.TrimSuffix(partName(filename, pdf.PageRange{First: page, Last: page}, pageCount), ".pdf") + ".png"
+}
+
+// rasterize renders pages of the PDF data at dpi as PNG images in a pooled tab, retrying once on
+// a fresh pool if the Chrome session broke.
+func (svc *PDFService) rasterize(data []byte, pages []int, dpi int) ([][]byte, error) {
+	run := func() ([][]byte, error) {
+		ctx, release, err := svc.openTab()
+		if err != nil {
+			return nil, err
+		}
+		images, err := rasterizePages(ctx, svc.PDFJS, data, pages, dpi)
+		release(err)
+		return images, err
+	}
+	images, err := run()
+	if svc.restartAfter(err) {
+		images, err = run()
+	}
+	if err != nil {
+		rerr := renderError(err)
+		logging.Error("PDF preview failed", "code", rerr.Code, "timeout_secs", svc.Config.PDF.TimeoutSecs, "error", err.Error())
+		return nil, rerr
+	}
+	return images, nil
+}
+
+// rasterizePages loads data with pdf.js into the tab of ctx and renders each of pages at dpi.
+// The tab's requests to previewOrigin are answered by previewResponse.
+func rasterizePages(ctx context.Context, files fs.FS, data []byte, pages []int, dpi int) ([][]byte, error) {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chromedp.ListenTarget(lctx, func(ev any) {
+		if ev, ok := ev.(*fetch.EventRequestPaused); ok {
+			// Listeners run on the tab's event loop, which must not wait for the answer.
+			go fulfillPreviewRequest(lctx, files, data, ev)
+		}
+	})
+
+	awaitPromise := func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}
+	// Pooled tabs are reused: stop intercepting requests and leave the preview page, which ends
+	// its worker and drops window.preview, before the tab is released.
+	defer chromedp.Run(ctx, fetch.Disable(), chromedp.Navigate("about:blank"))
+	err := chromedp.Run(ctx,
+		fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: previewOrigin + "/*"}}),
+		chromedp.Navigate(previewOrigin+"/"),
+		chromedp.Evaluate(previewLoadScript, nil, awaitPromise),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := float64(dpi) / pointsPerInch
+	images := make([][]byte, 0, len(pages))
+	for _, n := range pages {
+		var dataURL string
+		script := fmt.Sprintf(previewPageScript, n, scale, maxPreviewPixels)
+		if err := chromedp.Run(ctx, chromedp.Evaluate(script, &dataURL, awaitPromise)); err != nil {
+			return nil, err
+		}
+		if dataURL == "" {
+			return nil, domain.NewError(domain.CodeInvalidPreview, fmt.Sprintf("Invalid preview: page %d exceeds %d megapixels at %d dpi; lower dpi", n, maxPreviewPixels/1_000_000, dpi))
+		}
+		image, err := decodePNGDataURL(dataURL)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// fulfillPreviewRequest answers a request of the preview tab with previewResponse.
+func fulfillPreviewRequest(ctx context.Context, files fs.FS, data []byte, ev *fetch.EventRequestPaused) {
+	status, contentType, body := previewResponse(files, data, ev.Request.URL)
+	err := chromedp.Run(ctx, fetch.FulfillRequest(ev.RequestID, int64(status)).
+		WithResponseHeaders([]*fetch.HeaderEntry{{Name: fiber.HeaderContentType, Value: contentType}}).
+		WithBody(base64.StdEncoding.EncodeToString(body)))
+	if err != nil && ctx.Err() == nil {
+		logging.Warn("Answering a preview request failed", "url", ev.Request.URL, "error", err)
+	}
+}
+
+// previewResponse returns the status, content type and body for a request of the preview tab:
+// previewPage, the PDF data, or a file of the pdf.js package. Anything else is not found.
+func previewResponse(files fs.FS, data []byte, rawURL string) (int, string, []byte) {
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme+"://"+u.Host == previewOrigin {
+		switch p := u.Path; {
+		case p == "/":
+			return fiber.StatusOK, fiber.MIMETextHTMLCharsetUTF8, []byte(previewPage)
+		case p == previewDocumentPath:
+			return fiber.StatusOK, "application/pdf", data
+		case strings.HasPrefix(p, pdfjsPathPrefix):
+			// fs.FS rejects names with "..", so nothing outside preview.pdfjs_dir is served.
+			name := strings.TrimPrefix(p, pdfjsPathPrefix)
+			if body, err := fs.ReadFile(files, name); err == nil {
+				return fiber.StatusOK, pdfjsContentType(name), body
+			}
+		}
+	}
+	return fiber.StatusNotFound, fiber.MIMETextPlainCharsetUTF8, []byte("not found")
+}
+
+// pdfjsContentType returns the content type of a pdf.js file. Module scripts must be served as
+// JavaScript; fonts and CMaps are read as binary data.
+func pdfjsContentType(name string) string {
+	switch path.Ext(name) {
+	case ".mjs", ".js":
+		return fiber.MIMETextJavaScriptCharsetUTF8
+	case ".json":
+		return fiber.MIMEApplicationJSON
+	}
+	return fiber.MIMEOctetStream
+}
+
+// decodePNGDataURL returns the image of a data URL made by canvas.toDataURL("image/png").
+func decodePNGDataURL(dataURL string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(dataURL, "data:image/png;base64,")
+	if !ok {
+		return nil, errors.New("the page was not rasterized as PNG")
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
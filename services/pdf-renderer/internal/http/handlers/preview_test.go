@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/infra/cache"
+)
+
+func TestPreviewName(t *testing.T) {
+	assert.Equal(t, "labels-7.png", previewName("labels.pdf", 7, 9))
+	assert.Equal(t, "labels-007.png", previewName("labels.pdf", 7, 120))
+
+	archive, err := previewArchive([][]byte{[]byte("one"), []byte("three")}, []int{1, 3}, 12, "labels.pdf", time.Now())
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "labels-01.png", zr.File[0].Name)
+	assert.Equal(t, "labels-03.png", zr.File[1].Name)
+	assert.Equal(t, zip.Store, zr.File[1].Method, "PNG is compressed already")
+}
+
+func TestPreviewResponse(t *testing.T) {
+	files := fstest.MapFS{
+		"build/pdf.min.mjs":               {Data: []byte("export {};")},
+		"standard_fonts/FoxitSans.pfb":    {Data: []byte{0x80, 0x01}},
+		"../secret":                       {Data: []byte("secret")},
+		"build/pdf.worker.min.mjs":        {Data: []byte("export {};")},
+		"standard_fonts/LICENSE_FOXIT":    {Data: []byte("license")},
+		"cmaps/78-EUC-H.bcmap":            {Data: []byte{0xe0}},
+		"web/images/annotation-check.svg": {Data: []byte("<svg/>")},
+	}
+	doc := pagesPDF(1)
+
+	for _, tc := range []struct {
+		url         string
+		status      int
+		contentType string
+		body        []byte
+	}{
+		{previewOrigin + "/", 200, fiber.MIMETextHTMLCharsetUTF8, []byte(previewPage)},
+		{previewOrigin + previewDocumentPath, 200, "application/pdf", doc},
+		{previewOrigin + "/pdfjs/build/pdf.min.mjs", 200, fiber.MIMETextJavaScriptCharsetUTF8, []byte("export {};")},
+		{previewOrigin + "/pdfjs/standard_fonts/FoxitSans.pfb", 200, fiber.MIMEOctetStream, []byte{0x80, 0x01}},
+		{previewOrigin + "/pdfjs/../secret", 404, fiber.MIMETextPlainCharsetUTF8, nil},
+		{previewOrigin + "/pdfjs/build/missing.mjs", 404, fiber.MIMETextPlainCharsetUTF8, nil},
+		{previewOrigin + "/favicon.ico", 404, fiber.MIMETextPlainCharsetUTF8, nil},
+		{"https://example.com" + previewDocumentPath, 404, fiber.MIMETextPlainCharsetUTF8, nil},
+	} {
+		status, contentType, body := previewResponse(files, doc, tc.url)
+		assert.Equal(t, tc.status, status, tc.url)
+		assert.Equal(t, tc.contentType, contentType, tc.url)
+		if tc.body != nil {
+			assert.Equal(t, tc.body, body, tc.url)
+		}
+	}
+}
+
+func TestLoadPDFJS(t *testing.T) {
+	dir := t.TempDir()
+	_, err := loadPDFJS(dir)
+	assert.Error(t, err, "not a pdfjs-dist package")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "build"), 0o755))
+	for _, name := range pdfjsFiles {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("export {};"), 0o644))
+	}
+	files, err := loadPDFJS(dir)
+	require.NoError(t, err)
+	status, _, _ := previewResponse(files, nil, previewOrigin+"/pdfjs/build/pdf.worker.min.mjs")
+	assert.Equal(t, 200, status)
+}
+
+func TestDecodePNGDataURL(t *testing.T) {
+	image, err := decodePNGDataURL("data:image/png;base64,iVBORw0KGgo=")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\n"), image)
+
+	_, err = decodePNGDataURL("data:,")
+	assert.Error(t, err)
+}
+
+// TestPreviewResponses checks the responses of output=png that need no Chrome: previews are made
+// from the cached PDF, never 304, and need pdf.js.
+func TestPreviewResponses(t *testing.T) {
+	svc := NewPDFService(testConfig(), nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+	params := &PDFRequestParams{HTML: "<b>Labels</b>", Margin: 0.4, Filename: "labels.pdf"}
+	entry := seedCache(t, svc, params, pagesPDF(12))
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	post := func(form string) (*http.Response, string) {
+		req := httptest.NewRequest("POST", "/pdf", strings.NewReader("html=<b>Labels</b>&filename=labels.pdf&output=png&"+form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(fiber.HeaderIfNoneMatch, entry.Meta.ETag)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := post("pages=1")
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Contains(t, body, "PREVIEW_DISABLED")
+
+	svc.PDFJS = fstest.MapFS{}
+	resp, _ = post("pages=1&dry_run=true")
+	assert.Equal(t, 204, resp.StatusCode, "previews are never 304")
+	assert.Equal(t, "HIT", resp.Header.Get(headerCache), "the preview is not part of the cache key")
+	assert.Empty(t, resp.Header.Get(fiber.HeaderETag))
+
+	resp, body = post("pages=13-20")
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, body, "INVALID_PREVIEW")
+	assert.Contains(t, body, "12 pages")
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/infra/cache"
+)
+
+// Response headers describing how a PDF was produced.
+const (
+	headerPDFPages        = "X-PDF-Pages"
+	headerRenderDuration  = "X-Render-Duration-Ms"
+	headerQueueWait       = "X-Queue-Wait-Ms"
+	headerCache           = "X-Cache"
+	headerChromeRestarted = "X-Chrome-Restarted"
+	headerOriginalSize    = "X-PDF-Original-Size"
+	headerOptimizedSize   = "X-PDF-Optimized-Size"
+)
+
+// renderTiming describes one render for the response headers.
+type renderTiming struct {
+	QueueWait time.Duration // until a Chrome tab (or per-request Chrome) was ready
+	Render    time.Duration // loading the page and printing it, without the transfer
+	Restarted bool          // the Chrome pool was restarted and the render retried
+
+	OriginalSize int // Chrome's PDF in bytes if it was optimized, else 0
+}
+
+// renderResult is a PDF returned by renderShared. Timing is nil if another replica rendered it
+// and it was read from the shared cache.
+type renderResult struct {
+	*cache.Entry
+	Timing *renderTiming
+}
+
+// setCacheHitHeaders describes a PDF served from the cache.
+func setCacheHitHeaders(c *fiber.Ctx, meta cache.Meta) {
+	c.Set(headerCache, "HIT")
+	setPagesHeader(c, meta.Pages)
+	setSizeHeaders(c, meta)
+}
+
+// setRenderHeaders describes a PDF rendered for this request (or a concurrent identical one).
+func setRenderHeaders(c *fiber.Ctx, t renderTiming) {
+	c.Set(headerCache, "MISS")
+	c.Set(headerQueueWait, strconv.FormatInt(t.QueueWait.Milliseconds(), 10))
+	c.Set(headerRenderDuration, strconv.FormatInt(t.Render.Milliseconds(), 10))
+	c.Set(headerChromeRestarted, strconv.FormatBool(t.Restarted))
+}
+
+// setResultHeaders describes the outcome of renderShared.
+func setResultHeaders(c *fiber.Ctx, result *renderResult) {
+	if result.Timing == nil {
+		setCacheHitHeaders(c, result.Meta)
+		return
+	}
+	setRenderHeaders(c, *result.Timing)
+	setPagesHeader(c, result.Meta.Pages)
+	setSizeHeaders(c, result.Meta)
+}
+
+// setPagesHeader sets X-PDF-Pages unless the page count is unknown.
+func setPagesHeader(c *fiber.Ctx, pages int) {
+	if pages > 0 {
+		c.Set(headerPDFPages, strconv.Itoa(pages))
+	}
+}
+
+// setSizeHeaders reports the size of an optimized PDF before and after optimization.
+func setSizeHeaders(c *fiber.Ctx, meta cache.Meta) {
+	if meta.OriginalSize > 0 {
+		c.Set(headerOriginalSize, strconv.Itoa(meta.OriginalSize))
+		c.Set(headerOptimizedSize, strconv.Itoa(meta.Size))
+	}
+}
+
+// isDryRun reports whether the client asked for the metadata headers only: a HEAD request or
+// dry_run=true.
+func isDryRun(c *fiber.Ctx, params *PDFRequestParams) bool {
+	return params.DryRun || c.Method() == fiber.MethodHead
+}
+
+// sendDryRun answers a dry run. HEAD gets the headers of the equivalent GET, including
+// Content-Length; other methods get 204 without a body.
+func sendDryRun(c *fiber.Ctx, entry *cache.Entry, filename string) error {
+	setConditionalHeaders(c, entry.Meta)
+	if c.Method() == fiber.MethodHead {
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, "attachment; filename="+filename)
+		return c.Send(entry.Data)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/infra/cache"
+)
+
+const twoPagePDF = `%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Count 2 /Kids [3 0 R 4 0 R] >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R >> endobj
+4 0 obj << /Type /Page /Parent 2 0 R >> endobj
+trailer << /Size 5 /Root 1 0 R >>
+%%EOF
+`
+
+// newMetadataTestApp serves a cached two-page PDF for both v0 endpoints.
+func newMetadataTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	svc := NewPDFService(testConfig(), nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+
+	seedCache(t, svc, helloParams(), []byte(twoPagePDF))
+	seedCache(t, svc, &PDFRequestParams{URL: "https://example.com", Margin: 0.4}, []byte(twoPagePDF))
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	app.Get("/pdf", svc.HandleURLConversion)
+	return app
+}
+
+func TestMetadataHeaders_CacheHit(t *testing.T) {
+	app := newMetadataTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/pdf?url=https://example.com", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "HIT", resp.Header.Get(headerCache))
+	assert.Equal(t, "2", resp.Header.Get(headerPDFPages))
+	assert.Empty(t, resp.Header.Get(headerRenderDuration), "nothing was rendered")
+}
+
+func TestMetadataHeaders_Head(t *testing.T) {
+	app := newMetadataTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest("HEAD", "/pdf?url=https://example.com", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(headerPDFPages))
+	assert.Equal(t, "application/pdf", resp.Header.Get(fiber.HeaderContentType))
+	assert.EqualValues(t, len(twoPagePDF), resp.ContentLength)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Empty(t, body)
+}
+
+func TestMetadataHeaders_DryRun(t *testing.T) {
+	app := newMetadataTestApp(t)
+
+	req := httptest.NewRequest("POST", "/pdf", strings.NewReader("html=<b>Hello World!</b>&dry_run=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(headerPDFPages))
+	assert.Equal(t, "HIT", resp.Header.Get(headerCache))
+	assert.NotEmpty(t, resp.Header.Get(fiber.HeaderETag))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Empty(t, body)
+}
+
+func TestSetResultHeaders(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		setResultHeaders(c, &renderResult{
+			Entry:  newCachedPDF([]byte(twoPagePDF), 0),
+			Timing: &renderTiming{QueueWait: 12 * time.Millisecond, Render: 1500 * time.Millisecond, Restarted: true},
+		})
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "MISS", resp.Header.Get(headerCache))
+	assert.Equal(t, "12", resp.Header.Get(headerQueueWait))
+	assert.Equal(t, "1500", resp.Header.Get(headerRenderDuration))
+	assert.Equal(t, "true", resp.Header.Get(headerChromeRestarted))
+	assert.Equal(t, "2", resp.Header.Get(headerPDFPages))
+}
+
+func TestSizeHeaders(t *testing.T) {
+	optimized := newCachedPDF([]byte(twoPagePDF), 0)
+	optimized.Meta.OriginalSize = 4096
+	app := fiber.New()
+	app.Get("/:entry", func(c *fiber.Ctx) error {
+		if c.Params("entry") == "optimized" {
+			setCacheHitHeaders(c, optimized.Meta)
+		} else {
+			setResultHeaders(c, &renderResult{Entry: newCachedPDF([]byte(twoPagePDF), 0), Timing: &renderTiming{}})
+		}
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/optimized", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "4096", resp.Header.Get(headerOriginalSize))
+	assert.Equal(t, strconv.Itoa(len(twoPagePDF)), resp.Header.Get(headerOptimizedSize))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/plain", nil))
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get(headerOriginalSize), "not optimized")
+	assert.Empty(t, resp.Header.Get(headerOptimizedSize))
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/xid"
+
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/infra/logging"
+)
+
+// renderLockPrefix namespaces the distributed render locks next to the pdfcache: entries.
+const renderLockPrefix = "pdflock:"
+
+// lockPollInterval is how often followers check whether the leader published its result.
+const lockPollInterval = 100 * time.Millisecond
+
+// releaseLockScript deletes the lock only if we still own it (the lease may have expired and
+// been taken over by another replica meanwhile).
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// renderShared renders the document identified by cacheKey at most once at a time.
+//
+// Concurrent callers in this process share one render via single-flight. When the PDF cache is
+// shared between replicas (redis, tiered) and render_lock_enabled is on, a Redis lock extends
+// this across replicas: the lock holder
+// renders and caches the PDF while other replicas poll the cache for its result. If the lock
+// holder fails or takes longer than render_lock_wait, followers fall back to rendering locally.
+func (svc *PDFService) renderShared(cacheKey string, write cacheWrite, render func() ([]byte, renderTiming, error)) (*renderResult, error) {
+	v, err, shared := svc.flight.Do(cacheKey, func() (any, error) {
+		return svc.renderAndCache(cacheKey, write, render)
+	})
+	if shared {
+		logging.Info("PDF render shared with concurrent request", "key", cacheKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*renderResult), nil
+}
+
+// renderAndCache runs one render (guarded by the distributed lock if enabled) and stores the
+// result in the cache so waiting replicas can pick it up. Forced refreshes skip the lock: the
+// current holder may be about to publish the copy the client asked to bypass.
+func (svc *PDFService) renderAndCache(cacheKey string, write cacheWrite, render func() ([]byte, renderTiming, error)) (*renderResult, error) {
+	cacheEnabled := svc.cacheEnabled()
+
+	if svc.useRenderLock() && !write.Refresh {
+		token, acquired, err := acquireRenderLock(svc.Redis, cacheKey, svc.renderLockTTL())
+		switch {
+		case err != nil:
+			logging.Warn("Render lock unavailable; rendering without it", "key", cacheKey, "error", err)
+		case acquired:
+			defer releaseRenderLock(svc.Redis, cacheKey, token)
+		default:
+			cached, err := waitForCachedPDF(svc.Redis, svc.Cache, cacheKey, svc.renderLockWait())
+			if err == nil && cached != nil {
+				logging.Info("PDF rendered by another replica", "key", cacheKey)
+				return &renderResult{Entry: cached}, nil
+			}
+			logging.Warn("No result from render lock holder; rendering locally", "key", cacheKey, "error", err)
+		}
+	}
+
+	pdfBuf, timing, err := render()
+	if err != nil {
+		return nil, err
+	}
+	if len(pdfBuf) > svc.Config.Limits.MaxPDFBytes {
+		return nil, errPDFTooLarge
+	}
+
+	if !cacheEnabled {
+		entry := newCachedPDF(pdfBuf, 0)
+		entry.Meta.OriginalSize = timing.OriginalSize
+		return &renderResult{Entry: entry, Timing: &timing}, nil
+	}
+
+	ttl := write.TTL
+	if ttl <= 0 {
+		ttl = svc.Config.Cache.PDFCacheTTL
+	}
+	ttl = cacheTTL(ttl)
+
+	entry := newCachedPDF(pdfBuf, ttl)
+	entry.Meta.OriginalSize = timing.OriginalSize
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	storeCachedPDF(ctx, svc.Cache, cacheKey, entry, ttl, write.Tags...)
+	cancel()
+	return &renderResult{Entry: entry, Timing: &timing}, nil
+}
+
+// useRenderLock reports whether renders coordinate across replicas. Waiting for another
+// replica only helps if its result lands in a cache this replica can read.
+func (svc *PDFService) useRenderLock() bool {
+	return svc.cacheEnabled() && svc.Redis != nil && svc.Cache.Shared() && svc.Config.Cache.RenderLockEnabled
+}
+
+// renderLockTTL is the lock lease. It must outlive a render so the lock does not expire while
+// the holder is still working; the lease also bounds how long a crashed holder blocks others.
+func (svc *PDFService) renderLockTTL() time.Duration {
+	if svc.Config.Cache.RenderLockTTL > 0 {
+		return svc.Config.Cache.RenderLockTTL
+	}
+	return time.Duration(svc.Config.PDF.TimeoutSecs)*time.Second + 10*time.Second
+}
+
+// renderLockWait is how long followers wait for the lock holder's result.
+func (svc *PDFService) renderLockWait() time.Duration {
+	if svc.Config.Cache.RenderLockWait > 0 {
+		return svc.Config.Cache.RenderLockWait
+	}
+	return time.Duration(svc.Config.PDF.TimeoutSecs) * time.Second
+}
+
+// acquireRenderLock tries to take the lock for cacheKey. It returns the owner token on success.
+func acquireRenderLock(rdb *redis.Client, cacheKey string, ttl time.Duration) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	token := xid.New().String()
+	ok, err := rdb.SetNX(ctx, renderLockPrefix+cacheKey, token, ttl).Result()
+	if err != nil {
+		return "", false, err
+	}
+	return token, ok, nil
+}
+
+// releaseRenderLock releases the lock if token still owns it.
+func releaseRenderLock(rdb *redis.Client, cacheKey, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	if err := releaseLockScript.Run(ctx, rdb, []string{renderLockPrefix + cacheKey}, token).Err(); err != nil {
+		logging.Warn("Render lock release failed", "key", cacheKey, "error", err)
+	}
+}
+
+// waitForCachedPDF polls the cache until the lock holder published the PDF. It returns
+// (nil, nil) when the lock disappears without a cached result (the holder failed).
+// Polling reads only the metadata so it doesn't skew the cache's hit/miss counters.
+func waitForCachedPDF(rdb *redis.Client, pc cache.PDFCache, cacheKey string, wait time.Duration) (*cache.Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		meta, err := pc.GetMeta(ctx, cacheKey)
+		if err != nil {
+			return nil, err
+		}
+		if meta != nil {
+			return readCachedPDF(ctx, pc, cacheKey)
+		}
+
+		held, err := rdb.Exists(ctx, renderLockPrefix+cacheKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		if held == 0 {
+			// Lock released or expired; the holder may have cached right before releasing.
+			cached, err := readCachedPDF(ctx, pc, cacheKey)
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				return nil, err
+			}
+			return cached, nil
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/config"
+)
+
+func newLockTestService(t *testing.T) (*PDFService, *miniredis.Miniredis) {
+	t.Helper()
+	return newRedisTestService(t, func(cfg *config.Config) {
+		cfg.Cache.RenderLockEnabled = true
+		cfg.Cache.RenderLockTTL = 5 * time.Second
+		cfg.Cache.RenderLockWait = 500 * time.Millisecond
+	})
+}
+
+func TestRenderShared_DedupesConcurrentRenders(t *testing.T) {
+	svc, srv := newLockTestService(t)
+
+	var renders atomic.Int32
+	render := func() ([]byte, renderTiming, error) {
+		renders.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return []byte("%PDF-1.4 shared"), renderTiming{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf, err := svc.renderShared("pdfcache:same", cacheWrite{}, render)
+			assert.NoError(t, err)
+			assert.Equal(t, "%PDF-1.4 shared", string(buf.Data))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), renders.Load())
+
+	cached, err := srv.Get("pdfcache:same")
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 shared", cached)
+	assert.False(t, srv.Exists(renderLockPrefix+"pdfcache:same"), "lock must be released")
+}
+
+func TestRenderShared_WaitsForOtherReplica(t *testing.T) {
+	svc, srv := newLockTestService(t)
+
+	// Another replica holds the lock and publishes its result shortly after.
+	require.NoError(t, srv.Set(renderLockPrefix+"pdfcache:k", "other-replica"))
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		_ = srv.Set("pdfcache:k", "%PDF-1.4 remote")
+		srv.Del(renderLockPrefix + "pdfcache:k")
+	}()
+
+	buf, err := svc.renderShared("pdfcache:k", cacheWrite{}, func() ([]byte, renderTiming, error) {
+		t.Error("render must not run while another replica holds the lock")
+		return nil, renderTiming{}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 remote", string(buf.Data))
+	assert.Nil(t, buf.Timing, "not rendered here")
+}
+
+func TestRenderShared_FallsBackWhenLockHolderStalls(t *testing.T) {
+	svc, srv := newLockTestService(t)
+	require.NoError(t, srv.Set(renderLockPrefix+"pdfcache:k", "stuck-replica"))
+
+	start := time.Now()
+	buf, err := svc.renderShared("pdfcache:k", cacheWrite{}, func() ([]byte, renderTiming, error) {
+		return []byte("%PDF-1.4 local"), renderTiming{Render: time.Second}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 local", string(buf.Data))
+	require.NotNil(t, buf.Timing)
+	assert.Equal(t, time.Second, buf.Timing.Render)
+	assert.GreaterOrEqual(t, time.Since(start), svc.Config.Cache.RenderLockWait)
+
+	// The foreign lock is left alone.
+	owner, err := srv.Get(renderLockPrefix + "pdfcache:k")
+	require.NoError(t, err)
+	assert.Equal(t, "stuck-replica", owner)
+}
+
+func TestRenderShared_RejectsOversizedPDF(t *testing.T) {
+	svc, srv := newLockTestService(t)
+	svc.Config.Limits.MaxPDFBytes = 4
+
+	_, err := svc.renderShared("pdfcache:big", cacheWrite{}, func() ([]byte, renderTiming, error) {
+		return []byte("%PDF-1.4 too large"), renderTiming{}, nil
+	})
+	assert.ErrorIs(t, err, errPDFTooLarge)
+	assert.False(t, srv.Exists("pdfcache:big"), "oversized PDFs must not be cached")
+}
+
+func TestRenderShared_KeepsOriginalSize(t *testing.T) {
+	svc, _ := newLockTestService(t)
+
+	result, err := svc.renderShared("pdfcache:optimized", cacheWrite{}, func() ([]byte, renderTiming, error) {
+		return []byte("%PDF-1.4 small"), renderTiming{OriginalSize: 4096}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4096, result.Meta.OriginalSize)
+
+	cached, err := readCachedPDF(context.Background(), svc.Cache, "pdfcache:optimized")
+	require.NoError(t, err)
+	require.NotNil(t, cached)
+	assert.Equal(t, 4096, cached.Meta.OriginalSize, "cache hits report it too")
+}
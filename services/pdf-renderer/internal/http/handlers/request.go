@@ -0,0 +1,939 @@
+package handlers
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/pdf"
+)
+
+// PDFRequestVersion is the current /v1 request schema version.
+const PDFRequestVersion = "1"
+
+// Wait strategies (PDFRequestV1.Wait.Strategy).
+const (
+	waitAuto     = "auto"     // readyState, window.__HTML2PDF_READY__, fonts and images (v0 behavior)
+	waitLoad     = "load"     // document.readyState == "complete" only
+	waitSelector = "selector" // until Wait.Selector is visible
+)
+
+const (
+	defaultWaitTimeout = 15 * time.Second
+	maxWaitDelay       = 10 * time.Second
+	maxViewportPixels  = 10000
+	maxMetadataLength  = 1000 // characters per document information field
+	maxPasswordBytes   = 127  // AES-256 security handlers use the first 127 bytes only
+
+	maxWatermarkText       = 200 // characters
+	maxWatermarkImageBytes = 1 << 20
+	defaultWatermarkFont   = 48 // points
+	defaultWatermarkColor  = "#808080"
+	defaultWatermarkAlpha  = 0.5
+	defaultWatermarkAngle  = 45 // degrees, text only; images are upright by default
+	defaultWatermarkScale  = 0.5
+
+	defaultSignatureBoxWidth  = 200 // points
+	defaultSignatureBoxHeight = 50  // points
+
+	maxAttachments        = 10
+	maxAttachmentBytes    = 2 << 20 // in total, including a Factur-X invoice
+	maxAttachmentFilename = 255     // bytes
+)
+
+var (
+	filenamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+	colorPattern    = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+	// attachmentRelationships maps the relationship values of the API onto AFRelationship names.
+	attachmentRelationships = map[string]string{
+		"source":      pdf.RelationshipSource,
+		"data":        pdf.RelationshipData,
+		"alternative": pdf.RelationshipAlternative,
+		"supplement":  pdf.RelationshipSupplement,
+		"unspecified": pdf.RelationshipUnspecified,
+	}
+)
+
+// PDFRequestV1 is the JSON body of POST /v1/pdf. v0 form and query requests are mapped onto the
+// same structure, so both versions share one validator (validatePDFRequest).
+type PDFRequestV1 struct {
+	Version string `json:"version,omitempty"` // schema version; empty means the current one
+
+	Source struct {
+		HTML string `json:"html,omitempty"`
+		URL  string `json:"url,omitempty"`
+	} `json:"source"`
+
+	Page struct {
+		Format      string      `json:"format,omitempty"`
+		Orientation string      `json:"orientation,omitempty"`
+		Margin      json.Number `json:"margin,omitempty"` // inches
+	} `json:"page"`
+
+	Wait struct {
+		Strategy  string `json:"strategy,omitempty"`
+		Selector  string `json:"selector,omitempty"`
+		DelayMS   int    `json:"delay_ms,omitempty"`   // extra wait after the strategy completed
+		TimeoutMS int    `json:"timeout_ms,omitempty"` // bound for the strategy (default 15000)
+	} `json:"wait"`
+
+	Emulation struct {
+		Media    string `json:"media,omitempty"` // "print" (default) or "screen"
+		Viewport *struct {
+			Width             int     `json:"width"`
+			Height            int     `json:"height"`
+			DeviceScaleFactor float64 `json:"device_scale_factor,omitempty"`
+		} `json:"viewport,omitempty"`
+	} `json:"emulation"`
+
+	Output struct {
+		Type     string `json:"type,omitempty"` // "pdf" (default), "storage" or "png"
+		Filename string `json:"filename,omitempty"`
+		CacheTTL string `json:"cache_ttl,omitempty"`
+		DryRun   bool   `json:"dry_run,omitempty"` // render, but return only the metadata headers
+		PDFA     string `json:"pdfa,omitempty"`    // PDF/A conformance level: "2b", "3b" or empty
+		Split    string `json:"split,omitempty"`   // "per_page", "every:N" or "ranges:1-2,3-5"
+
+		Outline      bool `json:"outline,omitempty"`       // document outline from the headings
+		OutlineDepth int  `json:"outline_depth,omitempty"` // heading levels in the outline (1-6)
+		Tagged       bool `json:"tagged,omitempty"`        // tagged (accessible) PDF
+
+		InteractiveForms bool `json:"interactive_forms,omitempty"` // HTML form controls become AcroForm fields
+
+		DPI   int    `json:"dpi,omitempty"`   // resolution of the PNG images (type "png")
+		Pages string `json:"pages,omitempty"` // pages rasterized, e.g. "1-3,5"; all if empty (type "png")
+	} `json:"output"`
+
+	Metadata struct {
+		Title    string `json:"title,omitempty"`
+		Author   string `json:"author,omitempty"`
+		Subject  string `json:"subject,omitempty"`
+		Keywords string `json:"keywords,omitempty"`
+		Creator  string `json:"creator,omitempty"`
+		XMP      bool   `json:"xmp,omitempty"` // also write an XMP metadata stream
+	} `json:"metadata"`
+
+	Encryption struct {
+		UserPassword  string   `json:"user_password,omitempty"`
+		OwnerPassword string   `json:"owner_password,omitempty"`
+		Permissions   []string `json:"permissions,omitempty"` // granted with the user password
+	} `json:"encryption"`
+
+	// Watermark is either text or an image (base64 in JSON), stamped over the rendered pages.
+	Watermark struct {
+		Text     string      `json:"text,omitempty"`
+		FontSize json.Number `json:"font_size,omitempty"` // points
+		Color    string      `json:"color,omitempty"`     // #RRGGBB
+		Image    []byte      `json:"image,omitempty"`     // PNG or JPEG
+		Scale    json.Number `json:"scale,omitempty"`     // image width relative to the page width
+		Opacity  json.Number `json:"opacity,omitempty"`
+		Rotation json.Number `json:"rotation,omitempty"` // degrees counterclockwise
+		Position string      `json:"position,omitempty"`
+		Pages    string      `json:"pages,omitempty"` // e.g. "1-3,5"; all pages if empty
+	} `json:"watermark"`
+
+	// Signature signs the PDF with a configured signing profile; present (even empty) to sign.
+	Signature *SignatureV1 `json:"signature,omitempty"`
+
+	Optimize struct {
+		Linearize   bool `json:"linearize,omitempty"`   // fast web view
+		Compress    bool `json:"compress,omitempty"`    // object streams and Flate-encoded streams
+		Deduplicate bool `json:"deduplicate,omitempty"` // one copy of identical fonts and images
+		ImageDPI    int  `json:"image_dpi,omitempty"`   // downsample images above this resolution
+	} `json:"optimize"`
+
+	// Attachments are embedded into the PDF as associated files.
+	Attachments []AttachmentV1 `json:"attachments,omitempty"`
+
+	// FacturX embeds a Factur-X (ZUGFeRD) invoice; it implies output.pdfa "3b".
+	FacturX *FacturXV1 `json:"facturx,omitempty"`
+
+	// fill replaces the source for POST /v0/pdf/fill, which has no JSON counterpart.
+	fill *fillRequest
+}
+
+// AttachmentV1 is a file embedded into the PDF.
+type AttachmentV1 struct {
+	Filename     string `json:"filename"`
+	Content      []byte `json:"content"`                // base64 in JSON
+	MIMEType     string `json:"mime_type,omitempty"`    // default: from the filename extension
+	Description  string `json:"description,omitempty"`  // shown by viewers
+	Relationship string `json:"relationship,omitempty"` // key of attachmentRelationships; default "unspecified"
+}
+
+// FacturXV1 is the facturx section of PDFRequestV1.
+type FacturXV1 struct {
+	XML []byte `json:"xml"` // the Cross Industry Invoice, base64 in JSON
+}
+
+// SignatureV1 is the signature section of PDFRequestV1.
+type SignatureV1 struct {
+	Profile     string `json:"profile,omitempty"` // default: the API key's profile
+	Reason      string `json:"reason,omitempty"`  // empty fields take the profile's defaults
+	Location    string `json:"location,omitempty"`
+	ContactInfo string `json:"contact_info,omitempty"`
+
+	// Box makes the signature visible; without it the signature is invisible.
+	Box *SignatureBoxV1 `json:"box,omitempty"`
+}
+
+// SignatureBoxV1 places a visible signature.
+type SignatureBoxV1 struct {
+	Page     int         `json:"page,omitempty"` // default: the last page
+	Position string      `json:"position,omitempty"`
+	Width    json.Number `json:"width,omitempty"` // points
+	Height   json.Number `json:"height,omitempty"`
+}
+
+// WaitOptions controls when the page is considered ready for printing.
+type WaitOptions struct {
+	Strategy string
+	Selector string
+	Delay    time.Duration
+	Timeout  time.Duration
+}
+
+// EmulationOptions controls media type and viewport during rendering.
+type EmulationOptions struct {
+	Media             string
+	ViewportWidth     int64
+	ViewportHeight    int64
+	DeviceScaleFactor float64
+}
+
+// fieldErrors collects the field errors of one request.
+type fieldErrors []domain.FieldError
+
+func (fe *fieldErrors) add(field string, code domain.Code, msg string) {
+	*fe = append(*fe, domain.FieldError{Field: field, Code: code, Message: msg})
+}
+
+// addError records a *domain.Error returned by a shared parser (cache_ttl, output).
+func (fe *fieldErrors) addError(field string, err error) {
+	code, msg := domain.CodeInvalidRequest, err.Error()
+	var de *domain.Error
+	if errors.As(err, &de) {
+		code, msg = de.Code, de.Message
+	}
+	fe.add(field, code, msg)
+}
+
+// validatePDFRequest validates req and converts it into the internal model. All field errors are
+// collected; the error is a *domain.ValidationError unless the server itself is misconfigured.
+func validatePDFRequest(req *PDFRequestV1, cfg config.Config) (*PDFRequestParams, error) {
+	var errs fieldErrors
+	params := &PDFRequestParams{}
+
+	if req.Version != "" && req.Version != PDFRequestVersion {
+		errs.add("version", domain.CodeUnsupportedVersion, fmt.Sprintf("Unsupported schema version %q (current: %q)", req.Version, PDFRequestVersion))
+	}
+
+	// Source: exactly one of html or url, unless a form is filled.
+	switch src := req.Source; {
+	case req.fill != nil:
+		validateFill(req, cfg, params, &errs)
+	case src.URL != "" && src.HTML != "":
+		errs.add("source", domain.CodeInvalidSource, "Invalid source: set either html or url, not both")
+	case src.URL != "":
+		parsed, err := neturl.ParseRequestURI(src.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			errs.add("source.url", domain.CodeInvalidURL, "Invalid URL: must be HTTP or HTTPS")
+		}
+		params.URL = src.URL
+	default:
+		if len(src.HTML) < 10 {
+			errs.add("source.html", domain.CodeInvalidHTML, "Invalid HTML: content too short or missing")
+		} else if len(src.HTML) > cfg.Limits.MaxHTMLBytes {
+			errs.add("source.html", domain.CodeHTMLTooLarge, fmt.Sprintf("HTML input exceeds %d bytes", cfg.Limits.MaxHTMLBytes))
+		}
+		params.HTML = src.HTML
+	}
+
+	// Page
+	params.Format = strings.ToUpper(req.Page.Format)
+	if params.Format != "" {
+		if _, ok := cfg.PDF.PaperSizes[params.Format]; !ok {
+			errs.add("page.format", domain.CodeInvalidFormat, "Invalid format: not supported")
+		}
+	}
+
+	params.Orientation = strings.ToLower(req.Page.Orientation)
+	if params.Orientation != "" && params.Orientation != "portrait" && params.Orientation != "landscape" {
+		errs.add("page.orientation", domain.CodeInvalidOrientation, "Invalid orientation: must be 'portrait' or 'landscape'")
+	}
+
+	params.Margin = 0.4
+	if req.Page.Margin != "" {
+		m, err := strconv.ParseFloat(string(req.Page.Margin), 64)
+		if err != nil || m < 0.1 || m > 2.0 {
+			errs.add("page.margin", domain.CodeInvalidMargin, "Invalid margin: must be a float between 0.1 and 2.0")
+		}
+		params.Margin = m
+	}
+
+	// Output
+	params.Filename = req.Output.Filename
+	if params.Filename == "" {
+		params.Filename = "output.pdf"
+	} else if !strings.HasSuffix(params.Filename, ".pdf") {
+		errs.add("output.filename", domain.CodeInvalidFilename, "Filename must end with .pdf")
+	} else if !filenamePattern.MatchString(params.Filename) {
+		errs.add("output.filename", domain.CodeInvalidFilename, "Filename contains invalid characters")
+	}
+
+	if ttl, err := parseCacheTTL(req.Output.CacheTTL, cfg); err != nil {
+		errs.addError("output.cache_ttl", err)
+	} else {
+		params.CacheTTL = ttl
+	}
+
+	if output, err := parseOutput(req.Output.Type); err != nil {
+		errs.addError("output.type", err)
+	} else {
+		params.Output = output
+	}
+	params.DryRun = req.Output.DryRun
+
+	switch pdfa := strings.ToLower(strings.TrimSpace(req.Output.PDFA)); pdfa {
+	case "", pdf.PDFA2B, pdf.PDFA3B:
+		params.PDFA = pdfa
+	default:
+		errs.add("output.pdfa", domain.CodeInvalidPDFA, "Invalid pdfa: must be '2b' or '3b'")
+	}
+	// The Factur-X preset implies PDF/A-3b, so the PDF/A checks below apply to it.
+	if req.FacturX != nil && params.PDFA == "" {
+		params.PDFA = pdf.PDFA3B
+	}
+
+	// Wait and emulation (v1 only; zero values keep the v0 behavior).
+	validateWait(req, cfg, params, &errs)
+	validateEmulation(req, params, &errs)
+	validateMetadata(req, params, &errs)
+	validateEncryption(req, params, &errs)
+	validateWatermark(req, params, &errs)
+	validateSignature(req, cfg, params, &errs)
+	validateOptimize(req, params, &errs)
+	validateSplit(req, params, &errs)
+	validatePreview(req, params, &errs)
+	validateOutline(req, params, &errs)
+	validateInteractiveForms(req, params, &errs)
+	validateAttachments(req, params, &errs)
+
+	if len(errs) > 0 {
+		return nil, &domain.ValidationError{Fields: errs}
+	}
+
+	paper, ok := cfg.PDF.PaperSizes[params.Format]
+	if !ok {
+		paper, ok = cfg.PDF.PaperSizes[cfg.PDF.DefaultPaper]
+		if !ok {
+			return nil, domain.NewError(domain.CodeInternal, "Default paper size not configured")
+		}
+	}
+	if params.Orientation == "landscape" {
+		paper.Width, paper.Height = paper.Height, paper.Width
+	}
+	params.Paper = paper
+
+	return params, nil
+}
+
+func validateWait(req *PDFRequestV1, cfg config.Config, params *PDFRequestParams, errs *fieldErrors) {
+	w := req.Wait
+	params.Wait.Strategy = strings.ToLower(w.Strategy)
+	switch params.Wait.Strategy {
+	case "":
+		params.Wait.Strategy = waitAuto
+	case waitAuto, waitLoad:
+	case waitSelector:
+		if strings.TrimSpace(w.Selector) == "" {
+			errs.add("wait.selector", domain.CodeInvalidWait, "Invalid wait: selector is required for strategy 'selector'")
+		}
+	default:
+		errs.add("wait.strategy", domain.CodeInvalidWait, "Invalid wait: strategy must be 'auto', 'load' or 'selector'")
+	}
+	if w.Selector != "" && params.Wait.Strategy != waitSelector {
+		errs.add("wait.selector", domain.CodeInvalidWait, "Invalid wait: selector requires strategy 'selector'")
+	}
+	params.Wait.Selector = w.Selector
+
+	if w.DelayMS < 0 || time.Duration(w.DelayMS)*time.Millisecond > maxWaitDelay {
+		errs.add("wait.delay_ms", domain.CodeInvalidWait, fmt.Sprintf("Invalid wait: delay_ms must be between 0 and %d", maxWaitDelay.Milliseconds()))
+	}
+	params.Wait.Delay = time.Duration(w.DelayMS) * time.Millisecond
+
+	maxTimeout := time.Duration(cfg.PDF.TimeoutSecs) * time.Second
+	params.Wait.Timeout = defaultWaitTimeout
+	if w.TimeoutMS != 0 {
+		params.Wait.Timeout = time.Duration(w.TimeoutMS) * time.Millisecond
+		if w.TimeoutMS < 0 || (maxTimeout > 0 && params.Wait.Timeout > maxTimeout) {
+			errs.add("wait.timeout_ms", domain.CodeInvalidWait, fmt.Sprintf("Invalid wait: timeout_ms must be between 1 and %d", maxTimeout.Milliseconds()))
+		}
+	}
+}
+
+func validateEmulation(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	e := req.Emulation
+	params.Emulation.Media = strings.ToLower(e.Media)
+	if params.Emulation.Media != "" && params.Emulation.Media != "print" && params.Emulation.Media != "screen" {
+		errs.add("emulation.media", domain.CodeInvalidEmulation, "Invalid emulation: media must be 'print' or 'screen'")
+	}
+
+	if vp := e.Viewport; vp != nil {
+		if vp.Width < 1 || vp.Width > maxViewportPixels {
+			errs.add("emulation.viewport.width", domain.CodeInvalidEmulation, fmt.Sprintf("Invalid viewport: width must be between 1 and %d", maxViewportPixels))
+		}
+		if vp.Height < 1 || vp.Height > maxViewportPixels {
+			errs.add("emulation.viewport.height", domain.CodeInvalidEmulation, fmt.Sprintf("Invalid viewport: height must be between 1 and %d", maxViewportPixels))
+		}
+		if vp.DeviceScaleFactor != 0 && (vp.DeviceScaleFactor < 0.5 || vp.DeviceScaleFactor > 4) {
+			errs.add("emulation.viewport.device_scale_factor", domain.CodeInvalidEmulation, "Invalid viewport: device_scale_factor must be between 0.5 and 4")
+		}
+		params.Emulation.ViewportWidth = int64(vp.Width)
+		params.Emulation.ViewportHeight = int64(vp.Height)
+		params.Emulation.DeviceScaleFactor = vp.DeviceScaleFactor
+	}
+}
+
+func validateMetadata(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	m := req.Metadata
+	for _, f := range []struct{ name, value string }{
+		{"title", m.Title}, {"author", m.Author}, {"subject", m.Subject}, {"keywords", m.Keywords}, {"creator", m.Creator},
+	} {
+		if utf8.RuneCountInString(f.value) > maxMetadataLength {
+			errs.add("metadata."+f.name, domain.CodeInvalidMetadata, fmt.Sprintf("Invalid metadata: %s exceeds %d characters", f.name, maxMetadataLength))
+		} else if !utf8.ValidString(f.value) {
+			errs.add("metadata."+f.name, domain.CodeInvalidMetadata, fmt.Sprintf("Invalid metadata: %s is not valid UTF-8", f.name))
+		}
+	}
+	params.Metadata = pdf.Metadata{
+		Title:    m.Title,
+		Author:   m.Author,
+		Subject:  m.Subject,
+		Keywords: m.Keywords,
+		Creator:  m.Creator,
+		XMP:      m.XMP,
+	}
+}
+
+func validateEncryption(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	e := req.Encryption
+	for _, f := range []struct{ name, value string }{{"user_password", e.UserPassword}, {"owner_password", e.OwnerPassword}} {
+		if len(f.value) > maxPasswordBytes {
+			errs.add("encryption."+f.name, domain.CodeInvalidEncryption, fmt.Sprintf("Invalid encryption: %s exceeds %d bytes", f.name, maxPasswordBytes))
+		} else if !utf8.ValidString(f.value) {
+			errs.add("encryption."+f.name, domain.CodeInvalidEncryption, fmt.Sprintf("Invalid encryption: %s is not valid UTF-8", f.name))
+		}
+	}
+	permissions := make([]string, 0, len(e.Permissions))
+	for _, p := range e.Permissions {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if !pdf.ValidPermission(p) {
+			errs.add("encryption.permissions", domain.CodeInvalidEncryption, "Invalid encryption: permissions must be 'print', 'copy', 'modify' or 'annotate'")
+			continue
+		}
+		permissions = append(permissions, p)
+	}
+	params.Encryption = pdf.Encryption{UserPassword: e.UserPassword, OwnerPassword: e.OwnerPassword, Permissions: permissions}
+
+	if e.UserPassword == "" && e.OwnerPassword == "" && len(e.Permissions) == 0 {
+		return
+	}
+	if e.UserPassword == "" && e.OwnerPassword == "" {
+		errs.add("encryption", domain.CodeInvalidEncryption, "Invalid encryption: a user or owner password is required")
+	}
+	if params.PDFA != "" {
+		errs.add("encryption", domain.CodeInvalidEncryption, "Invalid encryption: PDF/A documents cannot be encrypted")
+	}
+}
+
+func validateWatermark(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	w := req.Watermark
+	if w.Text == "" && w.Image == nil && w.FontSize == "" && w.Color == "" && w.Scale == "" &&
+		w.Opacity == "" && w.Rotation == "" && w.Position == "" && w.Pages == "" {
+		return
+	}
+	invalid := func(field, msg string) {
+		errs.add("watermark"+field, domain.CodeInvalidWatermark, "Invalid watermark: "+msg)
+	}
+	// number parses an optional numeric field, reporting values outside [min, max].
+	number := func(field string, raw json.Number, def, min, max float64) float64 {
+		if raw == "" {
+			return def
+		}
+		v, err := strconv.ParseFloat(string(raw), 64)
+		if err != nil || v < min || v > max {
+			invalid("."+field, fmt.Sprintf("%s must be a number between %g and %g", field, min, max))
+		}
+		return v
+	}
+
+	wm := &pdf.Watermark{
+		Text:     w.Text,
+		Image:    w.Image,
+		Opacity:  number("opacity", w.Opacity, defaultWatermarkAlpha, 0.01, 1),
+		Position: strings.ToLower(strings.TrimSpace(w.Position)),
+		Pages:    strings.TrimSpace(w.Pages),
+	}
+	switch {
+	case w.Text != "" && w.Image != nil:
+		invalid("", "set either text or image, not both")
+	case w.Text != "":
+		if utf8.RuneCountInString(w.Text) > maxWatermarkText {
+			invalid(".text", fmt.Sprintf("text exceeds %d characters", maxWatermarkText))
+		} else if !utf8.ValidString(w.Text) {
+			invalid(".text", "text is not valid UTF-8")
+		}
+		wm.FontSize = int(number("font_size", w.FontSize, defaultWatermarkFont, 6, 200))
+		wm.Color = defaultWatermarkColor
+		if w.Color != "" {
+			if !colorPattern.MatchString(w.Color) {
+				invalid(".color", "color must be #RRGGBB")
+			}
+			wm.Color = w.Color
+		}
+		wm.Rotation = number("rotation", w.Rotation, defaultWatermarkAngle, -180, 180)
+		if w.Scale != "" {
+			invalid(".scale", "scale applies to image watermarks only")
+		}
+		if params.PDFA != "" {
+			invalid(".text", "text watermarks use a font that is not embedded, which PDF/A forbids; use an image")
+		}
+	case w.Image != nil:
+		if len(w.Image) > maxWatermarkImageBytes {
+			invalid(".image", fmt.Sprintf("image exceeds %d bytes", maxWatermarkImageBytes))
+		} else if t := http.DetectContentType(w.Image); t != "image/png" && t != "image/jpeg" {
+			invalid(".image", "image must be a PNG or JPEG")
+		}
+		wm.Scale = number("scale", w.Scale, defaultWatermarkScale, 0.01, 1)
+		wm.Rotation = number("rotation", w.Rotation, 0, -180, 180)
+		if w.FontSize != "" || w.Color != "" {
+			invalid("", "font_size and color apply to text watermarks only")
+		}
+	default:
+		invalid("", "text or image is required")
+	}
+	if wm.Position == "" {
+		wm.Position = pdf.PositionCenter
+	} else if !pdf.ValidPosition(wm.Position) {
+		invalid(".position", "position must be 'center', 'top-left', 'top-right', 'bottom-left', 'bottom-right' or 'tiled'")
+	}
+	if wm.Pages != "" && !pdf.ValidPageRange(wm.Pages) {
+		invalid(".pages", "pages must be page numbers or ranges such as '1-3,5'")
+	}
+	params.Watermark = wm
+}
+
+// validateSignature checks the signature fields. The profile is resolved per API key later, by
+// resolveSignature.
+func validateSignature(req *PDFRequestV1, cfg config.Config, params *PDFRequestParams, errs *fieldErrors) {
+	s := req.Signature
+	if s == nil {
+		return
+	}
+	invalid := func(field, msg string) {
+		errs.add("signature"+field, domain.CodeInvalidSignature, "Invalid signature: "+msg)
+	}
+
+	if s.Profile != "" {
+		if _, ok := cfg.Signing.Profiles[s.Profile]; !ok {
+			invalid(".profile", "unknown signing profile")
+		}
+	}
+	for _, f := range []struct{ name, value string }{{"reason", s.Reason}, {"location", s.Location}, {"contact_info", s.ContactInfo}} {
+		if utf8.RuneCountInString(f.value) > maxMetadataLength {
+			invalid("."+f.name, fmt.Sprintf("%s exceeds %d characters", f.name, maxMetadataLength))
+		} else if !utf8.ValidString(f.value) {
+			invalid("."+f.name, fmt.Sprintf("%s is not valid UTF-8", f.name))
+		}
+	}
+	sig := &pdf.Signature{Reason: s.Reason, Location: s.Location, ContactInfo: s.ContactInfo}
+
+	if b := s.Box; b != nil {
+		// size parses an optional box dimension, reporting values outside [min, max].
+		size := func(field string, raw json.Number, def, min, max float64) float64 {
+			if raw == "" {
+				return def
+			}
+			v, err := strconv.ParseFloat(string(raw), 64)
+			if err != nil || v < min || v > max {
+				invalid(".box."+field, fmt.Sprintf("%s must be a number between %g and %g", field, min, max))
+			}
+			return v
+		}
+		sig.Box = &pdf.SignatureBox{
+			Page:     b.Page,
+			Position: strings.ToLower(strings.TrimSpace(b.Position)),
+			Width:    size("width", b.Width, defaultSignatureBoxWidth, 50, 600),
+			Height:   size("height", b.Height, defaultSignatureBoxHeight, 20, 300),
+		}
+		if b.Page < 0 {
+			invalid(".box.page", "page must be a positive page number")
+		}
+		if sig.Box.Position == "" {
+			sig.Box.Position = pdf.PositionBottomRight
+		} else if !pdf.ValidSignatureBoxPosition(sig.Box.Position) {
+			invalid(".box.position", "position must be 'center', 'top-left', 'top-right', 'bottom-left' or 'bottom-right'")
+		}
+		if params.PDFA != "" {
+			invalid(".box", "visible signatures use a font that is not embedded, which PDF/A forbids; sign invisibly")
+		}
+	}
+	if !params.Encryption.IsZero() {
+		invalid("", "signed documents cannot be encrypted: encrypting would invalidate the signature")
+	}
+	params.SignatureProfile = s.Profile
+	params.Signature = sig
+}
+
+func validateOptimize(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	o := req.Optimize
+	invalid := func(field, msg string) {
+		errs.add("optimize"+field, domain.CodeInvalidOptimization, "Invalid optimize: "+msg)
+	}
+	if o.ImageDPI != 0 && (o.ImageDPI < pdf.MinImageDPI || o.ImageDPI > pdf.MaxImageDPI) {
+		invalid(".image_dpi", fmt.Sprintf("image_dpi must be between %d and %d", pdf.MinImageDPI, pdf.MaxImageDPI))
+	}
+	if o.Linearize && o.Compress {
+		invalid("", "linearized documents cannot use object streams; set either linearize or compress")
+	}
+	if o.Linearize && !params.Encryption.IsZero() {
+		invalid(".linearize", "encrypted documents cannot be linearized")
+	}
+	if o.Compress && params.Signature != nil {
+		invalid(".compress", "signed documents cannot use object streams")
+	}
+	params.Optimize = pdf.Optimization{Linearize: o.Linearize, Compress: o.Compress, Deduplicate: o.Deduplicate, ImageDPI: o.ImageDPI}
+}
+
+func validateSplit(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	if req.Output.Split == "" {
+		return
+	}
+	invalid := func(msg string) {
+		errs.add("output.split", domain.CodeInvalidSplit, "Invalid split: "+msg)
+	}
+	split, err := pdf.ParseSplit(req.Output.Split)
+	switch {
+	case err != nil:
+		invalid("must be 'per_page', 'every:N' or 'ranges:1-2,3-5'")
+	case len(split.Ranges) > maxSplitParts:
+		invalid(fmt.Sprintf("at most %d ranges", maxSplitParts))
+	case params.Output == outputStorage:
+		invalid("split archives cannot be uploaded; use output 'pdf'")
+	case params.Signature != nil:
+		invalid("signed documents cannot be split")
+	}
+	params.Split = split
+}
+
+// validatePreview checks the dpi and pages of output=png, which are rasterized from the PDF for
+// each response.
+func validatePreview(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	o := req.Output
+	invalid := func(field, msg string) {
+		errs.add("output"+field, domain.CodeInvalidPreview, "Invalid preview: "+msg)
+	}
+	if params.Output != outputPNG {
+		if o.DPI != 0 || o.Pages != "" {
+			invalid(".type", "dpi and pages apply to output 'png'")
+		}
+		return
+	}
+	if o.DPI != 0 && (o.DPI < minPreviewDPI || o.DPI > maxPreviewDPI) {
+		invalid(".dpi", fmt.Sprintf("dpi must be between %d and %d", minPreviewDPI, maxPreviewDPI))
+	}
+	if o.Pages != "" && !pdf.ValidPageRange(o.Pages) {
+		invalid(".pages", "pages must be a page range such as '1-3,5'")
+	}
+	if !params.Split.IsZero() {
+		invalid(".type", "output 'png' returns one image per page; remove split")
+	}
+	if !params.Encryption.IsZero() {
+		invalid(".type", "images cannot be encrypted; remove the passwords")
+	}
+	params.PreviewDPI = cmp.Or(o.DPI, defaultPreviewDPI)
+	params.PreviewPages = strings.TrimSpace(o.Pages)
+}
+
+func validateOutline(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	o := req.Output
+	switch {
+	case o.OutlineDepth != 0 && (o.OutlineDepth < 1 || o.OutlineDepth > pdf.MaxOutlineDepth):
+		errs.add("output.outline_depth", domain.CodeInvalidOutline, fmt.Sprintf("Invalid outline: outline_depth must be between 1 and %d", pdf.MaxOutlineDepth))
+	case o.OutlineDepth != 0 && !o.Outline:
+		errs.add("output.outline_depth", domain.CodeInvalidOutline, "Invalid outline: outline_depth requires outline")
+	}
+	if o.Outline {
+		params.OutlineDepth = cmp.Or(o.OutlineDepth, pdf.MaxOutlineDepth)
+	}
+	// Chrome builds the outline from the structure tree of a tagged PDF.
+	params.Tagged = o.Tagged || o.Outline
+}
+
+// validateInteractiveForms checks output.interactive_forms. The form controls are measured in a
+// layout at the paper's width, which a custom viewport would change.
+func validateInteractiveForms(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	if !req.Output.InteractiveForms || req.fill != nil {
+		return
+	}
+	invalid := func(msg string) {
+		errs.add("output.interactive_forms", domain.CodeInvalidForm, "Invalid form: "+msg)
+	}
+	if req.Emulation.Viewport != nil {
+		invalid("interactive_forms lays the page out at the paper's width; remove emulation.viewport")
+	}
+	if params.PDFA != "" {
+		invalid("form fields use a font that is not embedded, which PDF/A forbids")
+	}
+	params.InteractiveForms = true
+}
+
+func validateAttachments(req *PDFRequestV1, params *PDFRequestParams, errs *fieldErrors) {
+	if len(req.Attachments) == 0 && req.FacturX == nil {
+		return
+	}
+	invalid := func(field, msg string) {
+		errs.add(field, domain.CodeInvalidAttachment, "Invalid attachment: "+msg)
+	}
+
+	if len(req.Attachments) > maxAttachments {
+		invalid("attachments", fmt.Sprintf("at most %d attachments", maxAttachments))
+	}
+	total := 0
+	names := map[string]bool{}
+	for i, a := range req.Attachments {
+		field := fmt.Sprintf("attachments[%d]", i)
+		switch {
+		case a.Filename == "":
+			invalid(field+".filename", "filename is required")
+		case len(a.Filename) > maxAttachmentFilename || !filenamePattern.MatchString(a.Filename):
+			invalid(field+".filename", "filename contains invalid characters")
+		case names[a.Filename]:
+			invalid(field+".filename", "filenames must be unique")
+		}
+		names[a.Filename] = true
+		if len(a.Content) == 0 {
+			invalid(field+".content", "content is required")
+		}
+		total += len(a.Content)
+
+		mimeType := a.MIMEType
+		if mimeType == "" {
+			mimeType = mime.TypeByExtension(path.Ext(a.Filename))
+		}
+		if mimeType != "" {
+			mediaType, _, err := mime.ParseMediaType(mimeType)
+			if err != nil || !strings.Contains(mediaType, "/") {
+				invalid(field+".mime_type", "mime_type must be a media type such as 'text/csv'")
+			}
+			mimeType = mediaType
+		}
+		if utf8.RuneCountInString(a.Description) > maxMetadataLength {
+			invalid(field+".description", fmt.Sprintf("description exceeds %d characters", maxMetadataLength))
+		} else if !utf8.ValidString(a.Description) {
+			invalid(field+".description", "description is not valid UTF-8")
+		}
+		relationship := pdf.RelationshipUnspecified
+		if a.Relationship != "" {
+			var ok bool
+			if relationship, ok = attachmentRelationships[strings.ToLower(strings.TrimSpace(a.Relationship))]; !ok {
+				invalid(field+".relationship", "relationship must be 'source', 'data', 'alternative', 'supplement' or 'unspecified'")
+			}
+		}
+		params.Attachments = append(params.Attachments, pdf.Attachment{
+			Name:         a.Filename,
+			Data:         a.Content,
+			MIMEType:     mimeType,
+			Description:  a.Description,
+			Relationship: relationship,
+		})
+	}
+
+	if fx := req.FacturX; fx != nil {
+		total += len(fx.XML)
+		invoice, err := pdf.ParseFacturX(fx.XML)
+		switch {
+		case err != nil:
+			invalid("facturx.xml", "xml must be a Factur-X or ZUGFeRD invoice (CrossIndustryInvoice with a known guideline)")
+		case names[invoice.FileName()]:
+			invalid("facturx", fmt.Sprintf("an attachment is already named %q", invoice.FileName()))
+		case params.PDFA != pdf.PDFA3B:
+			invalid("facturx", "Factur-X invoices require pdfa '3b'")
+		}
+		params.FacturX = invoice
+	}
+	if total > maxAttachmentBytes {
+		invalid("attachments", fmt.Sprintf("attachments exceed %d bytes in total", maxAttachmentBytes))
+	}
+	if len(req.Attachments) > 0 && params.PDFA == pdf.PDFA2B {
+		invalid("attachments", "PDF/A-2 documents cannot embed files; use pdfa '3b'")
+	}
+	if !params.Split.IsZero() {
+		invalid("attachments", "split parts do not carry attachments; remove split")
+	}
+}
+
+// renderOptionsKey encodes the v1-only render options for the cache key. It is empty for the
+// defaults, so v0 requests keep their existing cache keys.
+func (p *PDFRequestParams) renderOptionsKey() string {
+	var b strings.Builder
+	if w := p.Wait; w.Strategy != "" && w.Strategy != waitAuto || w.Selector != "" || w.Delay > 0 || (w.Timeout != 0 && w.Timeout != defaultWaitTimeout) {
+		fmt.Fprintf(&b, "wait:%s|%s|%d|%d;", w.Strategy, w.Selector, w.Delay.Milliseconds(), w.Timeout.Milliseconds())
+	}
+	if e := p.Emulation; e != (EmulationOptions{}) {
+		fmt.Fprintf(&b, "emu:%s|%d|%d|%g;", e.Media, e.ViewportWidth, e.ViewportHeight, e.DeviceScaleFactor)
+	}
+	if m := p.Metadata; !m.IsZero() {
+		fmt.Fprintf(&b, "meta:%q|%q|%q|%q|%q|%t;", m.Title, m.Author, m.Subject, m.Keywords, m.Creator, m.XMP)
+	}
+	if p.PDFA != "" {
+		fmt.Fprintf(&b, "pdfa:%s;", p.PDFA)
+	}
+	if p.Tagged {
+		fmt.Fprintf(&b, "tagged:%d;", p.OutlineDepth)
+	}
+	if p.InteractiveForms {
+		b.WriteString("forms;")
+	}
+	if w := p.Watermark; !w.IsZero() {
+		fmt.Fprintf(&b, "wm:%q|%d|%s|%x|%g|%g|%g|%s|%s;", w.Text, w.FontSize, w.Color, sha256.Sum256(w.Image), w.Scale, w.Opacity, w.Rotation, w.Position, w.Pages)
+	}
+	for _, a := range p.Attachments {
+		fmt.Fprintf(&b, "att:%q|%x|%s|%q|%s;", a.Name, sha256.Sum256(a.Data), a.MIMEType, a.Description, a.Relationship)
+	}
+	if fx := p.FacturX; fx != nil {
+		fmt.Fprintf(&b, "fx:%x;", sha256.Sum256(fx.XML))
+	}
+	if f := p.Fill; f != nil {
+		fmt.Fprintf(&b, "fill:%x|%t", sha256.Sum256(f.PDF), f.Flatten)
+		for _, name := range slices.Sorted(maps.Keys(f.Values)) {
+			fmt.Fprintf(&b, "|%q=%q", name, f.Values[name])
+		}
+		b.WriteString(";")
+	}
+	if o := p.Optimize; !o.IsZero() {
+		fmt.Fprintf(&b, "opt:%t|%t|%t|%d;", o.Linearize, o.Compress, o.Deduplicate, o.ImageDPI)
+	}
+	if s := p.Signature; s != nil {
+		// The certificate is part of the key so a renewed one is never served from the cache.
+		var cert []byte
+		if s.Signer != nil {
+			cert = s.Signer.Certificate.Raw
+		}
+		fmt.Fprintf(&b, "sig:%s|%x|%q|%q|%q", p.SignatureProfile, sha256.Sum256(cert), s.Reason, s.Location, s.ContactInfo)
+		if box := s.Box; box != nil {
+			fmt.Fprintf(&b, "|%d|%s|%g|%g", box.Page, box.Position, box.Width, box.Height)
+		}
+		b.WriteString(";")
+	}
+	return b.String()
+}
+
+// v0Request maps v0 request values (form fields or query parameters) onto the v1 schema.
+func v0Request(get func(key string) string) *PDFRequestV1 {
+	req := &PDFRequestV1{}
+	req.Source.HTML = get("html")
+	req.Source.URL = get("url")
+	req.Page.Format = get("format")
+	req.Page.Orientation = get("orientation")
+	req.Page.Margin = json.Number(get("margin"))
+	req.Output.Filename = get("filename")
+	req.Output.CacheTTL = get("cache_ttl")
+	req.Output.Type = get("output")
+	req.Output.DryRun = parseFlag(get("dry_run"))
+	req.Output.PDFA = get("pdfa")
+	req.Output.Split = get("split")
+	if dpi := get("dpi"); dpi != "" {
+		// Anything but a number is reported as out of range.
+		if req.Output.DPI, _ = strconv.Atoi(dpi); req.Output.DPI == 0 {
+			req.Output.DPI = -1
+		}
+	}
+	req.Output.Pages = get("pages")
+	req.Output.Outline = parseFlag(get("outline"))
+	if depth := get("outline_depth"); depth != "" {
+		// Anything but a number is reported as out of range.
+		if req.Output.OutlineDepth, _ = strconv.Atoi(depth); req.Output.OutlineDepth == 0 {
+			req.Output.OutlineDepth = -1
+		}
+	}
+	req.Output.Tagged = parseFlag(get("tagged"))
+	req.Output.InteractiveForms = parseFlag(get("interactive_forms"))
+	req.Metadata.Title = get("title")
+	req.Metadata.Author = get("author")
+	req.Metadata.Subject = get("subject")
+	req.Metadata.Keywords = get("keywords")
+	req.Metadata.Creator = get("creator")
+	req.Metadata.XMP = parseFlag(get("xmp"))
+	req.Encryption.UserPassword = get("user_password")
+	req.Encryption.OwnerPassword = get("owner_password")
+	if permissions := get("permissions"); permissions != "" {
+		req.Encryption.Permissions = strings.Split(permissions, ",")
+	}
+	req.Watermark.Text = get("watermark_text")
+	req.Watermark.FontSize = json.Number(get("watermark_font_size"))
+	req.Watermark.Color = get("watermark_color")
+	req.Watermark.Scale = json.Number(get("watermark_scale"))
+	req.Watermark.Opacity = json.Number(get("watermark_opacity"))
+	req.Watermark.Rotation = json.Number(get("watermark_rotation"))
+	req.Watermark.Position = get("watermark_position")
+	req.Watermark.Pages = get("watermark_pages")
+	sig := &SignatureV1{
+		Profile:     get("signature_profile"),
+		Reason:      get("signature_reason"),
+		Location:    get("signature_location"),
+		ContactInfo: get("signature_contact_info"),
+	}
+	if position, page := get("signature_box_position"), get("signature_box_page"); position != "" || page != "" {
+		sig.Box = &SignatureBoxV1{Position: position}
+		// Anything but a positive number is reported as an invalid page.
+		if sig.Box.Page, _ = strconv.Atoi(page); page != "" && sig.Box.Page <= 0 {
+			sig.Box.Page = -1
+		}
+	}
+	if parseFlag(get("sign")) || sig.Profile != "" {
+		req.Signature = sig
+	}
+	req.Optimize.Linearize = parseFlag(get("optimize_linearize"))
+	req.Optimize.Compress = parseFlag(get("optimize_compress"))
+	req.Optimize.Deduplicate = parseFlag(get("optimize_deduplicate"))
+	if dpi := get("optimize_image_dpi"); dpi != "" {
+		// Anything but a number is reported as out of range.
+		if req.Optimize.ImageDPI, _ = strconv.Atoi(dpi); req.Optimize.ImageDPI == 0 {
+			req.Optimize.ImageDPI = -1
+		}
+	}
+	return req
+}
+
+// parseFlag reads a boolean v0 parameter. Anything but a true value (true, 1, …) means false.
+func parseFlag(raw string) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(raw))
+	return err == nil && v
+}
+
+// validateV0 runs the shared validator and reports only the first error, as v0 always has.
+func validateV0(req *PDFRequestV1, cfg config.Config) (*PDFRequestParams, error) {
+	params, err := validatePDFRequest(req, cfg)
+	if ve, ok := err.(*domain.ValidationError); ok {
+		return nil, ve.First()
+	}
+	return params, err
+}
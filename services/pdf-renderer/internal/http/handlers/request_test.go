@@ -0,0 +1,729 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/http/problem"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/pdf"
+)
+
+func TestValidatePDFRequest_ReportsAllFieldErrors(t *testing.T) {
+	req := &PDFRequestV1{Version: "2"}
+	req.Source.HTML = "<p>"
+	req.Page.Format = "B7"
+	req.Page.Margin = "5"
+	req.Wait.Strategy = "selector"
+	req.Emulation.Media = "tv"
+	req.Output.Filename = "x.doc"
+
+	_, err := validatePDFRequest(req, testConfig())
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, domain.CodeInvalidRequest, ve.Code())
+
+	var fields []string
+	var codes []domain.Code
+	for _, f := range ve.Fields {
+		fields = append(fields, f.Field)
+		codes = append(codes, f.Code)
+	}
+	assert.Equal(t, []string{
+		"version", "source.html", "page.format", "page.margin", "output.filename",
+		"wait.selector", "emulation.media",
+	}, fields)
+	assert.Equal(t, []domain.Code{
+		domain.CodeUnsupportedVersion, domain.CodeInvalidHTML, domain.CodeInvalidFormat, domain.CodeInvalidMargin,
+		domain.CodeInvalidFilename, domain.CodeInvalidWait, domain.CodeInvalidEmulation,
+	}, codes)
+	assert.Equal(t, fiber.StatusBadRequest, problem.From(err).Status)
+}
+
+func TestValidatePDFRequest_SizeLimitIs413(t *testing.T) {
+	req := &PDFRequestV1{}
+	req.Source.HTML = strings.Repeat("x", 2048)
+
+	_, err := validatePDFRequest(req, testConfig())
+	p := problem.From(err)
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, p.Status)
+	assert.Equal(t, domain.CodeHTMLTooLarge, p.Code)
+}
+
+func TestV0AndV1ShareModelAndCacheKey(t *testing.T) {
+	cfg := testConfig()
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "orientation": "LANDSCAPE", "margin": "0.5", "filename": "a.pdf"}[key]
+	})
+	p0, err := validateV0(v0, cfg)
+	require.NoError(t, err)
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Page.Orientation = "landscape"
+	v1.Page.Margin = "0.5"
+	v1.Output.Filename = "a.pdf"
+	p1, err := validatePDFRequest(v1, cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, p0, p1)
+	assert.Equal(t, computePDFCacheKey(p0), computePDFCacheKey(p1))
+
+	// Render options only change the key when they differ from the defaults.
+	v1.Emulation.Media = "screen"
+	p2, err := validatePDFRequest(v1, cfg)
+	require.NoError(t, err)
+	assert.NotEqual(t, computePDFCacheKey(p0), computePDFCacheKey(p2))
+}
+
+func TestMetadataIsValidatedAndPartOfTheCacheKey(t *testing.T) {
+	cfg := testConfig()
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "title": "Report", "author": "Finance", "xmp": "true"}[key]
+	})
+	p0, err := validateV0(v0, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Report", p0.Metadata.Title)
+	assert.True(t, p0.Metadata.XMP)
+	assert.True(t, p0.needsPostProcessing())
+
+	plain := *p0
+	plain.Metadata.Title = "Other"
+	assert.NotEqual(t, computePDFCacheKey(p0), computePDFCacheKey(&plain))
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Metadata.Subject = strings.Repeat("x", maxMetadataLength+1)
+	_, err = validatePDFRequest(v1, cfg)
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "metadata.subject", ve.Fields[0].Field)
+	assert.Equal(t, domain.CodeInvalidMetadata, ve.Code())
+}
+
+func TestPDFAIsValidatedAndPartOfTheCacheKey(t *testing.T) {
+	cfg := testConfig()
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "pdfa": "2B"}[key]
+	})
+	p0, err := validateV0(v0, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, pdf.PDFA2B, p0.PDFA)
+	assert.True(t, p0.needsPostProcessing())
+
+	plain := *p0
+	plain.PDFA = ""
+	assert.NotEqual(t, computePDFCacheKey(p0), computePDFCacheKey(&plain))
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Output.PDFA = "1a"
+	_, err = validatePDFRequest(v1, cfg)
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "output.pdfa", ve.Fields[0].Field)
+	assert.Equal(t, domain.CodeInvalidPDFA, ve.Code())
+}
+
+func TestEncryptionIsValidatedAndNotPartOfTheCacheKey(t *testing.T) {
+	cfg := testConfig()
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "user_password": "secret", "permissions": "Print, copy"}[key]
+	})
+	p0, err := validateV0(v0, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{pdf.PermissionPrint, pdf.PermissionCopy}, p0.Encryption.Permissions)
+	assert.True(t, p0.needsPostProcessing())
+
+	plain := *p0
+	plain.Encryption = pdf.Encryption{}
+	assert.Equal(t, computePDFCacheKey(p0), computePDFCacheKey(&plain))
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Output.PDFA = pdf.PDFA2B
+	v1.Encryption.Permissions = []string{"fly"}
+	_, err = validatePDFRequest(v1, cfg)
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, domain.CodeInvalidEncryption, ve.Code())
+	assert.Len(t, ve.Fields, 3, "unknown permission, no password, PDF/A")
+}
+
+func TestWatermarkIsValidatedAndPartOfTheCacheKey(t *testing.T) {
+	cfg := testConfig()
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "watermark_text": "DRAFT", "watermark_position": "Tiled", "watermark_pages": "1-2"}[key]
+	})
+	p0, err := validateV0(v0, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, &pdf.Watermark{
+		Text: "DRAFT", FontSize: defaultWatermarkFont, Color: defaultWatermarkColor, Opacity: defaultWatermarkAlpha,
+		Rotation: defaultWatermarkAngle, Position: pdf.PositionTiled, Pages: "1-2",
+	}, p0.Watermark)
+	assert.True(t, p0.needsPostProcessing())
+
+	stamped := *p0
+	stamped.Watermark = &pdf.Watermark{Image: pngImage(t), Scale: defaultWatermarkScale, Opacity: 1, Position: pdf.PositionCenter}
+	other := stamped
+	other.Watermark = &pdf.Watermark{Image: append(pngImage(t), 0), Scale: defaultWatermarkScale, Opacity: 1, Position: pdf.PositionCenter}
+	assert.NotEqual(t, computePDFCacheKey(p0), computePDFCacheKey(&stamped))
+	assert.NotEqual(t, computePDFCacheKey(&stamped), computePDFCacheKey(&other), "the image is part of the key")
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Output.PDFA = pdf.PDFA2B
+	v1.Watermark.Text = "DRAFT"
+	v1.Watermark.Color = "grey"
+	v1.Watermark.Opacity = "2"
+	v1.Watermark.Position = "middle"
+	v1.Watermark.Pages = "3-1"
+	_, err = validatePDFRequest(v1, cfg)
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, domain.CodeInvalidWatermark, ve.Code())
+	var fields []string
+	for _, f := range ve.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{"watermark.opacity", "watermark.color", "watermark.text", "watermark.position", "watermark.pages"}, fields)
+
+	v1 = &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Watermark.Image = []byte("GIF89a")
+	v1.Watermark.FontSize = "12"
+	_, err = validatePDFRequest(v1, cfg)
+	require.ErrorAs(t, err, &ve)
+	assert.Len(t, ve.Fields, 2, "not a PNG or JPEG, font_size on an image")
+
+	v1.Watermark.Image = nil
+	_, err = validatePDFRequest(v1, cfg)
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "Invalid watermark: text or image is required", ve.Fields[0].Message)
+}
+
+func TestWatermarkImageUpload(t *testing.T) {
+	cfg := testConfig()
+	svc := NewPDFService(cfg, nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Watermark.Image = pngImage(t)
+	params, err := validatePDFRequest(v1, cfg)
+	require.NoError(t, err)
+	seedCache(t, svc, params, []byte("%PDF-1.4 stamped"))
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	post := func(img []byte) (int, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		require.NoError(t, mw.WriteField("html", "<b>Hello World!</b>"))
+		fw, err := mw.CreateFormFile("watermark_image", "logo.png")
+		require.NoError(t, err)
+		_, _ = fw.Write(img)
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest("POST", "/pdf", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+
+	status, body := post(pngImage(t))
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "%PDF-1.4 stamped", body, "same cache key as the v1 request")
+
+	status, body = post(bytes.Repeat([]byte{0x89}, maxWatermarkImageBytes+10))
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Contains(t, body, "INVALID_WATERMARK")
+}
+
+func TestSignatureIsValidatedAndPartOfTheCacheKey(t *testing.T) {
+	cfg := signingConfig(t)
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "sign": "true", "signature_reason": "Approved", "signature_box_page": "2"}[key]
+	})
+	p0, err := validateV0(v0, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, &pdf.Signature{
+		Reason: "Approved",
+		Box:    &pdf.SignatureBox{Page: 2, Position: pdf.PositionBottomRight, Width: defaultSignatureBoxWidth, Height: defaultSignatureBoxHeight},
+	}, p0.Signature)
+	assert.True(t, p0.needsPostProcessing())
+
+	plain := *p0
+	plain.Signature = nil
+	shared, invoices := *p0, *p0
+	shared.SignatureProfile, invoices.SignatureProfile = "shared", "invoices"
+	assert.NotEqual(t, computePDFCacheKey(p0), computePDFCacheKey(&plain))
+	assert.NotEqual(t, computePDFCacheKey(&shared), computePDFCacheKey(&invoices), "the profile is part of the key")
+
+	v0 = v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "signature_box_page": "first"}[key]
+	})
+	p0, err = validateV0(v0, cfg)
+	require.NoError(t, err)
+	assert.Nil(t, p0.Signature, "box fields alone do not sign")
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Output.PDFA = pdf.PDFA2B
+	v1.Encryption.UserPassword = "secret"
+	v1.Signature = &SignatureV1{
+		Profile: "gone",
+		Reason:  strings.Repeat("x", maxMetadataLength+1),
+		Box:     &SignatureBoxV1{Page: -1, Position: "tiled", Width: "10"},
+	}
+	_, err = validatePDFRequest(v1, cfg)
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	var fields []string
+	for _, f := range ve.Fields {
+		if f.Code == domain.CodeInvalidSignature {
+			fields = append(fields, f.Field)
+		}
+	}
+	assert.Equal(t, []string{
+		"signature.profile", "signature.reason", "signature.box.width", "signature.box.page",
+		"signature.box.position", "signature.box", "signature",
+	}, fields)
+}
+
+func TestOptimizeIsValidatedAndPartOfTheCacheKey(t *testing.T) {
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "optimize_linearize": "true", "optimize_deduplicate": "1", "optimize_image_dpi": "150"}[key]
+	})
+	p0, err := validateV0(v0, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, pdf.Optimization{Linearize: true, Deduplicate: true, ImageDPI: 150}, p0.Optimize)
+	assert.True(t, p0.needsPostProcessing())
+
+	plain, compressed := *p0, *p0
+	plain.Optimize = pdf.Optimization{}
+	compressed.Optimize = pdf.Optimization{Compress: true}
+	assert.NotEqual(t, computePDFCacheKey(p0), computePDFCacheKey(&plain))
+	assert.NotEqual(t, computePDFCacheKey(&compressed), computePDFCacheKey(&plain))
+	assert.False(t, plain.needsPostProcessing())
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Encryption.UserPassword = "secret"
+	v1.Optimize.Linearize = true
+	v1.Optimize.Compress = true
+	v1.Optimize.ImageDPI = 1200
+	_, err = validatePDFRequest(v1, testConfig())
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	var fields []string
+	for _, f := range ve.Fields {
+		if f.Code == domain.CodeInvalidOptimization {
+			fields = append(fields, f.Field)
+		}
+	}
+	assert.Equal(t, []string{"optimize.image_dpi", "optimize", "optimize.linearize"}, fields)
+
+	v1 = &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Signature = &SignatureV1{}
+	v1.Optimize.Compress = true
+	_, err = validatePDFRequest(v1, signingConfig(t))
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "optimize.compress", ve.Fields[0].Field)
+
+	_, err = validateV0(v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "optimize_image_dpi": "high"}[key]
+	}), testConfig())
+	var de *domain.Error
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, domain.CodeInvalidOptimization, de.Code)
+}
+
+func TestSplitIsValidatedAndNotPartOfTheCacheKey(t *testing.T) {
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "split": "every:2"}[key]
+	})
+	p0, err := validateV0(v0, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, pdf.Split{Every: 2}, p0.Split)
+	assert.True(t, p0.needsPostProcessing())
+
+	whole := *p0
+	whole.Split = pdf.Split{}
+	assert.Equal(t, computePDFCacheKey(p0), computePDFCacheKey(&whole))
+
+	for _, tc := range []struct {
+		name string
+		edit func(*PDFRequestV1)
+		cfg  config.Config
+	}{
+		{"syntax", func(r *PDFRequestV1) { r.Output.Split = "every:0" }, testConfig()},
+		{"storage", func(r *PDFRequestV1) { r.Output.Split = "per_page"; r.Output.Type = outputStorage }, testConfig()},
+		{"signature", func(r *PDFRequestV1) { r.Output.Split = "per_page"; r.Signature = &SignatureV1{} }, signingConfig(t)},
+	} {
+		v1 := &PDFRequestV1{}
+		v1.Source.HTML = "<b>Hello World!</b>"
+		tc.edit(v1)
+		_, err = validatePDFRequest(v1, tc.cfg)
+		var ve *domain.ValidationError
+		require.ErrorAs(t, err, &ve, tc.name)
+		assert.Equal(t, domain.CodeInvalidSplit, ve.Code(), tc.name)
+		assert.Equal(t, "output.split", ve.Fields[0].Field, tc.name)
+	}
+}
+
+func TestPreviewIsValidatedAndNotPartOfTheCacheKey(t *testing.T) {
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "output": "png", "pages": "1", "dpi": "48"}[key]
+	})
+	p0, err := validateV0(v0, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, outputPNG, p0.Output)
+	assert.Equal(t, "1", p0.PreviewPages)
+	assert.Equal(t, 48, p0.PreviewDPI)
+
+	pdfOutput := *p0
+	pdfOutput.Output, pdfOutput.PreviewPages, pdfOutput.PreviewDPI = outputPDF, "", 0
+	assert.Equal(t, computePDFCacheKey(p0), computePDFCacheKey(&pdfOutput), "previews are made from the cached PDF")
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Output.Type = "png"
+	p1, err := validatePDFRequest(v1, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, defaultPreviewDPI, p1.PreviewDPI)
+	assert.Empty(t, p1.PreviewPages, "all pages")
+
+	for _, tc := range []struct {
+		name  string
+		edit  func(*PDFRequestV1)
+		field string
+	}{
+		{"dpi too low", func(r *PDFRequestV1) { r.Output.DPI = 5 }, "output.dpi"},
+		{"dpi too high", func(r *PDFRequestV1) { r.Output.DPI = 1200 }, "output.dpi"},
+		{"pages", func(r *PDFRequestV1) { r.Output.Pages = "3-1" }, "output.pages"},
+		{"split", func(r *PDFRequestV1) { r.Output.Split = "per_page" }, "output.type"},
+		{"encryption", func(r *PDFRequestV1) { r.Encryption.UserPassword = "secret" }, "output.type"},
+		{"pdf output", func(r *PDFRequestV1) { r.Output.Type = outputPDF; r.Output.DPI = 150 }, "output.type"},
+	} {
+		v1 := &PDFRequestV1{}
+		v1.Source.HTML = "<b>Hello World!</b>"
+		v1.Output.Type = outputPNG
+		tc.edit(v1)
+		_, err = validatePDFRequest(v1, testConfig())
+		var ve *domain.ValidationError
+		require.ErrorAs(t, err, &ve, tc.name)
+		assert.Equal(t, domain.CodeInvalidPreview, ve.Code(), tc.name)
+		assert.Equal(t, tc.field, ve.Fields[0].Field, tc.name)
+	}
+}
+
+func TestOutlineIsValidatedAndPartOfTheCacheKey(t *testing.T) {
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "outline": "true", "outline_depth": "2"}[key]
+	})
+	p0, err := validateV0(v0, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, 2, p0.OutlineDepth)
+	assert.True(t, p0.Tagged, "Chrome needs a tagged PDF for the outline")
+	assert.Equal(t, 2, p0.postProcessOptions().OutlineDepth)
+
+	full, tagged, plain := *p0, *p0, *p0
+	full.OutlineDepth = pdf.MaxOutlineDepth
+	tagged.OutlineDepth = 0
+	plain.OutlineDepth, plain.Tagged = 0, false
+	assert.False(t, full.needsPostProcessing(), "Chrome's outline has every level")
+	keys := map[string]bool{}
+	for _, p := range []*PDFRequestParams{p0, &full, &tagged, &plain} {
+		keys[computePDFCacheKey(p)] = true
+	}
+	assert.Len(t, keys, 4)
+
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Output.Outline = true
+	p1, err := validatePDFRequest(v1, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, pdf.MaxOutlineDepth, p1.OutlineDepth)
+
+	for _, depth := range []string{"7", "deep"} {
+		_, err = validateV0(v0Request(func(key string) string {
+			return map[string]string{"html": "<b>Hello World!</b>", "outline": "true", "outline_depth": depth}[key]
+		}), testConfig())
+		var de *domain.Error
+		require.ErrorAs(t, err, &de, depth)
+		assert.Equal(t, domain.CodeInvalidOutline, de.Code, depth)
+	}
+
+	v1.Output.Outline = false
+	v1.Output.OutlineDepth = 3
+	_, err = validatePDFRequest(v1, testConfig())
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "Invalid outline: outline_depth requires outline", ve.Fields[0].Message)
+}
+
+func TestInteractiveFormsAreValidatedAndPartOfTheCacheKey(t *testing.T) {
+	v0 := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "interactive_forms": "true"}[key]
+	})
+	p0, err := validateV0(v0, testConfig())
+	require.NoError(t, err)
+	assert.True(t, p0.InteractiveForms)
+	assert.True(t, p0.needsPostProcessing(), "the fields are added after printing")
+
+	static := *p0
+	static.InteractiveForms = false
+	assert.NotEqual(t, computePDFCacheKey(p0), computePDFCacheKey(&static))
+
+	for _, tc := range []struct {
+		name string
+		edit func(*PDFRequestV1)
+		want string
+	}{
+		{"viewport", func(r *PDFRequestV1) {
+			r.Emulation.Viewport = &struct {
+				Width             int     `json:"width"`
+				Height            int     `json:"height"`
+				DeviceScaleFactor float64 `json:"device_scale_factor,omitempty"`
+			}{Width: 1280, Height: 800}
+		}, "remove emulation.viewport"},
+		{"pdfa", func(r *PDFRequestV1) { r.Output.PDFA = "2b" }, "PDF/A forbids"},
+	} {
+		v1 := &PDFRequestV1{}
+		v1.Source.HTML = "<b>Hello World!</b>"
+		v1.Output.InteractiveForms = true
+		tc.edit(v1)
+		_, err = validatePDFRequest(v1, testConfig())
+		var ve *domain.ValidationError
+		require.ErrorAs(t, err, &ve, tc.name)
+		assert.Equal(t, domain.CodeInvalidForm, ve.Code(), tc.name)
+		assert.Equal(t, "output.interactive_forms", ve.Fields[0].Field, tc.name)
+		assert.Contains(t, ve.Fields[0].Message, tc.want, tc.name)
+	}
+}
+
+// facturXInvoice is a minimal Factur-X invoice of the EN 16931 profile.
+const facturXInvoice = `<rsm:CrossIndustryInvoice xmlns:rsm="urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+  xmlns:ram="urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100">
+ <rsm:ExchangedDocumentContext><ram:GuidelineSpecifiedDocumentContextParameter>
+  <ram:ID>urn:cen.eu:en16931:2017</ram:ID>
+ </ram:GuidelineSpecifiedDocumentContextParameter></rsm:ExchangedDocumentContext>
+</rsm:CrossIndustryInvoice>`
+
+func TestAttachmentsAreValidatedAndPartOfTheCacheKey(t *testing.T) {
+	cfg := testConfig()
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Attachments = []AttachmentV1{
+		{Filename: "data.json", Content: []byte(`{"total":42}`), Relationship: "Data"},
+		{Filename: "notes.txt", Content: []byte("notes"), MIMEType: "text/plain; charset=utf-8", Description: "Notes"},
+	}
+	p1, err := validatePDFRequest(v1, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []pdf.Attachment{
+		{Name: "data.json", Data: []byte(`{"total":42}`), MIMEType: "application/json", Relationship: pdf.RelationshipData},
+		{Name: "notes.txt", Data: []byte("notes"), MIMEType: "text/plain", Description: "Notes", Relationship: pdf.RelationshipUnspecified},
+	}, p1.Attachments)
+	assert.True(t, p1.needsPostProcessing())
+
+	other := *p1
+	other.Attachments = []pdf.Attachment{p1.Attachments[0]}
+	assert.NotEqual(t, computePDFCacheKey(p1), computePDFCacheKey(&other))
+
+	for _, tc := range []struct {
+		name  string
+		edit  func(*PDFRequestV1)
+		field string
+	}{
+		{"no filename", func(r *PDFRequestV1) { r.Attachments[0].Filename = "" }, "attachments[0].filename"},
+		{"path", func(r *PDFRequestV1) { r.Attachments[0].Filename = "../data.json" }, "attachments[0].filename"},
+		{"duplicate", func(r *PDFRequestV1) { r.Attachments[1].Filename = "data.json" }, "attachments[1].filename"},
+		{"empty", func(r *PDFRequestV1) { r.Attachments[1].Content = nil }, "attachments[1].content"},
+		{"mime type", func(r *PDFRequestV1) { r.Attachments[1].MIMEType = "text" }, "attachments[1].mime_type"},
+		{"relationship", func(r *PDFRequestV1) { r.Attachments[0].Relationship = "parent" }, "attachments[0].relationship"},
+		{"too large", func(r *PDFRequestV1) { r.Attachments[0].Content = make([]byte, maxAttachmentBytes) }, "attachments"},
+		{"pdfa 2b", func(r *PDFRequestV1) { r.Output.PDFA = "2b" }, "attachments"},
+		{"split", func(r *PDFRequestV1) { r.Output.Split = "per_page" }, "attachments"},
+	} {
+		req := *v1
+		req.Attachments = append([]AttachmentV1(nil), v1.Attachments...)
+		tc.edit(&req)
+		_, err := validatePDFRequest(&req, cfg)
+		var ve *domain.ValidationError
+		require.ErrorAs(t, err, &ve, tc.name)
+		assert.Equal(t, domain.CodeInvalidAttachment, ve.Code(), tc.name)
+		assert.Equal(t, tc.field, ve.Fields[0].Field, tc.name)
+	}
+}
+
+func TestFacturXImpliesPDFA3B(t *testing.T) {
+	cfg := testConfig()
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.FacturX = &FacturXV1{XML: []byte(facturXInvoice)}
+	params, err := validatePDFRequest(v1, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, pdf.PDFA3B, params.PDFA)
+	assert.Equal(t, pdf.FacturXEN16931, params.FacturX.Level)
+	assert.Equal(t, params.FacturX, params.postProcessOptions().FacturX)
+
+	explicit := *v1
+	explicit.Output.PDFA = "3b"
+	p3b, err := validatePDFRequest(&explicit, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, computePDFCacheKey(params), computePDFCacheKey(p3b))
+
+	for _, tc := range []struct {
+		name  string
+		edit  func(*PDFRequestV1)
+		field string
+	}{
+		{"pdfa 2b", func(r *PDFRequestV1) { r.Output.PDFA = "2b" }, "facturx"},
+		{"not an invoice", func(r *PDFRequestV1) { r.FacturX = &FacturXV1{XML: []byte("<Invoice/>")} }, "facturx.xml"},
+		{"name taken", func(r *PDFRequestV1) {
+			r.Attachments = []AttachmentV1{{Filename: "factur-x.xml", Content: []byte("<x/>")}}
+		}, "facturx"},
+	} {
+		req := *v1
+		tc.edit(&req)
+		_, err := validatePDFRequest(&req, cfg)
+		var ve *domain.ValidationError
+		require.ErrorAs(t, err, &ve, tc.name)
+		assert.Equal(t, domain.CodeInvalidAttachment, ve.Code(), tc.name)
+		assert.Equal(t, tc.field, ve.Fields[0].Field, tc.name)
+	}
+
+	encrypted := *v1
+	encrypted.Encryption.UserPassword = "secret"
+	_, err = validatePDFRequest(&encrypted, cfg)
+	var ve *domain.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, domain.CodeInvalidEncryption, ve.Code(), "Factur-X invoices are PDF/A documents")
+}
+
+func TestAttachmentUpload(t *testing.T) {
+	cfg := testConfig()
+	svc := NewPDFService(cfg, nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+	v1 := &PDFRequestV1{}
+	v1.Source.HTML = "<b>Hello World!</b>"
+	v1.Attachments = []AttachmentV1{
+		{Filename: "data.json", Content: []byte(`{"total":42}`), Relationship: "source"},
+		{Filename: "notes.txt", Content: []byte("notes"), MIMEType: "text/plain", Relationship: "source"},
+	}
+	v1.FacturX = &FacturXV1{XML: []byte(facturXInvoice)}
+	params, err := validatePDFRequest(v1, cfg)
+	require.NoError(t, err)
+	seedCache(t, svc, params, []byte("%PDF-1.4 invoice"))
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	post := func(data []byte) (int, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		require.NoError(t, mw.WriteField("html", "<b>Hello World!</b>"))
+		require.NoError(t, mw.WriteField("attachment_relationship", "source"))
+		fw, err := mw.CreateFormFile("attachment", "data.json")
+		require.NoError(t, err)
+		_, _ = fw.Write(data)
+		fw, err = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition": {`form-data; name="attachment"; filename="notes.txt"`},
+			"Content-Type":        {"text/plain"},
+		})
+		require.NoError(t, err)
+		_, _ = fw.Write([]byte("notes"))
+		fw, err = mw.CreateFormFile("facturx_xml", "invoice.xml")
+		require.NoError(t, err)
+		_, _ = fw.Write([]byte(facturXInvoice))
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest("POST", "/pdf", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+
+	status, body := post([]byte(`{"total":42}`))
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "%PDF-1.4 invoice", body, "same cache key as the v1 request")
+
+	status, body = post(nil)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Contains(t, body, "INVALID_ATTACHMENT")
+}
+
+func TestParseFlag(t *testing.T) {
+	for raw, want := range map[string]bool{"": false, "true": true, "1": true, "false": false, "yes": false} {
+		assert.Equal(t, want, parseFlag(raw), raw)
+	}
+}
+
+func TestValidateV0_ReturnsFirstErrorOnly(t *testing.T) {
+	req := v0Request(func(key string) string {
+		return map[string]string{"html": "<b>Hello World!</b>", "orientation": "up", "margin": "abc"}[key]
+	})
+	_, err := validateV0(req, testConfig())
+	var de *domain.Error
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, domain.CodeInvalidOrientation, de.Code)
+	assert.Equal(t, "Invalid orientation: must be 'portrait' or 'landscape'", de.Message)
+}
+
+func TestHandleConversionV1(t *testing.T) {
+	svc := NewPDFService(testConfig(), nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+	params := helloParams()
+	params.Format = "A4"
+	seedCache(t, svc, params, []byte("%PDF-1.4 cached"))
+
+	app := newTestApp()
+	app.Post("/v1/pdf", svc.HandleConversionV1)
+
+	post := func(contentType, body string) (int, string) {
+		req := httptest.NewRequest("POST", "/v1/pdf", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+
+	status, body := post("application/json", `{"version":"1","source":{"html":"<b>Hello World!</b>"},"page":{"format":"a4"}}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "%PDF-1.4 cached", body)
+
+	status, body = post("application/json", `{"source":{"html":"<b>Hello World!</b>"},"colour":"red"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "unknown fields are rejected")
+	assert.Contains(t, body, `"code":"INVALID_JSON"`)
+	assert.Contains(t, body, `unknown field \"colour\"`)
+
+	status, body = post("application/json", `{"page":{"margin":true}}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.NotContains(t, body, "Go struct", "decoder internals are not exposed")
+
+	status, _ = post("application/x-www-form-urlencoded", "html=<b>Hello World!</b>")
+	assert.Equal(t, fiber.StatusUnsupportedMediaType, status)
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, image.NewGray(image.Rect(0, 0, 4, 4))))
+	return b.Bytes()
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/pdf"
+)
+
+var (
+	errNoSigningProfile   = domain.NewError(domain.CodeInvalidSignature, "Invalid signature: no signing profile is configured for this API key; name one in the request")
+	errSignatureForbidden = domain.NewError(domain.CodeSignatureForbidden, "This API key may not sign with the requested profile")
+	errSigningUnavailable = domain.NewError(domain.CodeSigningUnavailable, "The signing certificate of the requested profile is unavailable")
+)
+
+// loadSigners loads the certificate of every signing profile. A profile that fails to load is
+// logged and left out, so its requests fail with errSigningUnavailable instead of the service
+// refusing to start.
+func loadSigners(cfg config.Config) map[string]*pdf.Signer {
+	signers := make(map[string]*pdf.Signer, len(cfg.Signing.Profiles))
+	for name, profile := range cfg.Signing.Profiles {
+		var (
+			signer *pdf.Signer
+			err    error
+		)
+		if profile.PKCS12File != "" {
+			signer, err = pdf.LoadPKCS12(profile.PKCS12File, profile.PKCS12Password)
+		} else {
+			signer, err = pdf.LoadSigner(profile.CertFile, profile.KeyFile)
+		}
+		if err != nil {
+			logging.Error("Signing profile unavailable", "profile", name, "error", err)
+			continue
+		}
+		signers[name] = signer
+	}
+	return signers
+}
+
+// resolveSignature completes the signature of a signed request: the profile is the one named in
+// the request or else the API key's (signing.token_profiles), and supplies the certificate and
+// the defaults for the fields the request left empty.
+func (svc *PDFService) resolveSignature(c *fiber.Ctx, params *PDFRequestParams) error {
+	if params.Signature == nil {
+		return nil
+	}
+	cfg := svc.Config.Signing
+	token := c.Get("X-API-Key")
+	if token == "" {
+		return errSignatureForbidden
+	}
+	tokenHash := domain.Checksum([]byte(token))
+
+	name := params.SignatureProfile
+	if name == "" {
+		if name = cfg.TokenProfiles[tokenHash]; name == "" {
+			return errNoSigningProfile
+		}
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		// A token profile naming a profile that does not exist is a configuration error.
+		logging.Error("Signing profile not configured", "profile", name)
+		return errSigningUnavailable
+	}
+	if !slices.Contains(profile.Tokens, tokenHash) && cfg.TokenProfiles[tokenHash] != name {
+		return errSignatureForbidden
+	}
+	signer := svc.Signers[name]
+	if signer == nil {
+		return errSigningUnavailable
+	}
+
+	sig := *params.Signature
+	sig.Signer = signer
+	sig.Reason = cmp.Or(sig.Reason, profile.Reason)
+	sig.Location = cmp.Or(sig.Location, profile.Location)
+	sig.ContactInfo = cmp.Or(sig.ContactInfo, profile.ContactInfo)
+	params.Signature = &sig
+	params.SignatureProfile = name
+	return nil
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/pdf"
+)
+
+// writeSigningFiles writes a self-signed document signing certificate and its key as PEM files
+// and returns their paths.
+func writeSigningFiles(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Example Corp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "signing.crt"), filepath.Join(dir, "signing.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// signingConfig returns testConfig with the profiles invoices (the API key "billing"), shared
+// ("billing" and "other"), unlisted (no API key) and broken (missing files); "billing" defaults
+// to invoices.
+func signingConfig(t *testing.T) config.Config {
+	certFile, keyFile := writeSigningFiles(t)
+	cfg := testConfig()
+	cfg.Signing.Profiles = map[string]config.SigningProfile{
+		"invoices": {CertFile: certFile, KeyFile: keyFile, Reason: "Issued by Example Corp", Location: "Berlin",
+			Tokens: []string{domain.Checksum([]byte("billing"))}},
+		"shared":   {CertFile: certFile, KeyFile: keyFile, Tokens: []string{domain.Checksum([]byte("billing")), domain.Checksum([]byte("other"))}},
+		"unlisted": {CertFile: certFile, KeyFile: keyFile},
+		"broken":   {CertFile: filepath.Join(t.TempDir(), "missing.crt"), KeyFile: keyFile, Tokens: []string{domain.Checksum([]byte("other"))}},
+	}
+	cfg.Signing.TokenProfiles = map[string]string{domain.Checksum([]byte("billing")): "invoices"}
+	return cfg
+}
+
+func TestLoadSigners(t *testing.T) {
+	signers := loadSigners(signingConfig(t))
+	assert.Len(t, signers, 3, "broken is left out")
+	require.NotNil(t, signers["invoices"])
+	assert.Equal(t, "Example Corp", signers["invoices"].Certificate.Subject.CommonName)
+}
+
+func TestResolveSignature(t *testing.T) {
+	svc := NewPDFService(signingConfig(t), nil)
+	app := newTestApp()
+	app.Get("/sign", func(c *fiber.Ctx) error {
+		params := &PDFRequestParams{SignatureProfile: c.Query("profile"), Signature: &pdf.Signature{Reason: c.Query("reason")}}
+		if err := svc.resolveSignature(c, params); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"profile": params.SignatureProfile, "reason": params.Signature.Reason, "location": params.Signature.Location})
+	})
+	resolve := func(token, query string) (int, string) {
+		req := httptest.NewRequest("GET", "/sign?"+query, nil)
+		if token != "" {
+			req.Header.Set("X-API-Key", token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		var body map[string]string
+		if resp.StatusCode == 200 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			return resp.StatusCode, body["profile"] + "|" + body["reason"] + "|" + body["location"]
+		}
+		var p map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+		return resp.StatusCode, p["code"].(string)
+	}
+
+	status, got := resolve("billing", "")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "invoices|Issued by Example Corp|Berlin", got, "the API key's profile and its defaults")
+
+	_, got = resolve("billing", "reason=Paid")
+	assert.Equal(t, "invoices|Paid|Berlin", got, "request fields win over the profile's")
+
+	_, got = resolve("billing", "profile=shared")
+	assert.Equal(t, "shared||", got)
+
+	for _, tt := range []struct {
+		token, query string
+		status       int
+		code         domain.Code
+	}{
+		{"", "profile=shared", 403, domain.CodeSignatureForbidden},
+		{"other", "", 400, domain.CodeInvalidSignature},
+		{"other", "profile=invoices", 403, domain.CodeSignatureForbidden},
+		{"other", "profile=unlisted", 403, domain.CodeSignatureForbidden},
+		{"billing", "profile=unlisted", 403, domain.CodeSignatureForbidden},
+		{"third", "profile=shared", 403, domain.CodeSignatureForbidden},
+		{"other", "profile=broken", 503, domain.CodeSigningUnavailable},
+		{"other", "profile=gone", 503, domain.CodeSigningUnavailable},
+	} {
+		status, got := resolve(tt.token, tt.query)
+		assert.Equal(t, tt.status, status, "%s %s", tt.token, tt.query)
+		assert.Equal(t, string(tt.code), got, "%s %s", tt.token, tt.query)
+	}
+}
+
+func TestPostProcess_Signature(t *testing.T) {
+	svc := NewPDFService(signingConfig(t), nil)
+	params := &PDFRequestParams{Signature: &pdf.Signature{Signer: svc.Signers["shared"]}}
+	require.True(t, params.needsPostProcessing())
+	out, err := postProcess(validPDF(), params)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "/SubFilter/ETSI.CAdES.detached")
+
+	_, err = postProcess([]byte("%PDF-1.4 not really"), params)
+	var de *domain.Error
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, "Signing the PDF failed", de.Message)
+}
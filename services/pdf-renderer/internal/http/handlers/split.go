@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/pdf"
+)
+
+// maxSplitParts bounds the number of PDFs in a split archive.
+const maxSplitParts = 1000
+
+// sendParts answers with entry cut into the parts params.Split asks for, each encrypted if
+// requested, as a ZIP archive. Like encrypted PDFs, archives are built for each response and
+// carry no ETag. Dry runs other than HEAD are answered without splitting.
+func (svc *PDFService) sendParts(c *fiber.Ctx, entry *cache.Entry, params *PDFRequestParams, dryRun bool) error {
+	meta := entry.Meta
+	meta.ETag = ""
+	if dryRun && c.Method() != fiber.MethodHead {
+		setConditionalHeaders(c, meta)
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	archive, n, err := splitArchive(entry, params)
+	if err != nil {
+		return err
+	}
+	if len(archive) > svc.Config.Limits.MaxPDFBytes {
+		return errPDFTooLarge
+	}
+	name := archiveName(params.Filename)
+	logging.Info("PDF split", "filename", name, "parts", n, "request_id", c.Get("X-Request-ID"))
+
+	setConditionalHeaders(c, meta)
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename="+name)
+	return c.Send(archive)
+}
+
+// splitArchive cuts entry into parts and zips them, named after params.Filename with their page
+// range (see partName). It returns the archive and the number of parts.
+func splitArchive(entry *cache.Entry, params *PDFRequestParams) ([]byte, int, error) {
+	pages := entry.Meta.Pages
+	if pages == 0 {
+		var err error
+		if pages, err = pdf.PageCount(entry.Data); err != nil {
+			return nil, 0, domain.WrapError(domain.CodePostProcessFailed, "Splitting the PDF failed", err)
+		}
+	}
+	switch n := len(params.Split.Parts(pages)); {
+	case n == 0:
+		return nil, 0, domain.NewError(domain.CodeInvalidSplit, fmt.Sprintf("Invalid split: no range lies within the document's %d pages", pages))
+	case n > maxSplitParts:
+		return nil, 0, domain.NewError(domain.CodeInvalidSplit, fmt.Sprintf("Invalid split: the document's %d pages make %d parts, more than %d", pages, n, maxSplitParts))
+	}
+
+	parts, err := pdf.SplitPages(entry.Data, params.Split)
+	if errors.Is(err, pdf.ErrNoParts) {
+		return nil, 0, domain.WrapError(domain.CodeInvalidSplit, "Invalid split: no range lies within the document", err)
+	}
+	if err != nil {
+		return nil, 0, domain.WrapError(domain.CodePostProcessFailed, "Splitting the PDF failed", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range parts {
+		data := part.Data
+		if !params.Encryption.IsZero() {
+			if data, err = pdf.Encrypt(data, params.Encryption); err != nil {
+				return nil, 0, domain.WrapError(domain.CodePostProcessFailed, "Encrypting the PDF failed", err)
+			}
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     partName(params.Filename, part.Pages, pages),
+			Method:   zip.Deflate,
+			Modified: entry.Meta.CreatedAt,
+		})
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			return nil, 0, domain.WrapError(domain.CodePostProcessFailed, "Splitting the PDF failed", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, 0, domain.WrapError(domain.CodePostProcessFailed, "Splitting the PDF failed", err)
+	}
+	return buf.Bytes(), len(parts), nil
+}
+
+// partName names a part after the requested filename and its pages, zero-padded to the width
+// of the page count so the names sort in page order: "labels-07.pdf", "labels-01-03.pdf".
+func partName(filename string, r pdf.PageRange, pageCount int) string {
+	width := len(strconv.Itoa(pageCount))
+	name := fmt.Sprintf("%s-%0*d", strings.TrimSuffix(filename, ".pdf"), width, r.First)
+	if r.Last != r.First {
+		name += fmt.Sprintf("-%0*d", width, r.Last)
+	}
+	return name + ".pdf"
+}
+
+// archiveName names the archive of a split PDF: "labels.pdf" becomes "labels.zip".
+func archiveName(filename string) string {
+	return strings.TrimSuffix(filename, ".pdf") + ".zip"
+}
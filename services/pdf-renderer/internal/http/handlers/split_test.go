@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/pdf"
+)
+
+// pagesPDF returns a PDF with n empty pages and a correct xref table.
+func pagesPDF(n int) []byte {
+	kids := make([]string, n)
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	for i := range n {
+		kids[i] = fmt.Sprintf("%d 0 R", 3+i)
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 288 432] /Resources << >> >>")
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Count %d /Kids [%s] >>", n, strings.Join(kids, " "))
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestPartName(t *testing.T) {
+	assert.Equal(t, "labels-7.pdf", partName("labels.pdf", pdf.PageRange{First: 7, Last: 7}, 9))
+	assert.Equal(t, "labels-07.pdf", partName("labels.pdf", pdf.PageRange{First: 7, Last: 7}, 12))
+	assert.Equal(t, "labels-001-010.pdf", partName("labels.pdf", pdf.PageRange{First: 1, Last: 10}, 120))
+	assert.Equal(t, "labels.zip", archiveName("labels.pdf"))
+}
+
+// TestSplitResponses checks that the cache holds the whole PDF and each response splits it.
+func TestSplitResponses(t *testing.T) {
+	svc := NewPDFService(testConfig(), nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+	params := &PDFRequestParams{HTML: "<b>Labels</b>", Margin: 0.4, Filename: "labels.pdf"}
+	entry := seedCache(t, svc, params, pagesPDF(12))
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	post := func(form string) *http.Response {
+		req := httptest.NewRequest("POST", "/pdf", strings.NewReader("html=<b>Labels</b>&filename=labels.pdf&"+form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(fiber.HeaderIfNoneMatch, entry.Meta.ETag)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+	unzip := func(resp *http.Response) map[string][]byte {
+		body, _ := io.ReadAll(resp.Body)
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			files[f.Name], err = io.ReadAll(rc)
+			require.NoError(t, err)
+		}
+		return files
+	}
+
+	resp := post("split=ranges:1-3,12")
+	assert.Equal(t, 200, resp.StatusCode, "split responses are never 304")
+	assert.Equal(t, "HIT", resp.Header.Get(headerCache), "the split is not part of the cache key")
+	assert.Equal(t, "application/zip", resp.Header.Get(fiber.HeaderContentType))
+	assert.Equal(t, "attachment; filename=labels.zip", resp.Header.Get(fiber.HeaderContentDisposition))
+	assert.Empty(t, resp.Header.Get(fiber.HeaderETag))
+	files := unzip(resp)
+	require.Len(t, files, 2)
+	for name, pages := range map[string]int{"labels-01-03.pdf": 3, "labels-12.pdf": 1} {
+		n, err := pdf.PageCount(files[name])
+		require.NoError(t, err, name)
+		assert.Equal(t, pages, n, name)
+	}
+
+	files = unzip(post("split=per_page&user_password=secret"))
+	require.Len(t, files, 12)
+	assert.Contains(t, string(files["labels-05.pdf"]), "/Encrypt", "each part is encrypted")
+
+	resp = post("split=per_page&dry_run=true")
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp = post("split=ranges:13-20")
+	assert.Equal(t, 400, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "INVALID_SPLIT")
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/infra/storage"
+)
+
+const (
+	outputPDF     = "pdf"
+	outputStorage = "storage"
+	outputPNG     = "png"
+
+	defaultUploadTimeout = 30 * time.Second
+)
+
+var (
+	errStorageDisabled = domain.NewError(domain.CodeStorageDisabled, "Object storage output is not enabled")
+	errStorageUpload   = domain.NewError(domain.CodeStorageUploadFailed, "Object storage upload failed")
+)
+
+// parseOutput validates the optional output request parameter. An empty value means "pdf".
+func parseOutput(raw string) (string, error) {
+	switch output := strings.ToLower(strings.TrimSpace(raw)); output {
+	case "", outputPDF:
+		return outputPDF, nil
+	case outputStorage, outputPNG:
+		return output, nil
+	}
+	return "", domain.NewError(domain.CodeInvalidOutput, "Invalid output: must be 'pdf', 'storage' or 'png'")
+}
+
+// sendToStorage uploads the PDF to the configured bucket and responds with where to fetch it.
+func (svc *PDFService) sendToStorage(c *fiber.Ctx, params *PDFRequestParams, pdf *cache.Entry) error {
+	sum := domain.Checksum(pdf.Data)
+	key := storage.ObjectKey(*svc.Config, storage.KeyVars{
+		Token:    c.Get("X-API-Key"),
+		Filename: params.Filename,
+		SHA256:   sum,
+		Now:      time.Now(),
+	})
+
+	timeout := svc.Config.Storage.UploadTimeout
+	if timeout <= 0 {
+		timeout = defaultUploadTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	obj, err := svc.Storage.Put(ctx, key, pdf.Data, storage.PutOptions{Filename: params.Filename})
+	if err != nil {
+		logging.Error("PDF upload failed", "key", key, "error", err)
+		return errStorageUpload
+	}
+
+	logging.Info("PDF uploaded", "bucket", obj.Bucket, "key", obj.Key, "size", obj.Size, "request_id", c.Get("X-Request-ID"))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(obj)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/cache"
+	"pdf-renderer/internal/infra/storage"
+)
+
+type fakeObjectStore struct {
+	keys []string
+	data []byte
+	err  error
+}
+
+func (f *fakeObjectStore) Put(_ context.Context, key string, data []byte, _ storage.PutOptions) (*storage.Object, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.keys = append(f.keys, key)
+	f.data = data
+	return &storage.Object{Bucket: "pdfs", Key: key, Size: int64(len(data)), SHA256: domain.Checksum(data), URL: "https://files/" + key}, nil
+}
+
+func newStorageTestApp(t *testing.T, store storage.ObjectStore) *fiber.App {
+	t.Helper()
+	cfg := testConfig()
+	cfg.Storage.KeyTemplate = "{token}/{filename}"
+	svc := NewPDFService(cfg, nil)
+	svc.Cache = cache.NewMemory(0, 0, 0)
+	svc.Storage = store
+
+	seedCache(t, svc, helloParams(), []byte("%PDF-1.4 cached"))
+
+	app := newTestApp()
+	app.Post("/pdf", svc.HandleConversion)
+	return app
+}
+
+func postForStorage(t *testing.T, app *fiber.App, form string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/pdf", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	var out map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestStorageOutput_UploadsAndReturnsObject(t *testing.T) {
+	store := &fakeObjectStore{}
+	app := newStorageTestApp(t, store)
+
+	status, out := postForStorage(t, app, "html=<b>Hello World!</b>&output=storage&filename=report.pdf")
+	require.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, "public/report.pdf", out["key"])
+	assert.EqualValues(t, len("%PDF-1.4 cached"), out["size"])
+	assert.Equal(t, domain.Checksum([]byte("%PDF-1.4 cached")), out["sha256"])
+	assert.Equal(t, "https://files/public/report.pdf", out["url"])
+	assert.Equal(t, "%PDF-1.4 cached", string(store.data))
+}
+
+func TestStorageOutput_Errors(t *testing.T) {
+	status, _ := postForStorage(t, newStorageTestApp(t, nil), "html=<b>Hello World!</b>&output=storage")
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+
+	status, _ = postForStorage(t, newStorageTestApp(t, &fakeObjectStore{err: errors.New("boom")}), "html=<b>Hello World!</b>&output=storage")
+	assert.Equal(t, fiber.StatusBadGateway, status)
+
+	status, _ = postForStorage(t, newStorageTestApp(t, &fakeObjectStore{}), "html=<b>Hello World!</b>&output=zip")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
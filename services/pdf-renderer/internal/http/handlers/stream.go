@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+
+	"github.com/chromedp/cdproto/cdp"
+	cdpio "github.com/chromedp/cdproto/io"
+	"github.com/chromedp/chromedp"
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/infra/logging"
+	"pdf-renderer/internal/pdf"
+)
+
+// pdfChunkSize is how much of a PDF stream is requested from Chrome per IO.read.
+const pdfChunkSize = 1 << 20
+
+// pdfStream is a PDF printed by Chrome (PrintToPDF with ReturnAsStream) that has not been
+// transferred yet. It holds the tab until Close.
+type pdfStream struct {
+	ctx     context.Context
+	handle  cdpio.StreamHandle
+	release func(error)
+	timing  renderTiming
+
+	formFields []pdf.FormField // measured with params.InteractiveForms
+}
+
+// CopyTo reads the PDF from Chrome chunk by chunk and writes it to w. If limit > 0 the copy stops
+// with errPDFTooLarge as soon as more than limit bytes arrived.
+func (s *pdfStream) CopyTo(w io.Writer, limit int) (int64, error) {
+	var n int64
+	err := chromedp.Run(s.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		n, err = copyPDFChunks(func() ([]byte, bool, error) {
+			return readPDFChunk(ctx, s.handle)
+		}, w, limit)
+		return err
+	}))
+	return n, err
+}
+
+// Close releases the Chrome stream and the tab. err is the outcome of the transfer.
+func (s *pdfStream) Close(err error) {
+	if s.ctx.Err() == nil {
+		_ = chromedp.Run(s.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+			return cdpio.Close(s.handle).Do(ctx)
+		}))
+	}
+	s.release(err)
+}
+
+// readPDFChunk reads the next chunk of a Chrome stream. cdpio.Read drops the base64 flag, so the
+// command is executed directly.
+func readPDFChunk(ctx context.Context, handle cdpio.StreamHandle) ([]byte, bool, error) {
+	var res cdpio.ReadReturns
+	if err := cdp.Execute(ctx, cdpio.CommandRead, cdpio.Read(handle).WithSize(pdfChunkSize), &res); err != nil {
+		return nil, false, err
+	}
+	if !res.Base64encoded {
+		return []byte(res.Data), res.EOF, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(res.Data)
+	return data, res.EOF, err
+}
+
+// copyPDFChunks writes chunks returned by next to w until EOF, enforcing limit (if > 0) before
+// each write.
+func copyPDFChunks(next func() ([]byte, bool, error), w io.Writer, limit int) (int64, error) {
+	var n int64
+	for {
+		chunk, eof, err := next()
+		if err != nil {
+			return n, err
+		}
+		if limit > 0 && n+int64(len(chunk)) > int64(limit) {
+			return n, errPDFTooLarge
+		}
+		written, err := w.Write(chunk)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+		if eof {
+			return n, nil
+		}
+	}
+}
+
+// streamPDF renders params and sends the PDF to the client while Chrome transfers it, without
+// holding the whole document in memory. It is used when the PDF is not cached anyway.
+//
+// Errors up to and including PrintToPDF are reported as usual. Once the headers are sent a
+// failing transfer, including one exceeding limits.max_pdf_bytes, aborts the connection so the
+// client never mistakes a truncated body for a complete PDF.
+func (svc *PDFService) streamPDF(c *fiber.Ctx, params *PDFRequestParams) error {
+	stream, err := svc.openPDFStream(params)
+	if err != nil {
+		rerr := renderError(err)
+		logging.Error("PDF generation failed", "code", rerr.Code, "timeout_secs", svc.Config.PDF.TimeoutSecs, "error", err.Error())
+		return rerr
+	}
+
+	// The transfer outlives the handler; keep shutdown waiting for it.
+	svc.inflight.Add(1)
+	requestID := c.Get("X-Request-ID")
+	pr, pw := io.Pipe()
+	go func() {
+		defer svc.inflight.Done()
+		n, err := stream.CopyTo(pw, svc.Config.Limits.MaxPDFBytes)
+		stream.Close(err)
+		if err != nil {
+			logging.Error("PDF stream aborted", "bytes", n, "error", err.Error(), "request_id", requestID)
+		} else {
+			logging.Info("PDF streamed", "filename", params.Filename, "bytes", n, "request_id", requestID)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	// The page count is unknown until the transfer completed, so X-PDF-Pages is not sent.
+	setRenderHeaders(c, stream.timing)
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename="+params.Filename)
+	c.Context().SetBodyStream(pr, -1)
+	return nil
+}
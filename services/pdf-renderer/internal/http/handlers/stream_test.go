@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunks returns a next func for copyPDFChunks that serves parts in order and counts the reads.
+func chunks(reads *int, parts ...string) func() ([]byte, bool, error) {
+	return func() ([]byte, bool, error) {
+		i := *reads
+		*reads++
+		if i >= len(parts) {
+			return nil, true, errors.New("read past EOF")
+		}
+		return []byte(parts[i]), i == len(parts)-1, nil
+	}
+}
+
+func TestCopyPDFChunks(t *testing.T) {
+	var buf bytes.Buffer
+	var reads int
+	n, err := copyPDFChunks(chunks(&reads, "%PDF-", "1.4 ", "%%EOF"), &buf, 14)
+	require.NoError(t, err)
+	assert.EqualValues(t, 14, n)
+	assert.Equal(t, "%PDF-1.4 %%EOF", buf.String())
+	assert.Equal(t, 3, reads)
+}
+
+func TestCopyPDFChunks_AbortsOnceLimitIsExceeded(t *testing.T) {
+	var buf bytes.Buffer
+	var reads int
+	n, err := copyPDFChunks(chunks(&reads, "%PDF-", "1.4 ", "xxxx", "%%EOF"), &buf, 10)
+	assert.ErrorIs(t, err, errPDFTooLarge)
+	assert.EqualValues(t, 9, n)
+	assert.Equal(t, 3, reads, "the rest of the stream is not read")
+	assert.Equal(t, "%PDF-1.4 ", buf.String(), "the chunk crossing the limit is not written")
+}
+
+func TestCopyPDFChunks_Unlimited(t *testing.T) {
+	var buf bytes.Buffer
+	var reads int
+	_, err := copyPDFChunks(chunks(&reads, "%PDF-1.4", ""), &buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4", buf.String())
+}
@@ -15,7 +15,9 @@ import (
 //
 // Auth and rate limiting are intentionally NOT handled here anymore.
 // They are enforced at the gateway (Envoy) via an external auth service.
-func Register(app *fiber.App, cfg config.Config) {
+//
+// ready backs the readiness endpoint; it may be nil, in which case the service is always ready.
+func Register(app *fiber.App, cfg config.Config, ready func() bool) {
 	_ = cfg // kept for forward-compat; middleware might use config later.
 
 	app.Use(cors.New())
@@ -26,9 +28,13 @@ func Register(app *fiber.App, cfg config.Config) {
 		},
 	}))
 
+	// Liveness stays green while draining; readiness flips so the gateway stops routing to us.
 	app.Use(healthcheck.New(healthcheck.Config{
 		LivenessEndpoint:  "/ops/health",
-		ReadinessEndpoint: "/ops/health",
+		ReadinessEndpoint: "/ops/ready",
+		ReadinessProbe: func(c *fiber.Ctx) bool {
+			return ready == nil || ready()
+		},
 	}))
 
 	app.Use(func(c *fiber.Ctx) error {
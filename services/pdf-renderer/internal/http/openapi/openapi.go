@@ -0,0 +1,69 @@
+// Package openapi serves the renderer's OpenAPI 3 document.
+//
+// The document is maintained by hand in openapi.json; instance-specific limits (HTML size, paper
+// formats, render timeout) are filled in from the config and the error codes from package
+// problem when it is served. The server tests check every registered route and sample responses
+// against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/http/problem"
+)
+
+//go:embed openapi.json
+var document []byte
+
+// Spec returns the OpenAPI document with the limits of cfg applied.
+func Spec(cfg config.Config) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("invalid embedded OpenAPI document: %w", err)
+	}
+
+	info := doc["info"].(map[string]any)
+	info["x-limits"] = map[string]any{
+		"max_html_bytes": cfg.Limits.MaxHTMLBytes,
+		"max_pdf_bytes":  cfg.Limits.MaxPDFBytes,
+		"timeout_secs":   cfg.PDF.TimeoutSecs,
+	}
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	if cfg.Limits.MaxHTMLBytes > 0 {
+		set(schemas, cfg.Limits.MaxHTMLBytes, "PDFFormV0", "properties", "html", "maxLength")
+		set(schemas, cfg.Limits.MaxHTMLBytes, "PDFRequestV1", "properties", "source", "properties", "html", "maxLength")
+	}
+	if cfg.PDF.TimeoutSecs > 0 {
+		set(schemas, cfg.PDF.TimeoutSecs*1000, "PDFRequestV1", "properties", "wait", "properties", "timeout_ms", "maximum")
+	}
+
+	schemas["ErrorCode"].(map[string]any)["enum"] = problem.Codes()
+
+	formats := make([]string, 0, len(cfg.PDF.PaperSizes))
+	for name := range cfg.PDF.PaperSizes {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	format := schemas["PaperFormat"].(map[string]any)
+	format["description"] = fmt.Sprintf("%s Available: %s.", format["description"], strings.Join(formats, ", "))
+	if cfg.PDF.DefaultPaper != "" {
+		format["default"] = cfg.PDF.DefaultPaper
+	}
+
+	return json.Marshal(doc)
+}
+
+// set assigns value at the nested object path below m. Missing objects are an error in the
+// embedded document and panic, which the tests catch.
+func set(m map[string]any, value any, path ...string) {
+	for _, key := range path[:len(path)-1] {
+		m = m[key].(map[string]any)
+	}
+	m[path[len(path)-1]] = value
+}
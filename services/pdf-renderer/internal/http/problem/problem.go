@@ -0,0 +1,185 @@
+// Package problem renders errors as RFC 7807 problem details (application/problem+json).
+//
+// Handlers return *domain.Error or *domain.ValidationError; this package maps their codes to
+// HTTP statuses. Any other error is reported as INTERNAL without its message, so internals such
+// as Chrome or Redis errors never reach clients.
+package problem
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+
+	"pdf-renderer/internal/domain"
+	"pdf-renderer/internal/infra/logging"
+)
+
+// MIMEProblemJSON is the content type of problem responses.
+const MIMEProblemJSON = "application/problem+json"
+
+// typePrefix prefixes the code to form the problem type URI.
+const typePrefix = "urn:html2pdf:error:"
+
+// Details is an RFC 7807 problem document with the service's extension members.
+type Details struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      domain.Code         `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []domain.FieldError `json:"errors,omitempty"`
+}
+
+var statusByCode = map[domain.Code]int{
+	domain.CodeInvalidRequest:       http.StatusBadRequest,
+	domain.CodeInvalidJSON:          http.StatusBadRequest,
+	domain.CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	domain.CodeUnsupportedVersion:   http.StatusBadRequest,
+	domain.CodeInvalidSource:        http.StatusBadRequest,
+	domain.CodeInvalidURL:           http.StatusBadRequest,
+	domain.CodeInvalidHTML:          http.StatusBadRequest,
+	domain.CodeHTMLTooLarge:         http.StatusRequestEntityTooLarge,
+	domain.CodeInvalidFormat:        http.StatusBadRequest,
+	domain.CodeInvalidOrientation:   http.StatusBadRequest,
+	domain.CodeInvalidMargin:        http.StatusBadRequest,
+	domain.CodeInvalidFilename:      http.StatusBadRequest,
+	domain.CodeInvalidCacheTTL:      http.StatusBadRequest,
+	domain.CodeInvalidOutput:        http.StatusBadRequest,
+	domain.CodeInvalidWait:          http.StatusBadRequest,
+	domain.CodeInvalidEmulation:     http.StatusBadRequest,
+	domain.CodeInvalidMetadata:      http.StatusBadRequest,
+	domain.CodeInvalidPDFA:          http.StatusBadRequest,
+	domain.CodeInvalidEncryption:    http.StatusBadRequest,
+	domain.CodeInvalidWatermark:     http.StatusBadRequest,
+	domain.CodeInvalidSignature:     http.StatusBadRequest,
+	domain.CodeSignatureForbidden:   http.StatusForbidden,
+	domain.CodeInvalidOptimization:  http.StatusBadRequest,
+	domain.CodeInvalidSplit:         http.StatusBadRequest,
+	domain.CodeInvalidOutline:       http.StatusBadRequest,
+	domain.CodeInvalidAttachment:    http.StatusBadRequest,
+	domain.CodeInvalidForm:          http.StatusBadRequest,
+	domain.CodeInvalidPreview:       http.StatusBadRequest,
+	domain.CodeInvalidToken:         http.StatusBadRequest,
+
+	domain.CodePDFTooLarge:       http.StatusRequestEntityTooLarge,
+	domain.CodeRenderTimeout:     http.StatusRequestTimeout,
+	domain.CodePoolSaturated:     http.StatusServiceUnavailable,
+	domain.CodeChromeCrashed:     http.StatusServiceUnavailable,
+	domain.CodeChromeUnavailable: http.StatusServiceUnavailable,
+	domain.CodeNavigationFailed:  http.StatusBadGateway,
+	domain.CodeRenderFailed:      http.StatusInternalServerError,
+	domain.CodePostProcessFailed: http.StatusInternalServerError,
+	domain.CodePDFANotConformant: http.StatusUnprocessableEntity,
+
+	domain.CodeShuttingDown:        http.StatusServiceUnavailable,
+	domain.CodeCacheDisabled:       http.StatusServiceUnavailable,
+	domain.CodeCacheUnavailable:    http.StatusBadGateway,
+	domain.CodeStorageDisabled:     http.StatusServiceUnavailable,
+	domain.CodeStorageUploadFailed: http.StatusBadGateway,
+	domain.CodeSigningUnavailable:  http.StatusServiceUnavailable,
+	domain.CodePreviewDisabled:     http.StatusServiceUnavailable,
+
+	domain.CodeBadRequest:       http.StatusBadRequest,
+	domain.CodeNotFound:         http.StatusNotFound,
+	domain.CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	domain.CodeRequestTooLarge:  http.StatusRequestEntityTooLarge,
+	domain.CodeInternal:         http.StatusInternalServerError,
+}
+
+// codeByStatus names fiber errors raised by the framework itself (routing, body limit).
+var codeByStatus = map[int]domain.Code{
+	http.StatusBadRequest:            domain.CodeBadRequest,
+	http.StatusNotFound:              domain.CodeNotFound,
+	http.StatusMethodNotAllowed:      domain.CodeMethodNotAllowed,
+	http.StatusRequestEntityTooLarge: domain.CodeRequestTooLarge,
+	http.StatusUnsupportedMediaType:  domain.CodeUnsupportedMediaType,
+}
+
+// Status returns the HTTP status for code; unknown codes are 500.
+func Status(code domain.Code) int {
+	if s, ok := statusByCode[code]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// Codes returns every error code the service reports, sorted.
+func Codes() []domain.Code {
+	codes := make([]domain.Code, 0, len(statusByCode))
+	for code := range statusByCode {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// From converts err into problem details.
+func From(err error) Details {
+	var (
+		de *domain.Error
+		ve *domain.ValidationError
+		fe *fiber.Error
+		p  Details
+	)
+	switch {
+	case errors.As(err, &ve):
+		p.Code = ve.Code()
+		p.Errors = ve.Fields
+		p.Status = http.StatusBadRequest
+		if Status(p.Code) == http.StatusRequestEntityTooLarge {
+			p.Status = http.StatusRequestEntityTooLarge
+		}
+		p.Detail = "Invalid request"
+		if len(ve.Fields) == 1 {
+			p.Detail = ve.Fields[0].Message
+		}
+	case errors.As(err, &de):
+		p.Code = de.Code
+		p.Status = Status(de.Code)
+		p.Detail = de.Message
+	case errors.As(err, &fe):
+		p.Status = fe.Code
+		p.Code = codeByStatus[fe.Code]
+		p.Detail = fe.Message
+		if fe.Code >= http.StatusInternalServerError {
+			p.Detail = http.StatusText(fe.Code)
+		}
+		if p.Code == "" {
+			p.Code = domain.CodeInternal
+			if fe.Code < http.StatusInternalServerError {
+				p.Code = domain.CodeBadRequest
+			}
+		}
+	default:
+		p.Code = domain.CodeInternal
+		p.Status = http.StatusInternalServerError
+		p.Detail = "Internal Server Error"
+	}
+
+	p.Type = typePrefix + string(p.Code)
+	p.Title = http.StatusText(p.Status)
+	return p
+}
+
+// Write sends err as a problem response.
+func Write(c *fiber.Ctx, err error) error {
+	p := From(err)
+	p.Instance = c.Path()
+	p.RequestID = c.GetRespHeader(fiber.HeaderXRequestID)
+	if p.RequestID == "" {
+		p.RequestID = c.Get(fiber.HeaderXRequestID)
+	}
+
+	logging.Warn("Request failed", "path", c.Path(), "status", p.Status, "code", p.Code, "error", err.Error(), "request_id", p.RequestID)
+
+	return c.Status(p.Status).JSON(p, MIMEProblemJSON)
+}
+
+// ErrorHandler is a fiber.ErrorHandler that answers every error with problem details.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	return Write(c, err)
+}
@@ -0,0 +1,77 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/domain"
+)
+
+func TestFrom(t *testing.T) {
+	cause := errors.New("cdp: websocket: close 1006 (abnormal closure)")
+
+	p := From(fmt.Errorf("render: %w", domain.WrapError(domain.CodeChromeCrashed, "Chrome session interrupted", cause)))
+	assert.Equal(t, 503, p.Status)
+	assert.Equal(t, domain.CodeChromeCrashed, p.Code)
+	assert.Equal(t, "urn:html2pdf:error:CHROME_CRASHED", p.Type)
+	assert.Equal(t, "Service Unavailable", p.Title)
+	assert.Equal(t, "Chrome session interrupted", p.Detail, "the cause is not exposed")
+
+	p = From(cause)
+	assert.Equal(t, 500, p.Status)
+	assert.Equal(t, domain.CodeInternal, p.Code)
+	assert.Equal(t, "Internal Server Error", p.Detail)
+
+	p = From(fiber.ErrMethodNotAllowed)
+	assert.Equal(t, 405, p.Status)
+	assert.Equal(t, domain.CodeMethodNotAllowed, p.Code)
+
+	p = From(fiber.NewError(fiber.StatusInternalServerError, "secret internals"))
+	assert.Equal(t, "Internal Server Error", p.Detail)
+}
+
+func TestFrom_ValidationError(t *testing.T) {
+	tooLarge := domain.FieldError{Field: "source.html", Code: domain.CodeHTMLTooLarge, Message: "HTML input exceeds 10 bytes"}
+	badMargin := domain.FieldError{Field: "page.margin", Code: domain.CodeInvalidMargin, Message: "Invalid margin"}
+
+	p := From(&domain.ValidationError{Fields: []domain.FieldError{tooLarge}})
+	assert.Equal(t, 413, p.Status)
+	assert.Equal(t, domain.CodeHTMLTooLarge, p.Code)
+	assert.Equal(t, tooLarge.Message, p.Detail)
+
+	p = From(&domain.ValidationError{Fields: []domain.FieldError{tooLarge, badMargin}})
+	assert.Equal(t, 400, p.Status)
+	assert.Equal(t, domain.CodeInvalidRequest, p.Code)
+	assert.Len(t, p.Errors, 2)
+}
+
+func TestErrorHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(requestid.New())
+	app.Get("/pdf", func(c *fiber.Ctx) error {
+		return domain.NewError(domain.CodeInvalidFormat, "Invalid format: not supported")
+	})
+
+	req := httptest.NewRequest("GET", "/pdf", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "req-1")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, MIMEProblemJSON, resp.Header.Get(fiber.HeaderContentType))
+
+	body, _ := io.ReadAll(resp.Body)
+	var p Details
+	require.NoError(t, json.Unmarshal(body, &p))
+	assert.Equal(t, domain.CodeInvalidFormat, p.Code)
+	assert.Equal(t, "req-1", p.RequestID)
+	assert.Equal(t, "/pdf", p.Instance)
+}
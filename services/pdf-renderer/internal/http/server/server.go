@@ -2,8 +2,11 @@ package server
 
 import (
 	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
 	"pdf-renderer/internal/http/handlers"
 	"pdf-renderer/internal/http/middleware"
+	"pdf-renderer/internal/http/openapi"
+	"pdf-renderer/internal/http/problem"
 	"pdf-renderer/internal/infra/logging"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,6 +16,10 @@ import (
 type Deps struct {
 	Config config.Config
 	Redis  *redis.Client
+
+	// PDF is the shared render service. If nil, New creates one from Config and Redis.
+	// Pass it in when the caller needs to drain and close it on shutdown.
+	PDF *handlers.PDFService
 }
 
 // New creates and configures a new Fiber app instance.
@@ -22,44 +29,61 @@ func New(deps Deps) *fiber.App {
 	app := fiber.New(fiber.Config{
 		Prefork:               cfg.Server.Prefork,
 		DisableStartupMessage: true,
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			msg := "Internal Server Error"
-
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-				msg = e.Message
-			}
-
-			logging.Warn("Request failed", "path", c.Path(), "status", code, "message", msg)
-
-			return c.Status(code).JSON(fiber.Map{
-				"error": fiber.Map{
-					"code":    code,
-					"message": msg,
-				},
-			})
-		},
+		// Every error is answered as application/problem+json with a stable code.
+		ErrorHandler: problem.ErrorHandler,
 	})
 
-	middleware.Register(app, cfg)
-	registerRoutes(app, cfg, deps.Redis)
+	// Create one shared service instance so /v0/pdf (GET+POST) share the same Chrome pool.
+	svc := deps.PDF
+	if svc == nil {
+		svc = handlers.NewPDFService(cfg, deps.Redis)
+	}
+
+	middleware.Register(app, cfg, svc.Ready)
+	registerRoutes(app, svc)
 
-	// Ensure all responses, including 404s, return JSON.
+	// Ensure all responses, including 404s, return problem details.
 	app.Use(func(c *fiber.Ctx) error {
-		return fiber.NewError(fiber.StatusNotFound, "Not Found")
+		return domain.NewError(domain.CodeNotFound, "Not Found")
 	})
 
 	return app
 }
 
-func registerRoutes(app *fiber.App, cfg config.Config, redis *redis.Client) {
+func registerRoutes(app *fiber.App, svc *handlers.PDFService) {
 	v0 := app.Group("/v0")
 
-	// Create one shared service instance so /v0/pdf (GET+POST) share the same Chrome pool.
-	svc := handlers.NewPDFService(cfg, redis)
-
 	v0.Post("/pdf", svc.HandleConversion)
+	v0.Post("/pdf/fill", svc.HandleFill)
 	v0.Get("/pdf", svc.HandleURLConversion)
 	v0.Get("/chrome/stats", svc.HandleChromeStats)
+	v0.Get("/openapi.json", openAPIHandler(*svc.Config))
+
+	// v1 takes a JSON body (handlers.PDFRequestV1) and reports all validation errors at once.
+	v1 := app.Group("/v1")
+	v1.Post("/pdf", svc.HandleConversionV1)
+
+	// Cache management. /ops/* requires a token with the ops scope at the gateway.
+	ops := app.Group("/ops")
+	ops.Get("/cache/stats", svc.HandleCacheStats)
+	ops.Delete("/cache/entry", svc.HandlePurgeEntry)
+	ops.Delete("/cache/url", svc.HandlePurgeURL)
+	ops.Delete("/cache/token", svc.HandlePurgeToken)
+	ops.Delete("/cache", svc.HandleFlushCache)
+}
+
+// openAPIHandler serves the OpenAPI document for cfg. Every route added in registerRoutes must be
+// described in internal/http/openapi/openapi.json; server_test.go fails otherwise.
+func openAPIHandler(cfg config.Config) fiber.Handler {
+	spec, err := openapi.Spec(cfg)
+	if err != nil {
+		logging.Error("OpenAPI document unavailable", "error", err)
+	}
+	return func(c *fiber.Ctx) error {
+		if err != nil {
+			return domain.WrapError(domain.CodeInternal, "OpenAPI document unavailable", err)
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(spec)
+	}
 }
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/http/handlers"
+	"pdf-renderer/internal/http/openapi"
+	"pdf-renderer/internal/infra/cache"
+)
+
+func testConfig() config.Config {
+	var cfg config.Config
+	cfg.Limits.MaxHTMLBytes = 1024
+	cfg.Limits.MaxPDFBytes = 1024 * 1024
+	cfg.PDF.DefaultPaper = "A4"
+	cfg.PDF.PaperSizes = map[string]config.PaperSize{
+		"A4": {Width: 8.27, Height: 11.69},
+	}
+	cfg.PDF.TimeoutSecs = 30
+	return cfg
+}
+
+// warmCache answers every lookup with the same PDF so requests never reach Chrome.
+type warmCache struct {
+	*cache.Memory
+	entry *cache.Entry
+}
+
+func (w *warmCache) Get(context.Context, string) (*cache.Entry, error) { return w.entry, nil }
+
+func (w *warmCache) GetMeta(context.Context, string) (*cache.Meta, error) {
+	return &w.entry.Meta, nil
+}
+
+func newTestApp(t *testing.T) (*fiber.App, *openapi3.T) {
+	t.Helper()
+	cfg := testConfig()
+
+	svc := handlers.NewPDFService(cfg, nil)
+	now := time.Now()
+	svc.Cache = &warmCache{
+		Memory: cache.NewMemory(0, 0, 0),
+		entry: &cache.Entry{
+			Data: []byte("%PDF-1.4 cached"),
+			Meta: cache.Meta{ETag: `"abc"`, Size: 15, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		},
+	}
+	app := New(Deps{Config: cfg, PDF: svc})
+
+	spec, err := openapi.Spec(cfg)
+	require.NoError(t, err)
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+	return app, doc
+}
+
+func TestOpenAPI_DescribesEveryRoute(t *testing.T) {
+	app, doc := newTestApp(t)
+
+	registered := map[string]bool{}
+	// Fiber adds HEAD to every GET route; only the ones with a meaning of their own are documented.
+	heads := map[string]bool{}
+	for _, r := range app.GetRoutes(true) {
+		if r.Method == fiber.MethodHead {
+			heads[r.Method+" "+r.Path] = true
+			continue
+		}
+		registered[r.Method+" "+r.Path] = true
+	}
+	// Served by the healthcheck middleware rather than a route.
+	registered["GET /ops/health"] = true
+	registered["GET /ops/ready"] = true
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	for route := range registered {
+		assert.True(t, documented[route], "route %s is missing from openapi.json", route)
+	}
+	for op := range documented {
+		assert.True(t, registered[op] || heads[op], "openapi.json documents %s, which is not registered", op)
+	}
+}
+
+func TestOpenAPI_AppliesConfigLimits(t *testing.T) {
+	_, doc := newTestApp(t)
+
+	html := doc.Components.Schemas["PDFFormV0"].Value.Properties["html"].Value
+	require.NotNil(t, html.MaxLength)
+	assert.EqualValues(t, 1024, *html.MaxLength)
+
+	timeout := doc.Components.Schemas["PDFRequestV1"].Value.Properties["wait"].Value.Properties["timeout_ms"].Value
+	require.NotNil(t, timeout.Max)
+	assert.EqualValues(t, 30000, *timeout.Max)
+
+	assert.Contains(t, doc.Components.Schemas["PaperFormat"].Value.Description, "Available: A4.")
+	assert.Equal(t, float64(1024*1024), doc.Info.Extensions["x-limits"].(map[string]any)["max_pdf_bytes"])
+}
+
+func TestOpenAPI_HandlersMatchSpec(t *testing.T) {
+	app, doc := newTestApp(t)
+	router, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+
+	openapi3filter.RegisterBodyDecoder("application/pdf", openapi3filter.FileBodyDecoder)
+	defer openapi3filter.UnregisterBodyDecoder("application/pdf")
+
+	// The form decoder reports absent optional fields as null, which then fails their
+	// non-nullable schemas; drop them so only the fields actually sent are validated.
+	formDecoder := openapi3filter.RegisteredBodyDecoder(fiber.MIMEApplicationForm)
+	openapi3filter.RegisterBodyDecoder(fiber.MIMEApplicationForm,
+		func(body io.Reader, h http.Header, schema *openapi3.SchemaRef, enc openapi3filter.EncodingFn) (any, error) {
+			v, err := formDecoder(body, h, schema, enc)
+			if m, ok := v.(map[string]any); ok {
+				for k, field := range m {
+					if field == nil {
+						delete(m, k)
+					}
+				}
+			}
+			return v, err
+		})
+	defer openapi3filter.RegisterBodyDecoder(fiber.MIMEApplicationForm, formDecoder)
+
+	form := func(v url.Values) io.Reader { return strings.NewReader(v.Encode()) }
+	const boundary = "sample-boundary"
+	multipartForm := "multipart/form-data; boundary=" + boundary
+	upload := func(v map[string]string, pdf string) io.Reader {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		_ = mw.SetBoundary(boundary)
+		for k, value := range v {
+			_ = mw.WriteField(k, value)
+		}
+		if pdf != "" {
+			fw, _ := mw.CreateFormFile("pdf", "form.pdf")
+			_, _ = fw.Write([]byte(pdf))
+		}
+		_ = mw.Close()
+		return &b
+	}
+	html := "<b>Hello World!</b>"
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        io.Reader
+		header      map[string]string
+		status      int
+		// badRequest marks deliberately invalid requests; only the response is checked.
+		badRequest bool
+	}{
+		{name: "v0 html", method: "POST", target: "/v0/pdf", contentType: fiber.MIMEApplicationForm,
+			body: form(url.Values{"html": {html}, "margin": {"0.5"}}), status: 200},
+		{name: "v0 html not modified", method: "POST", target: "/v0/pdf", contentType: fiber.MIMEApplicationForm,
+			body: form(url.Values{"html": {html}}), header: map[string]string{"If-None-Match": `"abc"`}, status: 304},
+		{name: "v0 html too short", method: "POST", target: "/v0/pdf", contentType: fiber.MIMEApplicationForm,
+			body: form(url.Values{"html": {"<p>"}}), status: 400, badRequest: true},
+		{name: "v0 html too large", method: "POST", target: "/v0/pdf", contentType: fiber.MIMEApplicationForm,
+			body: form(url.Values{"html": {strings.Repeat("x", 2048)}}), status: 413, badRequest: true},
+		{name: "v0 url", method: "GET", target: "/v0/pdf?url=https://example.com&orientation=landscape", status: 200},
+		{name: "v0 url watermark", method: "GET", target: "/v0/pdf?url=https://example.com&watermark_text=DRAFT&watermark_opacity=0.3", status: 200},
+		{name: "v0 url head", method: "HEAD", target: "/v0/pdf?url=https://example.com", status: 200},
+		{name: "v0 html dry run", method: "POST", target: "/v0/pdf", contentType: fiber.MIMEApplicationForm,
+			body: form(url.Values{"html": {html}, "dry_run": {"true"}}), status: 204},
+		{name: "v0 url missing", method: "GET", target: "/v0/pdf", status: 400, badRequest: true},
+		{name: "v1 html", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"version":"1","source":{"html":"` + html + `"},"page":{"margin":0.5},"wait":{"strategy":"load"}}`), status: 200},
+		{name: "v1 metadata", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"metadata":{"title":"Report","author":"Finance","xmp":true}}`), status: 200},
+		{name: "v1 metadata too long", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"metadata":{"title":"` + strings.Repeat("x", 1001) + `"}}`), status: 400, badRequest: true},
+		{name: "v1 pdfa", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"pdfa":"2b"}}`), status: 200},
+		{name: "v1 pdfa unsupported", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"pdfa":"1a"}}`), status: 400, badRequest: true},
+		{name: "v1 encryption without password", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"encryption":{"permissions":["print"]}}`), status: 400},
+		{name: "v1 watermark", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"url":"https://example.com"},"watermark":{"text":"DRAFT","color":"#ff0000","position":"tiled","pages":"1-2"}}`), status: 200},
+		{name: "v1 watermark position", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"watermark":{"text":"DRAFT","position":"middle"}}`), status: 400, badRequest: true},
+		{name: "v1 signature without api key", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"signature":{"reason":"Approved","box":{"page":1,"position":"top-left","width":150}}}`), status: 403},
+		{name: "v1 signature box position", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"signature":{"box":{"position":"tiled"}}}`), status: 400, badRequest: true},
+		{name: "v1 optimize", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"optimize":{"linearize":true,"deduplicate":true,"image_dpi":150}}`), status: 200},
+		{name: "v1 optimize linearize and compress", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"optimize":{"linearize":true,"compress":true}}`), status: 400},
+		{name: "v0 url optimize", method: "GET", target: "/v0/pdf?url=https://example.com&optimize_compress=true&optimize_image_dpi=96", status: 200},
+		{name: "v1 split dry run", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"filename":"labels.pdf","split":"per_page","dry_run":true}}`), status: 204},
+		{name: "v1 split storage", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"type":"storage","split":"every:2"}}`), status: 400},
+		{name: "v0 url split", method: "GET", target: "/v0/pdf?url=https://example.com&split=every:0", status: 400, badRequest: true},
+		{name: "v1 outline", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"outline":true,"outline_depth":3,"tagged":true}}`), status: 200},
+		{name: "v0 url outline depth", method: "GET", target: "/v0/pdf?url=https://example.com&outline=true&outline_depth=9", status: 400, badRequest: true},
+		{name: "v1 interactive forms", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"<input name=email value=jane@example.com>"},"output":{"interactive_forms":true}}`), status: 200},
+		{name: "v1 interactive forms pdfa", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"pdfa":"2b","interactive_forms":true}}`), status: 400},
+		{name: "v1 png without pdf.js", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"type":"png","dpi":48,"pages":"1"}}`), status: 503},
+		{name: "v1 png with split", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"type":"png","split":"per_page"}}`), status: 400},
+		{name: "v1 attachments", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"pdfa":"3b"},"attachments":[{"filename":"data.csv","content":"YSxiCjEsMgo=","mime_type":"text/csv","relationship":"data"}]}`), status: 200},
+		{name: "v1 facturx pdfa 2b", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"pdfa":"2b"},"facturx":{"xml":"PEludm9pY2UvPg=="}}`), status: 400},
+		{name: "v1 attachment filename", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"attachments":[{"filename":"../data.csv","content":"YSxi"}]}`), status: 400, badRequest: true},
+		// The multipart decoder of the validator does not read "true" as a boolean, so these
+		// samples leave out flatten and dry_run.
+		{name: "v0 fill", method: "POST", target: "/v0/pdf/fill", contentType: multipartForm,
+			body: upload(map[string]string{"fields": `{"name":"Jane Doe","agree":true,"toppings":["Ham","Olives"]}`, "title": "Application"}, "%PDF-1.7 form"), status: 200},
+		{name: "v0 fill template name", method: "POST", target: "/v0/pdf/fill", contentType: multipartForm,
+			body: upload(map[string]string{"template": "../invoice"}, ""), status: 400, badRequest: true},
+		{name: "v0 fill without templates", method: "POST", target: "/v0/pdf/fill", contentType: multipartForm,
+			body: upload(map[string]string{"template": "invoice"}, ""), status: 400},
+		{name: "v0 url sign without profile", method: "GET", target: "/v0/pdf?url=https://example.com&sign=true&signature_box_position=center",
+			header: map[string]string{"X-API-Key": "secret"}, status: 400},
+		{name: "v1 dry run", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"` + html + `"},"output":{"dry_run":true}}`), status: 204},
+		{name: "v1 field errors", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationJSON,
+			body: strings.NewReader(`{"source":{"html":"<p>"},"page":{"margin":9}}`), status: 400, badRequest: true},
+		{name: "v1 wrong content type", method: "POST", target: "/v1/pdf", contentType: fiber.MIMEApplicationForm,
+			body: form(url.Values{"html": {html}}), status: 415, badRequest: true},
+		{name: "chrome stats", method: "GET", target: "/v0/chrome/stats", status: 200},
+		{name: "openapi", method: "GET", target: "/v0/openapi.json", status: 200},
+		{name: "health", method: "GET", target: "/ops/health", status: 200},
+		{name: "ready", method: "GET", target: "/ops/ready", status: 200},
+		{name: "cache stats", method: "GET", target: "/ops/cache/stats", status: 200},
+		{name: "purge entry", method: "DELETE", target: "/ops/cache/entry?url=https://example.com", status: 200},
+		{name: "purge url", method: "DELETE", target: "/ops/cache/url?url=https://example.com", status: 200},
+		{name: "purge url missing", method: "DELETE", target: "/ops/cache/url", status: 400, badRequest: true},
+		{name: "purge token", method: "DELETE", target: "/ops/cache/token", contentType: fiber.MIMEApplicationForm,
+			body: form(url.Values{"token": {"secret"}}), status: 200},
+		{name: "flush", method: "DELETE", target: "/ops/cache", status: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reqBody []byte
+			if tt.body != nil {
+				reqBody, _ = io.ReadAll(tt.body)
+			}
+			newRequest := func() *http.Request {
+				req := httptest.NewRequest(tt.method, "http://localhost"+tt.target, bytes.NewReader(reqBody))
+				if tt.contentType != "" {
+					req.Header.Set("Content-Type", tt.contentType)
+				}
+				for k, v := range tt.header {
+					req.Header.Set(k, v)
+				}
+				return req
+			}
+
+			// The validator consumes the body, so the app gets its own copy.
+			req := newRequest()
+			route, params, err := router.FindRoute(req)
+			require.NoError(t, err)
+			in := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: params,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+					SkipSettingDefaults: true,
+				},
+			}
+			if err := openapi3filter.ValidateRequest(context.Background(), in); tt.badRequest {
+				require.Error(t, err, "sample request should violate the spec")
+			} else {
+				require.NoError(t, err)
+			}
+
+			resp, err := app.Test(newRequest(), -1)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			respBody, _ := io.ReadAll(resp.Body)
+			require.Equal(t, tt.status, resp.StatusCode, string(respBody))
+
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: in,
+				Status:                 resp.StatusCode,
+				Header:                 resp.Header,
+				Body:                   io.NopCloser(bytes.NewReader(respBody)),
+				Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+			})
+			assert.NoError(t, err, string(respBody))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package cache stores rendered PDFs behind a backend-agnostic interface.
+//
+// Backends: Redis (shared across replicas), an in-memory LRU, a size-capped filesystem LRU,
+// and a tiered composition (memory L1 in front of Redis L2). The backend is selected with
+// cache.backend in html2pdf.yaml.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+)
+
+// Backend names accepted in cache.backend.
+const (
+	BackendRedis      = "redis"
+	BackendMemory     = "memory"
+	BackendFilesystem = "filesystem"
+	BackendTiered     = "tiered"
+)
+
+// Meta describes a cached PDF. It is kept next to the PDF so conditional requests can be
+// answered without reading the (potentially large) PDF body.
+type Meta struct {
+	ETag         string    `json:"etag"`
+	Size         int       `json:"size"`
+	Pages        int       `json:"pages,omitempty"`         // 0 if unknown
+	OriginalSize int       `json:"original_size,omitempty"` // before optimization; 0 if not optimized
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Entry is a cached PDF together with its metadata.
+type Entry struct {
+	Data []byte
+	Meta Meta
+}
+
+// Stats is a snapshot of a backend for the ops endpoints.
+type Stats struct {
+	Backend    string  `json:"backend"`
+	Entries    int64   `json:"entries"`
+	Bytes      int64   `json:"bytes"`
+	MaxBytes   int64   `json:"max_bytes,omitempty"` // total capacity of the backend; 0 = unlimited or unknown
+	MaxEntries int     `json:"max_entries,omitempty"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+	Evictions  uint64  `json:"evictions"`
+	Tiers      []Stats `json:"tiers,omitempty"`
+
+	// Compression is the codec used for new entries; CompressionRatio is original / stored
+	// bytes over the entries this instance wrote (0 if none yet).
+	Compression      string  `json:"compression,omitempty"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+}
+
+// PDFCache stores rendered PDFs by cache key.
+//
+// Get and GetMeta return (nil, nil) on a miss. Tags (see URLTag, TokenTag) group entries for
+// bulk purges. Delete, PurgeTag and Flush return the number of entries removed.
+type PDFCache interface {
+	Get(ctx context.Context, key string) (*Entry, error)
+	GetMeta(ctx context.Context, key string) (*Meta, error)
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration, tags ...string) error
+	Delete(ctx context.Context, keys ...string) (int64, error)
+	PurgeTag(ctx context.Context, tag string) (int64, error)
+	Flush(ctx context.Context) (int64, error)
+	Stats(ctx context.Context) (Stats, error)
+
+	// Shared reports whether entries are visible to other replicas, i.e. whether waiting for
+	// another replica's render can ever produce a hit.
+	Shared() bool
+}
+
+// URLTag returns the tag grouping every entry rendered from url.
+func URLTag(url string) string {
+	return "url:" + domain.Checksum([]byte(url))
+}
+
+// TokenTag returns the tag grouping every entry rendered for an API token.
+// Only a hash of the token is stored.
+func TokenTag(token string) string {
+	return "token:" + domain.Checksum([]byte(token))
+}
+
+// New builds the backend configured in cfg.Cache. rdb may be nil unless a Redis-backed
+// backend is selected.
+func New(cfg config.Config, rdb *redis.Client) (PDFCache, error) {
+	c := cfg.Cache
+	if !validCodec(c.Redis.Compression) {
+		return nil, fmt.Errorf("unknown cache compression codec %q", c.Redis.Compression)
+	}
+
+	switch c.Backend {
+	case "", BackendRedis:
+		if rdb == nil {
+			return nil, fmt.Errorf("cache backend %q requires redis", BackendRedis)
+		}
+		return NewRedis(rdb, c.Redis.MaxEntryBytes, c.Redis.Compression), nil
+
+	case BackendMemory:
+		return NewMemory(c.Memory.MaxBytes, c.Memory.MaxEntries, 0), nil
+
+	case BackendFilesystem:
+		return NewFilesystem(c.Filesystem.Dir, c.Filesystem.MaxBytes)
+
+	case BackendTiered:
+		if rdb == nil {
+			return nil, fmt.Errorf("cache backend %q requires redis", BackendTiered)
+		}
+		l1 := NewMemory(c.Memory.MaxBytes, c.Memory.MaxEntries, c.Memory.MaxTTL)
+		return NewTiered(l1, NewRedis(rdb, c.Redis.MaxEntryBytes, c.Redis.Compression)), nil
+	}
+
+	return nil, fmt.Errorf("unknown cache backend %q", c.Backend)
+}
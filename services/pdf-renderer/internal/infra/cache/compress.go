@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec names accepted in cache.redis.compression.
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+// Compressed payloads start with a 4-byte magic and a codec byte. A PDF always starts with
+// "%PDF", so entries written before compression existed are recognised and read as is.
+var payloadMagic = []byte("\x00h2p")
+
+const (
+	codecIDGzip byte = 1
+	codecIDZstd byte = 2
+)
+
+// zstdEncoder and zstdDecoder lazily create the shared zstd encoder and decoder (both are safe
+// for concurrent EncodeAll/DecodeAll calls). If creating one failed, every call returns the
+// error, so the entry is not cached or read as a miss.
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+)
+
+// validCodec reports whether name is a supported codec ("" means none).
+func validCodec(name string) bool {
+	switch name {
+	case "", CodecNone, CodecGzip, CodecZstd:
+		return true
+	}
+	return false
+}
+
+// encodePayload compresses data with codec and prepends the header. With no codec, or when
+// compression does not save space, the data is returned unchanged.
+func encodePayload(codec string, data []byte) ([]byte, error) {
+	var id byte
+	var compressed []byte
+
+	switch codec {
+	case "", CodecNone:
+		return data, nil
+
+	case CodecZstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, fmt.Errorf("zstd encoder: %w", err)
+		}
+		id = codecIDZstd
+		compressed = enc.EncodeAll(data, make([]byte, 0, len(data)/2))
+
+	case CodecGzip:
+		id = codecIDGzip
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		compressed = buf.Bytes()
+
+	default:
+		return nil, fmt.Errorf("unknown compression codec %q", codec)
+	}
+
+	if len(compressed)+len(payloadMagic)+1 >= len(data) {
+		return data, nil
+	}
+	out := make([]byte, 0, len(payloadMagic)+1+len(compressed))
+	out = append(out, payloadMagic...)
+	out = append(out, id)
+	return append(out, compressed...), nil
+}
+
+// decodePayload reverses encodePayload. Payloads without the header are returned unchanged.
+func decodePayload(payload []byte) ([]byte, error) {
+	if len(payload) <= len(payloadMagic) || !bytes.HasPrefix(payload, payloadMagic) {
+		return payload, nil
+	}
+	body := payload[len(payloadMagic)+1:]
+
+	switch payload[len(payloadMagic)] {
+	case codecIDZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, fmt.Errorf("zstd decoder: %w", err)
+		}
+		return dec.DecodeAll(body, nil)
+
+	case codecIDGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unknown compression codec id %d", payload[len(payloadMagic)])
+}
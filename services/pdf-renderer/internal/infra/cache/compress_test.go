@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var samplePDF = append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("<< /Type /Font /Subtype /TrueType >>\n"), 200)...)
+
+func TestPayload_RoundTrip(t *testing.T) {
+	for _, codec := range []string{CodecGzip, CodecZstd} {
+		payload, err := encodePayload(codec, samplePDF)
+		require.NoError(t, err, codec)
+		assert.True(t, bytes.HasPrefix(payload, payloadMagic), codec)
+		assert.Less(t, len(payload), len(samplePDF)/4, codec)
+
+		data, err := decodePayload(payload)
+		require.NoError(t, err, codec)
+		assert.Equal(t, samplePDF, data, codec)
+	}
+}
+
+func TestPayload_UncompressedPassThrough(t *testing.T) {
+	// Entries written before compression (and incompressible data) are stored as is.
+	data, err := decodePayload([]byte("%PDF-1.4 legacy"))
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 legacy", string(data))
+
+	payload, err := encodePayload(CodecZstd, []byte("%PDF"))
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF", string(payload))
+
+	_, err = encodePayload("lz4", samplePDF)
+	assert.Error(t, err)
+}
+
+func TestRedis_CompressedEntries(t *testing.T) {
+	ctx := context.Background()
+	plain, srv := newTestRedis(t)
+	r := NewRedis(plain.rdb, 0, CodecZstd)
+
+	// Legacy uncompressed entry is still readable after enabling compression.
+	require.NoError(t, plain.Set(ctx, "old", &Entry{Data: samplePDF, Meta: Meta{Size: len(samplePDF)}}, time.Minute))
+	old, err := r.Get(ctx, "old")
+	require.NoError(t, err)
+	assert.Equal(t, samplePDF, old.Data)
+
+	require.NoError(t, r.Set(ctx, "new", &Entry{Data: samplePDF, Meta: Meta{ETag: `"x"`, Size: len(samplePDF)}}, time.Minute))
+	stored, err := srv.Get("new")
+	require.NoError(t, err)
+	assert.Less(t, len(stored), len(samplePDF))
+
+	got, err := r.Get(ctx, "new")
+	require.NoError(t, err)
+	assert.Equal(t, samplePDF, got.Data)
+	assert.Equal(t, `"x"`, got.Meta.ETag)
+
+	s, err := r.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, CodecZstd, s.Compression)
+	assert.Greater(t, s.CompressionRatio, 4.0)
+}
+
+func TestPayload_ZstdUnavailable(t *testing.T) {
+	payload, err := encodePayload(CodecZstd, samplePDF)
+	require.NoError(t, err)
+
+	encoder, decoder := zstdEncoder, zstdDecoder
+	t.Cleanup(func() { zstdEncoder, zstdDecoder = encoder, decoder })
+	zstdEncoder = func() (*zstd.Encoder, error) { return nil, errors.New("no memory") }
+	zstdDecoder = func() (*zstd.Decoder, error) { return nil, errors.New("no memory") }
+
+	_, err = encodePayload(CodecZstd, samplePDF)
+	assert.ErrorContains(t, err, "zstd encoder")
+	_, err = decodePayload(payload)
+	assert.ErrorContains(t, err, "zstd decoder")
+
+	// Redis caches nothing rather than panicking, and reads the entry as a miss.
+	ctx := context.Background()
+	plain, srv := newTestRedis(t)
+	r := NewRedis(plain.rdb, 0, CodecZstd)
+	assert.Error(t, r.Set(ctx, "k", &Entry{Data: samplePDF, Meta: Meta{Size: len(samplePDF)}}, time.Minute))
+	assert.False(t, srv.Exists("k"))
+
+	require.NoError(t, srv.Set("k", string(payload)))
+	got, err := r.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pdf-renderer/internal/infra/logging"
+)
+
+const (
+	fsDataExt = ".pdf"
+	fsMetaExt = ".json"
+)
+
+// fsRecord is the sidecar file written next to each cached PDF.
+type fsRecord struct {
+	Key       string    `json:"key"`
+	Meta      Meta      `json:"meta"`
+	Tags      []string  `json:"tags,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Filesystem stores PDFs as files in a local directory, evicting least recently used entries
+// once the total size exceeds maxBytes. The index lives in memory and is rebuilt from the
+// sidecar files on startup, so entries survive restarts (but are not shared between hosts).
+type Filesystem struct {
+	dir string
+	now func() time.Time
+
+	mu    sync.Mutex
+	index *lru
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewFilesystem opens (or creates) dir and loads the entries already stored there.
+func NewFilesystem(dir string, maxBytes int64) (*Filesystem, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "html2pdf-cache")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create cache dir: %w", err)
+	}
+
+	f := &Filesystem{dir: dir, now: time.Now}
+	f.index = newLRU(maxBytes, 0, f.removeFiles)
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Filesystem) Get(_ context.Context, key string) (*Entry, error) {
+	f.mu.Lock()
+	it, ok := f.index.get(key, f.now())
+	f.mu.Unlock()
+	if !ok {
+		f.misses.Add(1)
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(f.path(key, fsDataExt))
+	if err != nil {
+		// File vanished underneath us (e.g. manual cleanup); drop it from the index.
+		f.mu.Lock()
+		f.index.remove(key)
+		f.mu.Unlock()
+		f.misses.Add(1)
+		return nil, nil
+	}
+	f.hits.Add(1)
+
+	// Persist recency so the LRU order survives restarts.
+	now := f.now()
+	_ = os.Chtimes(f.path(key, fsMetaExt), now, now)
+
+	return &Entry{Data: data, Meta: it.value.(Meta)}, nil
+}
+
+func (f *Filesystem) GetMeta(_ context.Context, key string) (*Meta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	it, ok := f.index.get(key, f.now())
+	if !ok {
+		return nil, nil
+	}
+	meta := it.value.(Meta)
+	return &meta, nil
+}
+
+func (f *Filesystem) Set(_ context.Context, key string, entry *Entry, ttl time.Duration, tags ...string) error {
+	size := int64(len(entry.Data))
+
+	f.mu.Lock()
+	fits := f.index.fits(size)
+	if !fits {
+		// Too large for this cache; drop any older copy so readers don't get stale data.
+		f.index.remove(key)
+	}
+	f.mu.Unlock()
+	if !fits {
+		return nil
+	}
+
+	rec := fsRecord{Key: key, Meta: entry.Meta, Tags: tags}
+	if ttl > 0 {
+		rec.ExpiresAt = f.now().Add(ttl)
+	}
+	sidecar, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	// Write both files atomically; the sidecar last, since load() keys off it.
+	if err := writeFileAtomic(f.path(key, fsDataExt), entry.Data); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.path(key, fsMetaExt), sidecar); err != nil {
+		_ = os.Remove(f.path(key, fsDataExt))
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index.put(&lruItem{key: key, size: size, expiresAt: rec.ExpiresAt, tags: tags, value: entry.Meta})
+	return nil
+}
+
+func (f *Filesystem) Delete(_ context.Context, keys ...string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int64
+	for _, k := range keys {
+		if f.index.remove(k) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *Filesystem) PurgeTag(ctx context.Context, tag string) (int64, error) {
+	f.mu.Lock()
+	keys := f.index.keysForTag(tag)
+	f.mu.Unlock()
+	return f.Delete(ctx, keys...)
+}
+
+func (f *Filesystem) Flush(_ context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.index.clear(), nil
+}
+
+func (f *Filesystem) Stats(_ context.Context) (Stats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return Stats{
+		Backend:   BackendFilesystem,
+		Entries:   int64(f.index.len()),
+		Bytes:     f.index.bytes,
+		MaxBytes:  f.index.maxBytes,
+		Hits:      f.hits.Load(),
+		Misses:    f.misses.Load(),
+		Evictions: f.index.evictions,
+	}, nil
+}
+
+func (f *Filesystem) Shared() bool { return false }
+
+// path maps a cache key to a file name; keys are hashed so any key is a safe file name.
+func (f *Filesystem) path(key, ext string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:16])+ext)
+}
+
+// removeFiles is the index's removal hook: evicted, expired and deleted entries lose their files.
+func (f *Filesystem) removeFiles(it *lruItem) {
+	_ = os.Remove(f.path(it.key, fsMetaExt))
+	_ = os.Remove(f.path(it.key, fsDataExt))
+}
+
+// load rebuilds the index from the sidecar files, oldest access first, dropping expired
+// entries, orphaned files and leftovers of interrupted writes.
+func (f *Filesystem) load() error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return fmt.Errorf("cannot read cache dir: %w", err)
+	}
+
+	type loaded struct {
+		rec   fsRecord
+		size  int64
+		atime time.Time
+	}
+	var items []loaded
+	keep := map[string]bool{}
+	now := f.now()
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, fsMetaExt) {
+			continue
+		}
+		sidecar := filepath.Join(f.dir, name)
+		raw, err := os.ReadFile(sidecar)
+		if err != nil {
+			continue
+		}
+		var rec fsRecord
+		if json.Unmarshal(raw, &rec) != nil || rec.Key == "" || f.path(rec.Key, fsMetaExt) != sidecar {
+			continue
+		}
+		if !rec.ExpiresAt.IsZero() && now.After(rec.ExpiresAt) {
+			continue
+		}
+		dataInfo, err := os.Stat(f.path(rec.Key, fsDataExt))
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		items = append(items, loaded{rec: rec, size: dataInfo.Size(), atime: info.ModTime()})
+		keep[name] = true
+		keep[filepath.Base(f.path(rec.Key, fsDataExt))] = true
+	}
+
+	// Remove everything that is not a live entry (expired, orphaned, temp files).
+	var removed int
+	for _, e := range entries {
+		if e.IsDir() || keep[e.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(f.dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logging.Warn("Cache cleanup failed", "file", e.Name(), "error", err)
+			continue
+		}
+		removed++
+	}
+
+	// Oldest access first, so the most recently used entries end up at the front and
+	// anything over budget (e.g. after lowering max_bytes) is evicted from the LRU end.
+	sort.Slice(items, func(i, j int) bool { return items[i].atime.Before(items[j].atime) })
+	for _, l := range items {
+		f.index.put(&lruItem{key: l.rec.Key, size: l.size, expiresAt: l.rec.ExpiresAt, tags: l.rec.Tags, value: l.rec.Meta})
+	}
+
+	logging.Info("Filesystem PDF cache loaded", "dir", f.dir, "entries", f.index.len(), "bytes", f.index.bytes, "removed_files", removed)
+	return nil
+}
+
+// writeFileAtomic writes data to a temp file in the same directory and renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
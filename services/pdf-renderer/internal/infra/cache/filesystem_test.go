@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystem_PersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	f, err := NewFilesystem(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Set(ctx, "pdfcache:a", entry("%PDF a"), time.Hour, URLTag("https://example.com")))
+	require.NoError(t, f.Set(ctx, "pdfcache:gone", entry("%PDF gone"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	// Leftovers of an interrupted write are cleaned up on load.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("junk"), 0o644))
+
+	f, err = NewFilesystem(dir, 0)
+	require.NoError(t, err)
+
+	got, err := f.Get(ctx, "pdfcache:a")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "%PDF a", string(got.Data))
+	assert.Equal(t, `"%PDF a"`, got.Meta.ETag)
+
+	gone, _ := f.Get(ctx, "pdfcache:gone")
+	assert.Nil(t, gone)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2, "only the live entry's data and sidecar remain")
+
+	n, err := f.PurgeTag(ctx, URLTag("https://example.com"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	files, _ = os.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestFilesystem_EvictionRemovesFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	f, err := NewFilesystem(dir, 10)
+	require.NoError(t, err)
+	require.NoError(t, f.Set(ctx, "a", entry("aaaaaa"), 0))
+	require.NoError(t, f.Set(ctx, "b", entry("bbbbbb"), 0))
+
+	a, _ := f.Get(ctx, "a")
+	assert.Nil(t, a)
+	_, err = os.Stat(f.path("a", fsDataExt))
+	assert.True(t, os.IsNotExist(err))
+
+	// Replacing an entry keeps its files.
+	require.NoError(t, f.Set(ctx, "b", entry("BBBBBB"), 0))
+	b, _ := f.Get(ctx, "b")
+	require.NotNil(t, b)
+	assert.Equal(t, "BBBBBB", string(b.Data))
+
+	s, err := f.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, BackendFilesystem, s.Backend)
+	assert.EqualValues(t, 1, s.Entries)
+	assert.EqualValues(t, 6, s.Bytes)
+	assert.EqualValues(t, 1, s.Evictions)
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+)
+
+// lruItem is one entry tracked by an lru index.
+type lruItem struct {
+	key       string
+	size      int64
+	expiresAt time.Time
+	tags      []string
+	value     any // backend-specific payload (e.g. *Entry for the memory backend)
+}
+
+// lru is a size- and count-bounded LRU index with per-entry expiry and tag lookup.
+// It is not safe for concurrent use; backends guard it with their own mutex.
+type lru struct {
+	maxBytes   int64 // 0 = unbounded
+	maxEntries int   // 0 = unbounded
+
+	ll    *list.List // front = most recently used
+	items map[string]*list.Element
+	tags  map[string]map[string]struct{}
+	bytes int64
+
+	// onRemove is called for every item that leaves the index (evicted, expired or deleted).
+	onRemove  func(*lruItem)
+	evictions uint64
+}
+
+func newLRU(maxBytes int64, maxEntries int, onRemove func(*lruItem)) *lru {
+	return &lru{
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		tags:       map[string]map[string]struct{}{},
+		onRemove:   onRemove,
+	}
+}
+
+// fits reports whether an item of size can ever be stored.
+func (l *lru) fits(size int64) bool {
+	return l.maxBytes <= 0 || size <= l.maxBytes
+}
+
+// get returns the live item for key and marks it as recently used.
+func (l *lru) get(key string, now time.Time) (*lruItem, bool) {
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	it := el.Value.(*lruItem)
+	if !it.expiresAt.IsZero() && now.After(it.expiresAt) {
+		l.removeElement(el)
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return it, true
+}
+
+// put inserts or replaces an item and evicts least recently used items until within limits.
+// Replacing an item does not call onRemove: the new value takes over the old one's storage.
+func (l *lru) put(it *lruItem) {
+	if el, ok := l.items[it.key]; ok {
+		l.detach(el)
+	}
+
+	l.items[it.key] = l.ll.PushFront(it)
+	l.bytes += it.size
+	for _, tag := range it.tags {
+		if l.tags[tag] == nil {
+			l.tags[tag] = map[string]struct{}{}
+		}
+		l.tags[tag][it.key] = struct{}{}
+	}
+
+	for l.overLimit() {
+		oldest := l.ll.Back()
+		if oldest == nil || oldest.Value.(*lruItem) == it {
+			break
+		}
+		l.removeElement(oldest)
+		l.evictions++
+	}
+}
+
+func (l *lru) overLimit() bool {
+	return (l.maxBytes > 0 && l.bytes > l.maxBytes) || (l.maxEntries > 0 && l.ll.Len() > l.maxEntries)
+}
+
+// remove deletes key and reports whether it existed.
+func (l *lru) remove(key string) bool {
+	el, ok := l.items[key]
+	if !ok {
+		return false
+	}
+	l.removeElement(el)
+	return true
+}
+
+// keysForTag returns the keys currently registered under tag.
+func (l *lru) keysForTag(tag string) []string {
+	keys := make([]string, 0, len(l.tags[tag]))
+	for k := range l.tags[tag] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// clear removes every item and returns how many there were.
+func (l *lru) clear() int64 {
+	n := int64(l.ll.Len())
+	for el := l.ll.Front(); el != nil; {
+		next := el.Next()
+		l.removeElement(el)
+		el = next
+	}
+	return n
+}
+
+func (l *lru) len() int { return l.ll.Len() }
+
+func (l *lru) removeElement(el *list.Element) {
+	it := l.detach(el)
+	if l.onRemove != nil {
+		l.onRemove(it)
+	}
+}
+
+// detach unlinks an element from the index without calling onRemove.
+func (l *lru) detach(el *list.Element) *lruItem {
+	it := el.Value.(*lruItem)
+	l.ll.Remove(el)
+	delete(l.items, it.key)
+	l.bytes -= it.size
+	for _, tag := range it.tags {
+		delete(l.tags[tag], it.key)
+		if len(l.tags[tag]) == 0 {
+			delete(l.tags, tag)
+		}
+	}
+	return it
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Memory is an in-process LRU cache bounded by total bytes and entry count.
+// Entries are not shared between replicas and are lost on restart.
+type Memory struct {
+	mu     sync.Mutex
+	index  *lru
+	maxTTL time.Duration // caps entry lifetime (used as L1 so stale copies age out quickly)
+	now    func() time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewMemory returns an in-memory LRU. maxBytes / maxEntries of 0 mean unbounded; a maxTTL of 0
+// keeps the TTL passed to Set.
+func NewMemory(maxBytes int64, maxEntries int, maxTTL time.Duration) *Memory {
+	return &Memory{
+		index:  newLRU(maxBytes, maxEntries, nil),
+		maxTTL: maxTTL,
+		now:    time.Now,
+	}
+}
+
+func (m *Memory) Get(_ context.Context, key string) (*Entry, error) {
+	m.mu.Lock()
+	it, ok := m.index.get(key, m.now())
+	m.mu.Unlock()
+
+	if !ok {
+		m.misses.Add(1)
+		return nil, nil
+	}
+	m.hits.Add(1)
+	return it.value.(*Entry), nil
+}
+
+func (m *Memory) GetMeta(_ context.Context, key string) (*Meta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	it, ok := m.index.get(key, m.now())
+	if !ok {
+		return nil, nil
+	}
+	meta := it.value.(*Entry).Meta
+	return &meta, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, entry *Entry, ttl time.Duration, tags ...string) error {
+	if m.maxTTL > 0 && (ttl <= 0 || ttl > m.maxTTL) {
+		ttl = m.maxTTL
+	}
+	size := int64(len(entry.Data))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.index.fits(size) {
+		// Too large for this cache; drop any older copy so readers don't get stale data.
+		m.index.remove(key)
+		return nil
+	}
+	it := &lruItem{key: key, size: size, tags: tags, value: entry}
+	if ttl > 0 {
+		it.expiresAt = m.now().Add(ttl)
+	}
+	m.index.put(it)
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, keys ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for _, k := range keys {
+		if m.index.remove(k) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) PurgeTag(ctx context.Context, tag string) (int64, error) {
+	m.mu.Lock()
+	keys := m.index.keysForTag(tag)
+	m.mu.Unlock()
+	return m.Delete(ctx, keys...)
+}
+
+func (m *Memory) Flush(_ context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.index.clear(), nil
+}
+
+func (m *Memory) Stats(_ context.Context) (Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return Stats{
+		Backend:    BackendMemory,
+		Entries:    int64(m.index.len()),
+		Bytes:      m.index.bytes,
+		MaxBytes:   m.index.maxBytes,
+		MaxEntries: m.index.maxEntries,
+		Hits:       m.hits.Load(),
+		Misses:     m.misses.Load(),
+		Evictions:  m.index.evictions,
+	}, nil
+}
+
+func (m *Memory) Shared() bool { return false }
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entry(body string) *Entry {
+	return &Entry{Data: []byte(body), Meta: Meta{ETag: `"` + body + `"`, Size: len(body)}}
+}
+
+func TestMemory_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(10, 0, 0)
+
+	require.NoError(t, m.Set(ctx, "a", entry("aaaa"), time.Minute))
+	require.NoError(t, m.Set(ctx, "b", entry("bbbb"), time.Minute))
+	_, _ = m.Get(ctx, "a") // a is now more recent than b
+	require.NoError(t, m.Set(ctx, "c", entry("cccc"), time.Minute))
+
+	a, _ := m.Get(ctx, "a")
+	b, _ := m.Get(ctx, "b")
+	c, _ := m.Get(ctx, "c")
+	assert.NotNil(t, a)
+	assert.Nil(t, b)
+	assert.NotNil(t, c)
+
+	s, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, s.Entries)
+	assert.EqualValues(t, 8, s.Bytes)
+	assert.EqualValues(t, 1, s.Evictions)
+	assert.EqualValues(t, 3, s.Hits)
+	assert.EqualValues(t, 1, s.Misses)
+}
+
+func TestMemory_MaxEntriesAndOversizedEntries(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(8, 2, 0)
+
+	require.NoError(t, m.Set(ctx, "a", entry("a"), 0))
+	require.NoError(t, m.Set(ctx, "b", entry("b"), 0))
+	require.NoError(t, m.Set(ctx, "c", entry("c"), 0))
+	a, _ := m.Get(ctx, "a")
+	assert.Nil(t, a, "oldest entry evicted by max_entries")
+
+	// An entry larger than the whole cache is skipped and drops the stale copy.
+	require.NoError(t, m.Set(ctx, "b", entry(strings.Repeat("x", 9)), 0))
+	b, _ := m.Get(ctx, "b")
+	assert.Nil(t, b)
+}
+
+func TestMemory_ExpiryAndMaxTTL(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(0, 0, time.Second)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	require.NoError(t, m.Set(ctx, "k", entry("pdf"), time.Hour))
+	meta, _ := m.GetMeta(ctx, "k")
+	require.NotNil(t, meta)
+
+	now = now.Add(2 * time.Second) // capped at max_ttl, not the requested hour
+	meta, _ = m.GetMeta(ctx, "k")
+	assert.Nil(t, meta)
+}
+
+func TestMemory_PurgeTagAndFlush(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(0, 0, 0)
+
+	require.NoError(t, m.Set(ctx, "a", entry("a"), 0, URLTag("https://example.com"), TokenTag("t1")))
+	require.NoError(t, m.Set(ctx, "b", entry("b"), 0, URLTag("https://example.com")))
+	require.NoError(t, m.Set(ctx, "c", entry("c"), 0, TokenTag("t1")))
+
+	n, err := m.PurgeTag(ctx, URLTag("https://example.com"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	n, err = m.PurgeTag(ctx, TokenTag("t1"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+
+	require.NoError(t, m.Set(ctx, "d", entry("d"), 0))
+	n, err = m.Flush(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+}
@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pdf-renderer/internal/infra/logging"
+)
+
+const (
+	// KeyPrefix namespaces cache keys in Redis. Callers build keys as KeyPrefix + <hash>.
+	KeyPrefix = "pdfcache:"
+	// metaKeySuffix is appended to a cache key to store the entry's metadata next to the PDF.
+	metaKeySuffix = ":meta"
+	// indexKeyPrefix namespaces the sets that map a tag to its cache keys.
+	indexKeyPrefix = "pdfidx:"
+
+	scanBatchSize = 500
+)
+
+// Redis stores PDFs in Redis, shared by all replicas. Each entry is two keys (PDF bytes and
+// JSON metadata) with the same TTL; tags are Redis sets of cache keys. PDF bytes are
+// optionally compressed (see encodePayload).
+type Redis struct {
+	rdb           *redis.Client
+	maxEntryBytes int64
+	codec         string
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	// Bytes written by this instance before and after compression.
+	rawBytes    atomic.Uint64
+	storedBytes atomic.Uint64
+}
+
+// NewRedis returns a Redis-backed cache that compresses PDFs with codec ("", "none", "gzip"
+// or "zstd"). PDFs whose stored size exceeds maxEntryBytes (if > 0) are not stored.
+func NewRedis(rdb *redis.Client, maxEntryBytes int64, codec string) *Redis {
+	return &Redis{rdb: rdb, maxEntryBytes: maxEntryBytes, codec: codec}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (*Entry, error) {
+	payload, err := r.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		r.misses.Add(1)
+		return nil, nil
+	}
+	if err != nil {
+		logging.Warn("Redis read failed", "error", err)
+		return nil, err
+	}
+	data, err := decodePayload(payload)
+	if err != nil {
+		logging.Warn("Invalid PDF cache payload", "key", key, "error", err)
+		r.misses.Add(1)
+		return nil, nil
+	}
+	r.hits.Add(1)
+
+	meta, _ := r.GetMeta(ctx, key)
+	if meta == nil || meta.Size != len(data) {
+		// Entry written without (or with stale) metadata; derive what we can from the bytes.
+		return &Entry{Data: data, Meta: Meta{Size: len(data)}}, nil
+	}
+	return &Entry{Data: data, Meta: *meta}, nil
+}
+
+func (r *Redis) GetMeta(ctx context.Context, key string) (*Meta, error) {
+	raw, err := r.rdb.Get(ctx, key+metaKeySuffix).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Warn("Redis read failed", "error", err)
+		return nil, err
+	}
+
+	var meta Meta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		logging.Warn("Invalid PDF cache metadata", "key", key, "error", err)
+		return nil, nil
+	}
+	return &meta, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration, tags ...string) error {
+	payload, err := encodePayload(r.codec, entry.Data)
+	if err != nil {
+		return err
+	}
+	if r.maxEntryBytes > 0 && int64(len(payload)) > r.maxEntryBytes {
+		_, err := r.Delete(ctx, key)
+		return err
+	}
+
+	meta, err := json.Marshal(entry.Meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, payload, ttl)
+		pipe.Set(ctx, key+metaKeySuffix, meta, ttl)
+		for _, tag := range tags {
+			// Keep the index alive as long as its longest-lived member. It may outlive
+			// members that expired meanwhile; purging a missing key is a no-op.
+			idx := indexKeyPrefix + tag
+			pipe.SAdd(ctx, idx, key)
+			pipe.ExpireNX(ctx, idx, ttl)
+			pipe.ExpireGT(ctx, idx, ttl)
+		}
+		return nil
+	})
+	if err == nil {
+		r.rawBytes.Add(uint64(len(entry.Data)))
+		r.storedBytes.Add(uint64(len(payload)))
+	}
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	pipe := r.rdb.TxPipeline()
+	dels := make([]*redis.IntCmd, 0, len(keys))
+	for _, k := range keys {
+		dels = append(dels, pipe.Del(ctx, k))
+		pipe.Del(ctx, k+metaKeySuffix)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, d := range dels {
+		n += d.Val()
+	}
+	return n, nil
+}
+
+// TagKeys returns the cache keys registered under tag.
+func (r *Redis) TagKeys(ctx context.Context, tag string) ([]string, error) {
+	return r.rdb.SMembers(ctx, indexKeyPrefix+tag).Result()
+}
+
+func (r *Redis) PurgeTag(ctx context.Context, tag string) (int64, error) {
+	idx := indexKeyPrefix + tag
+	keys, err := r.TagKeys(ctx, tag)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.Delete(ctx, keys...)
+	if err != nil {
+		return 0, err
+	}
+	return n, r.rdb.Del(ctx, idx).Err()
+}
+
+func (r *Redis) Flush(ctx context.Context) (int64, error) {
+	var purged int64
+	for _, pattern := range []string{KeyPrefix + "*", indexKeyPrefix + "*"} {
+		err := r.scan(ctx, pattern, func(keys []string) error {
+			for _, k := range keys {
+				if strings.HasPrefix(k, KeyPrefix) && !strings.HasSuffix(k, metaKeySuffix) {
+					purged++
+				}
+			}
+			return r.rdb.Unlink(ctx, keys...).Err()
+		})
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func (r *Redis) Stats(ctx context.Context) (Stats, error) {
+	s := Stats{
+		Backend:     BackendRedis,
+		Hits:        r.hits.Load(),
+		Misses:      r.misses.Load(),
+		Compression: r.codec,
+	}
+	if stored := r.storedBytes.Load(); stored > 0 {
+		s.CompressionRatio = float64(r.rawBytes.Load()) / float64(stored)
+	}
+
+	err := r.scan(ctx, KeyPrefix+"*", func(keys []string) error {
+		pipe := r.rdb.Pipeline()
+		var lens []*redis.IntCmd
+		for _, k := range keys {
+			if !strings.HasSuffix(k, metaKeySuffix) {
+				lens = append(lens, pipe.StrLen(ctx, k))
+			}
+		}
+		if len(lens) == 0 {
+			return nil
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+		for _, l := range lens {
+			if n := l.Val(); n > 0 {
+				s.Entries++
+				s.Bytes += n
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+
+	// Redis evicts on its own (maxmemory-policy); evicted_keys and maxmemory are server-wide
+	// (the capacity is shared with other keys), best effort.
+	if info, err := r.rdb.Info(ctx, "stats").Result(); err == nil {
+		s.Evictions = parseInfoField(info, "evicted_keys")
+	}
+	if info, err := r.rdb.Info(ctx, "memory").Result(); err == nil {
+		s.MaxBytes = int64(parseInfoField(info, "maxmemory"))
+	}
+	return s, nil
+}
+
+func (r *Redis) Shared() bool { return true }
+
+// scan iterates keys matching pattern in batches (SCAN, never KEYS).
+func (r *Redis) scan(ctx context.Context, pattern string, fn func([]string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.rdb.Scan(ctx, cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// parseInfoField extracts a numeric field from INFO output ("name:value" lines).
+func parseInfoField(info, name string) uint64 {
+	sc := bufio.NewScanner(strings.NewReader(info))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), name+":"); ok {
+			n, _ := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return NewRedis(rdb, 0, ""), srv
+}
+
+func TestRedis_SetGetMeta(t *testing.T) {
+	ctx := context.Background()
+	r, srv := newTestRedis(t)
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := entry("%PDF a")
+	e.Meta.Pages, e.Meta.CreatedAt, e.Meta.ExpiresAt = 3, created, created.Add(time.Minute)
+	require.NoError(t, r.Set(ctx, KeyPrefix+"a", e, time.Minute))
+	assert.Equal(t, time.Minute, srv.TTL(KeyPrefix+"a"))
+	assert.Equal(t, time.Minute, srv.TTL(KeyPrefix+"a"+metaKeySuffix), "the metadata expires with the PDF")
+
+	got, err := r.Get(ctx, KeyPrefix+"a")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, []byte("%PDF a"), got.Data)
+	assert.Equal(t, e.Meta, got.Meta)
+
+	meta, err := r.GetMeta(ctx, KeyPrefix+"a")
+	require.NoError(t, err)
+	assert.Equal(t, &e.Meta, meta)
+
+	// Metadata that does not describe the bytes is ignored.
+	require.NoError(t, srv.Set(KeyPrefix+"a", "%PDF replaced"))
+	got, err = r.Get(ctx, KeyPrefix+"a")
+	require.NoError(t, err)
+	assert.Equal(t, Meta{Size: len("%PDF replaced")}, got.Meta)
+
+	missing, err := r.Get(ctx, KeyPrefix+"missing")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	noMeta, err := r.GetMeta(ctx, KeyPrefix+"missing")
+	require.NoError(t, err)
+	assert.Nil(t, noMeta)
+}
+
+func TestRedis_SkipsOversizedEntries(t *testing.T) {
+	ctx := context.Background()
+	plain, srv := newTestRedis(t)
+	r := NewRedis(plain.rdb, 8, "")
+
+	require.NoError(t, r.Set(ctx, "k", entry("%PDF ok"), time.Minute))
+	assert.True(t, srv.Exists("k"))
+
+	// A too large replacement removes the entry rather than leaving the old PDF behind.
+	require.NoError(t, r.Set(ctx, "k", entry("%PDF too large"), time.Minute, TokenTag("t")))
+	assert.False(t, srv.Exists("k"))
+	assert.False(t, srv.Exists("k"+metaKeySuffix))
+	assert.False(t, srv.Exists(indexKeyPrefix+TokenTag("t")), "skipped entries are not indexed")
+}
+
+func TestRedis_TagIndex(t *testing.T) {
+	ctx := context.Background()
+	r, srv := newTestRedis(t)
+	idx := indexKeyPrefix + URLTag("https://example.com")
+
+	require.NoError(t, r.Set(ctx, KeyPrefix+"a", entry("%PDF a"), time.Hour, URLTag("https://example.com"), TokenTag("t")))
+	require.NoError(t, r.Set(ctx, KeyPrefix+"b", entry("%PDF b"), time.Minute, URLTag("https://example.com")))
+
+	members, err := srv.Members(idx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{KeyPrefix + "a", KeyPrefix + "b"}, members)
+	assert.Equal(t, time.Hour, srv.TTL(idx), "the index lives as long as its longest-lived member")
+
+	require.NoError(t, r.Set(ctx, KeyPrefix+"c", entry("%PDF c"), 2*time.Hour, URLTag("https://example.com")))
+	assert.Equal(t, 2*time.Hour, srv.TTL(idx))
+
+	keys, err := r.TagKeys(ctx, TokenTag("t"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{KeyPrefix + "a"}, keys)
+
+	n, err := r.PurgeTag(ctx, URLTag("https://example.com"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+	assert.False(t, srv.Exists(idx))
+	assert.False(t, srv.Exists(KeyPrefix+"a"+metaKeySuffix))
+
+	// The other tag's index still names the purged key; purging it again removes nothing.
+	n, err = r.PurgeTag(ctx, TokenTag("t"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+
+	n, err = r.PurgeTag(ctx, TokenTag("unknown"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+}
+
+func TestRedis_Flush(t *testing.T) {
+	ctx := context.Background()
+	r, srv := newTestRedis(t)
+
+	require.NoError(t, r.Set(ctx, KeyPrefix+"a", entry("%PDF a"), time.Minute, TokenTag("t")))
+	require.NoError(t, r.Set(ctx, KeyPrefix+"b", entry("%PDF b"), time.Minute))
+	require.NoError(t, srv.Set("session:1", "unrelated"))
+
+	n, err := r.Flush(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n, "metadata keys and tag indexes are not counted")
+	assert.Equal(t, []string{"session:1"}, srv.Keys(), "keys outside the cache are kept")
+}
+
+func TestRedis_Stats(t *testing.T) {
+	ctx := context.Background()
+	plain, srv := newTestRedis(t)
+	r := NewRedis(plain.rdb, 1<<20, CodecGzip)
+
+	require.NoError(t, r.Set(ctx, KeyPrefix+"a", &Entry{Data: samplePDF, Meta: Meta{Size: len(samplePDF)}}, time.Minute))
+	require.NoError(t, r.Set(ctx, KeyPrefix+"b", entry("%PDF bb"), time.Minute))
+	_, _ = r.Get(ctx, KeyPrefix+"a")
+	_, _ = r.Get(ctx, KeyPrefix+"missing")
+
+	stored, err := srv.Get(KeyPrefix + "a")
+	require.NoError(t, err)
+
+	s, err := r.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, BackendRedis, s.Backend)
+	assert.EqualValues(t, 2, s.Entries, "metadata keys are not entries")
+	assert.EqualValues(t, len(stored)+len("%PDF bb"), s.Bytes, "stored (compressed) bytes")
+	assert.Zero(t, s.MaxBytes, "max_entry_bytes is not a capacity; miniredis reports no maxmemory")
+	assert.EqualValues(t, 1, s.Hits)
+	assert.EqualValues(t, 1, s.Misses)
+	assert.Equal(t, CodecGzip, s.Compression)
+	assert.InDelta(t, float64(len(samplePDF)+7)/float64(len(stored)+7), s.CompressionRatio, 1e-9)
+	assert.True(t, r.Shared())
+}
+
+func TestParseInfoField(t *testing.T) {
+	info := "# Stats\r\ntotal_connections_received:12\r\nevicted_keys:42\r\n"
+	assert.EqualValues(t, 42, parseInfoField(info, "evicted_keys"))
+	assert.EqualValues(t, 0, parseInfoField(info, "expired_keys"))
+	assert.EqualValues(t, 268435456, parseInfoField("# Memory\r\nmaxmemory:268435456\r\nmaxmemory_human:256.00M\r\n", "maxmemory"))
+}
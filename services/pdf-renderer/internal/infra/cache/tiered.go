@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"pdf-renderer/internal/infra/logging"
+)
+
+// Tiered puts a small per-replica memory cache (L1) in front of a shared cache (L2).
+// Reads try L1 first and promote L2 hits; writes and purges go to both tiers.
+// L1 entries are capped by the memory backend's max TTL, which bounds how long a replica can
+// keep serving an entry that was purged through another replica.
+type Tiered struct {
+	l1 *Memory
+	l2 PDFCache
+}
+
+// NewTiered combines l1 and l2.
+func NewTiered(l1 *Memory, l2 PDFCache) *Tiered {
+	return &Tiered{l1: l1, l2: l2}
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (*Entry, error) {
+	if e, _ := t.l1.Get(ctx, key); e != nil {
+		return e, nil
+	}
+
+	e, err := t.l2.Get(ctx, key)
+	if err != nil || e == nil {
+		return e, err
+	}
+	t.promote(ctx, key, e)
+	return e, nil
+}
+
+func (t *Tiered) GetMeta(ctx context.Context, key string) (*Meta, error) {
+	if m, _ := t.l1.GetMeta(ctx, key); m != nil {
+		return m, nil
+	}
+	return t.l2.GetMeta(ctx, key)
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration, tags ...string) error {
+	if err := t.l2.Set(ctx, key, entry, ttl, tags...); err != nil {
+		return err
+	}
+	return t.l1.Set(ctx, key, entry, ttl, tags...)
+}
+
+func (t *Tiered) Delete(ctx context.Context, keys ...string) (int64, error) {
+	n1, _ := t.l1.Delete(ctx, keys...)
+	n2, err := t.l2.Delete(ctx, keys...)
+	return max(n1, n2), err
+}
+
+func (t *Tiered) PurgeTag(ctx context.Context, tag string) (int64, error) {
+	n1, _ := t.l1.PurgeTag(ctx, tag)
+
+	// Copies promoted from L2 carry no tags in L1; drop them by L2's tag membership.
+	if tl, ok := t.l2.(interface {
+		TagKeys(ctx context.Context, tag string) ([]string, error)
+	}); ok {
+		if keys, err := tl.TagKeys(ctx, tag); err == nil {
+			_, _ = t.l1.Delete(ctx, keys...)
+		}
+	}
+
+	n2, err := t.l2.PurgeTag(ctx, tag)
+	return max(n1, n2), err
+}
+
+func (t *Tiered) Flush(ctx context.Context) (int64, error) {
+	n1, _ := t.l1.Flush(ctx)
+	n2, err := t.l2.Flush(ctx)
+	return max(n1, n2), err
+}
+
+func (t *Tiered) Stats(ctx context.Context) (Stats, error) {
+	s1, _ := t.l1.Stats(ctx)
+	s2, err := t.l2.Stats(ctx)
+
+	// A request is a hit if either tier served it; L1 misses are counted again by L2.
+	return Stats{
+		Backend:   BackendTiered,
+		Entries:   s2.Entries,
+		Bytes:     s2.Bytes,
+		Hits:      s1.Hits + s2.Hits,
+		Misses:    s2.Misses,
+		Evictions: s1.Evictions + s2.Evictions,
+		Tiers:     []Stats{s1, s2},
+
+		Compression:      s2.Compression,
+		CompressionRatio: s2.CompressionRatio,
+	}, err
+}
+
+func (t *Tiered) Shared() bool { return t.l2.Shared() }
+
+// promote copies an L2 hit into L1 for the rest of its lifetime.
+func (t *Tiered) promote(ctx context.Context, key string, e *Entry) {
+	// Entries without a known expiry (written before metadata existed) stay in L2 only,
+	// so L1 never outlives them.
+	if e.Meta.ExpiresAt.IsZero() {
+		return
+	}
+	ttl := time.Until(e.Meta.ExpiresAt)
+	if ttl <= 0 {
+		return
+	}
+	// Tags are not known here; PurgeTag finds promoted copies through L2's tag index.
+	if err := t.l1.Set(ctx, key, e, ttl); err != nil {
+		logging.Warn("L1 cache promotion failed", "error", err)
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiered_PromotesAndPurgesBothTiers(t *testing.T) {
+	ctx := context.Background()
+	l2, srv := newTestRedis(t)
+	l1 := NewMemory(0, 0, time.Minute)
+	tc := NewTiered(l1, l2)
+	assert.True(t, tc.Shared())
+
+	// Written by another replica: only in L2.
+	e := entry("%PDF remote")
+	e.Meta.ExpiresAt = time.Now().Add(time.Minute)
+	require.NoError(t, l2.Set(ctx, "k", e, time.Minute, URLTag("https://example.com")))
+
+	got, err := tc.Get(ctx, "k")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	inL1, _ := l1.Get(ctx, "k")
+	assert.NotNil(t, inL1, "L2 hit is promoted to L1")
+
+	n, err := tc.PurgeTag(ctx, URLTag("https://example.com"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	assert.False(t, srv.Exists("k"))
+	stale, _ := l1.Get(ctx, "k")
+	assert.Nil(t, stale, "promoted copy is purged from L1 as well")
+
+	require.NoError(t, tc.Set(ctx, "k2", entry("%PDF local"), time.Minute, URLTag("https://example.org")))
+	_, err = tc.PurgeTag(ctx, URLTag("https://example.org"))
+	require.NoError(t, err)
+	gone, _ := tc.Get(ctx, "k2")
+	assert.Nil(t, gone)
+
+	s, err := tc.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, BackendTiered, s.Backend)
+	require.Len(t, s.Tiers, 2)
+	assert.Equal(t, BackendMemory, s.Tiers[0].Backend)
+	assert.Equal(t, BackendRedis, s.Tiers[1].Backend)
+}
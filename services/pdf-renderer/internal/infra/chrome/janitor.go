@@ -0,0 +1,270 @@
+package chrome
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/infra/logging"
+)
+
+const (
+	// profileDirPrefix is the name prefix of every profile directory created by createProfileDir.
+	profileDirPrefix = "html2pdf-chrome-profile-"
+
+	defaultProfileGCInterval = 10 * time.Minute
+	defaultProfileGCMinAge   = 2 * time.Minute
+)
+
+// errProcessListUnsupported is returned by listProcesses on platforms without /proc.
+var errProcessListUnsupported = errors.New("process listing not supported on this platform")
+
+// JanitorStats reports what the profile janitor reclaimed since startup.
+type JanitorStats struct {
+	Runs            uint64 `json:"runs"`
+	DirsRemoved     uint64 `json:"dirs_removed"`
+	BytesReclaimed  uint64 `json:"bytes_reclaimed"`
+	ProcessesKilled uint64 `json:"processes_killed"`
+	LastRun         string `json:"last_run,omitempty"`
+}
+
+// processInfo is the subset of a running process the janitor cares about.
+type processInfo struct {
+	PID         int
+	PPID        int
+	UserDataDir string // value of --user-data-dir, empty if not a Chromium process
+}
+
+// Janitor removes profile directories and Chromium processes left behind by previous runs
+// (crashes, SIGKILL, failed restarts). It never touches the live pool's profile, directories
+// younger than minAge, or profiles still used by a Chromium whose parent is alive (e.g. a
+// sibling prefork worker or another instance sharing user_data_dir).
+type Janitor struct {
+	base     string
+	minAge   time.Duration
+	interval time.Duration
+	live     func() string // current profile dir of the pool, "" if none
+
+	selfPID       int
+	listProcesses func() ([]processInfo, error)
+	killProcess   func(pid int) error
+	now           func() time.Time
+
+	mu       sync.Mutex // serializes sweeps
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	runs            atomic.Uint64
+	dirsRemoved     atomic.Uint64
+	bytesReclaimed  atomic.Uint64
+	processesKilled atomic.Uint64
+	lastRun         atomic.Value // stores time.Time
+}
+
+// NewJanitor returns a janitor for cfg's user_data_dir. live returns the profile directory of
+// the running Chromium, "" if there is none (e.g. before the pool's first render).
+func NewJanitor(cfg config.Config, live func() string) *Janitor {
+	minAge := cfg.PDF.ProfileGCMinAge
+	if minAge <= 0 {
+		minAge = defaultProfileGCMinAge
+	}
+	interval := cfg.PDF.ProfileGCInterval
+	if interval <= 0 {
+		interval = defaultProfileGCInterval
+	}
+	return &Janitor{
+		base:          profileBaseDir(cfg),
+		minAge:        minAge,
+		interval:      interval,
+		live:          live,
+		selfPID:       os.Getpid(),
+		listProcesses: listProcesses,
+		killProcess:   killProcess,
+		now:           time.Now,
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start sweeps once, so leftovers of a crashed run are reclaimed before the first render, and
+// then every profile_gc_interval until Stop.
+func (j *Janitor) Start() {
+	j.sweep()
+	go j.run()
+}
+
+// Stop ends the periodic sweeps.
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() { close(j.stop) })
+}
+
+// run sweeps every interval until Stop.
+func (j *Janitor) run() {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.sweep()
+		}
+	}
+}
+
+// sweep kills orphaned Chromium processes and removes stale profile directories.
+func (j *Janitor) sweep() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	live := ""
+	if j.live != nil {
+		live = j.live()
+	}
+
+	inUse, orphans, procErr := j.classifyProcesses(live)
+	if procErr != nil && !errors.Is(procErr, errProcessListUnsupported) {
+		logging.Warn("Chrome janitor could not list processes", "error", procErr)
+	}
+
+	var killed uint64
+	for _, pid := range orphans {
+		if err := j.killProcess(pid); err != nil {
+			logging.Warn("Chrome janitor could not kill orphaned process", "pid", pid, "error", err)
+			continue
+		}
+		killed++
+	}
+
+	var removed, reclaimed uint64
+	entries, err := os.ReadDir(j.base)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Warn("Chrome janitor could not read user_data_dir", "dir", j.base, "error", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), profileDirPrefix) {
+			continue
+		}
+		dir := filepath.Join(j.base, e.Name())
+		if dir == live || inUse[dir] {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || j.now().Sub(info.ModTime()) < j.minAge {
+			continue
+		}
+		size := dirSize(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			logging.Warn("Chrome janitor could not remove profile dir", "dir", dir, "error", err)
+			continue
+		}
+		removed++
+		reclaimed += size
+	}
+
+	j.runs.Add(1)
+	j.dirsRemoved.Add(removed)
+	j.bytesReclaimed.Add(reclaimed)
+	j.processesKilled.Add(killed)
+	j.lastRun.Store(j.now())
+
+	if removed > 0 || killed > 0 {
+		logging.Info("Chrome janitor reclaimed resources",
+			"dirs_removed", removed, "bytes_reclaimed", reclaimed, "processes_killed", killed)
+	}
+}
+
+// classifyProcesses groups Chromium processes by profile directory under base. A group is
+// orphaned when its profile is not the live one and its top-level process was reparented
+// (parent is init or gone). Groups whose parent is alive are reported as in use.
+func (j *Janitor) classifyProcesses(live string) (map[string]bool, []int, error) {
+	inUse := map[string]bool{}
+
+	procs, err := j.listProcesses()
+	if err != nil {
+		return inUse, nil, err
+	}
+
+	alive := make(map[int]bool, len(procs))
+	groups := map[string][]processInfo{}
+	for _, p := range procs {
+		alive[p.PID] = true
+		if p.UserDataDir == "" || filepath.Dir(p.UserDataDir) != j.base {
+			continue
+		}
+		if !strings.HasPrefix(filepath.Base(p.UserDataDir), profileDirPrefix) {
+			continue
+		}
+		groups[p.UserDataDir] = append(groups[p.UserDataDir], p)
+	}
+
+	var orphans []int
+	for dir, group := range groups {
+		if dir == live {
+			continue
+		}
+
+		members := make(map[int]bool, len(group))
+		for _, p := range group {
+			members[p.PID] = true
+		}
+
+		orphaned := true
+		for _, p := range group {
+			if members[p.PPID] {
+				continue // child of another process in the same group
+			}
+			if p.PPID == j.selfPID || (p.PPID > 1 && alive[p.PPID]) {
+				orphaned = false
+				break
+			}
+		}
+
+		if !orphaned {
+			inUse[dir] = true
+			continue
+		}
+		for _, p := range group {
+			orphans = append(orphans, p.PID)
+		}
+	}
+	return inUse, orphans, nil
+}
+
+// Stats reports what the janitor reclaimed since it was created.
+func (j *Janitor) Stats() JanitorStats {
+	s := JanitorStats{
+		Runs:            j.runs.Load(),
+		DirsRemoved:     j.dirsRemoved.Load(),
+		BytesReclaimed:  j.bytesReclaimed.Load(),
+		ProcessesKilled: j.processesKilled.Load(),
+	}
+	if v := j.lastRun.Load(); v != nil {
+		if t, ok := v.(time.Time); ok && !t.IsZero() {
+			s.LastRun = t.UTC().Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+// dirSize returns the total size of regular files below dir (best effort).
+func dirSize(dir string) uint64 {
+	var size uint64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,119 @@
+package chrome
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mkProfile creates a profile dir with a single file of size bytes and the given age.
+func mkProfile(t *testing.T, base, name string, size int, age time.Duration) string {
+	t.Helper()
+	dir := filepath.Join(base, name)
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Local State"), make([]byte, size), 0o644))
+	mtime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(dir, mtime, mtime))
+	return dir
+}
+
+func newTestJanitor(base, live string, procs []processInfo, killed *[]int) *Janitor {
+	return &Janitor{
+		base:          base,
+		minAge:        time.Minute,
+		live:          func() string { return live },
+		selfPID:       100,
+		listProcesses: func() ([]processInfo, error) { return procs, nil },
+		killProcess: func(pid int) error {
+			*killed = append(*killed, pid)
+			return nil
+		},
+		now: time.Now,
+	}
+}
+
+func TestJanitor_RemovesStaleProfiles(t *testing.T) {
+	base := t.TempDir()
+	live := mkProfile(t, base, profileDirPrefix+"live", 10, time.Hour)
+	stale := mkProfile(t, base, profileDirPrefix+"stale", 1000, time.Hour)
+	young := mkProfile(t, base, profileDirPrefix+"young", 10, time.Second)
+	other := mkProfile(t, base, "unrelated", 10, time.Hour)
+
+	var killed []int
+	j := newTestJanitor(base, live, nil, &killed)
+	j.sweep()
+
+	assert.DirExists(t, live)
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, young, "profiles younger than min age must be kept")
+	assert.DirExists(t, other, "directories without the profile prefix must be kept")
+	assert.Empty(t, killed)
+
+	s := j.Stats()
+	assert.Equal(t, uint64(1), s.Runs)
+	assert.Equal(t, uint64(1), s.DirsRemoved)
+	assert.Equal(t, uint64(1000), s.BytesReclaimed)
+	assert.NotEmpty(t, s.LastRun)
+}
+
+func TestJanitor_KillsOrphanedChromium(t *testing.T) {
+	base := t.TempDir()
+	live := mkProfile(t, base, profileDirPrefix+"live", 10, time.Hour)
+	orphan := mkProfile(t, base, profileDirPrefix+"orphan", 10, time.Hour)
+	sibling := mkProfile(t, base, profileDirPrefix+"sibling", 10, time.Hour)
+
+	procs := []processInfo{
+		{PID: 1, PPID: 0},
+		{PID: 100, PPID: 1},                      // this process
+		{PID: 101, PPID: 100, UserDataDir: live}, // our browser
+		{PID: 102, PPID: 101, UserDataDir: live}, // its renderer
+		{PID: 200, PPID: 1, UserDataDir: orphan}, // browser reparented to init
+		{PID: 201, PPID: 200, UserDataDir: orphan},
+		{PID: 300, PPID: 1},                         // another html2pdf worker
+		{PID: 301, PPID: 300, UserDataDir: sibling}, // its browser
+		{PID: 400, PPID: 1, UserDataDir: "/elsewhere/" + profileDirPrefix + "x"},
+	}
+
+	var killed []int
+	j := newTestJanitor(base, live, procs, &killed)
+	j.sweep()
+
+	sort.Ints(killed)
+	assert.Equal(t, []int{200, 201}, killed)
+	assert.DirExists(t, live)
+	assert.NoDirExists(t, orphan)
+	assert.DirExists(t, sibling, "profiles used by a live parent must be kept")
+
+	s := j.Stats()
+	assert.Equal(t, uint64(2), s.ProcessesKilled)
+	assert.Equal(t, uint64(1), s.DirsRemoved)
+}
+
+func TestJanitor_MissingBaseDir(t *testing.T) {
+	var killed []int
+	j := newTestJanitor(filepath.Join(t.TempDir(), "missing"), "", nil, &killed)
+	j.sweep()
+
+	assert.Equal(t, uint64(1), j.Stats().Runs)
+	assert.Equal(t, uint64(0), j.Stats().DirsRemoved)
+}
+
+func TestJanitor_StartSweepsImmediately(t *testing.T) {
+	base := t.TempDir()
+	stale := mkProfile(t, base, profileDirPrefix+"stale", 10, time.Hour)
+
+	var killed []int
+	j := newTestJanitor(base, "", nil, &killed)
+	j.interval, j.stop = time.Hour, make(chan struct{})
+	j.Start()
+	defer j.Stop()
+
+	assert.NoDirExists(t, stale, "leftovers are reclaimed before the first interval")
+	assert.Equal(t, uint64(1), j.Stats().Runs)
+	j.Stop() // idempotent
+}
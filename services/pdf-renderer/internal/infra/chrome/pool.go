@@ -63,6 +63,11 @@ func NewPool(cfg config.Config) (*Pool, error) {
 		return nil, fmt.Errorf("chrome pool disabled (chrome_pool_size <= 0)")
 	}
 
+	p := &Pool{
+		cfg: cfg,
+		sem: make(chan struct{}, cfg.PDF.ChromePoolSize),
+	}
+
 	profileDir, err := createProfileDir(cfg)
 	if err != nil {
 		return nil, err
@@ -111,15 +116,9 @@ func NewPool(cfg config.Config) (*Pool, error) {
 	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
 	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
 
-	p := &Pool{
-		cfg:           cfg,
-		allocCtx:      allocCtx,
-		allocCancel:   allocCancel,
-		browserCtx:    browserCtx,
-		browserCancel: browserCancel,
-		sem:           make(chan struct{}, cfg.PDF.ChromePoolSize),
-		profileDir:    profileDir,
-	}
+	p.allocCtx, p.allocCancel = allocCtx, allocCancel
+	p.browserCtx, p.browserCancel = browserCtx, browserCancel
+	p.profileDir = profileDir
 	for i := 0; i < cfg.PDF.ChromePoolSize; i++ {
 		p.sem <- struct{}{}
 	}
@@ -137,6 +136,13 @@ func NewPool(cfg config.Config) (*Pool, error) {
 	return p, nil
 }
 
+// ProfileDir returns the profile directory of the running Chromium, which a Janitor must keep.
+func (p *Pool) ProfileDir() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.profileDir
+}
+
 // Acquire blocks until capacity is available or ctx is cancelled.
 // It returns a fresh tab context; callers must Release it.
 func (p *Pool) Acquire(ctx context.Context) (*Tab, error) {
@@ -301,15 +307,21 @@ func (p *Pool) Close() {
 	}
 }
 
-func createProfileDir(cfg config.Config) (string, error) {
+// profileBaseDir returns the directory under which per-pool profile directories are created.
+func profileBaseDir(cfg config.Config) string {
 	base := cfg.PDF.UserDataDir
 	if base == "" {
 		base = filepath.Join(os.TempDir(), "html2pdf-chrome-profile")
 	}
+	return filepath.Clean(base)
+}
+
+func createProfileDir(cfg config.Config) (string, error) {
+	base := profileBaseDir(cfg)
 	if err := os.MkdirAll(base, 0o755); err != nil {
 		return "", fmt.Errorf("cannot create user_data_dir: %w", err)
 	}
-	dir, err := os.MkdirTemp(base, "html2pdf-chrome-profile-")
+	dir, err := os.MkdirTemp(base, profileDirPrefix)
 	if err != nil {
 		return "", fmt.Errorf("cannot create temp user data dir: %w", err)
 	}
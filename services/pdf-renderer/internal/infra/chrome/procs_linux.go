@@ -0,0 +1,75 @@
+//go:build linux
+
+package chrome
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listProcesses reads /proc and returns every process with its parent PID and, for Chromium
+// processes, the --user-data-dir they were started with.
+func listProcesses() ([]processInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	procs := make([]processInfo, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", e.Name())
+
+		stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			continue // process exited meanwhile
+		}
+		ppid, ok := parsePPID(stat)
+		if !ok {
+			continue
+		}
+
+		p := processInfo{PID: pid, PPID: ppid}
+		if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+			p.UserDataDir = userDataDirArg(cmdline)
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// parsePPID extracts the parent PID from /proc/<pid>/stat. The command name (field 2) may
+// contain spaces and parentheses, so parsing starts after its closing parenthesis.
+func parsePPID(stat []byte) (int, bool) {
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, false
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	return ppid, err == nil
+}
+
+// userDataDirArg returns the value of --user-data-dir from a NUL-separated command line.
+func userDataDirArg(cmdline []byte) string {
+	for _, arg := range bytes.Split(cmdline, []byte{0}) {
+		if v, ok := strings.CutPrefix(string(arg), "--user-data-dir="); ok {
+			return filepath.Clean(v)
+		}
+	}
+	return ""
+}
+
+func killProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package chrome
+
+// listProcesses is only implemented on Linux; elsewhere the janitor only removes directories.
+func listProcesses() ([]processInfo, error) {
+	return nil, errProcessListUnsupported
+}
+
+func killProcess(int) error {
+	return errProcessListUnsupported
+}
@@ -0,0 +1,176 @@
+// Package storage uploads rendered PDFs to S3-compatible object storage (AWS S3, MinIO, ...)
+// and hands out presigned download URLs.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/xid"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+)
+
+const (
+	defaultKeyTemplate   = "{date}/{id}.pdf"
+	defaultPresignExpiry = 15 * time.Minute
+	defaultRegion        = "us-east-1"
+
+	// maxPresignExpiry is the SigV4 limit for presigned URLs.
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// Object describes an uploaded PDF.
+type Object struct {
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PutOptions carries per-object settings for an upload.
+type PutOptions struct {
+	Filename string // download name, used for Content-Disposition
+}
+
+// ObjectStore uploads a PDF under key and returns where to download it.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte, opts PutOptions) (*Object, error)
+}
+
+// S3 is an ObjectStore backed by an S3-compatible bucket.
+type S3 struct {
+	client        *minio.Client
+	presigner     *minio.Client // client for the public endpoint; same as client if none is set
+	bucket        string
+	presignExpiry time.Duration
+}
+
+// NewS3 creates a client for cfg.Storage. No network calls are made; a missing bucket or bad
+// credentials surface on the first upload.
+func NewS3(cfg config.Config) (*S3, error) {
+	sc := cfg.Storage
+	if sc.Endpoint == "" || sc.Bucket == "" {
+		return nil, errors.New("storage.endpoint and storage.bucket are required")
+	}
+	region := sc.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	opts := func() *minio.Options {
+		// A fixed region avoids a GetBucketLocation round trip (and lets presigning work offline).
+		return &minio.Options{
+			Creds:  credentials.NewStaticV4(sc.AccessKey, sc.SecretKey, ""),
+			Secure: sc.UseSSL,
+			Region: region,
+		}
+	}
+
+	client, err := minio.New(sc.Endpoint, opts())
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage endpoint: %w", err)
+	}
+	presigner := client
+	if sc.PublicEndpoint != "" {
+		if presigner, err = minio.New(sc.PublicEndpoint, opts()); err != nil {
+			return nil, fmt.Errorf("invalid storage public_endpoint: %w", err)
+		}
+	}
+
+	expiry := sc.PresignExpiry
+	if expiry <= 0 {
+		expiry = defaultPresignExpiry
+	}
+	if expiry > maxPresignExpiry {
+		expiry = maxPresignExpiry
+	}
+
+	return &S3{client: client, presigner: presigner, bucket: sc.Bucket, presignExpiry: expiry}, nil
+}
+
+// Put uploads data as application/pdf and presigns a GET URL for it.
+func (s *S3) Put(ctx context.Context, key string, data []byte, opts PutOptions) (*Object, error) {
+	sum := domain.Checksum(data)
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:        "application/pdf",
+		ContentDisposition: contentDisposition(opts.Filename),
+		UserMetadata:       map[string]string{"sha256": sum},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.presignExpiry).UTC().Truncate(time.Second)
+	u, err := s.presigner.PresignedGetObject(ctx, s.bucket, key, s.presignExpiry, url.Values{})
+	if err != nil {
+		return nil, fmt.Errorf("presign failed: %w", err)
+	}
+
+	return &Object{
+		Bucket:    s.bucket,
+		Key:       key,
+		Size:      int64(len(data)),
+		SHA256:    sum,
+		URL:       u.String(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func contentDisposition(filename string) string {
+	if filename == "" {
+		return "attachment"
+	}
+	return "attachment; filename=" + filename
+}
+
+// KeyVars are the values substituted into storage.key_template.
+type KeyVars struct {
+	Token    string // API key of the request ("" for public requests)
+	Filename string
+	SHA256   string
+	Now      time.Time
+}
+
+// ObjectKey renders the object key for one upload from cfg.Storage.KeyTemplate.
+//
+// Placeholders: {date} (YYYY/MM/DD, UTC), {id} (unique id), {sha256} (PDF checksum),
+// {filename} (requested download name), {token} (first 16 hex chars of the API key's SHA-256,
+// "public" without a key). If the key's hash is listed in storage.token_prefixes, that prefix
+// is prepended.
+func ObjectKey(cfg config.Config, v KeyVars) string {
+	tmpl := cfg.Storage.KeyTemplate
+	if tmpl == "" {
+		tmpl = defaultKeyTemplate
+	}
+
+	tokenHash, tokenPart := "", "public"
+	if v.Token != "" {
+		tokenHash = domain.Checksum([]byte(v.Token))
+		tokenPart = tokenHash[:16]
+	}
+
+	key := strings.NewReplacer(
+		"{date}", v.Now.UTC().Format("2006/01/02"),
+		"{id}", xid.New().String(),
+		"{sha256}", v.SHA256,
+		"{filename}", v.Filename,
+		"{token}", tokenPart,
+	).Replace(tmpl)
+
+	if prefix := cfg.Storage.TokenPrefixes[tokenHash]; tokenHash != "" && prefix != "" {
+		key = path.Join(prefix, key)
+	}
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
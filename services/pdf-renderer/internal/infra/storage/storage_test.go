@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf-renderer/internal/config"
+	"pdf-renderer/internal/domain"
+)
+
+func TestObjectKey(t *testing.T) {
+	var cfg config.Config
+	now := time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC)
+
+	key := ObjectKey(cfg, KeyVars{Now: now})
+	assert.Regexp(t, `^2025/03/07/[0-9a-v]{20}\.pdf$`, key)
+
+	cfg.Storage.KeyTemplate = "/{token}/{sha256}/{filename}"
+	key = ObjectKey(cfg, KeyVars{Token: "secret", Filename: "invoice.pdf", SHA256: "abc", Now: now})
+	assert.Equal(t, domain.Checksum([]byte("secret"))[:16]+"/abc/invoice.pdf", key)
+
+	key = ObjectKey(cfg, KeyVars{Filename: "invoice.pdf", SHA256: "abc", Now: now})
+	assert.Equal(t, "public/abc/invoice.pdf", key)
+
+	cfg.Storage.TokenPrefixes = map[string]string{domain.Checksum([]byte("secret")): "tenants/acme"}
+	key = ObjectKey(cfg, KeyVars{Token: "secret", Filename: "invoice.pdf", SHA256: "abc", Now: now})
+	assert.True(t, strings.HasPrefix(key, "tenants/acme/"), key)
+	assert.NotContains(t, key, "secret")
+}
+
+func TestS3_PutUploadsAndPresigns(t *testing.T) {
+	var gotPath, gotType, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotType, gotBody = r.URL.Path, r.Header.Get("Content-Type"), string(body)
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer srv.Close()
+
+	var cfg config.Config
+	cfg.Storage.Endpoint = strings.TrimPrefix(srv.URL, "http://")
+	cfg.Storage.PublicEndpoint = "files.example.com"
+	cfg.Storage.Bucket = "pdfs"
+	cfg.Storage.AccessKey = "minio"
+	cfg.Storage.SecretKey = "minio123"
+	cfg.Storage.PresignExpiry = 10 * time.Minute
+
+	s3, err := NewS3(cfg)
+	require.NoError(t, err)
+
+	obj, err := s3.Put(context.Background(), "a/b.pdf", []byte("%PDF-1.4"), PutOptions{Filename: "b.pdf"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "/pdfs/a/b.pdf", gotPath)
+	assert.Equal(t, "application/pdf", gotType)
+	assert.Contains(t, gotBody, "%PDF-1.4") // chunk-signed over plain HTTP
+
+	assert.Equal(t, "pdfs", obj.Bucket)
+	assert.EqualValues(t, 8, obj.Size)
+	assert.Equal(t, domain.Checksum([]byte("%PDF-1.4")), obj.SHA256)
+	u, err := url.Parse(obj.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "files.example.com", u.Host)
+	assert.Equal(t, "600", u.Query().Get("X-Amz-Expires"))
+}
+
+func TestNewS3_RequiresBucket(t *testing.T) {
+	var cfg config.Config
+	cfg.Storage.Endpoint = "minio:9000"
+	_, err := NewS3(cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Relationships of an attachment to the document (AFRelationship, ISO 19005-3 and ISO 32000-2,
+// 14.13).
+const (
+	RelationshipSource      = "Source"      // the document was created from it, e.g. a spreadsheet
+	RelationshipData        = "Data"        // data behind the document's content, e.g. a table as CSV
+	RelationshipAlternative = "Alternative" // the same content in another format
+	RelationshipSupplement  = "Supplement"  // additions to the content, e.g. for accessibility
+	RelationshipUnspecified = "Unspecified"
+)
+
+var (
+	// ErrDuplicateAttachment means two attachments share a name; viewers list them by name.
+	ErrDuplicateAttachment = errors.New("pdf: attachment names must be unique")
+
+	// ErrAttachmentsPDFA2 means files were to be embedded in a PDF/A-2 document, which only
+	// allows embedded PDF/A documents. PDF/A-3 allows any file.
+	ErrAttachmentsPDFA2 = errors.New("pdf: PDF/A-2 documents cannot embed files; use PDF/A-3")
+)
+
+// Attachment is a file embedded in the document as an associated file: listed in the catalog's
+// AF array and the EmbeddedFiles name tree, so viewers show it and PDF/A-3 validators accept it.
+type Attachment struct {
+	Name         string // file name shown by viewers, unique within the document
+	Data         []byte
+	MIMEType     string // e.g. "text/xml"; "application/octet-stream" if empty
+	Description  string
+	Relationship string // Relationship* constant; RelationshipUnspecified if empty
+}
+
+// addAttachments embeds attachments, dated now, and lists them in the catalog's AF array.
+func addAttachments(ctx *model.Context, attachments []Attachment, now time.Time) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, a := range attachments {
+		if names[a.Name] {
+			return fmt.Errorf("%w: %q", ErrDuplicateAttachment, a.Name)
+		}
+		names[a.Name] = true
+	}
+	if err := ctx.LocateNameTree("EmbeddedFiles", true); err != nil {
+		return err
+	}
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	af, err := ctx.DereferenceArray(root["AF"])
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		spec, err := fileSpec(ctx, a, now)
+		if err != nil {
+			return fmt.Errorf("pdf: attachment %q: %w", a.Name, err)
+		}
+		ref, err := ctx.IndRefForNewObject(spec)
+		if err != nil {
+			return err
+		}
+		key, err := types.Escape(a.Name)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Names["EmbeddedFiles"].Add(ctx.XRefTable, *key, *ref, model.NameMap{}, nil); err != nil {
+			return fmt.Errorf("pdf: attachment %q: %w", a.Name, err)
+		}
+		af = append(af, *ref)
+	}
+	root.Update("AF", af)
+	return nil
+}
+
+// fileSpec returns the file specification of a, with its embedded file stream.
+func fileSpec(ctx *model.Context, a Attachment, now time.Time) (types.Dict, error) {
+	sd, err := ctx.NewStreamDictForBuf(a.Data)
+	if err != nil {
+		return nil, err
+	}
+	sd.InsertName("Type", "EmbeddedFile")
+	mimeType := a.MIMEType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	sd.InsertName("Subtype", mimeType)
+	params := types.NewDict()
+	params.InsertInt("Size", len(a.Data))
+	params.InsertString("ModDate", types.DateString(now))
+	sd.Insert("Params", params)
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	stream, err := ctx.IndRefForNewObject(*sd)
+	if err != nil {
+		return nil, err
+	}
+
+	// F is a byte string for older readers, UF the Unicode file name.
+	f, err := types.Escape(a.Name)
+	if !isPrintableASCII(a.Name) {
+		f, err = types.EscapedUTF16String(a.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	uf, err := types.EscapedUTF16String(a.Name)
+	if err != nil {
+		return nil, err
+	}
+	spec := types.NewDict()
+	spec.InsertName("Type", "Filespec")
+	spec.InsertString("F", *f)
+	spec.InsertString("UF", *uf)
+	ef := types.NewDict()
+	ef.Insert("F", *stream)
+	ef.Insert("UF", *stream)
+	spec.Insert("EF", ef)
+	if a.Description != "" {
+		desc, err := types.EscapedUTF16String(a.Description)
+		if err != nil {
+			return nil, err
+		}
+		spec.InsertString("Desc", *desc)
+	}
+	relationship := a.Relationship
+	if relationship == "" {
+		relationship = RelationshipUnspecified
+	}
+	spec.InsertName("AFRelationship", relationship)
+	return spec, nil
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attachmentSpecs returns the file specifications of the document's attachments by file name.
+func attachmentSpecs(t *testing.T, data []byte) map[string]map[string]string {
+	t.Helper()
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), config())
+	require.NoError(t, err)
+	root, err := ctx.Catalog()
+	require.NoError(t, err)
+	af, err := ctx.DereferenceArray(root["AF"])
+	require.NoError(t, err)
+	specs := map[string]map[string]string{}
+	for _, o := range af {
+		spec, err := ctx.DereferenceDict(o)
+		require.NoError(t, err)
+		ef, err := ctx.DereferenceDict(spec["EF"])
+		require.NoError(t, err)
+		sd, _, err := ctx.DereferenceStreamDict(ef["F"])
+		require.NoError(t, err)
+		name, err := ctx.DereferenceStringOrHexLiteral(spec["UF"], 0, nil)
+		require.NoError(t, err)
+		entries := map[string]string{
+			"AFRelationship": *spec.NameEntry("AFRelationship"),
+			"Subtype":        *sd.NameEntry("Subtype"),
+		}
+		if spec["Desc"] != nil {
+			entries["Desc"], err = ctx.DereferenceStringOrHexLiteral(spec["Desc"], 0, nil)
+			require.NoError(t, err)
+		}
+		specs[name] = entries
+	}
+	return specs
+}
+
+func TestProcess_Attachments(t *testing.T) {
+	attachments := []Attachment{
+		{Name: "data.csv", Data: []byte("a,b\n1,2\n"), MIMEType: "text/csv", Description: "Table data", Relationship: RelationshipData},
+		{Name: "Übersicht.txt", Data: []byte("notes")},
+	}
+	out, err := Process(chromePDF(embeddedFont), Options{Attachments: attachments})
+	require.NoError(t, err)
+
+	extracted, err := api.ExtractAttachmentsRaw(bytes.NewReader(out), "", nil, config())
+	require.NoError(t, err)
+	contents := map[string]string{}
+	for _, a := range extracted {
+		data, err := io.ReadAll(a)
+		require.NoError(t, err)
+		contents[a.FileName] = string(data)
+	}
+	assert.Equal(t, map[string]string{"data.csv": "a,b\n1,2\n", "Übersicht.txt": "notes"}, contents)
+
+	assert.Equal(t, map[string]map[string]string{
+		"data.csv":      {"AFRelationship": "Data", "Subtype": "text/csv", "Desc": "Table data"},
+		"Übersicht.txt": {"AFRelationship": "Unspecified", "Subtype": "application/octet-stream"},
+	}, attachmentSpecs(t, out))
+}
+
+func TestProcess_AttachmentsPDFA3B(t *testing.T) {
+	out, err := Process(chromePDF(embeddedFont), Options{
+		PDFA:        PDFA3B,
+		Attachments: []Attachment{{Name: "source.html", Data: []byte("<h1>Hello</h1>"), MIMEType: "text/html", Relationship: RelationshipSource}},
+	})
+	require.NoError(t, err)
+	validatePDFA(t, out, 3)
+	assert.Equal(t, "Source", attachmentSpecs(t, out)["source.html"]["AFRelationship"])
+}
+
+// TestProcess_AttachmentsPDFA3BClockStep steps the clock edit expects pdfcpu to stamp on one of
+// its calls: the attachments' dates must not hide a mismatch, and the Info dates must match the
+// XMP dates either way.
+func TestProcess_AttachmentsPDFA3BClockStep(t *testing.T) {
+	t.Cleanup(func() { clock = time.Now })
+	for _, step := range []int{1, 2} {
+		calls := 0
+		clock = func() time.Time {
+			calls++
+			if calls == step {
+				return time.Now().Add(-time.Hour) // pdfcpu stamps a different second
+			}
+			return time.Now()
+		}
+
+		out, err := Process(chromePDF(embeddedFont), Options{
+			PDFA:        PDFA3B,
+			Attachments: []Attachment{{Name: "source.html", Data: []byte("<h1>Hello</h1>"), MIMEType: "text/html", Relationship: RelationshipSource}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2/step, calls, "step %d: redone only after a mismatch", step)
+		validatePDFA(t, out, 3)
+	}
+}
+
+func TestProcess_AttachmentErrors(t *testing.T) {
+	a := Attachment{Name: "a.txt", Data: []byte("a")}
+	_, err := Process(chromePDF(embeddedFont), Options{Attachments: []Attachment{a, a}})
+	assert.ErrorIs(t, err, ErrDuplicateAttachment)
+
+	_, err = Process(chromePDF(embeddedFont), Options{PDFA: PDFA2B, Attachments: []Attachment{a}})
+	assert.ErrorIs(t, err, ErrAttachmentsPDFA2)
+}
@@ -0,0 +1,159 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sort"
+)
+
+// Object identifiers for CMS (RFC 5652), ESS (RFC 5035) and the algorithms used.
+var (
+	oidData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA256WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier                   `asn1:"set"`
+	EncapContentInfo struct{ EContentType asn1.ObjectIdentifier } // detached: no eContent
+	Certificates     asn1.RawValue                                // [0] IMPLICIT SET OF Certificate
+	SignerInfos      []signerInfo                                 `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue // [0] IMPLICIT SET OF Attribute
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue // SET OF AttributeValue
+}
+
+// essCertIDv2 omits hashAlgorithm: its default, SHA-256, is what is used.
+type essCertIDv2 struct {
+	CertHash     []byte
+	IssuerSerial struct {
+		Issuer       []asn1.RawValue // GeneralNames
+		SerialNumber *big.Int
+	}
+}
+
+// signCMS returns a detached CMS SignedData for content whose SHA-256 digest is digest, as PAdES
+// baseline B-B requires: the signed attributes are the content type, the message digest and the
+// ESS signing certificate; the signing time is in the signature dictionary only.
+func (s *Signer) signCMS(digest []byte) ([]byte, error) {
+	certHash := sha256.Sum256(s.Certificate.Raw)
+	var essID essCertIDv2
+	essID.CertHash = certHash[:]
+	essID.IssuerSerial.Issuer = []asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: s.Certificate.RawIssuer}}
+	essID.IssuerSerial.SerialNumber = s.Certificate.SerialNumber
+	// SigningCertificateV2 ::= SEQUENCE { certs SEQUENCE OF ESSCertIDv2 }
+	signingCert, err := asn1.Marshal(struct{ Certs []essCertIDv2 }{[]essCertIDv2{essID}})
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := asn1.Marshal(oidData)
+	if err != nil {
+		return nil, err
+	}
+	messageDigest, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := marshalAttributes(
+		attribute{Type: oidContentType, Values: set(contentType)},
+		attribute{Type: oidMessageDigest, Values: set(messageDigest)},
+		attribute{Type: oidSigningCertificateV2, Values: set(signingCert)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	// The signature covers the DER encoding of the attributes as a SET (not as [0]).
+	setDER, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(setDER)
+	sig, err := s.Key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	sigAlg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}
+	if _, ok := s.Key.Public().(*ecdsa.PublicKey); ok {
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+	var certs bytes.Buffer
+	for _, cert := range append([]*x509.Certificate{s.Certificate}, s.Chain...) {
+		certs.Write(cert.Raw)
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs.Bytes()},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: s.Certificate.RawIssuer}, SerialNumber: s.Certificate.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: sigAlg,
+			Signature:          sig,
+		}},
+	}
+	sd.EncapContentInfo.EContentType = oidData
+	inner, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}})
+}
+
+// set wraps DER encoded values into a SET.
+func set(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: der}
+}
+
+// marshalAttributes returns the content of a DER SET OF Attribute: the encodings in ascending
+// order.
+func marshalAttributes(attrs ...attribute) ([]byte, error) {
+	encoded := make([][]byte, len(attrs))
+	for i, a := range attrs {
+		der, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = der
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
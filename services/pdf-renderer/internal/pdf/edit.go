@@ -0,0 +1,86 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+func init() {
+	// Never read or create ~/.config/pdfcpu; the defaults below are all this package needs.
+	api.DisableConfigDir()
+}
+
+// config returns the pdfcpu configuration for post-processing Chrome's output. Object and xref
+// streams stay off so the result is laid out like Chrome's, and the optimizer is skipped; both
+// are turned on per document by Optimization.
+func config() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	conf.WriteObjectStream = false
+	conf.WriteXRefStream = false
+	conf.Optimize = false
+	conf.OptimizeBeforeWriting = false
+	conf.Offline = true
+	return conf
+}
+
+// recoverPanic turns a panic in pdfcpu into an error: its parser panics on some malformed
+// input instead of reporting it. Deferred by every function handing data to pdfcpu.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("pdf: pdfcpu panic: %v", r)
+	}
+}
+
+// clock returns the time edit expects pdfcpu to stamp; tests step it.
+var clock = time.Now
+
+// edit parses data, applies fn to the document and writes the result.
+//
+// pdfcpu stamps the write time into the document information dictionary (CreationDate,
+// ModDate). fn receives that time so XMP metadata can repeat it, as PDF/A requires; if the clock
+// crossed a second boundary before the dictionary was written, the edit is redone once.
+func edit(data []byte, fn func(ctx *model.Context, now time.Time) error) (_ []byte, err error) {
+	defer recoverPanic(&err)
+
+	var out bytes.Buffer
+	for attempt := 0; attempt < 2; attempt++ {
+		ctx, err := api.ReadAndValidate(bytes.NewReader(data), config())
+		if err != nil {
+			return nil, fmt.Errorf("pdf: read: %w", err)
+		}
+		now := clock().Truncate(time.Second)
+		if err := fn(ctx, now); err != nil {
+			return nil, err
+		}
+		out.Reset()
+		if err := api.WriteContext(ctx, &out); err != nil {
+			return nil, fmt.Errorf("pdf: write: %w", err)
+		}
+		// Compare the dictionary itself: fn may write the same date elsewhere (attachments do).
+		if infoModDate(ctx) == types.DateString(now) {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// infoModDate returns the ModDate of the document information dictionary, "" if it has none.
+func infoModDate(ctx *model.Context) string {
+	if ctx.Info == nil {
+		return ""
+	}
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || d == nil {
+		return ""
+	}
+	if s := d.StringEntry("ModDate"); s != nil {
+		return *s
+	}
+	return ""
+}
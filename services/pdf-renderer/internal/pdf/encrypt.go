@@ -0,0 +1,106 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Permissions that Encryption can grant to readers who open the document with the user
+// password. The owner password always grants everything.
+const (
+	PermissionPrint    = "print"
+	PermissionCopy     = "copy"
+	PermissionModify   = "modify"
+	PermissionAnnotate = "annotate"
+)
+
+// permissionFlags maps the permissions onto the access permission bits (ISO 32000-1, table 22).
+// Each permission sets its revision 2 bit and the revision 3 bit refining it.
+var permissionFlags = map[string]model.PermissionFlags{
+	PermissionPrint:    model.PermissionPrintRev2 | model.PermissionPrintRev3,
+	PermissionCopy:     model.PermissionExtract | model.PermissionExtractRev3,
+	PermissionModify:   model.PermissionModify | model.PermissionAssembleRev3,
+	PermissionAnnotate: model.PermissionModAnnFillForm | model.PermissionFillRev3,
+}
+
+// ErrNoPassword means Encryption was requested without a password.
+var ErrNoPassword = errors.New("pdf: encryption requires a user or owner password")
+
+// Encryption protects a PDF with passwords. Its String method hides the passwords, so it can be
+// logged as part of a request.
+type Encryption struct {
+	UserPassword  string // required to open the document; empty opens without a password
+	OwnerPassword string // grants all permissions; defaults to UserPassword
+
+	// Permissions lists what holders of the user password may do (Permission* constants).
+	// Anything not listed is denied.
+	Permissions []string
+}
+
+// IsZero reports whether e leaves the document unencrypted.
+func (e Encryption) IsZero() bool {
+	return e.UserPassword == "" && e.OwnerPassword == "" && len(e.Permissions) == 0
+}
+
+func (e Encryption) String() string {
+	return fmt.Sprintf("{user_password:%t owner_password:%t permissions:%v}", e.UserPassword != "", e.OwnerPassword != "", e.Permissions)
+}
+
+// ValidPermission reports whether p is one of the Permission* constants.
+func ValidPermission(p string) bool {
+	_, ok := permissionFlags[p]
+	return ok
+}
+
+// Encrypt returns data encrypted with AES-256. The document is marked as PDF 2.0 so pdfcpu uses
+// security handler revision 6; revision 5, its PDF 1.7 counterpart, checks passwords without
+// key stretching and is deprecated.
+func Encrypt(data []byte, e Encryption) (_ []byte, err error) {
+	defer recoverPanic(&err)
+
+	if e.UserPassword == "" && e.OwnerPassword == "" {
+		return nil, ErrNoPassword
+	}
+	owner := e.OwnerPassword
+	if owner == "" {
+		owner = e.UserPassword
+	}
+
+	conf := config()
+	conf.Cmd = model.ENCRYPT
+	conf.UserPW = e.UserPassword
+	conf.OwnerPW = owner
+	conf.EncryptUsingAES = true
+	conf.EncryptKeyLength = 256
+	conf.Permissions = model.PermissionsNone
+	for _, p := range e.Permissions {
+		flags, ok := permissionFlags[p]
+		if !ok {
+			return nil, fmt.Errorf("pdf: unknown permission %q", p)
+		}
+		conf.Permissions |= flags
+	}
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), conf)
+	if err != nil {
+		return nil, fmt.Errorf("pdf: read: %w", err)
+	}
+	if ctx.Encrypt != nil {
+		return nil, errors.New("pdf: already encrypted")
+	}
+	v20 := model.V20
+	ctx.HeaderVersion, ctx.RootVersion = &v20, nil
+	// A document compressed into object streams stays compressed.
+	ctx.WriteObjectStream = ctx.Read.UsingObjectStreams
+	ctx.WriteXRefStream = ctx.Read.UsingObjectStreams
+
+	var out bytes.Buffer
+	if err := api.WriteContext(ctx, &out); err != nil {
+		return nil, fmt.Errorf("pdf: encrypt: %w", err)
+	}
+	return out.Bytes(), nil
+}
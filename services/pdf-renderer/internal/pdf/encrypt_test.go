@@ -0,0 +1,80 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypt(t *testing.T) {
+	out, err := Encrypt(buildPDF(2), Encryption{
+		UserPassword:  "payslip",
+		OwnerPassword: "hr-department",
+		Permissions:   []string{PermissionPrint},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "/Encrypt")
+	assert.Contains(t, string(out), "/AESV3", "AES-256")
+	assert.True(t, bytes.HasPrefix(out, []byte("%PDF-2.0")))
+
+	_, err = api.ReadContext(bytes.NewReader(out), config())
+	assert.Error(t, err, "a password is required")
+
+	conf := config()
+	conf.UserPW = "payslip"
+	ctx, err := api.ReadContext(bytes.NewReader(out), conf)
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+	assert.Equal(t, 2, ctx.PageCount)
+	assert.Equal(t, 6, ctx.E.R, "security handler revision 6")
+
+	p := model.PermissionFlags(ctx.E.P)
+	assert.NotZero(t, p&model.PermissionPrintRev3, "print")
+	assert.Zero(t, p&model.PermissionExtract, "copy")
+	assert.Zero(t, p&model.PermissionModify, "modify")
+	assert.Zero(t, p&model.PermissionModAnnFillForm, "annotate")
+
+	n, err := PageCount(out)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "the page tree stays readable")
+}
+
+func TestEncrypt_OwnerDefaultsToUserPassword(t *testing.T) {
+	out, err := Encrypt(buildPDF(1), Encryption{UserPassword: "secret"})
+	require.NoError(t, err)
+
+	conf := config()
+	conf.OwnerPW = "secret"
+	_, err = api.ReadContext(bytes.NewReader(out), conf)
+	assert.NoError(t, err)
+}
+
+func TestEncrypt_Errors(t *testing.T) {
+	_, err := Encrypt(buildPDF(1), Encryption{Permissions: []string{PermissionPrint}})
+	assert.ErrorIs(t, err, ErrNoPassword)
+
+	_, err = Encrypt(buildPDF(1), Encryption{UserPassword: "x", Permissions: []string{"fly"}})
+	assert.Error(t, err)
+}
+
+func TestEncryption_StringHidesPasswords(t *testing.T) {
+	e := Encryption{UserPassword: "payslip", OwnerPassword: "hr-department", Permissions: []string{PermissionCopy}}
+	for _, s := range []string{e.String(), fmt.Sprint(e), fmt.Sprintf("%+v", struct{ E Encryption }{e})} {
+		assert.NotContains(t, s, "payslip")
+		assert.NotContains(t, s, "hr-department")
+	}
+	assert.Contains(t, e.String(), "copy")
+}
+
+func TestEncrypt_MalformedPDF(t *testing.T) {
+	// pdfcpu panics on this (a page tree without an xref table); it must surface as an error.
+	data := []byte("%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Count 0 /Kids [] >> endobj\ntrailer << /Size 3 /Root 1 0 R >>\n%%EOF\n")
+	_, err := Encrypt(data, Encryption{UserPassword: "x"})
+	assert.Error(t, err)
+}
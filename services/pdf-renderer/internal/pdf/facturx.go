@@ -0,0 +1,156 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Factur-X (ZUGFeRD 2) conformance levels, as written to the XMP metadata.
+const (
+	FacturXMinimum   = "MINIMUM"
+	FacturXBasicWL   = "BASIC WL"
+	FacturXBasic     = "BASIC"
+	FacturXEN16931   = "EN 16931"
+	FacturXExtended  = "EXTENDED"
+	FacturXXRechnung = "XRECHNUNG"
+)
+
+const facturXNamespace = "urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#"
+
+var (
+	// ErrInvalidFacturX means the invoice XML is not a UN/CEFACT Cross Industry Invoice with a
+	// known Factur-X or ZUGFeRD guideline.
+	ErrInvalidFacturX = errors.New("pdf: not a Factur-X invoice")
+
+	// ErrFacturXNotPDFA3 means Options.FacturX was set without PDFA3B, which Factur-X requires.
+	ErrFacturXNotPDFA3 = errors.New("pdf: Factur-X requires PDF/A-3")
+)
+
+// FacturX is the invoice XML of a Factur-X (ZUGFeRD 2) e-invoice, embedded into a PDF/A-3 with
+// the file name, relationship and XMP extension schema the specification prescribes.
+type FacturX struct {
+	XML   []byte
+	Level string // FacturX* conformance level
+}
+
+// ParseFacturX checks that data is a Cross Industry Invoice and reads its conformance level from
+// the guideline it names (ExchangedDocumentContext/GuidelineSpecifiedDocumentContextParameter/ID).
+func ParseFacturX(data []byte) (*FacturX, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var path []string
+	var guideline strings.Builder
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFacturX, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(path) == 0 && t.Name.Local != "CrossIndustryInvoice" {
+				return nil, fmt.Errorf("%w: root element is %s", ErrInvalidFacturX, t.Name.Local)
+			}
+			path = append(path, t.Name.Local)
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		case xml.CharData:
+			if n := len(path); n >= 2 && path[n-2] == "GuidelineSpecifiedDocumentContextParameter" && path[n-1] == "ID" {
+				guideline.Write(t)
+			}
+		}
+	}
+	level := facturXLevel(strings.TrimSpace(guideline.String()))
+	if level == "" {
+		return nil, fmt.Errorf("%w: unknown guideline %q", ErrInvalidFacturX, strings.TrimSpace(guideline.String()))
+	}
+	return &FacturX{XML: data, Level: level}, nil
+}
+
+// facturXLevel maps a guideline identifier of Factur-X 1.0 or ZUGFeRD 2 onto its conformance
+// level, or returns "".
+func facturXLevel(guideline string) string {
+	switch {
+	case strings.Contains(guideline, ":xrechnung"):
+		return FacturXXRechnung
+	case strings.HasSuffix(guideline, ":minimum"):
+		return FacturXMinimum
+	case strings.HasSuffix(guideline, ":basicwl"):
+		return FacturXBasicWL
+	case strings.HasSuffix(guideline, ":basic"):
+		return FacturXBasic
+	case strings.HasSuffix(guideline, ":extended"):
+		return FacturXExtended
+	case guideline == "urn:cen.eu:en16931:2017":
+		return FacturXEN16931
+	}
+	return ""
+}
+
+// FileName returns the name the specification gives the embedded invoice.
+func (f *FacturX) FileName() string {
+	if f.Level == FacturXXRechnung {
+		return "xrechnung.xml"
+	}
+	return "factur-x.xml"
+}
+
+// attachment returns the invoice as an associated file. The levels below BASIC do not carry
+// the whole invoice, so their XML is data for the PDF rather than an alternative to it.
+func (f *FacturX) attachment() Attachment {
+	relationship := RelationshipAlternative
+	if f.Level == FacturXMinimum || f.Level == FacturXBasicWL {
+		relationship = RelationshipData
+	}
+	return Attachment{
+		Name:         f.FileName(),
+		Data:         f.XML,
+		MIMEType:     "text/xml",
+		Description:  "Factur-X invoice",
+		Relationship: relationship,
+	}
+}
+
+// xmp returns the Factur-X properties and the PDF/A extension schema describing them, as
+// rdf:Description elements of an XMP packet.
+func (f *FacturX) xmp() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  <rdf:Description rdf:about=\"\" xmlns:fx=%q>\n", facturXNamespace)
+	b.WriteString("   <fx:DocumentType>INVOICE</fx:DocumentType>\n")
+	fmt.Fprintf(&b, "   <fx:DocumentFileName>%s</fx:DocumentFileName>\n", f.FileName())
+	b.WriteString("   <fx:Version>1.0</fx:Version>\n")
+	fmt.Fprintf(&b, "   <fx:ConformanceLevel>%s</fx:ConformanceLevel>\n", xmlText(f.Level))
+	b.WriteString("  </rdf:Description>\n")
+
+	b.WriteString(`  <rdf:Description rdf:about=""` +
+		` xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/"` +
+		` xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#"` +
+		` xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">` + "\n")
+	b.WriteString("   <pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType=\"Resource\">\n")
+	b.WriteString("    <pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>\n")
+	fmt.Fprintf(&b, "    <pdfaSchema:namespaceURI>%s</pdfaSchema:namespaceURI>\n", facturXNamespace)
+	b.WriteString("    <pdfaSchema:prefix>fx</pdfaSchema:prefix>\n")
+	b.WriteString("    <pdfaSchema:property><rdf:Seq>\n")
+	for _, p := range []struct{ name, description string }{
+		{"DocumentFileName", "The name of the embedded XML document"},
+		{"DocumentType", "The type of the hybrid document in capital letters, e.g. INVOICE or ORDER"},
+		{"Version", "The actual version of the standard applying to the embedded XML document"},
+		{"ConformanceLevel", "The conformance level of the embedded XML document"},
+	} {
+		b.WriteString("     <rdf:li rdf:parseType=\"Resource\">\n")
+		fmt.Fprintf(&b, "      <pdfaProperty:name>%s</pdfaProperty:name>\n", p.name)
+		b.WriteString("      <pdfaProperty:valueType>Text</pdfaProperty:valueType>\n")
+		b.WriteString("      <pdfaProperty:category>external</pdfaProperty:category>\n")
+		fmt.Fprintf(&b, "      <pdfaProperty:description>%s</pdfaProperty:description>\n", p.description)
+		b.WriteString("     </rdf:li>\n")
+	}
+	b.WriteString("    </rdf:Seq></pdfaSchema:property>\n")
+	b.WriteString("   </rdf:li></rdf:Bag></pdfaExtension:schemas>\n")
+	b.WriteString("  </rdf:Description>\n")
+	return b.String()
+}
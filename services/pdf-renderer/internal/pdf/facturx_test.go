@@ -0,0 +1,98 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// invoiceXML returns a minimal Cross Industry Invoice following guideline.
+func invoiceXML(guideline string) []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<rsm:CrossIndustryInvoice xmlns:rsm="urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+  xmlns:ram="urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100">
+ <rsm:ExchangedDocumentContext>
+  <ram:GuidelineSpecifiedDocumentContextParameter>
+   <ram:ID>%s</ram:ID>
+  </ram:GuidelineSpecifiedDocumentContextParameter>
+ </rsm:ExchangedDocumentContext>
+ <rsm:ExchangedDocument><ram:ID>INV-1</ram:ID></rsm:ExchangedDocument>
+</rsm:CrossIndustryInvoice>`, guideline))
+}
+
+func TestParseFacturX(t *testing.T) {
+	for guideline, level := range map[string]string{
+		"urn:factur-x.eu:1p0:minimum":                                           FacturXMinimum,
+		"urn:factur-x.eu:1p0:basicwl":                                           FacturXBasicWL,
+		"urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic":           FacturXBasic,
+		"urn:cen.eu:en16931:2017":                                               FacturXEN16931,
+		"urn:cen.eu:en16931:2017#conformant#urn:factur-x.eu:1p0:extended":       FacturXExtended,
+		"urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0": FacturXXRechnung,
+	} {
+		fx, err := ParseFacturX(invoiceXML(guideline))
+		require.NoError(t, err, guideline)
+		assert.Equal(t, level, fx.Level, guideline)
+	}
+
+	for name, data := range map[string][]byte{
+		"unknown guideline": invoiceXML("urn:example:invoice"),
+		"other root":        []byte(`<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"/>`),
+		"malformed":         []byte(`<rsm:CrossIndustryInvoice>`),
+		"empty":             nil,
+	} {
+		_, err := ParseFacturX(data)
+		assert.ErrorIs(t, err, ErrInvalidFacturX, name)
+	}
+}
+
+func TestProcess_FacturX(t *testing.T) {
+	fx, err := ParseFacturX(invoiceXML("urn:cen.eu:en16931:2017"))
+	require.NoError(t, err)
+	out, err := Process(chromePDF(embeddedFont), Options{PDFA: PDFA3B, FacturX: fx})
+	require.NoError(t, err)
+	validatePDFA(t, out, 3)
+
+	assert.Equal(t, map[string]map[string]string{
+		"factur-x.xml": {"AFRelationship": "Alternative", "Subtype": "text/xml", "Desc": "Factur-X invoice"},
+	}, attachmentSpecs(t, out))
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	root, err := ctx.Catalog()
+	require.NoError(t, err)
+	xmp, _, err := ctx.DereferenceStreamDict(root["Metadata"])
+	require.NoError(t, err)
+	require.NoError(t, xmp.Decode())
+	packet := string(xmp.Content)
+	for _, element := range []string{
+		"<fx:DocumentType>INVOICE</fx:DocumentType>",
+		"<fx:DocumentFileName>factur-x.xml</fx:DocumentFileName>",
+		"<fx:Version>1.0</fx:Version>",
+		"<fx:ConformanceLevel>EN 16931</fx:ConformanceLevel>",
+		"<pdfaSchema:namespaceURI>" + facturXNamespace + "</pdfaSchema:namespaceURI>",
+		"<pdfaSchema:prefix>fx</pdfaSchema:prefix>",
+	} {
+		assert.Contains(t, packet, element)
+	}
+}
+
+func TestProcess_FacturXMinimumIsData(t *testing.T) {
+	fx, err := ParseFacturX(invoiceXML("urn:factur-x.eu:1p0:minimum"))
+	require.NoError(t, err)
+	out, err := Process(chromePDF(embeddedFont), Options{PDFA: PDFA3B, FacturX: fx})
+	require.NoError(t, err)
+	assert.Equal(t, "Data", attachmentSpecs(t, out)["factur-x.xml"]["AFRelationship"])
+}
+
+func TestProcess_FacturXRequiresPDFA3B(t *testing.T) {
+	fx, err := ParseFacturX(invoiceXML("urn:factur-x.eu:1p0:basic"))
+	require.NoError(t, err)
+	for _, pdfa := range []string{"", PDFA2B} {
+		_, err = Process(chromePDF(embeddedFont), Options{PDFA: pdfa, FacturX: fx})
+		assert.ErrorIs(t, err, ErrFacturXNotPDFA3, pdfa)
+	}
+}
@@ -0,0 +1,431 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+var (
+	// ErrNoForm means the document has no AcroForm fields to fill.
+	ErrNoForm = errors.New("pdf: the document has no form fields")
+
+	// ErrUnknownField means a value was given for a field the form does not have.
+	ErrUnknownField = errors.New("pdf: unknown form field")
+
+	// ErrInvalidFieldValue means a value does not fit its field: not one of a choice field's
+	// options, several values for a single-value field, or text longer than the field allows.
+	ErrInvalidFieldValue = errors.New("pdf: invalid form field value")
+)
+
+// Form holds the values filled into the AcroForm fields of an existing document.
+type Form struct {
+	// Values maps fully qualified field names (e.g. "address.city") to their values: one for
+	// text, date, combo box and radio button fields ("true" or "false" for checkboxes), any
+	// number of options for multi-select list boxes. Fields without a value keep theirs.
+	Values map[string][]string
+
+	// Flatten draws the fields into the page content and removes the form, so the values can
+	// no longer be edited. Fields without an appearance, e.g. empty ones in forms relying on
+	// the viewer to draw them, disappear.
+	Flatten bool
+}
+
+// FillForm returns data with the form fields filled and, if requested, flattened. Signatures
+// in data are removed: filling the form invalidates them.
+func FillForm(data []byte, f Form) ([]byte, error) {
+	return edit(data, func(ctx *model.Context, _ time.Time) error {
+		return fillForm(ctx, f)
+	})
+}
+
+func fillForm(ctx *model.Context, f Form) error {
+	if ctx.Form == nil {
+		return ErrNoForm
+	}
+	group, ok, err := form.ExportForm(ctx.XRefTable, "")
+	if err != nil {
+		return err
+	}
+	if !ok || len(group.Forms) == 0 {
+		return ErrNoForm
+	}
+	values, err := formValues(group.Forms[0], f.Values)
+	if err != nil {
+		return err
+	}
+
+	ctx.RemoveSignature()
+	// XFA forms would show the data they were saved with instead of the values filled in.
+	ctx.Form.Delete("XFA")
+	_, _, err = form.FillForm(ctx, func(_, name string, _ form.FieldType, _ form.DataFormat) ([]string, bool, bool) {
+		v, ok := values[name]
+		// Locking has pdfcpu draw the appearance of combo boxes, which flattening needs.
+		return v.values, v.locked || f.Flatten, ok
+	}, nil, form.JSON)
+	if err != nil || !f.Flatten {
+		return err
+	}
+	return flattenForm(ctx)
+}
+
+// fieldValue is a value checked against its field, in the form pdfcpu fills it in.
+type fieldValue struct {
+	values []string
+	locked bool // the field is read-only and stays so
+}
+
+// formValues checks values against the fields of f and returns them by field name.
+func formValues(f form.Form, values map[string][]string) (map[string]fieldValue, error) {
+	checked := make(map[string]fieldValue, len(values))
+	one := func(name string, vv []string) error {
+		if len(vv) != 1 {
+			return fmt.Errorf("%w: %q takes one value", ErrInvalidFieldValue, name)
+		}
+		return nil
+	}
+	option := func(name string, v string, options []string) error {
+		if !slices.Contains(options, v) {
+			return fmt.Errorf("%w: %q must be one of %q", ErrInvalidFieldValue, name, options)
+		}
+		return nil
+	}
+	for name, vv := range values {
+		var (
+			err    error
+			locked bool
+		)
+		switch field := findField(f, name).(type) {
+		case *form.TextField:
+			locked = field.Locked
+			if err = one(name, vv); err == nil && field.MaxLen > 0 && utf8.RuneCountInString(vv[0]) > field.MaxLen {
+				err = fmt.Errorf("%w: %q takes at most %d characters", ErrInvalidFieldValue, name, field.MaxLen)
+			}
+		case *form.DateField:
+			locked = field.Locked
+			err = one(name, vv)
+		case *form.CheckBox:
+			locked = field.Locked
+			if err = one(name, vv); err == nil {
+				var on bool
+				if on, err = parseCheckBox(vv[0]); err != nil {
+					err = fmt.Errorf("%w: %q takes true or false", ErrInvalidFieldValue, name)
+				}
+				vv = []string{strconv.FormatBool(on)}
+			}
+		case *form.RadioButtonGroup:
+			locked = field.Locked
+			if err = one(name, vv); err == nil {
+				err = option(name, vv[0], field.Options)
+			}
+		case *form.ComboBox:
+			locked = field.Locked
+			if err = one(name, vv); err == nil {
+				err = option(name, vv[0], field.Options)
+			}
+		case *form.ListBox:
+			locked = field.Locked
+			if !field.Multi {
+				err = one(name, vv)
+			}
+			for _, v := range vv {
+				if err == nil {
+					err = option(name, v, field.Options)
+				}
+			}
+		default:
+			err = fmt.Errorf("%w: %q", ErrUnknownField, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		checked[name] = fieldValue{values: vv, locked: locked}
+	}
+	return checked, nil
+}
+
+// findField returns the field of f with the fully qualified name, or nil.
+func findField(f form.Form, name string) any {
+	for _, field := range f.TextFields {
+		if field.Name == name {
+			return field
+		}
+	}
+	for _, field := range f.DateFields {
+		if field.Name == name {
+			return field
+		}
+	}
+	for _, field := range f.CheckBoxes {
+		if field.Name == name {
+			return field
+		}
+	}
+	for _, field := range f.RadioButtonGroups {
+		if field.Name == name {
+			return field
+		}
+	}
+	for _, field := range f.ComboBoxes {
+		if field.Name == name {
+			return field
+		}
+	}
+	for _, field := range f.ListBoxes {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// parseCheckBox reads a checkbox value: a boolean, or on/off and yes/no as HTML forms send them.
+func parseCheckBox(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(strings.TrimSpace(s))
+}
+
+// flattenForm draws the widget annotations of every page into its content and removes them,
+// together with the AcroForm. Other annotations, e.g. links, are kept.
+func flattenForm(ctx *model.Context) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	acroForm, err := ctx.DereferenceDict(root["AcroForm"])
+	if err != nil {
+		return err
+	}
+	// Appearance streams without resources use the form's default resources.
+	dr, err := ctx.DereferenceDict(acroForm["DR"])
+	if err != nil {
+		return err
+	}
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		page, _, inherited, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			return err
+		}
+		if err := flattenPage(ctx, page, inherited.Resources, dr); err != nil {
+			return fmt.Errorf("pdf: flatten page %d: %w", pageNr, err)
+		}
+	}
+	root.Delete("AcroForm")
+	return nil
+}
+
+// flattenPage draws the visible widgets of page with their normal appearance (ISO 32000-1,
+// 12.5.5) after the page's content, and removes all widgets from its annotations.
+func flattenPage(ctx *model.Context, page, inheritedResources, dr types.Dict) error {
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil || annots == nil {
+		return err
+	}
+	var (
+		kept    types.Array
+		content bytes.Buffer
+		xobjs   = types.Dict{}
+	)
+	for _, obj := range annots {
+		annot, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			return err
+		}
+		if subtype := annot.Subtype(); subtype == nil || *subtype != "Widget" {
+			kept = append(kept, obj)
+			continue
+		}
+		if f := annot.IntEntry("F"); f != nil && *f&(annotInvisible|annotHidden) != 0 {
+			continue
+		}
+		ref, ok := widgetAppearance(ctx, annot)
+		if !ok {
+			continue
+		}
+		sd, _, err := ctx.DereferenceStreamDict(ref)
+		if err != nil || sd == nil {
+			return err
+		}
+		rect, err := ctx.RectForArray(annot.ArrayEntry("Rect"))
+		if err != nil || rect == nil {
+			continue
+		}
+		m, ok := appearanceMatrix(sd, rect)
+		if !ok {
+			continue
+		}
+		if _, found := sd.Find("Resources"); !found && dr != nil {
+			sd.Insert("Resources", dr)
+		}
+		sd.InsertName("Type", "XObject")
+		sd.InsertName("Subtype", "Form")
+		name := "Fm" + strconv.Itoa(ref.ObjectNumber.Value())
+		xobjs[name] = ref
+		fmt.Fprintf(&content, "q %s cm /%s Do Q\n", matrixOperands(m), name)
+	}
+	if len(kept) == 0 {
+		page.Delete("Annots")
+	} else {
+		page.Update("Annots", kept)
+	}
+	if len(xobjs) == 0 {
+		return nil
+	}
+	if err := addXObjects(ctx, page, inheritedResources, xobjs); err != nil {
+		return err
+	}
+	return appendContent(ctx, page, content.Bytes())
+}
+
+// widgetAppearance returns the normal appearance of a widget: the stream itself, or the one
+// for its appearance state (checkboxes and radio buttons).
+func widgetAppearance(ctx *model.Context, annot types.Dict) (types.IndirectRef, bool) {
+	ap, err := ctx.DereferenceDict(annot["AP"])
+	if err != nil || ap == nil {
+		return types.IndirectRef{}, false
+	}
+	n := ap["N"]
+	if states, err := ctx.DereferenceDict(n); err == nil && states != nil && states.Type() == nil {
+		as := annot.NameEntry("AS")
+		if as == nil {
+			return types.IndirectRef{}, false
+		}
+		n = states[*as]
+	}
+	ref, ok := n.(types.IndirectRef)
+	return ref, ok
+}
+
+// appearanceMatrix returns the matrix mapping the appearance stream's bounding box, transformed
+// by its Matrix, onto the annotation's rectangle.
+func appearanceMatrix(sd *types.StreamDict, rect *types.Rectangle) (matrix, bool) {
+	a := sd.ArrayEntry("BBox")
+	if len(a) != 4 {
+		return matrix{}, false
+	}
+	// A box is read as the matrix [llx lly urx ury 0 0] to reuse toMatrix's number parsing.
+	box, ok := toMatrix(append(append(types.Array(nil), a...), types.Integer(0), types.Integer(0)))
+	if !ok {
+		return matrix{}, false
+	}
+	m := identity
+	if a := sd.ArrayEntry("Matrix"); a != nil {
+		if m, ok = toMatrix(a); !ok {
+			return matrix{}, false
+		}
+	}
+	// The transformed box is the bounding box of the transformed corners.
+	var llx, lly, urx, ury float64
+	for i, corner := range [][2]float64{{box[0], box[1]}, {box[2], box[1]}, {box[0], box[3]}, {box[2], box[3]}} {
+		x := m[0]*corner[0] + m[2]*corner[1] + m[4]
+		y := m[1]*corner[0] + m[3]*corner[1] + m[5]
+		if i == 0 {
+			llx, lly, urx, ury = x, y, x, y
+			continue
+		}
+		llx, lly, urx, ury = min(llx, x), min(lly, y), max(urx, x), max(ury, y)
+	}
+	if urx-llx <= 0 || ury-lly <= 0 {
+		return matrix{}, false
+	}
+	sx, sy := rect.Width()/(urx-llx), rect.Height()/(ury-lly)
+	return matrix{sx, 0, 0, sy, rect.LL.X - llx*sx, rect.LL.Y - lly*sy}, true
+}
+
+func matrixOperands(m matrix) string {
+	parts := make([]string, len(m))
+	for i, v := range m {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+// addXObjects adds xobjs to the page's resources, which it takes over from the page tree if it
+// inherits them.
+func addXObjects(ctx *model.Context, page, inheritedResources types.Dict, xobjs types.Dict) error {
+	resources, err := ctx.DereferenceDict(page["Resources"])
+	if err != nil {
+		return err
+	}
+	if resources == nil {
+		resources = inheritedResources
+		if resources == nil {
+			resources = types.NewDict()
+		}
+		page.Update("Resources", resources)
+	}
+	existing, err := ctx.DereferenceDict(resources["XObject"])
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		resources.Update("XObject", xobjs)
+		return nil
+	}
+	for name, ref := range xobjs {
+		existing.Update(name, ref)
+	}
+	return nil
+}
+
+// appendContent draws content on top of the page: the existing content streams are wrapped in
+// q/Q so a graphics state they leave changed does not apply to it.
+func appendContent(ctx *model.Context, page types.Dict, content []byte) error {
+	var streams types.Array
+	switch obj := page["Contents"].(type) {
+	case nil:
+	case types.Array:
+		streams = obj
+	case types.IndirectRef:
+		deref, err := ctx.Dereference(obj)
+		if err != nil {
+			return err
+		}
+		if a, ok := deref.(types.Array); ok {
+			streams = a
+		} else {
+			streams = types.Array{obj}
+		}
+	default:
+		return errors.New("pdf: malformed page contents")
+	}
+	newStream := func(b []byte) (types.Object, error) {
+		sd, err := ctx.NewStreamDictForBuf(b)
+		if err != nil {
+			return nil, err
+		}
+		if err := sd.Encode(); err != nil {
+			return nil, err
+		}
+		ref, err := ctx.IndRefForNewObject(*sd)
+		if err != nil {
+			return nil, err
+		}
+		return *ref, nil
+	}
+	open, err := newStream([]byte("q\n"))
+	if err != nil {
+		return err
+	}
+	closing, err := newStream(append([]byte("Q\n"), content...))
+	if err != nil {
+		return err
+	}
+	all := append(types.Array{open}, streams...)
+	page.Update("Contents", append(all, closing))
+	return nil
+}
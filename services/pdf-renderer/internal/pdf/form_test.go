@@ -0,0 +1,145 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formPDF returns a one-page form with a text field "name" of at most 20 characters, a checkbox
+// "agree", a combo box "color", a radio button group "size", a multi-select list box "toppings"
+// and a link, as form editors write it.
+func formPDF() []byte {
+	ap := func(s string) string {
+		return fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 12 12] /Length %d >>\nstream\n%s\nendstream", len(s), s)
+	}
+	content := "0 0 1 rg 0 0 10 10 re f"
+	return assemblePDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [4 0 R 5 0 R 8 0 R 9 0 R 12 0 R] /DR << /Font << /Helv 13 0 R >> >> /DA (/Helv 0 Tf 0 g) >> >>",
+		"<< /Type /Pages /Count 1 /Kids [3 0 R] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << >> /Contents 14 0 R /Annots [4 0 R 5 0 R 8 0 R 10 0 R 11 0 R 12 0 R 15 0 R] >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Tx /T (name) /MaxLen 20 /Rect [50 700 250 720] /DA (/Helv 12 Tf 0 g) /F 4 /P 3 0 R >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Btn /T (agree) /Rect [50 650 62 662] /V /Off /AS /Off /AP << /N << /Yes 6 0 R /Off 7 0 R >> >> /F 4 /P 3 0 R >>",
+		ap("0 0 12 12 re f"),
+		ap("0 0 12 12 re S"),
+		"<< /Type /Annot /Subtype /Widget /FT /Ch /Ff 131072 /T (color) /Opt [(Red) (Green)] /Rect [50 600 250 620] /DA (/Helv 12 Tf 0 g) /F 4 /P 3 0 R >>",
+		"<< /FT /Btn /Ff 49152 /T (size) /Kids [10 0 R 11 0 R] /V /Off >>",
+		"<< /Type /Annot /Subtype /Widget /Parent 9 0 R /Rect [50 550 62 562] /AS /Off /AP << /N << /S 6 0 R /Off 7 0 R >> >> /F 4 /P 3 0 R >>",
+		"<< /Type /Annot /Subtype /Widget /Parent 9 0 R /Rect [70 550 82 562] /AS /Off /AP << /N << /M 6 0 R /Off 7 0 R >> >> /F 4 /P 3 0 R >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Ch /Ff 2097152 /T (toppings) /Opt [(Ham) (Cheese) (Olives)] /Rect [50 450 250 520] /DA (/Helv 12 Tf 0 g) /F 4 /P 3 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Annot /Subtype /Link /Rect [50 400 250 420] /A << /S /URI /URI (https://example.com) >> >>",
+		"<< /Producer (Form Editor) >>",
+	})
+}
+
+// readForm returns the fields of the form in data.
+func readForm(t *testing.T, data []byte) (*model.Context, form.Form) {
+	t.Helper()
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), config())
+	require.NoError(t, err)
+	g, ok, err := form.ExportForm(ctx.XRefTable, "")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, g.Forms, 1)
+	return ctx, g.Forms[0]
+}
+
+func filledValues() map[string][]string {
+	return map[string][]string{
+		"name":     {"Jane Doe"},
+		"agree":    {"yes"},
+		"color":    {"Green"},
+		"size":     {"M"},
+		"toppings": {"Ham", "Olives"},
+	}
+}
+
+func TestFillForm(t *testing.T) {
+	out, err := FillForm(formPDF(), Form{Values: filledValues()})
+	require.NoError(t, err)
+
+	_, f := readForm(t, out)
+	require.Len(t, f.TextFields, 1)
+	assert.Equal(t, "Jane Doe", f.TextFields[0].Value)
+	assert.False(t, f.TextFields[0].Locked, "fields stay editable")
+	require.Len(t, f.CheckBoxes, 1)
+	assert.True(t, f.CheckBoxes[0].Value)
+	require.Len(t, f.ComboBoxes, 1)
+	assert.Equal(t, "Green", f.ComboBoxes[0].Value)
+	require.Len(t, f.RadioButtonGroups, 1)
+	assert.Equal(t, "M", f.RadioButtonGroups[0].Value)
+	require.Len(t, f.ListBoxes, 1)
+	assert.Equal(t, []string{"Ham", "Olives"}, f.ListBoxes[0].Values)
+}
+
+func TestFillForm_KeepsUnfilledFields(t *testing.T) {
+	out, err := FillForm(formPDF(), Form{Values: map[string][]string{"name": {"Jane Doe"}}})
+	require.NoError(t, err)
+
+	_, f := readForm(t, out)
+	assert.Equal(t, "Jane Doe", f.TextFields[0].Value)
+	assert.False(t, f.CheckBoxes[0].Value)
+	assert.Empty(t, f.RadioButtonGroups[0].Value)
+}
+
+func TestFillForm_Flatten(t *testing.T) {
+	out, err := FillForm(formPDF(), Form{Values: filledValues(), Flatten: true})
+	require.NoError(t, err)
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	root, err := ctx.Catalog()
+	require.NoError(t, err)
+	assert.NotContains(t, root, "AcroForm")
+
+	page, _, _, err := ctx.PageDict(1, false)
+	require.NoError(t, err)
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	require.NoError(t, err)
+	require.Len(t, annots, 1, "only the link is left")
+	link, err := ctx.DereferenceDict(annots[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Link", *link.Subtype())
+
+	content, err := ctx.PageContent(page)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "q\n0 0 1 rg 0 0 10 10 re f", "the page content is wrapped in q/Q")
+	// The checked box and the chosen radio button are drawn, the other button with its Off state.
+	assert.Contains(t, string(content), "q 1 0 0 1 50 650 cm /Fm6 Do Q")
+	assert.Contains(t, string(content), "q 1 0 0 1 50 550 cm /Fm7 Do Q")
+	assert.Contains(t, string(content), "q 1 0 0 1 70 550 cm /Fm6 Do Q")
+	resources, err := ctx.DereferenceDict(page["Resources"])
+	require.NoError(t, err)
+	xobjs, err := ctx.DereferenceDict(resources["XObject"])
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(xobjs), 4, "text, checkbox states, combo and list box appearances")
+}
+
+func TestFillForm_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		values map[string][]string
+		want   error
+	}{
+		{map[string][]string{"surname": {"Doe"}}, ErrUnknownField},
+		{map[string][]string{"name": {"Jane", "Doe"}}, ErrInvalidFieldValue},
+		{map[string][]string{"name": {"Jane Doe of the Northern Reaches"}}, ErrInvalidFieldValue},
+		{map[string][]string{"agree": {"maybe"}}, ErrInvalidFieldValue},
+		{map[string][]string{"color": {"Blue"}}, ErrInvalidFieldValue},
+		{map[string][]string{"size": {"XL"}}, ErrInvalidFieldValue},
+		{map[string][]string{"toppings": {"Ham", "Pineapple"}}, ErrInvalidFieldValue},
+	} {
+		_, err := FillForm(formPDF(), Form{Values: tc.values})
+		assert.ErrorIs(t, err, tc.want, "%v", tc.values)
+	}
+
+	_, err := FillForm(chromePDF(embeddedFont), Form{Values: filledValues()})
+	assert.ErrorIs(t, err, ErrNoForm)
+}
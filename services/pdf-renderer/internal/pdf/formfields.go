@@ -0,0 +1,539 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Kinds of form fields (FormField.Kind).
+const (
+	FieldText     = "text"
+	FieldTextArea = "textarea" // multi-line text
+	FieldCheckBox = "checkbox"
+	FieldRadio    = "radio" // radio buttons with the same name form one group
+	FieldComboBox = "combobox"
+	FieldListBox  = "listbox"
+)
+
+// Field flags (ISO 32000-1, tables 221, 226, 228 and 230).
+const (
+	fieldReadOnly      = 1 << 0
+	fieldRequired      = 1 << 1
+	fieldMultiline     = 1 << 12
+	fieldNoToggleToOff = 1 << 14
+	fieldRadio         = 1 << 15
+	fieldCombo         = 1 << 17
+	fieldMultiSelect   = 1 << 21
+)
+
+const (
+	maxFieldFontSize = 12   // points, for fields without a font size
+	fieldInset       = 2    // points between the widget's edges and its text
+	fieldLeading     = 1.15 // line height relative to the font size
+)
+
+// FormField is an interactive AcroForm field added on top of a page, e.g. where Chrome printed
+// an HTML form control. Its appearance shows the value in Helvetica; borders and backgrounds are
+// left to the page, except for checkboxes and radio buttons, which are drawn whole.
+type FormField struct {
+	Kind string
+	// Name is the field's name; periods become underscores, and a name already taken gets a
+	// numeric suffix. Radio buttons with the same name are one field.
+	Name string
+	Page int        // 1-based; fields on pages the document does not have are dropped
+	Rect [4]float64 // lower-left x and y, upper-right x and y in points
+
+	Value    string   // text fields; for radio buttons the value the group takes when checked
+	Checked  bool     // checkboxes and radio buttons
+	Options  []Option // combo and list boxes
+	Multiple bool     // list boxes allow several selected options
+	MaxLen   int      // text fields; 0 is unlimited
+	FontSize float64  // points; 0 fits the text to the widget
+	ReadOnly bool
+	Required bool
+}
+
+// Option is one of the choices of a combo or list box.
+type Option struct {
+	Value    string // the field's value if selected
+	Text     string // shown instead of Value, if set
+	Selected bool
+}
+
+func (o Option) label() string {
+	if o.Text != "" {
+		return o.Text
+	}
+	return o.Value
+}
+
+// formFields adds fields to the document's AcroForm, which is created if there is none.
+type formFields struct {
+	ctx    *model.Context
+	form   types.Dict
+	fields types.Array
+	fonts  types.Dict // Helv and ZaDb, the form's default resources
+	taken  map[string]bool
+	radios map[string]*radioGroup // by the name of their buttons
+}
+
+// radioGroup is the field holding the radio buttons with the same name as its kids.
+type radioGroup struct {
+	field types.Dict
+	ref   types.IndirectRef
+}
+
+// addFormFields adds fields as widget annotations to their pages and to the AcroForm.
+func addFormFields(ctx *model.Context, fields []FormField) error {
+	ff, err := newFormFields(ctx)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.Page < 1 || f.Page > ctx.PageCount {
+			continue
+		}
+		if err := ff.add(f); err != nil {
+			return fmt.Errorf("pdf: form field %q: %w", f.Name, err)
+		}
+	}
+	ff.form.Update("Fields", ff.fields)
+	return nil
+}
+
+func newFormFields(ctx *model.Context) (*formFields, error) {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	form, err := ctx.DereferenceDict(root["AcroForm"])
+	if err != nil {
+		return nil, err
+	}
+	if form == nil {
+		form = types.NewDict()
+		root.Update("AcroForm", form)
+	}
+	fields, err := ctx.DereferenceArray(form["Fields"])
+	if err != nil {
+		return nil, err
+	}
+	ff := &formFields{ctx: ctx, form: form, fields: fields, taken: map[string]bool{}, radios: map[string]*radioGroup{}}
+	for _, obj := range fields {
+		if field, err := ctx.DereferenceDict(obj); err == nil && field != nil {
+			if t := field.StringEntry("T"); t != nil {
+				ff.taken[*t] = true
+			}
+		}
+	}
+
+	ff.fonts = types.Dict{}
+	for name, font := range map[string]types.Dict{
+		"Helv": {"Type": types.Name("Font"), "Subtype": types.Name("Type1"), "BaseFont": types.Name("Helvetica"), "Encoding": types.Name("WinAnsiEncoding")},
+		"ZaDb": {"Type": types.Name("Font"), "Subtype": types.Name("Type1"), "BaseFont": types.Name("ZapfDingbats")},
+	} {
+		ref, err := ctx.IndRefForNewObject(font)
+		if err != nil {
+			return nil, err
+		}
+		ff.fonts[name] = *ref
+	}
+	dr, err := ctx.DereferenceDict(form["DR"])
+	if err != nil {
+		return nil, err
+	}
+	if dr == nil {
+		dr = types.NewDict()
+		form.Update("DR", dr)
+	}
+	fonts, err := ctx.DereferenceDict(dr["Font"])
+	if err != nil {
+		return nil, err
+	}
+	if fonts == nil {
+		fonts = types.NewDict()
+		dr.Update("Font", fonts)
+	}
+	for name, ref := range ff.fonts {
+		if _, ok := fonts[name]; !ok {
+			fonts[name] = ref
+		}
+	}
+	if _, ok := form["DA"]; !ok {
+		form.InsertString("DA", "/Helv 0 Tf 0 g")
+	}
+	return ff, nil
+}
+
+// name returns a unique partial field name for name.
+func (ff *formFields) name(name string) string {
+	name = strings.ReplaceAll(name, ".", "_")
+	if name == "" {
+		name = "field"
+	}
+	unique := name
+	for i := 2; ff.taken[unique]; i++ {
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	ff.taken[unique] = true
+	return unique
+}
+
+// add adds the widget of f to its page, as a field of its own or as a radio button of a group.
+func (ff *formFields) add(f FormField) error {
+	page, pageRef, _, err := ff.ctx.PageDict(f.Page, false)
+	if err != nil {
+		return err
+	}
+	w, h := f.Rect[2]-f.Rect[0], f.Rect[3]-f.Rect[1]
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	widget := types.NewDict()
+	widget.InsertName("Type", "Annot")
+	widget.InsertName("Subtype", "Widget")
+	widget.Insert("Rect", types.NewNumberArray(f.Rect[0], f.Rect[1], f.Rect[2], f.Rect[3]))
+	widget.Insert("P", *pageRef)
+	widget.InsertInt("F", annotPrint)
+
+	flags := 0
+	if f.ReadOnly {
+		flags |= fieldReadOnly
+	}
+	if f.Required {
+		flags |= fieldRequired
+	}
+	var appearance types.Object
+	switch f.Kind {
+	case FieldText, FieldTextArea:
+		appearance, err = ff.text(widget, f, flags, w, h)
+	case FieldComboBox, FieldListBox:
+		appearance, err = ff.choice(widget, f, flags, w, h)
+	case FieldCheckBox:
+		appearance, err = ff.checkBox(widget, f, flags, w, h)
+	case FieldRadio:
+		return ff.radio(page, widget, f, flags, w, h)
+	default:
+		return fmt.Errorf("unknown kind %q", f.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	widget.InsertString("T", ff.name(f.Name))
+	widget.Insert("AP", types.Dict{"N": appearance})
+	ref, err := ff.addWidget(page, widget)
+	if err != nil {
+		return err
+	}
+	ff.fields = append(ff.fields, *ref)
+	return nil
+}
+
+// addWidget adds widget to the annotations of page.
+func (ff *formFields) addWidget(page, widget types.Dict) (*types.IndirectRef, error) {
+	ref, err := ff.ctx.IndRefForNewObject(widget)
+	if err != nil {
+		return nil, err
+	}
+	annots, err := ff.ctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		return nil, err
+	}
+	page.Update("Annots", append(annots, *ref))
+	return ref, nil
+}
+
+func (ff *formFields) text(widget types.Dict, f FormField, flags int, w, h float64) (types.Object, error) {
+	widget.InsertName("FT", "Tx")
+	widget.InsertString("DA", fmt.Sprintf("/Helv %s Tf 0 g", number(f.FontSize)))
+	if f.Kind == FieldTextArea {
+		flags |= fieldMultiline
+	}
+	if flags != 0 {
+		widget.InsertInt("Ff", flags)
+	}
+	if f.MaxLen > 0 {
+		widget.InsertInt("MaxLen", f.MaxLen)
+	}
+	lines := []string{f.Value}
+	if f.Value != "" {
+		v, err := textString(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		widget.Insert("V", v)
+		if f.Kind == FieldTextArea {
+			lines = strings.Split(strings.ReplaceAll(f.Value, "\r\n", "\n"), "\n")
+		}
+	}
+	return ff.appearance(w, h, textAppearance(lines, nil, w, h, f.fontSize(h), f.Kind == FieldTextArea))
+}
+
+func (ff *formFields) choice(widget types.Dict, f FormField, flags int, w, h float64) (types.Object, error) {
+	widget.InsertName("FT", "Ch")
+	widget.InsertString("DA", fmt.Sprintf("/Helv %s Tf 0 g", number(f.FontSize)))
+	list := f.Kind == FieldListBox
+	switch {
+	case !list:
+		flags |= fieldCombo
+	case f.Multiple:
+		flags |= fieldMultiSelect
+	}
+	if flags != 0 {
+		widget.InsertInt("Ff", flags)
+	}
+
+	var (
+		opts     types.Array
+		values   types.Array
+		indices  types.Array
+		lines    []string
+		selected []bool
+	)
+	for i, o := range f.Options {
+		value, err := textString(o.Value)
+		if err != nil {
+			return nil, err
+		}
+		if o.Text != "" && o.Text != o.Value {
+			text, err := textString(o.Text)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, types.Array{value, text})
+		} else {
+			opts = append(opts, value)
+		}
+		// A single-value field takes the first selected option.
+		chosen := o.Selected && (f.Multiple || len(values) == 0)
+		if chosen {
+			values = append(values, value)
+			indices = append(indices, types.Integer(i))
+			if !list {
+				lines = []string{o.label()}
+			}
+		}
+		if list {
+			lines = append(lines, o.label())
+			selected = append(selected, chosen)
+		}
+	}
+	widget.Insert("Opt", opts)
+	switch {
+	case len(values) == 1:
+		widget.Insert("V", values[0])
+	case len(values) > 1:
+		widget.Insert("V", values)
+	}
+	if list && len(indices) > 0 {
+		widget.Insert("I", indices)
+	}
+	return ff.appearance(w, h, textAppearance(lines, selected, w, h, f.fontSize(h), list))
+}
+
+func (ff *formFields) checkBox(widget types.Dict, f FormField, flags int, w, h float64) (types.Object, error) {
+	widget.InsertName("FT", "Btn")
+	widget.InsertString("DA", "/ZaDb 0 Tf 0 g")
+	widget.Insert("MK", types.Dict{"CA": types.StringLiteral("4")})
+	if flags != 0 {
+		widget.InsertInt("Ff", flags)
+	}
+	state := "Off"
+	if f.Checked {
+		state = "Yes"
+	}
+	widget.InsertName("V", state)
+	widget.InsertName("AS", state)
+	return ff.states("Yes", w, h, checkBoxAppearance(w, h, false), checkBoxAppearance(w, h, true))
+}
+
+// radio adds a radio button to the group of its name, which is created with the first button.
+// The group takes the flags of its first button.
+func (ff *formFields) radio(page, widget types.Dict, f FormField, flags int, w, h float64) error {
+	group, ok := ff.radios[f.Name]
+	if !ok {
+		field := types.NewDict()
+		field.InsertName("FT", "Btn")
+		field.InsertString("T", ff.name(f.Name))
+		field.InsertInt("Ff", flags|fieldRadio|fieldNoToggleToOff)
+		field.InsertName("V", "Off")
+		field.Insert("Kids", types.Array{})
+		ref, err := ff.ctx.IndRefForNewObject(field)
+		if err != nil {
+			return err
+		}
+		group = &radioGroup{field: field, ref: *ref}
+		ff.radios[f.Name] = group
+		ff.fields = append(ff.fields, *ref)
+	}
+
+	state := f.Value
+	if state == "" || state == "Off" {
+		state = "on"
+	}
+	widget.Insert("Parent", group.ref)
+	widget.InsertString("DA", "/ZaDb 0 Tf 0 g")
+	widget.Insert("MK", types.Dict{"CA": types.StringLiteral("l")})
+	widget.InsertName("AS", "Off")
+	if f.Checked {
+		// The last checked button wins, as in HTML.
+		group.field.Update("V", types.Name(state))
+		for _, kid := range group.field.ArrayEntry("Kids") {
+			if d, err := ff.ctx.DereferenceDict(kid); err == nil && d != nil {
+				d.Update("AS", types.Name("Off"))
+			}
+		}
+		widget.Update("AS", types.Name(state))
+	}
+	appearance, err := ff.states(state, w, h, radioAppearance(w, h, false), radioAppearance(w, h, true))
+	if err != nil {
+		return err
+	}
+	widget.Insert("AP", types.Dict{"N": appearance})
+	ref, err := ff.addWidget(page, widget)
+	if err != nil {
+		return err
+	}
+	group.field.Update("Kids", append(group.field.ArrayEntry("Kids"), *ref))
+	return nil
+}
+
+// appearance returns a form XObject of size w×h drawing content with the form's fonts.
+func (ff *formFields) appearance(w, h float64, content []byte) (types.IndirectRef, error) {
+	sd, err := ff.ctx.NewStreamDictForBuf(content)
+	if err != nil {
+		return types.IndirectRef{}, err
+	}
+	sd.InsertName("Type", "XObject")
+	sd.InsertName("Subtype", "Form")
+	sd.Insert("BBox", types.NewNumberArray(0, 0, w, h))
+	sd.Insert("Resources", types.Dict{"Font": ff.fonts})
+	if err := sd.Encode(); err != nil {
+		return types.IndirectRef{}, err
+	}
+	ref, err := ff.ctx.IndRefForNewObject(*sd)
+	if err != nil {
+		return types.IndirectRef{}, err
+	}
+	return *ref, nil
+}
+
+// states returns the appearance states of a checkbox or radio button: Off and on, the state
+// name of its checked appearance.
+func (ff *formFields) states(on string, w, h float64, off, checked []byte) (types.Dict, error) {
+	offRef, err := ff.appearance(w, h, off)
+	if err != nil {
+		return nil, err
+	}
+	onRef, err := ff.appearance(w, h, checked)
+	if err != nil {
+		return nil, err
+	}
+	return types.Dict{"Off": offRef, on: onRef}, nil
+}
+
+// fontSize returns the font size the appearance of f uses in a widget of height h.
+func (f FormField) fontSize(h float64) float64 {
+	if f.FontSize > 0 {
+		return f.FontSize
+	}
+	if f.Kind == FieldTextArea || f.Kind == FieldListBox {
+		return maxFieldFontSize
+	}
+	return max(1, min(maxFieldFontSize, (h-2*fieldInset)/fieldLeading))
+}
+
+// textAppearance draws lines of text into a w×h box, clipped to it: a single line centered
+// vertically, or several from the top. Lines for which selected is true are highlighted, as
+// list boxes show their selected options.
+func textAppearance(lines []string, selected []bool, w, h, fontSize float64, multiline bool) []byte {
+	var b bytes.Buffer
+	b.WriteString("/Tx BMC\nq\n")
+	fmt.Fprintf(&b, "1 1 %s %s re W n\n", number(w-2), number(h-2))
+	leading := fieldLeading * fontSize
+	// Helvetica's ascender and descender are about 0.72 and 0.21 em; the baseline of the first
+	// line leaves room for the ascender, or centers a single line.
+	top := h - fieldInset - 0.72*fontSize
+	if !multiline {
+		top = h/2 - (0.72-0.21)/2*fontSize
+	}
+	for i, sel := range selected {
+		if sel {
+			// The highlight spans the line's leading, centered on its glyphs.
+			y := top - float64(i)*leading - 0.21*fontSize - (leading-0.93*fontSize)/2
+			fmt.Fprintf(&b, "0.6 0.75 0.95 rg 1 %s %s %s re f\n", number(y), number(w-2), number(leading))
+		}
+	}
+	fmt.Fprintf(&b, "BT /Helv %s Tf 0 g %s TL %s %s Td\n", number(fontSize), number(leading), number(fieldInset), number(top))
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("T* ")
+		}
+		fmt.Fprintf(&b, "(%s) Tj\n", winAnsiText(line))
+	}
+	b.WriteString("ET\nQ\nEMC\n")
+	return b.Bytes()
+}
+
+// checkBoxAppearance draws a checkbox of size w×h: a square border and, if checked, a check mark
+// (ZapfDingbats "4", 0.846 em wide).
+func checkBoxAppearance(w, h float64, checked bool) []byte {
+	var b bytes.Buffer
+	side := min(w, h)
+	x, y := (w-side)/2, (h-side)/2
+	fmt.Fprintf(&b, "q 1 g %s %s %s %s re f 0.5 w 0.3 G %s %s %s %s re S Q\n",
+		number(x), number(y), number(side), number(side), number(x+0.25), number(y+0.25), number(side-0.5), number(side-0.5))
+	if checked {
+		size := 0.8 * side
+		fmt.Fprintf(&b, "q BT /ZaDb %s Tf 0 g %s %s Td (4) Tj ET Q\n", number(size), number((w-0.846*size)/2), number((h-0.7*size)/2))
+	}
+	return b.Bytes()
+}
+
+// radioAppearance draws a radio button of size w×h: a circle and, if checked, a dot.
+func radioAppearance(w, h float64, checked bool) []byte {
+	var b bytes.Buffer
+	r := min(w, h) / 2
+	b.WriteString("q 1 g ")
+	circle(&b, w/2, h/2, r)
+	b.WriteString("f 0.5 w 0.3 G ")
+	circle(&b, w/2, h/2, r-0.25)
+	b.WriteString("S")
+	if checked {
+		b.WriteString(" 0 g ")
+		circle(&b, w/2, h/2, r/2)
+		b.WriteString("f")
+	}
+	b.WriteString(" Q\n")
+	return b.Bytes()
+}
+
+// circle appends a circle path of radius r around (cx, cy), made of four Bézier curves.
+func circle(b *bytes.Buffer, cx, cy, r float64) {
+	k := r * 4 * (math.Sqrt2 - 1) / 3
+	fmt.Fprintf(b, "%s %s m ", number(cx+r), number(cy))
+	fmt.Fprintf(b, "%s %s %s %s %s %s c ", number(cx+r), number(cy+k), number(cx+k), number(cy+r), number(cx), number(cy+r))
+	fmt.Fprintf(b, "%s %s %s %s %s %s c ", number(cx-k), number(cy+r), number(cx-r), number(cy+k), number(cx-r), number(cy))
+	fmt.Fprintf(b, "%s %s %s %s %s %s c ", number(cx-r), number(cy-k), number(cx-k), number(cy-r), number(cx), number(cy-r))
+	fmt.Fprintf(b, "%s %s %s %s %s %s c ", number(cx+k), number(cy-r), number(cx+r), number(cy-k), number(cx+r), number(cy))
+}
+
+// number formats v as a content stream operand with at most two decimals.
+func number(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// textString returns s as a PDF text string (ISO 32000-1, 7.9.2.2).
+func textString(s string) (types.StringLiteral, error) {
+	escaped, err := types.EscapedUTF16String(s)
+	if err != nil {
+		return "", err
+	}
+	return types.StringLiteral(*escaped), nil
+}
@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// htmlFormFields returns the fields of a small HTML form as measured in the page.
+func htmlFormFields() []FormField {
+	return []FormField{
+		{Kind: FieldText, Name: "name", Page: 1, Rect: [4]float64{72, 700, 272, 718}, Value: "Jane", MaxLen: 40, FontSize: 10},
+		{Kind: FieldText, Name: "name", Page: 1, Rect: [4]float64{72, 670, 272, 688}},
+		{Kind: FieldTextArea, Name: "address.street", Page: 1, Rect: [4]float64{72, 600, 272, 660}, Value: "Main St 1\nSpringfield", Required: true},
+		{Kind: FieldCheckBox, Name: "agree", Page: 1, Rect: [4]float64{72, 580, 82, 590}, Checked: true},
+		{Kind: FieldRadio, Name: "size", Page: 1, Rect: [4]float64{72, 560, 82, 570}, Value: "S"},
+		{Kind: FieldRadio, Name: "size", Page: 1, Rect: [4]float64{92, 560, 102, 570}, Value: "M", Checked: true},
+		{Kind: FieldComboBox, Name: "color", Page: 1, Rect: [4]float64{72, 530, 172, 548}, Options: []Option{
+			{Value: "r", Text: "Red"}, {Value: "g", Text: "Green", Selected: true},
+		}},
+		{Kind: FieldListBox, Name: "toppings", Page: 1, Rect: [4]float64{72, 450, 172, 520}, Multiple: true, ReadOnly: true, Options: []Option{
+			{Value: "Ham", Selected: true}, {Value: "Olives"}, {Value: "Onions", Selected: true},
+		}},
+		{Kind: FieldText, Name: "beyond", Page: 2, Rect: [4]float64{72, 700, 272, 718}},
+	}
+}
+
+// textField returns the text field of f named name; pdfcpu exports fields in no fixed order.
+func textField(t *testing.T, f form.Form, name string) *form.TextField {
+	t.Helper()
+	for _, field := range f.TextFields {
+		if field.Name == name {
+			return field
+		}
+	}
+	require.Failf(t, "no such text field", "%q", name)
+	return nil
+}
+
+func TestProcess_FormFields(t *testing.T) {
+	out, err := Process(chromePDF(embeddedFont), Options{FormFields: htmlFormFields()})
+	require.NoError(t, err)
+	ctx, f := readForm(t, out)
+
+	require.Len(t, f.TextFields, 3, "the field on a page the document does not have is dropped")
+	name := textField(t, f, "name")
+	assert.Equal(t, "Jane", name.Value)
+	assert.Equal(t, 40, name.MaxLen)
+	assert.Empty(t, textField(t, f, "name_2").Value, "names are unique")
+	street := textField(t, f, "address_street") // periods would make a hierarchy
+	assert.True(t, street.Multiline)
+	assert.Equal(t, "Main St 1\nSpringfield", street.Value)
+
+	require.Len(t, f.CheckBoxes, 1)
+	assert.True(t, f.CheckBoxes[0].Value)
+	require.Len(t, f.RadioButtonGroups, 1)
+	assert.Equal(t, []string{"S", "M"}, f.RadioButtonGroups[0].Options)
+	assert.Equal(t, "M", f.RadioButtonGroups[0].Value)
+	require.Len(t, f.ComboBoxes, 1)
+	assert.Equal(t, "g", f.ComboBoxes[0].Value, "the value of the option, not its text")
+	require.Len(t, f.ListBoxes, 1)
+	assert.True(t, f.ListBoxes[0].Multi)
+	assert.True(t, f.ListBoxes[0].Locked)
+	assert.Equal(t, []string{"Ham", "Onions"}, f.ListBoxes[0].Values)
+
+	page, _, _, err := ctx.PageDict(1, false)
+	require.NoError(t, err)
+	assert.Len(t, page.ArrayEntry("Annots"), 2+8, "Chrome's links are kept")
+}
+
+func TestProcess_FormFieldsCanBeFilled(t *testing.T) {
+	out, err := Process(chromePDF(embeddedFont), Options{FormFields: htmlFormFields()})
+	require.NoError(t, err)
+	filled, err := FillForm(out, Form{Values: map[string][]string{"name": {"John"}, "size": {"S"}, "agree": {"false"}}})
+	require.NoError(t, err)
+	_, f := readForm(t, filled)
+	assert.Equal(t, "John", textField(t, f, "name").Value)
+	assert.Equal(t, "S", f.RadioButtonGroups[0].Value)
+	assert.False(t, f.CheckBoxes[0].Value)
+
+	flat, err := FillForm(out, Form{Flatten: true})
+	require.NoError(t, err)
+	assert.NotContains(t, string(flat), "/AcroForm")
+}
+
+func TestTextAppearance(t *testing.T) {
+	assert.Equal(t, "/Tx BMC\nq\n1 1 98 18 re W n\nBT /Helv 10 Tf 0 g 11.5 TL 2 7.45 Td\n(Jane \\(Doe\\)) Tj\nET\nQ\nEMC\n",
+		string(textAppearance([]string{"Jane (Doe)"}, nil, 100, 20, 10, false)))
+	assert.Equal(t, "/Tx BMC\nq\n1 1 98 38 re W n\n0.6 0.75 0.95 rg 1 16.1 98 11.5 re f\nBT /Helv 10 Tf 0 g 11.5 TL 2 30.8 Td\n(Ham) Tj\nT* (Olives) Tj\nET\nQ\nEMC\n",
+		string(textAppearance([]string{"Ham", "Olives"}, []bool{false, true}, 100, 40, 10, true)))
+}
@@ -0,0 +1,529 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"math"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// downsampleThreshold is how far above the target resolution an image has to be drawn
+	// before it is downsampled, as in Ghostscript: resampling a little gains nothing.
+	downsampleThreshold = 1.5
+
+	// maxFormDepth bounds the nesting of form XObjects followed when looking for images.
+	maxFormDepth = 8
+
+	jpegQuality = 85
+)
+
+// downsampleImages resamples the images the pages draw at more than downsampleThreshold times
+// dpi down to dpi. An image drawn several times is sized for its largest use. Images that cannot
+// be decoded here (CMYK, masks, 16 bits, predictors, …) or that would not get smaller are left
+// alone, as are images the page content does not draw directly or through form XObjects.
+func downsampleImages(ctx *model.Context, dpi int) error {
+	s := imageScanner{ctx: ctx, dpi: map[int]float64{}}
+	for i := 1; i <= ctx.PageCount; i++ {
+		d, _, inh, err := ctx.PageDict(i, false)
+		if err != nil {
+			return err
+		}
+		content, err := ctx.PageContent(d)
+		if err != nil {
+			// No or undecodable content: nothing drawn that could be resized.
+			continue
+		}
+		resources := d.DictEntry("Resources")
+		if resources == nil && inh != nil {
+			resources = inh.Resources
+		}
+		s.scan(content, resources, identity, map[int]bool{})
+	}
+	for nr, drawn := range s.dpi {
+		if drawn <= downsampleThreshold*float64(dpi) {
+			continue
+		}
+		if err := downsampleImage(ctx, nr, float64(dpi)/drawn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// times returns m × n: m applied first, then n.
+func (m matrix) times(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// imageScanner follows content streams to find the resolution images are drawn at.
+type imageScanner struct {
+	ctx *model.Context
+	dpi map[int]float64 // image object number -> lowest resolution drawn at
+}
+
+// scan interprets the graphics state operators of content (q, Q, cm) and records the images it
+// draws with Do. Malformed content ends the scan of that stream.
+func (s *imageScanner) scan(content []byte, resources types.Dict, ctm matrix, forms map[int]bool) {
+	var stack []matrix
+	var operands []types.Object
+	lex := contentLexer{data: content}
+	for {
+		tok, op, ok := lex.next()
+		if !ok {
+			return
+		}
+		if !op {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.(types.Name) {
+		case "q":
+			stack = append(stack, ctm)
+		case "Q":
+			if len(stack) > 0 {
+				ctm, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+		case "cm":
+			if m, ok := toMatrix(operands); ok {
+				ctm = m.times(ctm)
+			}
+		case "Do":
+			if len(operands) == 1 {
+				if name, ok := operands[0].(types.Name); ok {
+					s.draw(string(name), resources, ctm, forms)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// draw records the image XObject name in resources drawn with ctm, or scans the form XObject.
+func (s *imageScanner) draw(name string, resources types.Dict, ctm matrix, forms map[int]bool) {
+	xobjects, err := s.ctx.DereferenceDict(resources["XObject"])
+	if err != nil || xobjects == nil {
+		return
+	}
+	ref, ok := xobjects[name].(types.IndirectRef)
+	if !ok {
+		return
+	}
+	nr := ref.ObjectNumber.Value()
+	sd, _, err := s.ctx.DereferenceStreamDict(ref)
+	if err != nil || sd == nil {
+		return
+	}
+	switch subtype := sd.Subtype(); {
+	case subtype == nil:
+	case *subtype == "Image":
+		w, h := sd.IntEntry("Width"), sd.IntEntry("Height")
+		if w == nil || h == nil {
+			return
+		}
+		// The image fills the unit square, which ctm maps onto the page (in points).
+		width, height := math.Hypot(ctm[0], ctm[1])/72, math.Hypot(ctm[2], ctm[3])/72
+		if width == 0 || height == 0 {
+			return
+		}
+		dpi := math.Min(float64(*w)/width, float64(*h)/height)
+		if prev, seen := s.dpi[nr]; !seen || dpi < prev {
+			s.dpi[nr] = dpi
+		}
+	case *subtype == "Form":
+		if forms[nr] || len(forms) >= maxFormDepth {
+			return
+		}
+		if err := sd.Decode(); err != nil {
+			return
+		}
+		m := identity
+		if a, err := s.ctx.DereferenceArray(sd.Dict["Matrix"]); err == nil {
+			if fm, ok := toMatrix(a); ok {
+				m = fm
+			}
+		}
+		formResources := resources
+		if r, err := s.ctx.DereferenceDict(sd.Dict["Resources"]); err == nil && r != nil {
+			formResources = r
+		}
+		forms[nr] = true
+		s.scan(sd.Content, formResources, m.times(ctm), forms)
+		delete(forms, nr)
+	}
+}
+
+// toMatrix reads six numbers.
+func toMatrix(a []types.Object) (matrix, bool) {
+	var m matrix
+	if len(a) != 6 {
+		return m, false
+	}
+	for i, o := range a {
+		switch v := o.(type) {
+		case types.Integer:
+			m[i] = float64(v)
+		case types.Float:
+			m[i] = float64(v)
+		default:
+			return m, false
+		}
+	}
+	return m, true
+}
+
+// downsampleImage resamples image object nr by factor (< 1), together with its soft mask.
+func downsampleImage(ctx *model.Context, nr int, factor float64) error {
+	entry, ok := ctx.FindTableEntryLight(nr)
+	if !ok {
+		return nil
+	}
+	sd, ok := entry.Object.(types.StreamDict)
+	if !ok {
+		return nil
+	}
+	img, err := decodeImage(ctx, sd)
+	if err != nil {
+		return nil
+	}
+	b := img.Bounds()
+	w := max(1, int(math.Round(float64(b.Dx())*factor)))
+	h := max(1, int(math.Round(float64(b.Dy())*factor)))
+	resized, err := encodeImage(ctx, sd, resample(img, w, h))
+	if err != nil {
+		return err
+	}
+	before, after := len(sd.Raw), len(resized.Raw)
+
+	var mask *types.StreamDict
+	var maskEntry *model.XRefTableEntry
+	if ref := sd.IndirectRefEntry("SMask"); ref != nil {
+		maskEntry, ok = ctx.FindTableEntryLight(ref.ObjectNumber.Value())
+		if !ok {
+			return nil
+		}
+		msd, ok := maskEntry.Object.(types.StreamDict)
+		if !ok {
+			return nil
+		}
+		maskImg, err := decodeImage(ctx, msd)
+		if err != nil {
+			return nil
+		}
+		if mask, err = encodeImage(ctx, msd, resample(maskImg, w, h)); err != nil {
+			return err
+		}
+		before, after = before+len(msd.Raw), after+len(mask.Raw)
+	}
+	if after >= before {
+		return nil
+	}
+	entry.Object = *resized
+	if mask != nil {
+		maskEntry.Object = *mask
+	}
+	return nil
+}
+
+// errUnsupportedImage means an image is stored in a way decodeImage does not handle.
+var errUnsupportedImage = errors.New("pdf: unsupported image")
+
+// decodeImage decodes an 8-bit gray or RGB image stored as JPEG or with a single Flate filter.
+func decodeImage(ctx *model.Context, sd types.StreamDict) (image.Image, error) {
+	if len(sd.FilterPipeline) != 1 || sd.FilterPipeline[0].DecodeParms != nil ||
+		sd.Dict["ImageMask"] != nil || sd.Dict["Mask"] != nil || sd.Dict["Decode"] != nil {
+		return nil, errUnsupportedImage
+	}
+	if bpc := sd.IntEntry("BitsPerComponent"); bpc == nil || *bpc != 8 {
+		return nil, errUnsupportedImage
+	}
+	components := imageComponents(ctx, sd.Dict["ColorSpace"])
+	if components == 0 {
+		return nil, errUnsupportedImage
+	}
+	w, h := sd.IntEntry("Width"), sd.IntEntry("Height")
+	if w == nil || h == nil || *w <= 0 || *h <= 0 {
+		return nil, errUnsupportedImage
+	}
+
+	switch sd.FilterPipeline[0].Name {
+	case "DCTDecode":
+		img, err := jpeg.Decode(bytes.NewReader(sd.Raw))
+		if err != nil {
+			return nil, err
+		}
+		switch img.(type) {
+		case *image.Gray:
+			if components == 1 {
+				return img, nil
+			}
+		case *image.YCbCr:
+			if components == 3 {
+				return img, nil
+			}
+		}
+		return nil, errUnsupportedImage
+	case "FlateDecode":
+		if err := sd.Decode(); err != nil {
+			return nil, err
+		}
+		stride := *w * components
+		if len(sd.Content) < stride**h {
+			return nil, errUnsupportedImage
+		}
+		r := image.Rect(0, 0, *w, *h)
+		if components == 1 {
+			return &image.Gray{Pix: sd.Content[:stride**h], Stride: stride, Rect: r}, nil
+		}
+		img := image.NewRGBA(r)
+		for i, j := 0, 0; i < stride**h; i, j = i+3, j+4 {
+			copy(img.Pix[j:j+3], sd.Content[i:i+3])
+			img.Pix[j+3] = 0xff
+		}
+		return img, nil
+	}
+	return nil, errUnsupportedImage
+}
+
+// imageComponents returns the number of color components of a DeviceGray, DeviceRGB or
+// ICCBased color space, or 0.
+func imageComponents(ctx *model.Context, cs types.Object) int {
+	cs, err := ctx.Dereference(cs)
+	if err != nil {
+		return 0
+	}
+	switch cs := cs.(type) {
+	case types.Name:
+		switch cs {
+		case "DeviceGray":
+			return 1
+		case "DeviceRGB":
+			return 3
+		}
+	case types.Array:
+		if len(cs) != 2 || cs[0] != types.Name("ICCBased") {
+			return 0
+		}
+		profile, _, err := ctx.DereferenceStreamDict(cs[1])
+		if err != nil || profile == nil {
+			return 0
+		}
+		if n := profile.IntEntry("N"); n != nil && (*n == 1 || *n == 3) {
+			return *n
+		}
+	}
+	return 0
+}
+
+// resample scales img to w×h pixels.
+func resample(img image.Image, w, h int) image.Image {
+	r := image.Rect(0, 0, w, h)
+	var dst draw.Image = image.NewRGBA(r)
+	if _, gray := img.(*image.Gray); gray {
+		dst = image.NewGray(r)
+	}
+	draw.CatmullRom.Scale(dst, r, img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// encodeImage returns sd with its image replaced by img, in sd's encoding.
+func encodeImage(ctx *model.Context, sd types.StreamDict, img image.Image) (*types.StreamDict, error) {
+	b := img.Bounds()
+	out := types.StreamDict{Dict: sd.Dict.Clone().(types.Dict), FilterPipeline: sd.FilterPipeline}
+	out.Dict["Width"] = types.Integer(b.Dx())
+	out.Dict["Height"] = types.Integer(b.Dy())
+	switch sd.FilterPipeline[0].Name {
+	case "DCTDecode":
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		out.Raw = buf.Bytes()
+	default:
+		var pix []byte
+		switch img := img.(type) {
+		case *image.Gray:
+			pix = img.Pix
+		case *image.RGBA:
+			pix = make([]byte, 0, b.Dx()*b.Dy()*3)
+			for i := 0; i < len(img.Pix); i += 4 {
+				pix = append(pix, img.Pix[i:i+3]...)
+			}
+		}
+		flate, err := ctx.NewStreamDictForBuf(pix)
+		if err != nil {
+			return nil, err
+		}
+		if err := flate.Encode(); err != nil {
+			return nil, err
+		}
+		out.Content, out.Raw = pix, flate.Raw
+	}
+	l := int64(len(out.Raw))
+	out.StreamLength = &l
+	out.Dict["Length"] = types.Integer(l)
+	return &out, nil
+}
+
+// contentLexer splits a content stream into operands and operators. Strings, arrays and
+// dictionaries are skipped as opaque operands, inline images are skipped entirely.
+type contentLexer struct {
+	data []byte
+	pos  int
+}
+
+// next returns the next token: an operand, or an operator as a Name with op set. ok is false at
+// the end of the data or on malformed content.
+func (l *contentLexer) next() (tok types.Object, op bool, ok bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false, false
+	}
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		start := l.pos + 1
+		l.pos++
+		for l.pos < len(l.data) && isRegular(l.data[l.pos]) {
+			l.pos++
+		}
+		return types.Name(l.data[start:l.pos]), false, true
+	case c == '(':
+		return types.StringLiteral(""), false, l.skipString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<', c == '[':
+		return types.Array{}, false, l.skipNested()
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, false, false
+		}
+		l.pos += end + 1
+		return types.HexLiteral(""), false, true
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		return nil, false, false
+	}
+	start := l.pos
+	for l.pos < len(l.data) && isRegular(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if i, err := strconv.Atoi(word); err == nil {
+		return types.Integer(i), false, true
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return types.Float(f), false, true
+	}
+	if word == "BI" {
+		return types.Name(word), true, l.skipInlineImage()
+	}
+	return types.Name(word), true, true
+}
+
+func (l *contentLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// skipString skips a literal string with balanced parentheses and escapes.
+func (l *contentLexer) skipString() bool {
+	depth := 0
+	for ; l.pos < len(l.data); l.pos++ {
+		switch l.data[l.pos] {
+		case '\\':
+			l.pos++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				l.pos++
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipNested skips an array or dictionary, including nested ones and the strings in them.
+func (l *contentLexer) skipNested() bool {
+	depth := 0
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case c == '(':
+			if !l.skipString() {
+				return false
+			}
+			continue
+		case c == '[' || c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			depth++
+			if c == '<' {
+				l.pos++
+			}
+		case c == ']' || c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			depth--
+			if c == '>' {
+				l.pos++
+			}
+		}
+		l.pos++
+		if depth == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// skipInlineImage skips from BI past the image data to EI.
+func (l *contentLexer) skipInlineImage() bool {
+	id := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if id < 0 {
+		return false
+	}
+	l.pos += id + len("ID")
+	for l.pos < len(l.data) {
+		i := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if i < 0 {
+			return false
+		}
+		l.pos += i + len("EI")
+		if isSpace(l.data[l.pos-len("EI")-1]) && (l.pos == len(l.data) || !isRegular(l.data[l.pos])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isRegular(c byte) bool {
+	return !isSpace(c) && !bytes.ContainsRune([]byte("()<>[]{}/%"), rune(c))
+}
@@ -0,0 +1,596 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// openDocumentKeys are the catalog entries a viewer needs before it shows the first page; their
+// objects go right after the catalog (ISO 32000-1, F.3.4).
+var openDocumentKeys = []string{"ViewerPreferences", "PageMode", "Threads", "OpenAction", "AcroForm"}
+
+// inheritablePageKeys are the page attributes a page can inherit from the page tree. Linearized
+// pages carry them themselves, so the first page does not depend on the page tree.
+var inheritablePageKeys = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// linearize rewrites data for fast web view (ISO 32000-1, annex F): the first page and
+// everything it uses come first, behind a cross-reference section of their own, so a viewer can
+// show it before the rest of the file has arrived; hint tables locate the other pages. Objects
+// are written with a classic cross-reference table, without object streams; unreferenced objects
+// are dropped.
+func linearize(data []byte) (_ []byte, err error) {
+	defer recoverPanic(&err)
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), config())
+	if err != nil {
+		return nil, fmt.Errorf("pdf: read: %w", err)
+	}
+	if ctx.Encrypt != nil {
+		return nil, errors.New("pdf: linearize: encrypted documents are not supported")
+	}
+	l, err := newLinearizer(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pdf: linearize: %w", err)
+	}
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	out, err := l.write(bytes.TrimRight(header, "\r"))
+	if err != nil {
+		return nil, fmt.Errorf("pdf: linearize: %w", err)
+	}
+	return out, nil
+}
+
+// objectUsers records who needs an object: pages (by index from 0), the viewer opening the
+// document, or anything else (page tree, document information, outlines, …).
+type objectUsers struct {
+	pages    []int
+	openDoc  bool
+	other    bool
+	resolved types.Object
+}
+
+// linearizer lays out a document for linearization. Object numbers are reassigned: the second
+// half of the file (other pages, shared objects, the rest) is numbered from 1 and the first half
+// (linearization dictionary, catalog, hint stream, first page) above it, as annex F requires.
+type linearizer struct {
+	ctx   *model.Context
+	users map[int]*objectUsers
+	order []int       // object numbers in discovery order
+	pages []int       // page object numbers
+	page  map[int]int // page object number -> page index
+
+	part4 []int   // catalog and the objects needed to open the document
+	part6 []int   // first page: page object, private objects, objects shared with other pages
+	part7 [][]int // other pages: page object and private objects, by page index - 1
+	part8 []int   // objects shared by pages other than the first
+	part9 []int   // everything else
+
+	renumber renumbering
+	linNr    int // linearization dictionary
+	hintNr   int // primary hint stream
+	size     int // highest object number + 1
+}
+
+func newLinearizer(ctx *model.Context) (*linearizer, error) {
+	l := &linearizer{ctx: ctx, users: map[int]*objectUsers{}, page: map[int]int{}}
+	if ctx.PageCount == 0 {
+		return nil, errors.New("no pages")
+	}
+	for i := 1; i <= ctx.PageCount; i++ {
+		_, ref, _, err := ctx.PageDict(i, false)
+		if err != nil {
+			return nil, err
+		}
+		nr := ref.ObjectNumber.Value()
+		if _, dup := l.page[nr]; dup {
+			return nil, errors.New("page object used twice")
+		}
+		l.page[nr] = i - 1
+		l.pages = append(l.pages, nr)
+	}
+	if err := pushDownInheritedAttrs(ctx, l.pages); err != nil {
+		return nil, err
+	}
+
+	rootNr := ctx.Root.ObjectNumber.Value()
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	l.users[rootNr] = &objectUsers{openDoc: true, resolved: root}
+	l.order = append(l.order, rootNr)
+	for _, key := range openDocumentKeys {
+		if o, ok := root[key]; ok {
+			l.walk(o, func(u *objectUsers) { u.openDoc = true }, map[int]bool{})
+		}
+	}
+	for i, nr := range l.pages {
+		page, err := ctx.DereferenceDict(*types.NewIndirectRef(nr, 0))
+		if err != nil {
+			return nil, err
+		}
+		l.users[nr] = &objectUsers{pages: []int{i}, resolved: page}
+		l.order = append(l.order, nr)
+		markPage := func(u *objectUsers) {
+			if !slices.Contains(u.pages, i) {
+				u.pages = append(u.pages, i)
+			}
+		}
+		visited := map[int]bool{nr: true}
+		for _, key := range sortedKeys(page) {
+			if key != "Parent" {
+				l.walk(page[key], markPage, visited)
+			}
+		}
+	}
+	markOther := func(u *objectUsers) { u.other = true }
+	for _, key := range sortedKeys(root) {
+		if !slices.Contains(openDocumentKeys, key) {
+			l.walk(root[key], markOther, map[int]bool{rootNr: true})
+		}
+	}
+	if ctx.Info != nil {
+		l.walk(*ctx.Info, markOther, map[int]bool{})
+	}
+	l.classify(rootNr)
+	l.number()
+	return l, nil
+}
+
+// pushDownInheritedAttrs copies the attributes pages inherit from the page tree into the pages,
+// given by object number.
+func pushDownInheritedAttrs(ctx *model.Context, pages []int) error {
+	for _, nr := range pages {
+		page, err := ctx.DereferenceDict(*types.NewIndirectRef(nr, 0))
+		if err != nil {
+			return err
+		}
+		seen := map[int]bool{nr: true}
+		for parent := page["Parent"]; parent != nil; {
+			ref, ok := parent.(types.IndirectRef)
+			if !ok || seen[ref.ObjectNumber.Value()] {
+				break
+			}
+			seen[ref.ObjectNumber.Value()] = true
+			node, err := ctx.DereferenceDict(ref)
+			if err != nil || node == nil {
+				return err
+			}
+			for _, key := range inheritablePageKeys {
+				if _, ok := page[key]; !ok {
+					if v, ok := node[key]; ok {
+						page[key] = v
+					}
+				}
+			}
+			parent = node["Parent"]
+		}
+	}
+	return nil
+}
+
+// walk marks every indirect object reachable from o with mark. Page objects and the catalog are
+// left out: they belong to their own page and the document's opening.
+func (l *linearizer) walk(o types.Object, mark func(*objectUsers), visited map[int]bool) {
+	switch o := o.(type) {
+	case types.IndirectRef:
+		nr := o.ObjectNumber.Value()
+		if visited[nr] || l.isPage(nr) || nr == l.ctx.Root.ObjectNumber.Value() {
+			return
+		}
+		visited[nr] = true
+		u := l.users[nr]
+		if u == nil {
+			entry, ok := l.ctx.FindTableEntryLight(nr)
+			if !ok || entry.Free || entry.Object == nil {
+				return
+			}
+			u = &objectUsers{resolved: entry.Object}
+			l.users[nr] = u
+			l.order = append(l.order, nr)
+		}
+		mark(u)
+		l.walk(u.resolved, mark, visited)
+	case types.Dict:
+		for _, key := range sortedKeys(o) {
+			l.walk(o[key], mark, visited)
+		}
+	case types.StreamDict:
+		// Length is written as a direct value.
+		for _, key := range sortedKeys(o.Dict) {
+			if key != "Length" {
+				l.walk(o.Dict[key], mark, visited)
+			}
+		}
+	case types.Array:
+		for _, v := range o {
+			l.walk(v, mark, visited)
+		}
+	}
+}
+
+// classify assigns the objects to the parts of the file (ISO 32000-1, F.3), as qpdf does.
+func (l *linearizer) classify(rootNr int) {
+	l.part4 = []int{rootNr}
+	l.part6 = []int{l.pages[0]}
+	l.part7 = make([][]int, len(l.pages)-1)
+	for i, nr := range l.pages[1:] {
+		l.part7[i] = []int{nr}
+	}
+	var firstPageShared []int
+	for _, nr := range l.order {
+		u := l.users[nr]
+		if nr == rootNr || l.isPage(nr) {
+			continue
+		}
+		switch {
+		case u.openDoc:
+			l.part4 = append(l.part4, nr)
+		case slices.Contains(u.pages, 0) && len(u.pages) == 1 && !u.other:
+			l.part6 = append(l.part6, nr)
+		case slices.Contains(u.pages, 0):
+			firstPageShared = append(firstPageShared, nr)
+		case len(u.pages) == 1 && !u.other:
+			l.part7[u.pages[0]-1] = append(l.part7[u.pages[0]-1], nr)
+		case len(u.pages) > 1:
+			l.part8 = append(l.part8, nr)
+		default:
+			l.part9 = append(l.part9, nr)
+		}
+	}
+	l.part6 = append(l.part6, firstPageShared...)
+}
+
+func (l *linearizer) isPage(nr int) bool {
+	_, ok := l.page[nr]
+	return ok
+}
+
+// number assigns the new object numbers in file order within each half.
+func (l *linearizer) number() {
+	l.renumber = renumbering{}
+	next := 1
+	assign := func(nrs []int) {
+		for _, nr := range nrs {
+			l.renumber[nr] = next
+			next++
+		}
+	}
+	for _, page := range l.part7 {
+		assign(page)
+	}
+	assign(l.part8)
+	assign(l.part9)
+	l.linNr = next
+	next++
+	assign(l.part4)
+	l.hintNr = next
+	next++
+	assign(l.part6)
+	l.size = next
+}
+
+// write lays out the file: header, linearization dictionary, first-page cross-reference section
+// and trailer, catalog and open-document objects, hint stream, first page, other pages, shared
+// objects, the rest and the main cross-reference section (ISO 32000-1, F.3).
+func (l *linearizer) write(header []byte) ([]byte, error) {
+	objects := make(map[int][]byte, len(l.renumber))
+	for nr, n := range l.renumber {
+		obj, err := l.renumber.object(l.users[nr].resolved, n)
+		if err != nil {
+			return nil, err
+		}
+		objects[n] = obj
+	}
+	length := func(nrs []int) int {
+		n := 0
+		for _, nr := range nrs {
+			n += len(objects[l.renumber[nr]])
+		}
+		return n
+	}
+
+	trailer := types.Dict{"Size": types.Integer(l.size), "Root": l.renumber.ref(l.ctx.Root.ObjectNumber.Value())}
+	if l.ctx.Info != nil {
+		trailer["Info"] = l.renumber.ref(l.ctx.Info.ObjectNumber.Value())
+	}
+	if l.ctx.ID != nil {
+		trailer["ID"] = l.ctx.ID
+	}
+
+	// Everything but the values that depend on offsets has a fixed length, so the layout is
+	// computed once with zeros and then filled in.
+	var lay layout
+	hint := l.hintStream(&lay, objects)
+	lay.header = append(append([]byte{}, header...), "\n%\xe2\xe3\xcf\xd3\n"...)
+	offset := len(lay.header)
+	lay.lin = offset
+	offset += len(l.linearizationDict(&lay))
+	lay.firstXref = offset
+	offset += len(l.firstPageXref(&lay, trailer, objects))
+	offsets := map[int]int{}
+	place := func(nrs []int) {
+		for _, nr := range nrs {
+			n := l.renumber[nr]
+			offsets[n] = offset
+			offset += len(objects[n])
+		}
+	}
+	place(l.part4)
+	lay.hint, lay.hintLen = offset, len(hint)
+	offset += len(hint)
+	place(l.part6)
+	lay.firstPageEnd = offset
+	for _, page := range l.part7 {
+		place(page)
+	}
+	place(l.part8)
+	place(l.part9)
+	lay.mainXref = offset
+	lay.offsets = offsets
+	lay.pageLengths = []int{length(l.part6)}
+	for _, page := range l.part7 {
+		lay.pageLengths = append(lay.pageLengths, length(page))
+	}
+	mainXref := l.mainXref(&lay)
+	lay.fileLen = lay.mainXref + len(mainXref)
+
+	var out bytes.Buffer
+	out.Grow(lay.fileLen)
+	out.Write(lay.header)
+	out.Write(l.linearizationDict(&lay))
+	out.Write(l.firstPageXref(&lay, trailer, objects))
+	write := func(nrs []int) {
+		for _, nr := range nrs {
+			out.Write(objects[l.renumber[nr]])
+		}
+	}
+	write(l.part4)
+	out.Write(l.hintStream(&lay, objects))
+	write(l.part6)
+	for _, page := range l.part7 {
+		write(page)
+	}
+	write(l.part8)
+	write(l.part9)
+	out.Write(mainXref)
+	return out.Bytes(), nil
+}
+
+// layout holds the offsets of the parts of a linearized file.
+type layout struct {
+	header       []byte
+	lin          int
+	firstXref    int
+	hint         int
+	hintLen      int
+	firstPageEnd int
+	mainXref     int
+	fileLen      int
+	offsets      map[int]int // new object number -> offset
+	pageLengths  []int
+}
+
+// linearizationDict returns the linearization parameter dictionary. Numbers are padded to a
+// fixed width so it has the same length before and after the offsets are known.
+func (l *linearizer) linearizationDict(lay *layout) []byte {
+	first := l.renumber[l.pages[0]]
+	t := 0
+	if lay.mainXref > 0 {
+		// The white-space before the first entry of the main cross-reference section.
+		t = lay.mainXref + len(fmt.Sprintf("xref\n0 %d", l.linNr))
+	}
+	return fmt.Appendf(nil, "%d 0 obj\n<</Linearized 1/L %10d/H[%10d %10d]/O %d/E %10d/N %d/T %10d>>\nendobj\n",
+		l.linNr, lay.fileLen, lay.hint, lay.hintLen, first, lay.firstPageEnd, len(l.pages), t)
+}
+
+// firstPageXref returns the cross-reference section of the first half and its trailer, whose
+// Prev points at the main section.
+func (l *linearizer) firstPageXref(lay *layout, trailer types.Dict, objects map[int][]byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "xref\n%d %d\n", l.linNr, l.size-l.linNr)
+	for n := l.linNr; n < l.size; n++ {
+		off := lay.offsets[n]
+		switch n {
+		case l.linNr:
+			off = lay.lin
+		case l.hintNr:
+			off = lay.hint
+		}
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n%s", trailer.PDFString())
+	// Prev goes after the dictionary's own entries so its width stays fixed.
+	b.Truncate(b.Len() - len(">>"))
+	fmt.Fprintf(&b, "/Prev %10d>>\nstartxref\n0\n%%%%EOF\n", lay.mainXref)
+	return b.Bytes()
+}
+
+// mainXref returns the cross-reference section of the second half; startxref points at the
+// first-page section, which chains to this one.
+func (l *linearizer) mainXref(lay *layout) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", l.linNr)
+	for n := 1; n < l.linNr; n++ {
+		fmt.Fprintf(&b, "%010d 00000 n \n", lay.offsets[n])
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d>>\nstartxref\n%d\n%%%%EOF\n", l.linNr, lay.firstXref)
+	return b.Bytes()
+}
+
+// hintStream returns the primary hint stream: the page offset hint table and the shared object
+// hint table (ISO 32000-1, F.4). Offsets in hint tables leave out the hint stream itself.
+func (l *linearizer) hintStream(lay *layout, objects map[int][]byte) []byte {
+	hintOffset := func(off int) uint64 {
+		if lay.hintLen > 0 && off > lay.hint {
+			off -= lay.hintLen
+		}
+		return uint64(off)
+	}
+	objLen := func(nr int) int { return len(objects[l.renumber[nr]]) }
+
+	// Shared object table: the first page's objects, then part 8, one object per group.
+	shared := append(slices.Clone(l.part6), l.part8...)
+	sharedIndex := make(map[int]int, len(shared))
+	for i, nr := range shared {
+		sharedIndex[nr] = i
+	}
+
+	npages := len(l.pages)
+	nobjects := make([]int, npages)
+	lengths := make([]int, npages)
+	sharedRefs := make([][]int, npages)
+	nobjects[0] = len(l.part6)
+	for _, nr := range l.part6 {
+		lengths[0] += objLen(nr)
+	}
+	for i, page := range l.part7 {
+		nobjects[i+1] = len(page)
+		for _, nr := range page {
+			lengths[i+1] += objLen(nr)
+		}
+	}
+	for _, nr := range l.order {
+		u := l.users[nr]
+		idx, ok := sharedIndex[nr]
+		if !ok || len(u.pages)+boolInt(u.other)+boolInt(u.openDoc) < 2 {
+			continue
+		}
+		for _, p := range u.pages {
+			sharedRefs[p] = append(sharedRefs[p], idx)
+		}
+	}
+
+	minObjects, maxObjects := slices.Min(nobjects), slices.Max(nobjects)
+	minLength, maxLength := slices.Min(lengths), slices.Max(lengths)
+	maxShared := 0
+	for _, refs := range sharedRefs {
+		maxShared = max(maxShared, len(refs))
+	}
+	nbitsObjects, nbitsLength := nbits(maxObjects-minObjects), nbits(maxLength-minLength)
+	nbitsShared, nbitsSharedID := nbits(maxShared), nbits(len(shared))
+
+	var w bitWriter
+	// Page offset hint table header (table F.3). Content streams are not located separately:
+	// like qpdf, offset 0 and the page lengths.
+	w.write(uint64(minObjects), 32)
+	w.write(hintOffset(lay.offsets[l.renumber[l.pages[0]]]), 32)
+	w.write(uint64(nbitsObjects), 16)
+	w.write(uint64(minLength), 32)
+	w.write(uint64(nbitsLength), 16)
+	w.write(0, 32)
+	w.write(0, 16)
+	w.write(uint64(minLength), 32)
+	w.write(uint64(nbitsLength), 16)
+	w.write(uint64(nbitsShared), 16)
+	w.write(uint64(nbitsSharedID), 16)
+	w.write(0, 16) // numerator bits
+	w.write(4, 16) // denominator, unused without numerators
+	// Per-page entries (table F.4), item by item for all pages.
+	for _, n := range nobjects {
+		w.write(uint64(n-minObjects), nbitsObjects)
+	}
+	w.flush()
+	for _, n := range lengths {
+		w.write(uint64(n-minLength), nbitsLength)
+	}
+	w.flush()
+	for _, refs := range sharedRefs {
+		w.write(uint64(len(refs)), nbitsShared)
+	}
+	w.flush()
+	for _, refs := range sharedRefs {
+		for _, idx := range refs {
+			w.write(uint64(idx), nbitsSharedID)
+		}
+	}
+	w.flush()
+	w.flush() // numerators: 0 bits each
+	w.flush() // content stream offsets: 0 bits each
+	for _, n := range lengths {
+		w.write(uint64(n-minLength), nbitsLength)
+	}
+	w.flush()
+
+	sharedTable := len(w.buf)
+	groupLengths := make([]int, len(shared))
+	for i, nr := range shared {
+		groupLengths[i] = objLen(nr)
+	}
+	minGroup, maxGroup := slices.Min(groupLengths), slices.Max(groupLengths)
+	nbitsGroup := nbits(maxGroup - minGroup)
+	var firstShared, firstSharedOffset int
+	if len(l.part8) > 0 {
+		firstShared = l.renumber[l.part8[0]]
+		firstSharedOffset = lay.offsets[firstShared]
+	}
+	// Shared object hint table header (table F.5) and entries (table F.6).
+	w.write(uint64(firstShared), 32)
+	w.write(hintOffset(firstSharedOffset), 32)
+	w.write(uint64(len(l.part6)), 32)
+	w.write(uint64(len(shared)), 32)
+	w.write(0, 16) // one object per group
+	w.write(uint64(minGroup), 32)
+	w.write(uint64(nbitsGroup), 16)
+	for _, n := range groupLengths {
+		w.write(uint64(n-minGroup), nbitsGroup)
+	}
+	w.flush()
+	for range groupLengths {
+		w.write(0, 1) // no MD5 signature
+	}
+	w.flush()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d 0 obj\n<</Length %d/S %d>>\nstream\n", l.hintNr, len(w.buf), sharedTable)
+	b.Write(w.buf)
+	b.WriteString("\nendstream\nendobj\n")
+	return b.Bytes()
+}
+
+// bitWriter packs values most significant bit first, as hint tables are.
+type bitWriter struct {
+	buf  []byte
+	used int // bits used in the last byte, 0 if it is full or there is none
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.used == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[len(w.buf)-1] |= 1 << uint(7-w.used)
+		}
+		w.used = (w.used + 1) % 8
+	}
+}
+
+// flush pads to the next byte boundary.
+func (w *bitWriter) flush() { w.used = 0 }
+
+// nbits returns the number of bits needed to represent n >= 0.
+func nbits(n int) int { return bits.Len(uint(n)) }
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(d types.Dict) []string {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
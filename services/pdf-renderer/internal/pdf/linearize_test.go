@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var linearizationDict = regexp.MustCompile(`^%PDF-\d\.\d\n%[^\n]*\n(\d+) 0 obj\n<</Linearized 1/L +(\d+)/H\[ *(\d+) +(\d+)\]/O (\d+)/E +(\d+)/N (\d+)/T +(\d+)>>`)
+
+// checkLinearized checks the linearization parameters of data against the file and returns the
+// number of pages.
+func checkLinearized(t *testing.T, data []byte) int {
+	t.Helper()
+	m := linearizationDict.FindSubmatch(data)
+	require.NotNil(t, m, "the linearization dictionary is the first object")
+	var p [8]int
+	for i := range p {
+		p[i], _ = strconv.Atoi(string(m[i+1]))
+	}
+	lin, length, hint, hintLen, first, end, pages, mainXref := p[0], p[1], p[2], p[3], p[4], p[5], p[6], p[7]
+	assert.Equal(t, len(data), length, "L")
+	require.Less(t, hint+hintLen, len(data))
+	assert.Regexp(t, `^\d+ 0 obj\n<</Length \d+/S \d+>>\nstream\n`, string(data[hint:hint+hintLen]), "H")
+	assert.True(t, bytes.HasSuffix(data[:hint+hintLen], []byte("endobj\n")), "H")
+	assert.Equal(t, "\n", string(data[mainXref]), "T")
+	assert.True(t, bytes.HasSuffix(data[:mainXref], []byte(fmt.Sprintf("xref\n0 %d", lin))), "T")
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), config())
+	require.NoError(t, err)
+	assert.True(t, ctx.Read.Linearized)
+	assert.Equal(t, ctx.PageCount, pages, "N")
+	_, ref, _, err := ctx.PageDict(1, false)
+	require.NoError(t, err)
+	assert.Equal(t, first, ref.ObjectNumber.Value(), "O")
+	pageOffset := bytes.Index(data, []byte(fmt.Sprintf("\n%d 0 obj\n", first))) + 1
+	assert.Less(t, pageOffset, end, "E")
+	assert.Greater(t, pageOffset, hint, "the first page follows the hint stream")
+
+	// The page offset hint table starts with the least number of objects per page and the
+	// location of the first page's object, not counting the hint stream.
+	table := data[bytes.Index(data[hint:], []byte("stream\n"))+hint+len("stream\n"):]
+	assert.Equal(t, uint32(pageOffset-hintLen), binary.BigEndian.Uint32(table[4:8]))
+
+	n, err := PageCount(data)
+	require.NoError(t, err)
+	assert.Equal(t, pages, n)
+	return pages
+}
+
+func TestProcess_Linearize(t *testing.T) {
+	out, err := Process(buildPDF(3), Options{Optimize: Optimization{Linearize: true}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, checkLinearized(t, out))
+}
+
+func TestProcess_LinearizeSharedResources(t *testing.T) {
+	shared, private := flateImage(t, photo(16, 16)), flateImage(t, photo(8, 8))
+	out, err := Process(imagesPDF([]string{private, shared, shared, private}, []string{"%s Do", "%s Do", "%s Do", "%s Do"}),
+		Options{Optimize: Optimization{Linearize: true, Deduplicate: true}})
+	require.NoError(t, err)
+	assert.Equal(t, 4, checkLinearized(t, out))
+	assert.Equal(t, [][2]int{{8, 8}, {16, 16}, {16, 16}, {8, 8}}, imageSizes(t, out))
+}
+
+func TestProcess_LinearizePDFA2B(t *testing.T) {
+	out, err := Process(chromePDF(embeddedFont), Options{PDFA: PDFA2B, Optimize: Optimization{Linearize: true}})
+	require.NoError(t, err)
+	checkLinearized(t, out)
+	validatePDFA2B(t, out)
+}
+
+func TestProcess_LinearizeSignature(t *testing.T) {
+	pki := newTestPKI(t, ecdsaKey(t))
+	s := &Signature{Signer: pki.signer(t), Box: &SignatureBox{Page: 2, Position: PositionCenter, Width: 200, Height: 50}}
+	out, err := Process(buildPDF(2), Options{Optimize: Optimization{Linearize: true}, Signature: s})
+	require.NoError(t, err)
+	checkLinearized(t, out)
+	verifySignature(t, out, pki.root)
+}
+
+func TestLinearize_Invalid(t *testing.T) {
+	_, err := linearize([]byte("%PDF-1.4 not really"))
+	assert.Error(t, err)
+
+	encrypted, err := Encrypt(buildPDF(1), Encryption{OwnerPassword: "owner"})
+	require.NoError(t, err)
+	_, err = linearize(encrypted)
+	assert.Error(t, err)
+}
+
+func TestBitWriter(t *testing.T) {
+	var w bitWriter
+	w.write(1, 1)
+	w.write(0x5, 3)
+	w.flush()
+	w.write(0xabc, 12)
+	w.write(0, 0)
+	assert.Equal(t, []byte{0xd0, 0xab, 0xc0}, w.buf)
+	assert.Equal(t, 0, nbits(0))
+	assert.Equal(t, 3, nbits(4))
+}
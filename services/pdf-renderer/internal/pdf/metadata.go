@@ -0,0 +1,172 @@
+package pdf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Metadata is the document information written into a rendered PDF. Empty fields keep what
+// Chrome wrote (Title defaults to the HTML <title>).
+type Metadata struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string
+
+	// XMP also stores the fields as an XMP metadata stream referenced from the catalog, which
+	// archiving tools and PDF/A require.
+	XMP bool
+}
+
+// IsZero reports whether m leaves the document unchanged.
+func (m Metadata) IsZero() bool {
+	return m == Metadata{}
+}
+
+// entries returns the document information dictionary entries set by m.
+func (m Metadata) entries() map[string]string {
+	entries := map[string]string{}
+	for key, value := range map[string]string{
+		"Title":    m.Title,
+		"Author":   m.Author,
+		"Subject":  m.Subject,
+		"Keywords": m.Keywords,
+		"Creator":  m.Creator,
+	} {
+		if value != "" {
+			entries[key] = value
+		}
+	}
+	return entries
+}
+
+// SetMetadata returns data with m written to the document information dictionary and, if
+// m.XMP is set, to an XMP metadata stream replacing any existing one.
+func SetMetadata(data []byte, m Metadata) ([]byte, error) {
+	return Process(data, Options{Metadata: m})
+}
+
+// xmpFields is the document information as it will be written, mirrored into XMP.
+type xmpFields struct {
+	Title, Author, Subject, Keywords, Creator, Producer string
+	Date                                                time.Time // creation and modification
+	PDFAPart                                            int       // 0 unless PDF/A
+	PDFAConformance                                     string
+	FacturX                                             *FacturX // nil unless an e-invoice
+}
+
+// applyMetadata writes m into the document information dictionary and, with m.XMP, an XMP
+// stream repeating the final dictionary: fields m leaves empty keep Chrome's values, Producer
+// and the dates are those pdfcpu writes at now. fx adds the Factur-X properties.
+func applyMetadata(ctx *model.Context, m Metadata, now time.Time, pdfaPart int, pdfaConformance string, fx *FacturX) error {
+	if entries := m.entries(); len(entries) > 0 {
+		if err := pdfcpu.PropertiesAdd(ctx, entries); err != nil {
+			return fmt.Errorf("pdf: info dictionary: %w", err)
+		}
+	}
+	if !m.XMP {
+		return nil
+	}
+
+	fields := xmpFields{
+		Title:           firstNonEmpty(m.Title, ctx.Title),
+		Author:          firstNonEmpty(m.Author, ctx.Author),
+		Subject:         firstNonEmpty(m.Subject, ctx.Subject),
+		Keywords:        firstNonEmpty(m.Keywords, ctx.Keywords),
+		Creator:         firstNonEmpty(m.Creator, ctx.Creator),
+		Producer:        "pdfcpu " + model.VersionStr,
+		Date:            now,
+		PDFAPart:        pdfaPart,
+		PDFAConformance: pdfaConformance,
+		FacturX:         fx,
+	}
+
+	// Metadata streams stay unfiltered so they can be found without a PDF parser.
+	sd := types.StreamDict{Dict: types.NewDict(), Content: xmpPacket(fields)}
+	sd.InsertName("Type", "Metadata")
+	sd.InsertName("Subtype", "XML")
+	if err := sd.Encode(); err != nil {
+		return err
+	}
+	ref, err := ctx.IndRefForNewObject(sd)
+	if err != nil {
+		return err
+	}
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	root.Update("Metadata", *ref)
+	return nil
+}
+
+// xmpPacket serializes f as an XMP packet using the Dublin Core, Adobe PDF, XMP Basic and (for
+// PDF/A) PDF/A identification schemas, following the mapping of ISO 32000-1, 14.3.2, and for
+// e-invoices the Factur-X schema.
+func xmpPacket(f xmpFields) []byte {
+	date := f.Date.Format(time.RFC3339)
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`  <rdf:Description rdf:about=""` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/"` +
+		` xmlns:pdf="http://ns.adobe.com/pdf/1.3/"` +
+		` xmlns:xmp="http://ns.adobe.com/xap/1.0/"` +
+		` xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">` + "\n")
+	b.WriteString("   <dc:format>application/pdf</dc:format>\n")
+	if f.Title != "" {
+		fmt.Fprintf(&b, "   <dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", xmlText(f.Title))
+	}
+	if f.Author != "" {
+		fmt.Fprintf(&b, "   <dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", xmlText(f.Author))
+	}
+	if f.Subject != "" {
+		fmt.Fprintf(&b, "   <dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", xmlText(f.Subject))
+	}
+	if f.Keywords != "" {
+		fmt.Fprintf(&b, "   <pdf:Keywords>%s</pdf:Keywords>\n", xmlText(f.Keywords))
+	}
+	fmt.Fprintf(&b, "   <pdf:Producer>%s</pdf:Producer>\n", xmlText(f.Producer))
+	if f.Creator != "" {
+		fmt.Fprintf(&b, "   <xmp:CreatorTool>%s</xmp:CreatorTool>\n", xmlText(f.Creator))
+	}
+	fmt.Fprintf(&b, "   <xmp:CreateDate>%s</xmp:CreateDate>\n", date)
+	fmt.Fprintf(&b, "   <xmp:ModifyDate>%s</xmp:ModifyDate>\n", date)
+	fmt.Fprintf(&b, "   <xmp:MetadataDate>%s</xmp:MetadataDate>\n", date)
+	if f.PDFAPart > 0 {
+		fmt.Fprintf(&b, "   <pdfaid:part>%d</pdfaid:part>\n", f.PDFAPart)
+		fmt.Fprintf(&b, "   <pdfaid:conformance>%s</pdfaid:conformance>\n", f.PDFAConformance)
+	}
+	b.WriteString("  </rdf:Description>\n")
+	if f.FacturX != nil {
+		b.WriteString(f.FacturX.xmp())
+	}
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>`)
+	return []byte(b.String())
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
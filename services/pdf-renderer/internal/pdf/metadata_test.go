@@ -0,0 +1,56 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMetadata(t *testing.T) {
+	out, err := SetMetadata(buildPDF(2), Metadata{
+		Title:    "Quarterly report",
+		Author:   "Jürgen <Finance>",
+		Subject:  "Q3",
+		Keywords: "finance, q3",
+		XMP:      true,
+	})
+	require.NoError(t, err)
+
+	props, err := api.Properties(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	ctx, err := api.ReadContext(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+
+	assert.Equal(t, "Quarterly report", ctx.Title)
+	assert.Equal(t, "Jürgen <Finance>", ctx.Author)
+	assert.Equal(t, "Q3", ctx.Subject)
+	assert.Equal(t, "Chromium", ctx.Creator, "unset fields keep Chrome's value")
+	assert.Empty(t, props, "standard entries are not custom properties")
+
+	assert.Contains(t, string(out), "<dc:creator><rdf:Seq><rdf:li>Jürgen &lt;Finance&gt;</rdf:li></rdf:Seq></dc:creator>",
+		"the XMP stream is stored unfiltered")
+
+	n, err := PageCount(out)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestSetMetadata_InfoOnly(t *testing.T) {
+	out, err := SetMetadata(buildPDF(1), Metadata{Title: "Invoice"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "xmpmeta")
+
+	ctx, err := api.ReadContext(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+	assert.Equal(t, "Invoice", ctx.Title)
+}
+
+func TestSetMetadata_InvalidPDF(t *testing.T) {
+	_, err := SetMetadata([]byte("%PDF-1.4 truncated"), Metadata{Title: "x"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"errors"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Image resolutions accepted by Optimization.ImageDPI.
+const (
+	MinImageDPI = 72
+	MaxImageDPI = 600
+)
+
+var (
+	// ErrLinearizeCompressed means linearization and object streams were both requested: a
+	// linearized file keeps the classic cross-reference table its hint tables describe.
+	ErrLinearizeCompressed = errors.New("pdf: linearized documents cannot use object streams")
+
+	// ErrSignCompressed means a signature was requested for a document compressed into object
+	// streams, where the signature's placeholders cannot be filled in after writing.
+	ErrSignCompressed = errors.New("pdf: signed documents cannot use object streams")
+)
+
+// Optimization shrinks a rendered PDF or prepares it for progressive loading.
+type Optimization struct {
+	// Linearize lays the file out for fast web view: the first page can be shown before the
+	// rest has been downloaded.
+	Linearize bool
+
+	// Compress Flate-encodes uncompressed streams and packs objects into compressed object
+	// streams with a cross-reference stream (PDF 1.5).
+	Compress bool
+
+	// Deduplicate replaces identical fonts, images and resource dictionaries with one copy.
+	Deduplicate bool
+
+	// ImageDPI downsamples images drawn at more than 1.5 times this resolution to it (0 keeps
+	// them as they are).
+	ImageDPI int
+}
+
+// IsZero reports whether o leaves the document unchanged.
+func (o Optimization) IsZero() bool {
+	return o == Optimization{}
+}
+
+// apply runs the optimizations done while the document is being edited; linearization needs the
+// written file and comes after.
+func (o Optimization) apply(ctx *model.Context) error {
+	if o.Deduplicate {
+		ctx.OptimizeResourceDicts = true
+		ctx.OptimizeDuplicateContentStreams = true
+		if err := pdfcpu.OptimizeXRefTable(ctx); err != nil {
+			return err
+		}
+	}
+	if o.ImageDPI > 0 {
+		if err := downsampleImages(ctx, o.ImageDPI); err != nil {
+			return err
+		}
+	}
+	if o.Compress {
+		if err := compressStreams(ctx); err != nil {
+			return err
+		}
+		ctx.WriteObjectStream = true
+		ctx.WriteXRefStream = true
+	}
+	return nil
+}
+
+// compressStreams Flate-encodes the streams stored without a filter, where that makes them
+// smaller. XMP metadata stays readable as PDF/A asks.
+func compressStreams(ctx *model.Context) error {
+	for nr, entry := range ctx.Table {
+		if entry == nil || entry.Free || nr == 0 {
+			continue
+		}
+		sd, ok := entry.Object.(types.StreamDict)
+		if !ok || len(sd.FilterPipeline) > 0 || sd.Dict["Filter"] != nil || sd.Type() != nil && *sd.Type() == "Metadata" {
+			continue
+		}
+		content := sd.Content
+		if content == nil {
+			content = sd.Raw
+		}
+		compressed, err := ctx.NewStreamDictForBuf(content)
+		if err != nil {
+			return err
+		}
+		if err := compressed.Encode(); err != nil {
+			return err
+		}
+		if len(compressed.Raw) >= len(content) {
+			continue
+		}
+		sd.Content = content
+		sd.FilterPipeline = compressed.FilterPipeline
+		sd.Dict["Filter"] = compressed.Dict["Filter"]
+		sd.Raw = compressed.Raw
+		sd.StreamLength = compressed.StreamLength
+		sd.Dict["Length"] = types.Integer(len(sd.Raw))
+		entry.Object = sd
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// photo returns a w×h image with smooth gradients and some detail, like a photograph.
+func photo(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: uint8((x ^ y) & 0x3f), A: 0xff})
+		}
+	}
+	return img
+}
+
+// flateImage returns an image XObject with img's pixels as 8-bit RGB, Flate encoded.
+func flateImage(t *testing.T, img *image.RGBA) string {
+	t.Helper()
+	var pix []byte
+	for i := 0; i < len(img.Pix); i += 4 {
+		pix = append(pix, img.Pix[i:i+3]...)
+	}
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	_, err := zw.Write(pix)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+		img.Rect.Dx(), img.Rect.Dy()), b.Bytes())
+}
+
+// jpegImage returns an image XObject with img as a JPEG.
+func jpegImage(t *testing.T, img *image.RGBA) string {
+	t.Helper()
+	var b bytes.Buffer
+	require.NoError(t, jpeg.Encode(&b, img, &jpeg.Options{Quality: 95}))
+	return stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode",
+		img.Rect.Dx(), img.Rect.Dy()), b.Bytes())
+}
+
+func stream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// imagesPDF returns a document with a page per image, each drawing its image with the matrix in
+// content ("%s" for the image name).
+func imagesPDF(images []string, content []string) []byte {
+	n := len(images)
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	var kids []string
+	for i := range images {
+		page, img, contents := 3+3*i, 4+3*i, 5+3*i
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+		draw := fmt.Sprintf(content[i], fmt.Sprintf("/Im%d", i))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /XObject << /Im%d %d 0 R >> >> /Contents %d 0 R >>", i, img, contents),
+			images[i],
+			stream("", []byte(draw)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Count %d /Kids [%s] >>", n, strings.Join(kids, " "))
+	objects = append(objects, "<< /Producer (Skia/PDF) >>")
+	return assemblePDF(objects)
+}
+
+// imageSizes returns the width and height of the images drawn by each page of data.
+func imageSizes(t *testing.T, data []byte) [][2]int {
+	t.Helper()
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), config())
+	require.NoError(t, err)
+	var sizes [][2]int
+	for i := 1; i <= ctx.PageCount; i++ {
+		_, _, inh, err := ctx.PageDict(i, false)
+		require.NoError(t, err)
+		for _, o := range inh.Resources.DictEntry("XObject") {
+			sd, _, err := ctx.DereferenceStreamDict(o)
+			require.NoError(t, err)
+			sizes = append(sizes, [2]int{*sd.IntEntry("Width"), *sd.IntEntry("Height")})
+		}
+	}
+	return sizes
+}
+
+func TestProcess_ImageDPI(t *testing.T) {
+	img := photo(600, 400)
+	doc := imagesPDF(
+		[]string{flateImage(t, img), jpegImage(t, img), flateImage(t, img)},
+		[]string{
+			"q 144 0 0 96 0 0 cm %s Do Q",                   // 300 dpi
+			"q 2 0 0 2 0 0 cm q 72 0 0 48 0 0 cm %s Do Q Q", // 300 dpi, nested
+			"q 360 0 0 240 0 0 cm %s Do Q",                  // 120 dpi
+		})
+
+	out, err := Process(doc, Options{Optimize: Optimization{ImageDPI: 150}})
+	require.NoError(t, err)
+	assert.Less(t, len(out), len(doc))
+	assert.Equal(t, [][2]int{{300, 200}, {300, 200}, {600, 400}}, imageSizes(t, out),
+		"halved to 150 dpi; 120 dpi is below the target")
+	assert.Contains(t, string(out), "/DCTDecode", "JPEGs stay JPEGs")
+
+	out, err = Process(doc, Options{Optimize: Optimization{ImageDPI: 250}})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int{{600, 400}, {600, 400}, {600, 400}}, imageSizes(t, out), "within 1.5 times the target")
+}
+
+func TestProcess_ImageDPI_SharedImage(t *testing.T) {
+	img := flateImage(t, photo(600, 400))
+	doc := imagesPDF([]string{img}, []string{"q 144 0 0 96 0 0 cm %[1]s Do Q q 360 0 0 240 0 0 cm %[1]s Do Q"})
+	out, err := Process(doc, Options{Optimize: Optimization{ImageDPI: 72}})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int{{360, 240}}, imageSizes(t, out), "sized for the larger use, at 120 dpi")
+}
+
+func TestProcess_ImageDPI_Unsupported(t *testing.T) {
+	// A color space the resampler does not handle, and content that breaks off.
+	img := strings.Replace(flateImage(t, photo(600, 400)), "/DeviceRGB", "/DeviceCMYK", 1)
+	doc := imagesPDF([]string{img, flateImage(t, photo(600, 400))}, []string{"q 144 0 0 96 0 0 cm %s Do Q", "q 144 0 0 96 0 0 cm %s Do ) Q"})
+	out, err := Process(doc, Options{Optimize: Optimization{ImageDPI: 150}})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int{{600, 400}, {300, 200}}, imageSizes(t, out))
+}
+
+func TestProcess_Deduplicate(t *testing.T) {
+	img := flateImage(t, photo(64, 64))
+	doc := imagesPDF([]string{img, img, img}, []string{"q 64 0 0 64 0 0 cm %s Do Q", "q 64 0 0 64 0 0 cm %s Do Q", "q 64 0 0 64 0 0 cm %s Do Q"})
+	images := regexp.MustCompile(`/Subtype\s*/Image`)
+	require.Len(t, images.FindAll(doc, -1), 3)
+
+	out, err := Process(doc, Options{Optimize: Optimization{Deduplicate: true}})
+	require.NoError(t, err)
+	assert.Len(t, images.FindAll(out, -1), 1)
+	assert.Less(t, len(out), len(doc))
+	assert.Len(t, imageSizes(t, out), 3, "every page still draws it")
+}
+
+func TestProcess_Compress(t *testing.T) {
+	doc := imagesPDF([]string{flateImage(t, photo(8, 8))}, []string{strings.Repeat("q 8 0 0 8 0 0 cm %[1]s Do Q\n", 100)})
+	out, err := Process(doc, Options{Metadata: Metadata{Title: "Report", XMP: true}, Optimize: Optimization{Compress: true}})
+	require.NoError(t, err)
+	assert.Less(t, len(out), len(doc))
+	assert.Contains(t, string(out), "/Type/ObjStm")
+	assert.Contains(t, string(out), "/Type/XRef")
+	assert.Contains(t, string(out), "<x:xmpmeta", "XMP stays uncompressed")
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	assert.True(t, ctx.Read.UsingObjectStreams)
+	content, err := pageContent(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("q 8 0 0 8 0 0 cm /Im0 Do Q\n", 100), string(content))
+
+	n, err := PageCount(out)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func pageContent(ctx *model.Context, pageNr int) ([]byte, error) {
+	page, _, _, err := ctx.PageDict(pageNr, false)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.PageContent(page)
+}
+
+func TestProcess_CompressPDFA2B(t *testing.T) {
+	out, err := Process(chromePDF(embeddedFont), Options{PDFA: PDFA2B, Optimize: Optimization{Compress: true, Deduplicate: true}})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "/Type/ObjStm")
+	validatePDFA2B(t, out)
+}
+
+func TestEncrypt_KeepsObjectStreams(t *testing.T) {
+	compressed, err := Process(buildPDF(2), Options{Optimize: Optimization{Compress: true}})
+	require.NoError(t, err)
+	out, err := Encrypt(compressed, Encryption{UserPassword: "secret"})
+	require.NoError(t, err)
+
+	conf := config()
+	conf.UserPW = "secret"
+	ctx, err := api.ReadAndValidate(bytes.NewReader(out), conf)
+	require.NoError(t, err)
+	assert.True(t, ctx.Read.UsingObjectStreams)
+	assert.Equal(t, 2, ctx.PageCount)
+}
+
+func TestProcess_OptimizationConflicts(t *testing.T) {
+	_, err := Process(buildPDF(1), Options{Optimize: Optimization{Compress: true, Linearize: true}})
+	assert.ErrorIs(t, err, ErrLinearizeCompressed)
+
+	pki := newTestPKI(t, ecdsaKey(t))
+	_, err = Process(buildPDF(1), Options{Optimize: Optimization{Compress: true}, Signature: &Signature{Signer: pki.signer(t)}})
+	assert.ErrorIs(t, err, ErrSignCompressed)
+}
+
+func TestContentLexer(t *testing.T) {
+	content := "BT /F1 12 Tf (a \\) (nested) string) Tj ET % comment q\n" +
+		"[(x) 1 <414243>] TJ /P <</MCID 0 /A [1 2]>> BDC EMC " +
+		"BI /W 2 /H 1 /BPC 8 /CS /G ID \x00EI\xffEI EI 1.5 -2 .5 0 0 0 cm"
+	lex := contentLexer{data: []byte(content)}
+	var ops []string
+	var operands []types.Object
+	for {
+		tok, op, ok := lex.next()
+		if !ok {
+			break
+		}
+		if op {
+			ops = append(ops, string(tok.(types.Name)))
+			continue
+		}
+		operands = append(operands, tok)
+	}
+	assert.Equal(t, []string{"BT", "Tf", "Tj", "ET", "TJ", "BDC", "EMC", "BI", "cm"}, ops)
+	m, ok := toMatrix(operands[len(operands)-6:])
+	require.True(t, ok)
+	assert.Equal(t, matrix{1.5, -2, .5, 0, 0, 0}, m)
+}
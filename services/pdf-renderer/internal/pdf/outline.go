@@ -0,0 +1,67 @@
+package pdf
+
+import (
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// MaxOutlineDepth is the deepest heading level (h6) Chrome puts into a document outline.
+const MaxOutlineDepth = 6
+
+// limitOutline drops the outline items nested more than depth levels deep, e.g. the h3 to h6
+// entries of an outline Chrome generated from headings for depth 2. The counts of visible items
+// are updated; dropped items are no longer reachable and left out when the file is written.
+func limitOutline(ctx *model.Context, depth int) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	outlines, err := ctx.DereferenceDict(root["Outlines"])
+	if err != nil || outlines == nil {
+		return err
+	}
+	_, err = pruneOutline(ctx, outlines, depth, map[int]bool{})
+	return err
+}
+
+// pruneOutline drops the items more than depth levels below item and returns the number of
+// items visible when item is open, which it stores in item's Count (negative if item is closed).
+func pruneOutline(ctx *model.Context, item types.Dict, depth int, seen map[int]bool) (int, error) {
+	if depth == 0 {
+		delete(item, "First")
+		delete(item, "Last")
+		delete(item, "Count")
+		return 0, nil
+	}
+	visible := 0
+	for next := item["First"]; next != nil; {
+		ref, ok := next.(types.IndirectRef)
+		if !ok || seen[ref.ObjectNumber.Value()] {
+			break
+		}
+		seen[ref.ObjectNumber.Value()] = true
+		child, err := ctx.DereferenceDict(ref)
+		if err != nil || child == nil {
+			return 0, err
+		}
+		n, err := pruneOutline(ctx, child, depth-1, seen)
+		if err != nil {
+			return 0, err
+		}
+		visible++
+		if c := child.IntEntry("Count"); c != nil && *c > 0 {
+			visible += n
+		}
+		next = child["Next"]
+	}
+
+	switch c := item.IntEntry("Count"); {
+	case visible == 0:
+		delete(item, "Count")
+	case c != nil && *c < 0:
+		item["Count"] = types.Integer(-visible)
+	default:
+		item["Count"] = types.Integer(visible)
+	}
+	return visible, nil
+}
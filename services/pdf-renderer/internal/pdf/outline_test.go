@@ -0,0 +1,76 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outlinePDF returns a one-page document with the outline A > A.1 > A.1.a and a closed B > B.1,
+// as Chrome writes it for headings h1 > h2 > h3.
+func outlinePDF() []byte {
+	return assemblePDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R /Outlines 4 0 R >>",
+		"<< /Type /Pages /Count 1 /Kids [3 0 R] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << >> >>",
+		"<< /Type /Outlines /First 5 0 R /Last 8 0 R /Count 4 >>",
+		"<< /Title (A) /Parent 4 0 R /Next 8 0 R /First 6 0 R /Last 6 0 R /Count 2 /Dest [3 0 R /XYZ 0 800 0] >>",
+		"<< /Title (A.1) /Parent 5 0 R /First 7 0 R /Last 7 0 R /Count 1 /Dest [3 0 R /XYZ 0 700 0] >>",
+		"<< /Title (A.1.a) /Parent 6 0 R /Dest [3 0 R /XYZ 0 600 0] >>",
+		"<< /Title (B) /Parent 4 0 R /Prev 5 0 R /First 9 0 R /Last 9 0 R /Count -1 /Dest [3 0 R /XYZ 0 500 0] >>",
+		"<< /Title (B.1) /Parent 8 0 R /Dest [3 0 R /XYZ 0 400 0] >>",
+		"<< /Producer (Skia/PDF) >>",
+	})
+}
+
+// outlineTree returns the titles of the outline items below item, indented by level, with the
+// counts of the items that have one.
+func outlineTree(t *testing.T, ctx *model.Context, item types.Dict, indent string) []string {
+	t.Helper()
+	var lines []string
+	for next := item["First"]; next != nil; {
+		child, err := ctx.DereferenceDict(next)
+		require.NoError(t, err)
+		title, err := types.StringLiteralToString(child["Title"].(types.StringLiteral))
+		require.NoError(t, err)
+		if c := child.IntEntry("Count"); c != nil {
+			title += " " + types.Integer(*c).String()
+		}
+		lines = append(lines, indent+title)
+		lines = append(lines, outlineTree(t, ctx, child, indent+"  ")...)
+		next = child["Next"]
+	}
+	return lines
+}
+
+func TestProcess_OutlineDepth(t *testing.T) {
+	for _, tc := range []struct {
+		depth int
+		want  []string
+		count int
+	}{
+		{MaxOutlineDepth, []string{"A 2", "  A.1 1", "    A.1.a", "B -1", "  B.1"}, 4},
+		{2, []string{"A 1", "  A.1", "B -1", "  B.1"}, 3},
+		{1, []string{"A", "B"}, 2},
+	} {
+		out, err := Process(outlinePDF(), Options{OutlineDepth: tc.depth})
+		require.NoError(t, err)
+		ctx, err := api.ReadAndValidate(bytes.NewReader(out), config())
+		require.NoError(t, err)
+		root, err := ctx.Catalog()
+		require.NoError(t, err)
+		outlines, err := ctx.DereferenceDict(root["Outlines"])
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, outlineTree(t, ctx, outlines, ""), "depth %d", tc.depth)
+		assert.Equal(t, tc.count, *outlines.IntEntry("Count"), "depth %d", tc.depth)
+	}
+
+	out, err := Process(outlinePDF(), Options{OutlineDepth: 1})
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "(A.1)", "dropped items are not written")
+}
@@ -0,0 +1,104 @@
+// Package pdf inspects and post-processes rendered PDFs. PageCount is a minimal parser for the
+// hot path; edits go through pdfcpu.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// ErrNoPages means the page count could not be determined.
+var ErrNoPages = errors.New("pdf: page tree not found")
+
+var (
+	rootRef   = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	pagesRef  = regexp.MustCompile(`/Pages\s+(\d+)\s+(\d+)\s+R`)
+	count     = regexp.MustCompile(`/Count\s+(\d+)`)
+	pageType  = regexp.MustCompile(`/Type\s*/Page\b`)
+	objHeader = regexp.MustCompile(`(?:^|[^0-9])(\d+)\s+(\d+)\s+obj\b`)
+	endObject = []byte("endobj")
+)
+
+// PageCount returns the number of pages of data.
+//
+// It follows the last /Root reference (the newest trailer after incremental updates) to the
+// catalog and reads /Count from the root of the page tree. Documents whose page tree cannot be
+// located that way are counted by their /Type /Page objects, or parsed with pdfcpu if those are
+// compressed into object streams.
+func PageCount(data []byte) (int, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return 0, errors.New("pdf: missing %PDF- header")
+	}
+	if n, ok := pageTreeCount(data); ok {
+		return n, nil
+	}
+	if n := len(pageType.FindAllIndex(data, -1)); n > 0 {
+		return n, nil
+	}
+	if bytes.Contains(data, []byte("/ObjStm")) {
+		return objectStreamPageCount(data)
+	}
+	return 0, ErrNoPages
+}
+
+// objectStreamPageCount counts the pages of a document compressed into object streams (see
+// Optimization.Compress) with pdfcpu, which is slower but can decompress them.
+func objectStreamPageCount(data []byte) (_ int, err error) {
+	defer recoverPanic(&err)
+
+	n, err := api.PageCount(bytes.NewReader(data), config())
+	if err != nil || n == 0 {
+		return 0, ErrNoPages
+	}
+	return n, nil
+}
+
+// pageTreeCount reads /Root -> /Pages -> /Count.
+func pageTreeCount(data []byte) (int, bool) {
+	roots := rootRef.FindAllSubmatch(data, -1)
+	if len(roots) == 0 {
+		return 0, false
+	}
+	root := roots[len(roots)-1]
+	catalog := object(data, root[1], root[2])
+	if catalog == nil {
+		return 0, false
+	}
+	ref := pagesRef.FindSubmatch(catalog)
+	if ref == nil {
+		return 0, false
+	}
+	tree := object(data, ref[1], ref[2])
+	if tree == nil {
+		return 0, false
+	}
+	m := count.FindSubmatch(tree)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(m[1]))
+	return n, err == nil
+}
+
+// object returns the body of the last definition of object num/gen, or nil if it is not stored
+// as a plain indirect object.
+func object(data, num, gen []byte) []byte {
+	start := -1
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		if bytes.Equal(data[m[2]:m[3]], num) && bytes.Equal(data[m[4]:m[5]], gen) {
+			start = m[1]
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	body := data[start:]
+	if end := bytes.Index(body, endObject); end >= 0 {
+		body = body[:end]
+	}
+	return body
+}
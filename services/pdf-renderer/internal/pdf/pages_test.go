@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// threePages is shaped like Chrome's output: a catalog, a page tree root and a classic trailer.
+const threePages = `%PDF-1.4
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R >>
+endobj
+2 0 obj
+<< /Type /Pages /Count 3 /Kids [3 0 R 4 0 R 5 0 R] >>
+endobj
+3 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+4 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+5 0 obj
+<< /Type /Page /Parent 2 0 R >>
+endobj
+12 0 obj
+<< /Type /Pages /Count 7 >>
+endobj
+trailer
+<< /Size 6 /Root 1 0 R >>
+startxref
+0
+%%EOF
+`
+
+func TestPageCount(t *testing.T) {
+	n, err := PageCount([]byte(threePages))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "object 12 is not object 2")
+}
+
+func TestPageCount_IncrementalUpdate(t *testing.T) {
+	update := threePages + `2 0 obj
+<< /Type /Pages /Count 4 /Kids [3 0 R 4 0 R 5 0 R 6 0 R] >>
+endobj
+trailer
+<< /Size 7 /Root 1 0 R /Prev 0 >>
+%%EOF
+`
+	n, err := PageCount([]byte(update))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n, "the newest definition wins")
+}
+
+func TestPageCount_FallsBackToPageObjects(t *testing.T) {
+	// The catalog lives in an object stream the parser cannot read.
+	doc := `%PDF-1.7
+3 0 obj << /Type /Page >> endobj
+4 0 obj << /Type/Page >> endobj
+5 0 obj << /Type /XRef /Root 1 0 R >> endobj
+%%EOF`
+	n, err := PageCount([]byte(doc))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestPageCount_Invalid(t *testing.T) {
+	_, err := PageCount([]byte("<html></html>"))
+	assert.Error(t, err)
+
+	_, err = PageCount([]byte("%PDF-1.4\n%%EOF"))
+	assert.ErrorIs(t, err, ErrNoPages)
+}
+
+// buildPDF returns a valid PDF with n empty A4 pages and a classic xref table, as Chrome writes.
+func buildPDF(n int) []byte {
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	kids := make([]string, n)
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", i+3)
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << >> >>")
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Count %d /Kids [%s] >>", n, strings.Join(kids, " "))
+	objects = append(objects, "<< /Title (Untitled) /Producer (Skia/PDF) /Creator (Chromium) >>")
+	return assemblePDF(objects)
+}
+
+// assemblePDF numbers objects from 1 and writes them with a classic xref table. The first
+// object is the catalog and the last the document information dictionary.
+func assemblePDF(objects []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	return b.Bytes()
+}
@@ -0,0 +1,288 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+var (
+	// ErrUnsupportedPDFA means Options.PDFA names a conformance level this package cannot produce.
+	ErrUnsupportedPDFA = errors.New("pdf: unsupported PDF/A conformance level")
+
+	// ErrFontNotEmbedded means the document uses a font without an embedded font program, which
+	// PDF/A forbids and which cannot be fixed after printing.
+	ErrFontNotEmbedded = errors.New("pdf: PDF/A requires embedded fonts")
+)
+
+// Annotation flags (ISO 32000-1, 12.5.3).
+const (
+	annotInvisible      = 1 << 0
+	annotHidden         = 1 << 1
+	annotPrint          = 1 << 2
+	annotNoView         = 1 << 5
+	annotLocked         = 1 << 7
+	annotToggleNoView   = 1 << 8
+	annotForbiddenFlags = annotInvisible | annotHidden | annotNoView | annotToggleNoView
+)
+
+// forbiddenActions are the action types PDF/A-2 disallows (ISO 19005-2, 6.5.1).
+var forbiddenActions = map[string]bool{
+	"Launch": true, "Sound": true, "Movie": true, "ResetForm": true, "ImportData": true,
+	"JavaScript": true, "Hide": true, "SetOCGState": true, "Rendition": true, "Trans": true,
+	"GoTo3DView": true,
+}
+
+// convertPDFA makes a document printed by Chrome structurally conformant with PDF/A-2b, except
+// for the XMP metadata which applyMetadata writes. PDF/A-3b has the same requirements but allows
+// associated files, which addAttachments embeds afterwards:
+//
+//   - an sRGB output intent makes the device-dependent colours Chrome uses unambiguous;
+//   - document and page actions, JavaScript, embedded files and XFA are removed;
+//   - annotations are made printable and visible;
+//   - optional content configurations (added by watermarks) are named and lose their auto
+//     state changes;
+//   - fonts are checked to be embedded (Chrome embeds every font it draws with, so this only fails
+//     for unusual input).
+//
+// Transparency groups are kept: PDF/A-2, unlike PDF/A-1, allows transparency as long as an
+// output intent is present, and flattening it would mean rasterizing the page.
+func convertPDFA(ctx *model.Context) error {
+	if err := checkFontsEmbedded(ctx); err != nil {
+		return err
+	}
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	intent, err := sRGBOutputIntent(ctx)
+	if err != nil {
+		return err
+	}
+	root.Update("OutputIntents", types.Array{intent})
+
+	root.Delete("AA")
+	if action, err := ctx.DereferenceDict(root["OpenAction"]); err == nil && forbiddenAction(action) {
+		root.Delete("OpenAction")
+	}
+	if err := removeNameTrees(ctx, "JavaScript", "EmbeddedFiles"); err != nil {
+		return err
+	}
+	if form, err := ctx.DereferenceDict(root["AcroForm"]); err == nil && form != nil {
+		form.Delete("XFA")
+		form.Delete("NeedsRendering")
+	}
+	if err := convertOptionalContent(ctx); err != nil {
+		return err
+	}
+
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		page, _, _, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			return err
+		}
+		page.Delete("AA")
+		if err := convertAnnotations(ctx, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sRGBOutputIntent returns a PDF/A output intent with the embedded sRGB profile.
+func sRGBOutputIntent(ctx *model.Context) (types.Dict, error) {
+	sd, err := ctx.NewStreamDictForBuf(sRGBProfile())
+	if err != nil {
+		return nil, err
+	}
+	sd.InsertInt("N", 3)
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	profile, err := ctx.IndRefForNewObject(*sd)
+	if err != nil {
+		return nil, err
+	}
+
+	intent := types.NewDict()
+	intent.InsertName("Type", "OutputIntent")
+	intent.InsertName("S", "GTS_PDFA1")
+	intent.InsertString("OutputConditionIdentifier", sRGBDescription)
+	intent.InsertString("Info", sRGBDescription)
+	intent.InsertString("RegistryName", "http://www.color.org")
+	intent.Insert("DestOutputProfile", *profile)
+	return intent, nil
+}
+
+// removeNameTrees removes the named trees from the catalog's name dictionary, if present.
+func removeNameTrees(ctx *model.Context, names ...string) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	if _, ok := root.Find("Names"); !ok {
+		return nil
+	}
+	for _, name := range names {
+		namesDict, err := ctx.NamesDict()
+		if err != nil {
+			return err
+		}
+		if _, ok := namesDict.Find(name); !ok {
+			continue
+		}
+		delete(ctx.Names, name)
+		if err := ctx.RemoveNameTree(name); err != nil {
+			return fmt.Errorf("pdf: remove %s: %w", name, err)
+		}
+		if _, ok := root.Find("Names"); !ok {
+			break
+		}
+	}
+	return nil
+}
+
+// convertOptionalContent makes the optional content configurations conform (ISO 19005-2, 6.9):
+// each needs a unique Name, none may have an AS entry, and an Order must list every group.
+func convertOptionalContent(ctx *model.Context) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	props, err := ctx.DereferenceDict(root["OCProperties"])
+	if err != nil || props == nil {
+		return err
+	}
+	ocgs, err := ctx.DereferenceArray(props["OCGs"])
+	if err != nil {
+		return err
+	}
+
+	configs := []types.Object{props["D"]}
+	if others, err := ctx.DereferenceArray(props["Configs"]); err == nil {
+		configs = append(configs, others...)
+	}
+	for i, obj := range configs {
+		config, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			continue
+		}
+		config.Delete("AS")
+		name := "Default"
+		if i > 0 {
+			name = fmt.Sprintf("Configuration %d", i)
+		}
+		config.Update("Name", types.StringLiteral(name))
+		if order, err := ctx.DereferenceArray(config["Order"]); err == nil && order != nil {
+			listed := map[types.IndirectRef]bool{}
+			collectRefs(order, listed)
+			for _, ocg := range ocgs {
+				if ref, ok := ocg.(types.IndirectRef); ok && !listed[ref] {
+					order = append(order, ref)
+				}
+			}
+			config.Update("Order", order)
+		}
+	}
+	return nil
+}
+
+// collectRefs adds the references in a (nested) Order array to refs.
+func collectRefs(a types.Array, refs map[types.IndirectRef]bool) {
+	for _, obj := range a {
+		switch o := obj.(type) {
+		case types.IndirectRef:
+			refs[o] = true
+		case types.Array:
+			collectRefs(o, refs)
+		}
+	}
+}
+
+// convertAnnotations sets the print flag on the page's annotations, clears the flags hiding
+// them and removes their forbidden actions.
+func convertAnnotations(ctx *model.Context, page types.Dict) error {
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil || annots == nil {
+		return err
+	}
+	for _, obj := range annots {
+		annot, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			return err
+		}
+		if annot == nil {
+			continue
+		}
+		annot.Delete("AA")
+		if action, err := ctx.DereferenceDict(annot["A"]); err == nil && forbiddenAction(action) {
+			annot.Delete("A")
+		}
+		if subtype := annot.Subtype(); subtype != nil && *subtype == "Popup" {
+			continue
+		}
+		flags := 0
+		if f := annot.IntEntry("F"); f != nil {
+			flags = *f
+		}
+		annot.Update("F", types.Integer(flags&^annotForbiddenFlags|annotPrint))
+	}
+	return nil
+}
+
+func forbiddenAction(action types.Dict) bool {
+	if action == nil {
+		return false
+	}
+	s := action.NameEntry("S")
+	return s != nil && forbiddenActions[*s]
+}
+
+// checkFontsEmbedded returns ErrFontNotEmbedded naming the fonts without a font program. Type 3
+// fonts are defined by content streams and composite fonts by their descendants, which are
+// checked themselves.
+func checkFontsEmbedded(ctx *model.Context) error {
+	var missing []string
+	for _, entry := range ctx.Table {
+		if entry == nil || entry.Free {
+			continue
+		}
+		font, ok := entry.Object.(types.Dict)
+		if !ok || font.Type() == nil || *font.Type() != "Font" {
+			continue
+		}
+		if subtype := font.Subtype(); subtype != nil && (*subtype == "Type0" || *subtype == "Type3") {
+			continue
+		}
+		descriptor, err := ctx.DereferenceDict(font["FontDescriptor"])
+		if err == nil && descriptor != nil && hasFontFile(descriptor) {
+			continue
+		}
+		name := "unnamed"
+		if base := font.NameEntry("BaseFont"); base != nil {
+			name = *base
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %v", ErrFontNotEmbedded, missing)
+	}
+	return nil
+}
+
+func hasFontFile(descriptor types.Dict) bool {
+	for _, key := range []string{"FontFile", "FontFile2", "FontFile3"} {
+		if _, ok := descriptor.Find(key); ok {
+			return true
+		}
+	}
+	return false
+}
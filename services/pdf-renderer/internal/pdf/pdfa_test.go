@@ -0,0 +1,275 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chromePDF returns a one-page PDF shaped like Chrome's output: an embedded TrueType subset, a
+// transparency group and link annotations without flags, plus the features PDF/A forbids.
+func chromePDF(fontDescriptor string) []byte {
+	const content = "BT /F1 12 Tf 72 720 Td (Hello) Tj ET"
+	return assemblePDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R /OpenAction 8 0 R /Names << /JavaScript << /Names [(init) 8 0 R] >> >> >>",
+		"<< /Type /Pages /Count 1 /Kids [3 0 R] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >>" +
+			" /Group << /Type /Group /S /Transparency /CS /DeviceRGB >> /Annots [9 0 R 10 0 R] /AA << /O 8 0 R >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /TrueType /BaseFont /AAAAAA+Arial /FirstChar 32 /LastChar 126 /FontDescriptor 6 0 R >>",
+		fontDescriptor,
+		"<< /Length 4 /Length1 4 >>\nstream\nfont\nendstream",
+		"<< /Type /Action /S /JavaScript /JS (app.alert\\(1\\)) >>",
+		"<< /Type /Annot /Subtype /Link /Rect [72 700 200 720] /Border [0 0 0] /A << /S /URI /URI (https://example.com) >> >>",
+		"<< /Type /Annot /Subtype /Link /Rect [72 600 200 620] /F 2 /A 8 0 R >>",
+		"<< /Title (Contract) /Producer (Skia/PDF) /Creator (Chromium) >>",
+	})
+}
+
+const embeddedFont = "<< /Type /FontDescriptor /FontName /AAAAAA+Arial /Flags 32 /FontBBox [0 0 1000 1000]" +
+	" /ItalicAngle 0 /Ascent 900 /Descent -200 /CapHeight 700 /StemV 80 /FontFile2 7 0 R >>"
+
+func TestProcess_PDFA2B(t *testing.T) {
+	out, err := Process(chromePDF(embeddedFont), Options{PDFA: PDFA2B, Metadata: Metadata{Author: "Legal"}})
+	require.NoError(t, err)
+	validatePDFA2B(t, out)
+
+	ctx, err := api.ReadContext(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+	assert.Equal(t, "Contract", ctx.Title)
+	assert.Equal(t, "Legal", ctx.Author)
+
+	page, _, _, err := ctx.PageDict(1, false)
+	require.NoError(t, err)
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	require.NoError(t, err)
+	require.Len(t, annots, 2)
+	link, err := ctx.DereferenceDict(annots[0])
+	require.NoError(t, err)
+	assert.NotNil(t, link.DictEntry("A"), "URI actions are allowed")
+	hidden, err := ctx.DereferenceDict(annots[1])
+	require.NoError(t, err)
+	assert.Nil(t, hidden["A"], "JavaScript actions are removed")
+	assert.NotNil(t, page.DictEntry("Group"), "PDF/A-2 allows transparency groups")
+}
+
+func TestProcess_PDFA2B_FontNotEmbedded(t *testing.T) {
+	descriptor := strings.Replace(embeddedFont, " /FontFile2 7 0 R", "", 1)
+	_, err := Process(chromePDF(descriptor), Options{PDFA: PDFA2B})
+	require.ErrorIs(t, err, ErrFontNotEmbedded)
+	assert.Contains(t, err.Error(), "AAAAAA+Arial")
+}
+
+func TestProcess_UnsupportedPDFA(t *testing.T) {
+	_, err := Process(buildPDF(1), Options{PDFA: "1a"})
+	assert.ErrorIs(t, err, ErrUnsupportedPDFA)
+}
+
+func TestProcess_Zero(t *testing.T) {
+	data := buildPDF(1)
+	out, err := Process(data, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, data, out)
+}
+
+func TestSRGBProfile(t *testing.T) {
+	profile := sRGBProfile()
+	require.Greater(t, len(profile), 128)
+	assert.EqualValues(t, len(profile), binary.BigEndian.Uint32(profile), "size field")
+	assert.Equal(t, "mntr", string(profile[12:16]))
+	assert.Equal(t, "RGB ", string(profile[16:20]))
+	assert.Equal(t, "XYZ ", string(profile[20:24]))
+	assert.Equal(t, "acsp", string(profile[36:40]))
+
+	tags := binary.BigEndian.Uint32(profile[128:])
+	seen := map[string]bool{}
+	for i := 0; i < int(tags); i++ {
+		entry := profile[132+12*i:]
+		offset, size := binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:])
+		require.LessOrEqual(t, int(offset+size), len(profile), "tag %s", entry[:4])
+		seen[string(entry[:4])] = true
+	}
+	for _, sig := range []string{"desc", "cprt", "wtpt", "rXYZ", "gXYZ", "bXYZ", "rTRC", "gTRC", "bTRC"} {
+		assert.True(t, seen[sig], "required tag %s", sig)
+	}
+}
+
+var (
+	pdfHeader  = regexp.MustCompile(`^%PDF-1\.[0-7]\r?\n%(.{4})`)
+	xmpPDFAID  = `<pdfaid:part>%d</pdfaid:part>\s*<pdfaid:conformance>B</pdfaid:conformance>`
+	xmpElement = `<%s>%s</%s>`
+)
+
+// validatePDFA2B checks the structural requirements of ISO 19005-2 level B that post-processing
+// is responsible for. It does not look into content streams or font programs.
+func validatePDFA2B(t *testing.T, data []byte) {
+	t.Helper()
+	validatePDFA(t, data, 2)
+}
+
+// validatePDFA checks PDF/A-2b or, for part 3, PDF/A-3b (ISO 19005-3), which differs in
+// allowing associated files of any type.
+func validatePDFA(t *testing.T, data []byte, part int) {
+	t.Helper()
+
+	// 6.1.2: header with a binary comment.
+	header := pdfHeader.FindSubmatch(data)
+	require.NotNil(t, header, "file header")
+	for _, c := range header[1] {
+		assert.GreaterOrEqual(t, c, byte(0x80), "binary comment")
+	}
+
+	ctx, err := api.ReadContext(bytes.NewReader(data), config())
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+
+	// 6.1.3: file identifier, no encryption.
+	assert.NotEmpty(t, ctx.ID, "trailer /ID")
+	assert.Nil(t, ctx.Encrypt, "encryption")
+
+	root, err := ctx.Catalog()
+	require.NoError(t, err)
+
+	// 6.2.3: an output intent with an embedded RGB profile.
+	intents, err := ctx.DereferenceArray(root["OutputIntents"])
+	require.NoError(t, err)
+	require.Len(t, intents, 1, "OutputIntents")
+	intent, err := ctx.DereferenceDict(intents[0])
+	require.NoError(t, err)
+	assert.Equal(t, "GTS_PDFA1", *intent.NameEntry("S"))
+	profile, _, err := ctx.DereferenceStreamDict(intent["DestOutputProfile"])
+	require.NoError(t, err)
+	require.NotNil(t, profile, "DestOutputProfile")
+	assert.Equal(t, 3, *profile.IntEntry("N"))
+	require.NoError(t, profile.Decode())
+	assert.Equal(t, "acsp", string(profile.Content[36:40]))
+
+	// 6.6.2: an unfiltered XMP stream identifying the conformance level.
+	xmp, _, err := ctx.DereferenceStreamDict(root["Metadata"])
+	require.NoError(t, err)
+	require.NotNil(t, xmp, "catalog /Metadata")
+	_, filtered := xmp.Find("Filter")
+	assert.False(t, filtered, "metadata stream filter")
+	require.NoError(t, xmp.Decode())
+	packet := string(xmp.Content)
+	assert.Regexp(t, fmt.Sprintf(xmpPDFAID, part), packet)
+
+	// 6.6.3: the document information dictionary agrees with the XMP.
+	for _, field := range []struct{ info, xmp string }{
+		{ctx.Producer, "pdf:Producer"},
+		{ctx.Creator, "xmp:CreatorTool"},
+	} {
+		if field.info != "" {
+			assert.Contains(t, packet, fmt.Sprintf(xmpElement, field.xmp, xmlText(field.info), field.xmp))
+		}
+	}
+	if ctx.Title != "" {
+		assert.Contains(t, packet, `<rdf:li xml:lang="x-default">`+xmlText(ctx.Title)+`</rdf:li></rdf:Alt></dc:title>`)
+	}
+	if ctx.Author != "" {
+		assert.Contains(t, packet, `<dc:creator><rdf:Seq><rdf:li>`+xmlText(ctx.Author)+`</rdf:li>`)
+	}
+	for _, field := range []struct{ info, xmp string }{
+		{ctx.XRefTable.CreationDate, "xmp:CreateDate"},
+		{ctx.XRefTable.ModDate, "xmp:ModifyDate"},
+	} {
+		date, ok := types.DateTime(field.info, false)
+		require.True(t, ok, "info date %q", field.info)
+		assert.Contains(t, packet, fmt.Sprintf(xmpElement, field.xmp, date.Format("2006-01-02T15:04:05Z07:00"), field.xmp))
+	}
+
+	// 6.5.1, 6.6.1: no JavaScript, no document actions; 6.8: no embedded files in PDF/A-2.
+	assert.Nil(t, root["AA"], "catalog /AA")
+	if action, err := ctx.DereferenceDict(root["OpenAction"]); err == nil {
+		assert.False(t, forbiddenAction(action), "OpenAction")
+	}
+	if names, err := ctx.DereferenceDict(root["Names"]); err == nil && names != nil {
+		assert.Nil(t, names["JavaScript"], "JavaScript name tree")
+		if part == 2 {
+			assert.Nil(t, names["EmbeddedFiles"], "EmbeddedFiles name tree")
+		}
+	}
+	// ISO 19005-3, 6.8: each embedded file is an associated file with a MIME type and a date.
+	if part == 3 {
+		validateAssociatedFiles(t, ctx)
+	}
+
+	// 6.9: named optional content configurations without auto state changes.
+	if props, err := ctx.DereferenceDict(root["OCProperties"]); err == nil && props != nil {
+		config, err := ctx.DereferenceDict(props["D"])
+		require.NoError(t, err)
+		assert.NotEmpty(t, config.StringEntry("Name"), "optional content configuration /Name")
+		assert.Nil(t, config["AS"], "optional content configuration /AS")
+	}
+
+	// 6.3.2, 6.5.2: printable annotations without forbidden actions; 6.2.11.4: embedded fonts.
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		page, _, _, err := ctx.PageDict(pageNr, false)
+		require.NoError(t, err)
+		assert.Nil(t, page["AA"], "page %d /AA", pageNr)
+		validateAnnotations(t, ctx, page)
+	}
+	assert.NoError(t, checkFontsEmbedded(ctx))
+}
+
+func validateAssociatedFiles(t *testing.T, ctx *model.Context) {
+	t.Helper()
+	root, err := ctx.Catalog()
+	require.NoError(t, err)
+	associated := map[types.IndirectRef]bool{}
+	af, err := ctx.DereferenceArray(root["AF"])
+	require.NoError(t, err)
+	for _, o := range af {
+		associated[o.(types.IndirectRef)] = true
+	}
+	require.NoError(t, ctx.LocateNameTree("EmbeddedFiles", false))
+	tree := ctx.Names["EmbeddedFiles"]
+	if tree == nil {
+		return
+	}
+	require.NoError(t, tree.Process(ctx.XRefTable, func(_ *model.XRefTable, name string, o *types.Object) error {
+		ref, ok := (*o).(types.IndirectRef)
+		assert.True(t, ok && associated[ref], "%s is listed in /AF", name)
+		spec, err := ctx.DereferenceDict(*o)
+		require.NoError(t, err)
+		assert.NotNil(t, spec.NameEntry("AFRelationship"), "%s /AFRelationship", name)
+		assert.NotNil(t, spec.StringEntry("F"), "%s /F", name)
+		assert.NotNil(t, spec.StringEntry("UF"), "%s /UF", name)
+		ef, err := ctx.DereferenceDict(spec["EF"])
+		require.NoError(t, err)
+		sd, _, err := ctx.DereferenceStreamDict(ef["F"])
+		require.NoError(t, err)
+		assert.NotNil(t, sd.NameEntry("Subtype"), "%s MIME type", name)
+		assert.NotNil(t, sd.DictEntry("Params").StringEntry("ModDate"), "%s /ModDate", name)
+		return nil
+	}))
+}
+
+func validateAnnotations(t *testing.T, ctx *model.Context, page types.Dict) {
+	t.Helper()
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	require.NoError(t, err)
+	for _, obj := range annots {
+		annot, err := ctx.DereferenceDict(obj)
+		require.NoError(t, err)
+		if action, err := ctx.DereferenceDict(annot["A"]); err == nil {
+			assert.False(t, forbiddenAction(action), "annotation action")
+		}
+		if *annot.Subtype() == "Popup" {
+			continue
+		}
+		flags := annot.IntEntry("F")
+		require.NotNil(t, flags, "annotation /F")
+		assert.Equal(t, annotPrint, *flags&(annotPrint|annotForbiddenFlags), "annotation flags")
+	}
+}
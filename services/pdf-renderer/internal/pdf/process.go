@@ -0,0 +1,138 @@
+package pdf
+
+import (
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// PDF/A conformance levels supported by Options.PDFA.
+const (
+	PDFA2B = "2b"
+	PDFA3B = "3b" // like PDFA2B, but files of any type may be attached
+)
+
+// Options are the edits applied to a rendered PDF in a single read/write pass.
+type Options struct {
+	Metadata Metadata
+
+	// PDFA converts the document to the given PDF/A conformance level ("" for none).
+	PDFA string
+
+	// Watermark is stamped on the pages before the PDF/A conversion, if set.
+	Watermark *Watermark
+
+	// FormFields are added as interactive AcroForm fields. Their appearances use Helvetica, which
+	// is not embedded, so they cannot be combined with PDFA.
+	FormFields []FormField
+
+	// OutlineDepth limits the document outline to that many levels (0 keeps it as is).
+	OutlineDepth int
+
+	// Attachments are embedded as associated files, after the PDF/A conversion. PDFA2B allows
+	// none.
+	Attachments []Attachment
+
+	// FacturX embeds a Factur-X invoice and describes it in the XMP metadata. It requires
+	// PDFA3B.
+	FacturX *FacturX
+
+	// Optimize shrinks the document or linearizes it, after the edits above.
+	Optimize Optimization
+
+	// Signature signs the document, if set. Signing is the last step: any later change to the
+	// file invalidates the signature.
+	Signature *Signature
+}
+
+// IsZero reports whether opts leave the document unchanged.
+func (opts Options) IsZero() bool {
+	return opts.Metadata == Metadata{} && opts.PDFA == "" && opts.Watermark.IsZero() && len(opts.FormFields) == 0 &&
+		opts.OutlineDepth == 0 && len(opts.Attachments) == 0 && opts.FacturX == nil && opts.Optimize.IsZero() && opts.Signature == nil
+}
+
+// Process returns data with opts applied. data is returned as is if opts are zero.
+func Process(data []byte, opts Options) ([]byte, error) {
+	if opts.IsZero() {
+		return data, nil
+	}
+	if opts.Optimize.Compress && opts.Optimize.Linearize {
+		return nil, ErrLinearizeCompressed
+	}
+	if opts.Optimize.Compress && opts.Signature != nil {
+		return nil, ErrSignCompressed
+	}
+	if opts.FacturX != nil && opts.PDFA != PDFA3B {
+		return nil, ErrFacturXNotPDFA3
+	}
+	if len(opts.Attachments) > 0 && opts.PDFA == PDFA2B {
+		return nil, ErrAttachmentsPDFA2
+	}
+	out, err := edit(data, func(ctx *model.Context, now time.Time) error {
+		if opts.OutlineDepth > 0 {
+			if err := limitOutline(ctx, opts.OutlineDepth); err != nil {
+				return err
+			}
+		}
+		if !opts.Watermark.IsZero() {
+			if err := applyWatermark(ctx, opts.Watermark); err != nil {
+				return err
+			}
+		}
+		if len(opts.FormFields) > 0 {
+			if err := addFormFields(ctx, opts.FormFields); err != nil {
+				return err
+			}
+		}
+		if opts.Signature != nil {
+			// Added before the PDF/A conversion, which then checks the appearance's font.
+			if err := addSignatureField(ctx, opts.Signature, now); err != nil {
+				return err
+			}
+		}
+		if err := applyDocumentInfo(ctx, opts, now); err != nil {
+			return err
+		}
+		if err := addAttachments(ctx, opts.attachments(), now); err != nil {
+			return err
+		}
+		return opts.Optimize.apply(ctx)
+	})
+	if err == nil && opts.Optimize.Linearize {
+		out, err = linearize(out)
+	}
+	if err != nil || opts.Signature == nil {
+		return out, err
+	}
+	return sign(out, opts.Signature.Signer)
+}
+
+// applyDocumentInfo converts the document to opts.PDFA, if set, and writes opts.Metadata with
+// the conformance level the conversion claims.
+func applyDocumentInfo(ctx *model.Context, opts Options, now time.Time) error {
+	m := opts.Metadata
+	switch opts.PDFA {
+	case "":
+		return applyMetadata(ctx, m, now, 0, "", nil)
+	case PDFA2B, PDFA3B:
+		if err := convertPDFA(ctx); err != nil {
+			return err
+		}
+		m.XMP = true
+		part := 2
+		if opts.PDFA == PDFA3B {
+			part = 3
+		}
+		return applyMetadata(ctx, m, now, part, "B", opts.FacturX)
+	default:
+		return ErrUnsupportedPDFA
+	}
+}
+
+// attachments returns opts.Attachments and the Factur-X invoice, if any.
+func (opts Options) attachments() []Attachment {
+	if opts.FacturX == nil {
+		return opts.Attachments
+	}
+	return append(append([]Attachment(nil), opts.Attachments...), opts.FacturX.attachment())
+}
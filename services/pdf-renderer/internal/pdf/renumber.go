@@ -0,0 +1,71 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// renumbering maps the object numbers of a document to those of a file written from a selection
+// of its objects.
+type renumbering map[int]int
+
+// ref returns the renumbered reference to the old object nr; references to objects that are not
+// written become null.
+func (r renumbering) ref(nr int) types.Object {
+	if n, ok := r[nr]; ok {
+		return *types.NewIndirectRef(n, 0)
+	}
+	return nil
+}
+
+// rewrite returns a copy of o with its references renumbered.
+func (r renumbering) rewrite(o types.Object) types.Object {
+	switch o := o.(type) {
+	case types.IndirectRef:
+		return r.ref(o.ObjectNumber.Value())
+	case types.Dict:
+		d := types.NewDict()
+		for k, v := range o {
+			d[k] = r.rewrite(v)
+		}
+		return d
+	case types.Array:
+		a := make(types.Array, len(o))
+		for i, v := range o {
+			a[i] = r.rewrite(v)
+		}
+		return a
+	}
+	return o
+}
+
+// object returns o written as indirect object n.
+func (r renumbering) object(o types.Object, n int) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d 0 obj\n", n)
+	switch o := o.(type) {
+	case types.StreamDict:
+		if o.Raw == nil {
+			if err := o.Encode(); err != nil {
+				return nil, err
+			}
+		}
+		raw := o.Raw
+		d := r.rewrite(o.Dict).(types.Dict)
+		d["Length"] = types.Integer(len(raw))
+		b.WriteString(d.PDFString())
+		b.WriteString("\nstream\n")
+		b.Write(raw)
+		b.WriteString("\nendstream")
+	default:
+		if o := r.rewrite(o); o != nil {
+			b.WriteString(o.PDFString())
+		} else {
+			b.WriteString("null")
+		}
+	}
+	b.WriteString("\nendobj\n")
+	return b.Bytes(), nil
+}
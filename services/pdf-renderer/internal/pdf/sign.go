@@ -0,0 +1,285 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// ErrSignaturePlaceholder means the written document does not contain the signature
+// placeholders exactly once, so there is nothing unambiguous to sign.
+var ErrSignaturePlaceholder = errors.New("pdf: signature placeholder not found")
+
+const (
+	// byteRangePlaceholder is written as the signature's ByteRange and replaced, padded to the
+	// same length, once the offsets are known.
+	byteRangePlaceholder = "/ByteRange[0 9999999999 9999999999 9999999999]"
+
+	// contentsOverhead is the room reserved in Contents beyond the certificates: the signature
+	// value (512 bytes for RSA-4096), the signed attributes and the CMS structure.
+	contentsOverhead = 4096
+
+	signatureBoxMargin = 36 // points from the page edges
+	signatureBoxInset  = 4  // points between the border and the text
+	signatureFontSize  = 9  // points, the largest used in signature boxes
+)
+
+// Signature signs the document with a PAdES baseline B-B signature (ETSI EN 319 142-1): a
+// detached CAdES signature over the whole file, embedding the signing certificate and its chain.
+type Signature struct {
+	Signer *Signer
+
+	Reason      string
+	Location    string
+	ContactInfo string
+
+	// Box shows the signature on a page; without it the signature is invisible.
+	Box *SignatureBox
+}
+
+// SignatureBox is the visible appearance of a signature: the signer's name, the signing time,
+// the reason and the location, drawn in Helvetica. Helvetica is not embedded, so visible
+// signatures cannot be combined with PDF/A.
+type SignatureBox struct {
+	Page     int     // 1-based; 0 or a page beyond the document means the last page
+	Position string  // Position* constant except PositionTiled
+	Width    float64 // points
+	Height   float64 // points
+}
+
+// ValidSignatureBoxPosition reports whether p is a position a signature box can take.
+func ValidSignatureBoxPosition(p string) bool {
+	return p != PositionTiled && ValidPosition(p)
+}
+
+// addSignatureField adds a signature field whose value is a signature dictionary with
+// placeholders for ByteRange and Contents, which sign fills in after writing.
+func addSignatureField(ctx *model.Context, s *Signature, now time.Time) error {
+	size := contentsOverhead + len(s.Signer.Certificate.Raw)
+	for _, cert := range s.Signer.Chain {
+		size += len(cert.Raw)
+	}
+	sig := types.NewDict()
+	sig.InsertName("Type", "Sig")
+	sig.InsertName("Filter", "Adobe.PPKLite")
+	sig.InsertName("SubFilter", "ETSI.CAdES.detached")
+	sig.Insert("ByteRange", types.Array{types.Integer(0), types.Integer(9999999999), types.Integer(9999999999), types.Integer(9999999999)})
+	sig.Insert("Contents", types.HexLiteral(strings.Repeat("0", 2*size)))
+	sig.InsertString("M", types.DateString(now))
+	for key, value := range map[string]string{"Reason": s.Reason, "Location": s.Location, "ContactInfo": s.ContactInfo} {
+		if value == "" {
+			continue
+		}
+		escaped, err := types.EscapedUTF16String(value)
+		if err != nil {
+			return err
+		}
+		sig.Insert(key, types.StringLiteral(*escaped))
+	}
+	sigRef, err := ctx.IndRefForNewObject(sig)
+	if err != nil {
+		return err
+	}
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	form, err := ctx.DereferenceDict(root["AcroForm"])
+	if err != nil {
+		return err
+	}
+	if form == nil {
+		form = types.NewDict()
+		root.Update("AcroForm", form)
+	}
+	fields, err := ctx.DereferenceArray(form["Fields"])
+	if err != nil {
+		return err
+	}
+
+	pageNr := 1
+	if s.Box != nil {
+		pageNr = s.Box.Page
+		if pageNr <= 0 || pageNr > ctx.PageCount {
+			pageNr = ctx.PageCount
+		}
+	}
+	page, pageRef, _, err := ctx.PageDict(pageNr, false)
+	if err != nil {
+		return err
+	}
+
+	widget := types.NewDict()
+	widget.InsertName("Type", "Annot")
+	widget.InsertName("Subtype", "Widget")
+	widget.InsertName("FT", "Sig")
+	widget.InsertString("T", fmt.Sprintf("Signature%d", len(fields)+1))
+	widget.Insert("V", *sigRef)
+	widget.Insert("P", *pageRef)
+	widget.InsertInt("F", annotPrint|annotLocked)
+	if s.Box == nil {
+		// A zero-sized widget needs no appearance (ISO 19005-2, 6.3.3).
+		widget.Insert("Rect", types.NewNumberArray(0, 0, 0, 0))
+	} else {
+		dims, err := ctx.PageDims()
+		if err != nil {
+			return err
+		}
+		rect := s.Box.rect(dims[pageNr-1])
+		appearance, err := signatureAppearance(ctx, s, rect, now)
+		if err != nil {
+			return err
+		}
+		widget.Insert("Rect", types.NewNumberArray(rect.LL.X, rect.LL.Y, rect.UR.X, rect.UR.Y))
+		widget.Insert("AP", types.Dict{"N": *appearance})
+	}
+	widgetRef, err := ctx.IndRefForNewObject(widget)
+	if err != nil {
+		return err
+	}
+
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		return err
+	}
+	page.Update("Annots", append(annots, *widgetRef))
+	form.Update("Fields", append(fields, *widgetRef))
+	form.Update("SigFlags", types.Integer(3)) // SignaturesExist | AppendOnly
+	return nil
+}
+
+// rect returns the box's rectangle on a page of the given size.
+func (b *SignatureBox) rect(page types.Dim) *types.Rectangle {
+	x := (page.Width - b.Width) / 2
+	y := (page.Height - b.Height) / 2
+	switch b.Position {
+	case PositionTopLeft, PositionBottomLeft:
+		x = signatureBoxMargin
+	case PositionTopRight, PositionBottomRight:
+		x = page.Width - signatureBoxMargin - b.Width
+	}
+	switch b.Position {
+	case PositionTopLeft, PositionTopRight:
+		y = page.Height - signatureBoxMargin - b.Height
+	case PositionBottomLeft, PositionBottomRight:
+		y = signatureBoxMargin
+	}
+	return types.NewRectangle(x, y, x+b.Width, y+b.Height)
+}
+
+// signatureAppearance returns the form XObject drawing a signature box of the given size: a
+// border and as many lines of text as fit, clipped to the box.
+func signatureAppearance(ctx *model.Context, s *Signature, rect *types.Rectangle, now time.Time) (*types.IndirectRef, error) {
+	name := s.Signer.Certificate.Subject.CommonName
+	if name == "" {
+		name = s.Signer.Certificate.Subject.String()
+	}
+	lines := []string{"Digitally signed by " + name, "Date: " + now.Format("2006-01-02 15:04:05 -07:00")}
+	if s.Reason != "" {
+		lines = append(lines, "Reason: "+s.Reason)
+	}
+	if s.Location != "" {
+		lines = append(lines, "Location: "+s.Location)
+	}
+
+	w, h := rect.Width(), rect.Height()
+	fontSize := min(signatureFontSize, (h-2*signatureBoxInset)/(1.25*float64(len(lines))))
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "q 0.5 w 0.2 0.2 0.2 RG 0.25 0.25 %.2f %.2f re S\n", w-0.5, h-0.5)
+	fmt.Fprintf(&b, "0 0 %.2f %.2f re W n\n", w, h)
+	fmt.Fprintf(&b, "BT /Helv %.2f Tf %.2f TL 0.1 0.1 0.1 rg %d %.2f Td\n", fontSize, 1.25*fontSize, signatureBoxInset, h-signatureBoxInset-fontSize)
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("T* ")
+		}
+		fmt.Fprintf(&b, "(%s) Tj\n", winAnsiText(line))
+	}
+	b.WriteString("ET Q\n")
+
+	font := types.NewDict()
+	font.InsertName("Type", "Font")
+	font.InsertName("Subtype", "Type1")
+	font.InsertName("BaseFont", "Helvetica")
+	font.InsertName("Encoding", "WinAnsiEncoding")
+	fontRef, err := ctx.IndRefForNewObject(font)
+	if err != nil {
+		return nil, err
+	}
+
+	sd, err := ctx.NewStreamDictForBuf(b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	sd.InsertName("Type", "XObject")
+	sd.InsertName("Subtype", "Form")
+	sd.Insert("BBox", types.NewNumberArray(0, 0, w, h))
+	sd.Insert("Resources", types.Dict{"Font": types.Dict{"Helv": *fontRef}})
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	return ctx.IndRefForNewObject(*sd)
+}
+
+// winAnsiText returns s as the body of a string literal in WinAnsiEncoding, which matches
+// Latin-1 for the characters it shares; others become '?'.
+func winAnsiText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// sign fills in the placeholders addSignatureField left in data: the ByteRange covering
+// everything but the Contents value, then the CMS signature over those bytes.
+func sign(data []byte, s *Signer) ([]byte, error) {
+	start := bytes.Index(data, []byte(byteRangePlaceholder))
+	if start < 0 || bytes.Count(data, []byte(byteRangePlaceholder)) != 1 {
+		return nil, ErrSignaturePlaceholder
+	}
+	i := bytes.Index(data[start:], []byte("/Contents<"))
+	if i < 0 {
+		return nil, ErrSignaturePlaceholder
+	}
+	lt := start + i + len("/Contents")
+	n := bytes.IndexByte(data[lt:], '>')
+	if n < 0 {
+		return nil, ErrSignaturePlaceholder
+	}
+	gt := lt + n
+
+	out := bytes.Clone(data)
+	byteRange := fmt.Sprintf("/ByteRange[0 %d %d %d]", lt, gt+1, len(out)-gt-1)
+	copy(out[start:], byteRange+strings.Repeat(" ", len(byteRangePlaceholder)-len(byteRange)))
+
+	h := sha256.New()
+	h.Write(out[:lt])
+	h.Write(out[gt+1:])
+	cms, err := s.signCMS(h.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("pdf: sign: %w", err)
+	}
+	if 2*len(cms) > gt-lt-1 {
+		return nil, fmt.Errorf("pdf: sign: signature of %d bytes exceeds the space reserved", len(cms))
+	}
+	hex.Encode(out[lt+1:], cms)
+	return out, nil
+}
@@ -0,0 +1,245 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hhrutter/pkcs7"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testPKI is a self-signed CA, an intermediate CA and a document signing certificate issued by
+// the intermediate.
+type testPKI struct {
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	leaf         *x509.Certificate
+	key          crypto.Signer
+}
+
+func newTestPKI(t *testing.T, key crypto.Signer) *testPKI {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	issue := func(serial int64, subject string, pub crypto.PublicKey, parent *x509.Certificate, parentKey crypto.Signer, ca bool) *x509.Certificate {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: subject, Organization: []string{"Test"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		}
+		if ca {
+			tmpl.IsCA = true
+			tmpl.BasicConstraintsValid = true
+			tmpl.KeyUsage = x509.KeyUsageCertSign
+		}
+		if parent == nil {
+			parent = tmpl
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert
+	}
+	root := issue(1, "Test Root CA", caKey.Public(), nil, caKey, true)
+	intermediate := issue(2, "Test Intermediate CA", caKey.Public(), root, caKey, true)
+	return &testPKI{root: root, intermediate: intermediate, leaf: issue(3, "Jane Signer", key.Public(), intermediate, caKey, false), key: key}
+}
+
+func (p *testPKI) signer(t *testing.T) *Signer {
+	t.Helper()
+	s, err := NewSigner(p.leaf, p.key, []*x509.Certificate{p.intermediate})
+	require.NoError(t, err)
+	return s
+}
+
+func rsaKey(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func ecdsaKey(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+var byteRangePattern = regexp.MustCompile(`/ByteRange\[0 (\d+) (\d+) (\d+)\] *`)
+
+// verifySignature checks that data carries one signature covering the whole file, made by a
+// certificate chaining up to root, and returns the signature dictionary.
+func verifySignature(t *testing.T, data []byte, root *x509.Certificate) model.Signature {
+	t.Helper()
+	m := byteRangePattern.FindSubmatch(data)
+	require.NotNil(t, m, "ByteRange")
+	var r [3]int
+	for i := range r {
+		r[i], _ = strconv.Atoi(string(m[i+1]))
+	}
+	require.Equal(t, len(data), r[1]+r[2], "the byte range ends at the end of the file")
+	require.Equal(t, byte('<'), data[r[0]])
+	require.Equal(t, byte('>'), data[r[1]-1])
+
+	contents, err := hex.DecodeString(string(data[r[0]+1 : r[1]-1]))
+	require.NoError(t, err)
+	var der asn1.RawValue // without the zero padding
+	_, err = asn1.Unmarshal(contents, &der)
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(der.FullBytes)
+	require.NoError(t, err)
+	p7.Content = append(bytes.Clone(data[:r[0]]), data[r[1]:]...)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	require.NoError(t, p7.VerifyWithChain(roots))
+
+	// pdfcpu's validator also checks the PAdES structure of the signature dictionary.
+	ctx, err := api.ReadContext(bytes.NewReader(data), config())
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+	model.UserCertPool = roots
+	t.Cleanup(func() { model.UserCertPool = nil })
+	results, err := pdfcpu.ValidateSignatures(bytes.NewReader(data), ctx, true)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	// Offline, revocation cannot be checked, so the status stays unknown rather than valid (and
+	// the PAdES level unreported).
+	result := results[0]
+	assert.NotEqual(t, model.SignatureStatusInvalid, result.Status, "%s", result)
+	assert.Equal(t, model.False, result.DocModified, "%s", result)
+	require.Len(t, result.Details.Signers, 1)
+	assert.Equal(t, model.True, result.Details.Signers[0].Certificate.Trust.Status, "%s", result)
+	return result.Signature
+}
+
+func TestProcess_Signature(t *testing.T) {
+	for name, key := range map[string]crypto.Signer{"RSA": rsaKey(t), "ECDSA": ecdsaKey(t)} {
+		pki := newTestPKI(t, key)
+		out, err := Process(buildPDF(2), Options{Signature: &Signature{Signer: pki.signer(t), Reason: "Approved", Location: "Zürich"}})
+		require.NoError(t, err, name)
+		sig := verifySignature(t, out, pki.root)
+		assert.False(t, sig.Visible, name)
+		assert.Contains(t, string(out), "/SubFilter/ETSI.CAdES.detached", name)
+		assert.Contains(t, string(out), "/SigFlags 3", name)
+	}
+}
+
+func TestProcess_VisibleSignature(t *testing.T) {
+	pki := newTestPKI(t, ecdsaKey(t))
+	s := &Signature{Signer: pki.signer(t), Reason: "Approved (final)", Box: &SignatureBox{Page: 9, Position: PositionBottomRight, Width: 200, Height: 50}}
+	out, err := Process(buildPDF(3), Options{Metadata: Metadata{Title: "Report"}, Signature: s})
+	require.NoError(t, err)
+	sig := verifySignature(t, out, pki.root)
+	assert.True(t, sig.Visible)
+	assert.Equal(t, 3, sig.PageNr, "pages beyond the document mean the last page")
+
+	ctx, err := api.ReadContext(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+	page, _, _, err := ctx.PageDict(3, false)
+	require.NoError(t, err)
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	require.NoError(t, err)
+	require.Len(t, annots, 1)
+	widget, err := ctx.DereferenceDict(annots[0])
+	require.NoError(t, err)
+	assert.Equal(t, types.NewNumberArray(359, 36, 559, 86), widget.ArrayEntry("Rect"), "bottom right, 36pt from the edges")
+}
+
+func TestProcess_SignaturePDFA2B(t *testing.T) {
+	pki := newTestPKI(t, rsaKey(t))
+	out, err := Process(chromePDF(embeddedFont), Options{PDFA: PDFA2B, Signature: &Signature{Signer: pki.signer(t)}})
+	require.NoError(t, err)
+	verifySignature(t, out, pki.root)
+	validatePDFA2B(t, out)
+
+	// The appearance of a visible signature uses Helvetica, which is not embedded.
+	s := &Signature{Signer: pki.signer(t), Box: &SignatureBox{Position: PositionCenter, Width: 200, Height: 50}}
+	_, err = Process(chromePDF(embeddedFont), Options{PDFA: PDFA2B, Signature: s})
+	assert.ErrorIs(t, err, ErrFontNotEmbedded)
+}
+
+func TestNewSigner(t *testing.T) {
+	pki := newTestPKI(t, rsaKey(t))
+	_, err := NewSigner(pki.leaf, rsaKey(t), nil)
+	assert.ErrorContains(t, err, "does not match")
+
+	_, err = NewSigner(pki.intermediate, pki.key, nil)
+	assert.Error(t, err, "a CA certificate without digital signature usage")
+}
+
+func TestLoadSigner(t *testing.T) {
+	pki := newTestPKI(t, ecdsaKey(t))
+	dir := t.TempDir()
+	var certs bytes.Buffer
+	for _, cert := range []*x509.Certificate{pki.leaf, pki.intermediate} {
+		require.NoError(t, pem.Encode(&certs, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(pki.key)
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, certs.Bytes(), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	s, err := LoadSigner(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, pki.leaf, s.Certificate)
+	assert.Equal(t, []*x509.Certificate{pki.intermediate}, s.Chain)
+
+	_, err = LoadSigner(certFile, certFile)
+	assert.ErrorContains(t, err, "no private key")
+	_, err = LoadSigner(filepath.Join(dir, "missing.pem"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestLoadPKCS12(t *testing.T) {
+	pki := newTestPKI(t, rsaKey(t))
+	data, err := pkcs12.Modern.Encode(pki.key, pki.leaf, []*x509.Certificate{pki.intermediate}, "secret")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "signer.p12")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+
+	s, err := LoadPKCS12(file, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, pki.leaf, s.Certificate)
+	assert.Equal(t, []*x509.Certificate{pki.intermediate}, s.Chain)
+
+	_, err = LoadPKCS12(file, "wrong")
+	assert.Error(t, err)
+}
+
+func TestValidSignatureBoxPosition(t *testing.T) {
+	assert.True(t, ValidSignatureBoxPosition(PositionTopLeft))
+	assert.False(t, ValidSignatureBoxPosition(PositionTiled))
+	assert.False(t, ValidSignatureBoxPosition("middle"))
+}
+
+func TestWinAnsiText(t *testing.T) {
+	assert.Equal(t, "Z\xfcrich \\(CH\\) \\\\ ?", winAnsiText("Zürich (CH) \\ 東"))
+}
@@ -0,0 +1,130 @@
+package pdf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Signer is an X.509 certificate and its private key, used to sign PDFs (see Signature).
+type Signer struct {
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate // intermediate certificates, embedded in every signature
+	Key         crypto.Signer       // RSA or ECDSA
+}
+
+// NewSigner checks that key belongs to cert and may be used for signing documents.
+func NewSigner(cert *x509.Certificate, key crypto.PrivateKey, chain []*x509.Certificate) (*Signer, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("pdf: signing key cannot sign")
+	}
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(cert.PublicKey) {
+			return nil, errors.New("pdf: signing key does not match the certificate")
+		}
+	default:
+		return nil, fmt.Errorf("pdf: unsupported signing key type %T (use RSA or ECDSA)", pub)
+	}
+	// Without a key usage extension every usage is allowed.
+	if cert.KeyUsage != 0 && cert.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment) == 0 {
+		return nil, errors.New("pdf: certificate is not valid for digital signatures")
+	}
+	return &Signer{Certificate: cert, Chain: chain, Key: signer}, nil
+}
+
+// LoadSigner reads a PEM certificate file (the signing certificate first, then optionally its
+// chain) and a PEM private key file (PKCS #8, PKCS #1 or SEC 1).
+func LoadSigner(certFile, keyFile string) (*Signer, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	certs, key, err := parsePEM(append(append(certPEM, '\n'), keyPEM...))
+	if err != nil {
+		return nil, err
+	}
+	return newSignerFromBundle(certs, key)
+}
+
+// LoadPKCS12 reads a PKCS #12 (.p12, .pfx) file holding the signing certificate, its key and
+// optionally its chain.
+func LoadPKCS12(file, password string) (*Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("pdf: %s: %w", file, err)
+	}
+	return NewSigner(cert, key, chain)
+}
+
+// newSignerFromBundle picks the certificate matching key as the signing certificate; the others
+// form the chain.
+func newSignerFromBundle(certs []*x509.Certificate, key crypto.PrivateKey) (*Signer, error) {
+	if key == nil {
+		return nil, errors.New("pdf: no private key found")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("pdf: signing key cannot sign")
+	}
+	for i, cert := range certs {
+		pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(cert.PublicKey) {
+			continue
+		}
+		chain := append(append([]*x509.Certificate{}, certs[:i]...), certs[i+1:]...)
+		return NewSigner(cert, key, chain)
+	}
+	return nil, errors.New("pdf: no certificate matches the private key")
+}
+
+func parsePEM(data []byte) (certs []*x509.Certificate, key crypto.PrivateKey, err error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, key, nil
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("pdf: certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			if key, err = parsePrivateKey(block.Bytes); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("pdf: unsupported private key encoding")
+}
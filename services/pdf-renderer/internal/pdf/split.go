@@ -0,0 +1,464 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Split modes accepted by ParseSplit.
+const (
+	SplitPerPage = "per_page"
+	SplitEvery   = "every"  // every:N
+	SplitRanges  = "ranges" // ranges:1-2,3-5
+)
+
+var (
+	// ErrInvalidSplit means a split is not one of the forms ParseSplit accepts.
+	ErrInvalidSplit = errors.New("pdf: split must be 'per_page', 'every:N' or 'ranges:1-2,3-5'")
+
+	// ErrNoParts means none of the ranges of a split lies within the document.
+	ErrNoParts = errors.New("pdf: no split range lies within the document")
+)
+
+// wholeDocumentKeys are the catalog entries that index the pages of the whole document. A part
+// drops them rather than carry references to pages it does not contain.
+var wholeDocumentKeys = []string{"Outlines", "PageLabels", "StructTreeRoot", "MarkInfo", "Threads"}
+
+// PageRange is a range of pages, numbered from 1.
+type PageRange struct {
+	First, Last int
+}
+
+// Split cuts a document into parts: one every Every pages, or one per range in Ranges.
+type Split struct {
+	Every  int
+	Ranges []PageRange // ascending within a range; ranges may overlap
+}
+
+// ParseSplit reads a split in the form "per_page", "every:N" or "ranges:1-2,3-5".
+func ParseSplit(s string) (Split, error) {
+	mode, arg, _ := strings.Cut(strings.TrimSpace(s), ":")
+	switch strings.ToLower(mode) {
+	case SplitPerPage:
+		if arg != "" {
+			return Split{}, ErrInvalidSplit
+		}
+		return Split{Every: 1}, nil
+	case SplitEvery:
+		n, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil || n < 1 {
+			return Split{}, ErrInvalidSplit
+		}
+		return Split{Every: n}, nil
+	case SplitRanges:
+		if !ValidPageRange(arg) {
+			return Split{}, ErrInvalidSplit
+		}
+		var split Split
+		for _, part := range strings.Split(arg, ",") {
+			first, last, _ := parsePageRangePart(part)
+			split.Ranges = append(split.Ranges, PageRange{First: first, Last: last})
+		}
+		return split, nil
+	}
+	return Split{}, ErrInvalidSplit
+}
+
+// IsZero reports whether s leaves the document in one piece.
+func (s Split) IsZero() bool {
+	return s.Every == 0 && len(s.Ranges) == 0
+}
+
+// Parts returns the page ranges s cuts a pageCount page document into. Ranges are clipped to the
+// document; ranges beyond it, and ranges that repeat an earlier one once clipped, are left out.
+func (s Split) Parts(pageCount int) []PageRange {
+	var parts []PageRange
+	if s.Every > 0 {
+		for first := 1; first <= pageCount; first += s.Every {
+			parts = append(parts, PageRange{First: first, Last: min(first+s.Every-1, pageCount)})
+		}
+		return parts
+	}
+	for _, r := range s.Ranges {
+		if r.First > pageCount {
+			continue
+		}
+		r.Last = min(r.Last, pageCount)
+		if !slices.Contains(parts, r) {
+			parts = append(parts, r)
+		}
+	}
+	return parts
+}
+
+// Part is a document cut from a larger one.
+type Part struct {
+	Pages PageRange
+	Data  []byte
+}
+
+// SplitPages cuts data into the parts s describes. The document is parsed once; each part is
+// written with the pages of its range and the objects they use, and keeps the catalog
+// (metadata, output intents) and the document information unchanged, so PDF/A documents yield
+// PDF/A parts. Outlines, page labels and the structure tree describe the whole document and are
+// dropped, as are links to pages outside the part. Parts use a classic cross-reference table;
+// parts of a linearized document are linearized again. Signatures do not survive splitting.
+func SplitPages(data []byte, s Split) (_ []Part, err error) {
+	defer recoverPanic(&err)
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), config())
+	if err != nil {
+		return nil, fmt.Errorf("pdf: read: %w", err)
+	}
+	if ctx.Encrypt != nil {
+		return nil, errors.New("pdf: split: encrypted documents are not supported")
+	}
+	ranges := s.Parts(ctx.PageCount)
+	if len(ranges) == 0 {
+		return nil, ErrNoParts
+	}
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	sp, err := newSplitter(ctx, bytes.TrimRight(header, "\r"))
+	if err != nil {
+		return nil, fmt.Errorf("pdf: split: %w", err)
+	}
+	parts := make([]Part, 0, len(ranges))
+	for _, r := range ranges {
+		out, err := sp.part(r)
+		if err == nil && ctx.Read.Linearized {
+			out, err = linearize(out)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pdf: split pages %d-%d: %w", r.First, r.Last, err)
+		}
+		parts = append(parts, Part{Pages: r, Data: out})
+	}
+	return parts, nil
+}
+
+// splitter writes parts of a parsed document. The document itself is not changed, so one parse
+// serves every part: what differs per part is substituted while writing.
+type splitter struct {
+	ctx    *model.Context
+	header []byte
+	pages  []int        // page objects in page order
+	isPage map[int]bool // page objects
+	nodes  map[int]bool // intermediate page tree nodes
+	treeNr int          // root of the page tree
+}
+
+func newSplitter(ctx *model.Context, header []byte) (*splitter, error) {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	treeRef, ok := root["Pages"].(types.IndirectRef)
+	if !ok {
+		return nil, errors.New("page tree is not an indirect object")
+	}
+	tree, err := ctx.DereferenceDict(treeRef)
+	if err != nil {
+		return nil, err
+	}
+	s := &splitter{ctx: ctx, header: header, isPage: map[int]bool{}, nodes: map[int]bool{}, treeNr: treeRef.ObjectNumber.Value()}
+	s.nodes[s.treeNr] = true
+	if err := s.collectPages(tree); err != nil {
+		return nil, err
+	}
+	if len(s.pages) != ctx.PageCount {
+		return nil, fmt.Errorf("page tree has %d pages, expected %d", len(s.pages), ctx.PageCount)
+	}
+	// Every part has a page tree of its own; attributes the pages inherited now travel with them.
+	return s, pushDownInheritedAttrs(ctx, s.pages)
+}
+
+// collectPages appends the pages below the page tree node to s.pages, in order. Unlike looking
+// up each page by number, this walks the tree once.
+func (s *splitter) collectPages(node types.Dict) error {
+	kids, err := s.ctx.DereferenceArray(node["Kids"])
+	if err != nil {
+		return err
+	}
+	for _, kid := range kids {
+		ref, ok := kid.(types.IndirectRef)
+		nr := ref.ObjectNumber.Value()
+		if !ok || s.nodes[nr] || s.isPage[nr] {
+			return errors.New("malformed page tree")
+		}
+		d, err := s.ctx.DereferenceDict(ref)
+		if err != nil {
+			return err
+		}
+		if t := d.Type(); t != nil && *t == "Pages" {
+			s.nodes[nr] = true
+			if err := s.collectPages(d); err != nil {
+				return err
+			}
+			continue
+		}
+		s.isPage[nr] = true
+		s.pages = append(s.pages, nr)
+	}
+	return nil
+}
+
+// part writes the document with the pages in r only, in a single page tree node. Objects only
+// the other pages use are left out; references to the other pages become null.
+func (s *splitter) part(r PageRange) ([]byte, error) {
+	ctx := s.ctx
+	kept := map[int]bool{}
+	kids := types.Array{}
+	for _, nr := range s.pages[r.First-1 : r.Last] {
+		kept[nr] = true
+		kids = append(kids, *types.NewIndirectRef(nr, 0))
+	}
+	// leaves reports whether a destination or GoTo action points to a page outside the part.
+	leaves := func(o types.Object) bool {
+		nr, ok := destinationPage(ctx, o)
+		return ok && s.isPage[nr] && !kept[nr]
+	}
+
+	overrides := map[int]types.Object{}
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	root := maps.Clone(catalog)
+	for _, key := range wholeDocumentKeys {
+		delete(root, key)
+	}
+	if leaves(root["OpenAction"]) {
+		delete(root, "OpenAction")
+	}
+	if _, ok := root["Dests"]; ok {
+		root["Dests"] = s.replace(root["Dests"], overrides, func(o types.Object) types.Object {
+			return withoutDestinations(o, leaves)
+		})
+	}
+	if _, ok := root["Names"]; ok {
+		root["Names"] = s.replace(root["Names"], overrides, func(o types.Object) types.Object {
+			names, ok := o.(types.Dict)
+			if !ok || names["Dests"] == nil {
+				return o
+			}
+			names = maps.Clone(names)
+			names["Dests"] = s.replace(names["Dests"], overrides, func(o types.Object) types.Object {
+				return s.nameTreeWithout(o, overrides, leaves)
+			})
+			return names
+		})
+	}
+	overrides[ctx.Root.ObjectNumber.Value()] = root
+	treeRef := *types.NewIndirectRef(s.treeNr, 0)
+	overrides[s.treeNr] = types.Dict{"Type": types.Name("Pages"), "Kids": kids, "Count": types.Integer(len(kids))}
+	for nr := range kept {
+		page, err := ctx.DereferenceDict(*types.NewIndirectRef(nr, 0))
+		if err != nil {
+			return nil, err
+		}
+		page = maps.Clone(page)
+		page["Parent"] = treeRef
+		if err := dropLinks(ctx, page, leaves); err != nil {
+			return nil, err
+		}
+		overrides[nr] = page
+	}
+
+	// Collect what the part uses, in a stable order.
+	var order []int
+	seen := map[int]bool{}
+	var walk func(o types.Object)
+	walk = func(o types.Object) {
+		switch o := o.(type) {
+		case types.IndirectRef:
+			nr := o.ObjectNumber.Value()
+			if seen[nr] || s.isPage[nr] && !kept[nr] || s.nodes[nr] && nr != s.treeNr {
+				return
+			}
+			seen[nr] = true
+			resolved := s.resolve(nr, overrides)
+			if resolved == nil {
+				return
+			}
+			order = append(order, nr)
+			walk(resolved)
+		case types.Dict:
+			for _, key := range sortedKeys(o) {
+				walk(o[key])
+			}
+		case types.StreamDict:
+			walk(o.Dict)
+		case types.Array:
+			for _, v := range o {
+				walk(v)
+			}
+		}
+	}
+	walk(*ctx.Root)
+	if ctx.Info != nil {
+		walk(*ctx.Info)
+	}
+	return s.write(order, overrides, r)
+}
+
+// resolve returns object nr as the part writes it.
+func (s *splitter) resolve(nr int, overrides map[int]types.Object) types.Object {
+	if o, ok := overrides[nr]; ok {
+		return o
+	}
+	entry, ok := s.ctx.FindTableEntryLight(nr)
+	if !ok || entry.Free {
+		return nil
+	}
+	return entry.Object
+}
+
+// replace returns o with fn applied to its value: a direct value is replaced, an indirect one
+// overridden for the part.
+func (s *splitter) replace(o types.Object, overrides map[int]types.Object, fn func(types.Object) types.Object) types.Object {
+	ref, ok := o.(types.IndirectRef)
+	if !ok {
+		return fn(o)
+	}
+	if resolved := s.resolve(ref.ObjectNumber.Value(), overrides); resolved != nil {
+		overrides[ref.ObjectNumber.Value()] = fn(resolved)
+	}
+	return o
+}
+
+// nameTreeWithout returns the name tree node o without the destinations leaves reports.
+func (s *splitter) nameTreeWithout(o types.Object, overrides map[int]types.Object, leaves func(types.Object) bool) types.Object {
+	node, ok := o.(types.Dict)
+	if !ok {
+		return o
+	}
+	node = maps.Clone(node)
+	if names, _ := s.ctx.DereferenceArray(node["Names"]); names != nil {
+		keep := types.Array{}
+		for i := 0; i+1 < len(names); i += 2 {
+			if !leaves(names[i+1]) {
+				keep = append(keep, names[i], names[i+1])
+			}
+		}
+		node["Names"] = keep
+	}
+	if kids, _ := s.ctx.DereferenceArray(node["Kids"]); kids != nil {
+		for _, kid := range kids {
+			s.replace(kid, overrides, func(o types.Object) types.Object {
+				return s.nameTreeWithout(o, overrides, leaves)
+			})
+		}
+	}
+	return node
+}
+
+// write returns the objects in order as a PDF file, numbered from 1: the part r.
+func (s *splitter) write(order []int, overrides map[int]types.Object, r PageRange) ([]byte, error) {
+	renumber := make(renumbering, len(order))
+	for i, nr := range order {
+		renumber[nr] = i + 1
+	}
+	var out bytes.Buffer
+	out.Write(s.header)
+	out.WriteString("\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(order))
+	// A part is a document of its own, with an identifier of its own: a hash of the document's
+	// identifier, the range and the part's objects.
+	id := md5.New()
+	fmt.Fprintf(id, "%v %d-%d", s.ctx.ID, r.First, r.Last)
+	for i, nr := range order {
+		obj, err := renumber.object(s.resolve(nr, overrides), i+1)
+		if err != nil {
+			return nil, err
+		}
+		offsets[i] = out.Len()
+		out.Write(obj)
+		id.Write(obj)
+	}
+
+	trailer := types.Dict{"Size": types.Integer(len(order) + 1), "Root": renumber.ref(s.ctx.Root.ObjectNumber.Value())}
+	if s.ctx.Info != nil {
+		trailer["Info"] = renumber.ref(s.ctx.Info.ObjectNumber.Value())
+	}
+	sum := types.HexLiteral(hex.EncodeToString(id.Sum(nil)))
+	trailer["ID"] = types.Array{sum, sum}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(order)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer.PDFString(), xref)
+	return out.Bytes(), nil
+}
+
+// destinationPage returns the page object an explicit destination, a destination dictionary or
+// a GoTo action points to.
+func destinationPage(ctx *model.Context, o types.Object) (int, bool) {
+	for range 4 {
+		o, _ = ctx.Dereference(o)
+		switch d := o.(type) {
+		case types.Dict:
+			o = d["D"]
+			continue
+		case types.Array:
+			if len(d) > 0 {
+				if ref, ok := d[0].(types.IndirectRef); ok {
+					return ref.ObjectNumber.Value(), true
+				}
+			}
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// dropLinks removes the annotations of page that link to pages outside the part.
+func dropLinks(ctx *model.Context, page types.Dict, leaves func(types.Object) bool) error {
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil || annots == nil {
+		return err
+	}
+	keep := types.Array{}
+	for _, o := range annots {
+		annot, err := ctx.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if annot != nil && (leaves(annot["Dest"]) || leaves(annot["A"])) {
+			continue
+		}
+		keep = append(keep, o)
+	}
+	if len(keep) < len(annots) {
+		page["Annots"] = keep
+	}
+	return nil
+}
+
+// withoutDestinations returns the destination dictionary o (the catalog's Dests) without the
+// destinations leaves reports.
+func withoutDestinations(o types.Object, leaves func(types.Object) bool) types.Object {
+	dests, ok := o.(types.Dict)
+	if !ok {
+		return o
+	}
+	keep := types.NewDict()
+	for name, dest := range dests {
+		if !leaves(dest) {
+			keep[name] = dest
+		}
+	}
+	return keep
+}
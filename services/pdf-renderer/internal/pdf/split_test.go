@@ -0,0 +1,144 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSplit(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Split
+	}{
+		{"per_page", Split{Every: 1}},
+		{" PER_PAGE ", Split{Every: 1}},
+		{"every:3", Split{Every: 3}},
+		{"ranges:1-2,3-5", Split{Ranges: []PageRange{{1, 2}, {3, 5}}}},
+		{"ranges:4,1-4", Split{Ranges: []PageRange{{4, 4}, {1, 4}}}},
+	} {
+		got, err := ParseSplit(tc.in)
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.want, got, tc.in)
+	}
+	for _, in := range []string{"", "per_page:2", "every", "every:0", "every:x", "ranges:", "ranges:3-1", "ranges:0-2", "pages:1"} {
+		_, err := ParseSplit(in)
+		assert.ErrorIs(t, err, ErrInvalidSplit, in)
+	}
+}
+
+func TestSplit_Parts(t *testing.T) {
+	assert.Equal(t, []PageRange{{1, 2}, {3, 4}, {5, 5}}, Split{Every: 2}.Parts(5))
+	assert.Equal(t, []PageRange{{2, 3}, {1, 1}}, Split{Ranges: []PageRange{{2, 9}, {7, 8}, {1, 1}, {2, 3}}}.Parts(3),
+		"clipped to the document")
+	assert.Empty(t, Split{Every: 1}.Parts(0))
+}
+
+func TestSplitPages(t *testing.T) {
+	doc := imagesPDF(
+		[]string{flateImage(t, photo(8, 8)), flateImage(t, photo(16, 16)), flateImage(t, photo(24, 24))},
+		[]string{"%s Do", "%s Do", "%s Do"})
+
+	parts, err := SplitPages(doc, Split{Every: 2})
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, PageRange{1, 2}, parts[0].Pages)
+	assert.Equal(t, [][2]int{{8, 8}, {16, 16}}, imageSizes(t, parts[0].Data))
+	assert.Equal(t, PageRange{3, 3}, parts[1].Pages)
+	assert.Equal(t, [][2]int{{24, 24}}, imageSizes(t, parts[1].Data))
+	assert.Len(t, regexp.MustCompile(`/Subtype\s*/Image`).FindAll(parts[1].Data, -1), 1, "the other pages' images are left out")
+
+	_, err = SplitPages(doc, Split{Ranges: []PageRange{{4, 5}}})
+	assert.ErrorIs(t, err, ErrNoParts)
+}
+
+func TestSplitPages_Links(t *testing.T) {
+	doc := assemblePDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R /Dests << /first [3 0 R /Fit] /second [4 0 R /Fit] >> /Outlines 7 0 R /OpenAction [4 0 R /Fit]" +
+			" /Names << /Dests 8 0 R >> >>",
+		"<< /Type /Pages /Count 2 /Kids [3 0 R 4 0 R] /MediaBox [0 0 595 842] >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << >> /Annots [5 0 R 6 0 R] >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << >> >>",
+		"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest [4 0 R /Fit] >>",
+		"<< /Type /Annot /Subtype /Link /Rect [0 20 10 30] /A << /S /GoTo /D [3 0 R /Fit] >> >>",
+		"<< /Type /Outlines /Count 0 >>",
+		"<< /Kids [9 0 R] >>",
+		"<< /Limits [(a) (b)] /Names [(a) [4 0 R /Fit] (b) << /D [3 0 R /Fit] >>] >>",
+		"<< /Producer (Skia/PDF) >>",
+	})
+
+	parts, err := SplitPages(doc, Split{Ranges: []PageRange{{1, 1}}})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	out := parts[0].Data
+	assert.Len(t, regexp.MustCompile(`/Type\s*/Page\b`).FindAll(out, -1), 1, "page 2 is left out")
+
+	ctx, err := api.ReadAndValidate(bytes.NewReader(out), config())
+	require.NoError(t, err)
+	assert.Equal(t, 1, ctx.PageCount)
+	root, err := ctx.Catalog()
+	require.NoError(t, err)
+	assert.Nil(t, root["Outlines"])
+	assert.Nil(t, root["OpenAction"])
+	dests, err := ctx.DereferenceDict(root["Dests"])
+	require.NoError(t, err)
+	assert.Contains(t, dests, "first")
+	assert.NotContains(t, dests, "second")
+	names, err := ctx.DereferenceDict(root["Names"])
+	require.NoError(t, err)
+	tree, err := ctx.DereferenceDict(names["Dests"])
+	require.NoError(t, err)
+	leaf, err := ctx.DereferenceDict(tree.ArrayEntry("Kids")[0])
+	require.NoError(t, err)
+	require.Len(t, leaf.ArrayEntry("Names"), 2)
+	assert.Equal(t, "b", leaf.ArrayEntry("Names")[0].(types.StringLiteral).Value())
+
+	page, _, _, err := ctx.PageDict(1, false)
+	require.NoError(t, err)
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	require.NoError(t, err)
+	assert.Len(t, annots, 1, "only the link within the part is kept")
+	mediaBox, err := ctx.DereferenceArray(page["MediaBox"])
+	require.NoError(t, err)
+	assert.Len(t, mediaBox, 4, "inherited from the page tree")
+}
+
+func TestSplitPages_LinearizedAndCompressed(t *testing.T) {
+	linearized, err := Process(buildPDF(3), Options{Optimize: Optimization{Linearize: true}})
+	require.NoError(t, err)
+	parts, err := SplitPages(linearized, Split{Every: 2})
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, 2, checkLinearized(t, parts[0].Data))
+	assert.Equal(t, 1, checkLinearized(t, parts[1].Data))
+
+	compressed, err := Process(buildPDF(3), Options{Optimize: Optimization{Compress: true}})
+	require.NoError(t, err)
+	parts, err = SplitPages(compressed, Split{Every: 1})
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	for _, part := range parts {
+		n, err := PageCount(part.Data)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+}
+
+func TestSplitPages_PDFA2B(t *testing.T) {
+	doc, err := Process(buildPDF(2), Options{PDFA: PDFA2B})
+	require.NoError(t, err)
+	parts, err := SplitPages(doc, Split{Every: 1})
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	for _, part := range parts {
+		validatePDFA2B(t, part.Data)
+	}
+	assert.NotEqual(t, idPattern.Find(parts[0].Data), idPattern.Find(parts[1].Data), "each part has an identifier of its own")
+}
+
+var idPattern = regexp.MustCompile(`/ID\s*\[\s*<[0-9a-fA-F]+>`)
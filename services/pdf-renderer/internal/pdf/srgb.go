@@ -0,0 +1,107 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// sRGBDescription names the output condition of PDF/A documents (and the ICC profile).
+const sRGBDescription = "sRGB IEC61966-2.1"
+
+// sRGBProfile returns an ICC v2 display profile for sRGB IEC 61966-2.1. It is generated
+// instead of shipped: the colorants, white point and tone curve are fixed by the standard, and
+// PDF/A only needs a valid RGB profile to anchor DeviceRGB.
+var sRGBProfile = sync.OnceValue(func() []byte {
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", iccTextDescription(sRGBDescription)},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+		// D50-adapted (Bradford) sRGB primaries.
+		{"rXYZ", iccXYZ(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", iccXYZ(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", iccXYZ(0.1431, 0.0606, 0.7141)},
+		{"rTRC", iccSRGBCurve()},
+		{"gTRC", nil}, // shares rTRC
+		{"bTRC", nil},
+	}
+
+	const headerSize = 128
+	offset := headerSize + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	_ = binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	var shared [2]uint32
+	for _, tag := range tags {
+		entry := shared
+		if tag.data != nil {
+			entry = [2]uint32{uint32(offset + data.Len()), uint32(len(tag.data))}
+			data.Write(tag.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+			shared = entry
+		}
+		table.WriteString(tag.sig)
+		_ = binary.Write(&table, binary.BigEndian, entry)
+	}
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(headerSize+table.Len()+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	for i, v := range []uint16{2025, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], iccXYZ(0.9642, 1.0, 0.8249)[8:]) // PCS illuminant D50
+
+	return append(append(header, table.Bytes()...), data.Bytes()...)
+})
+
+func iccXYZ(x, y, z float64) []byte {
+	b := make([]byte, 20)
+	copy(b, "XYZ ")
+	for i, v := range []float64{x, y, z} {
+		binary.BigEndian.PutUint32(b[8+4*i:], uint32(int32(math.Round(v*65536))))
+	}
+	return b
+}
+
+// iccSRGBCurve samples the sRGB transfer function (IEC 61966-2.1) into a 1024 entry curve.
+func iccSRGBCurve() []byte {
+	const n = 1024
+	b := make([]byte, 12+2*n)
+	copy(b, "curv")
+	binary.BigEndian.PutUint32(b[8:], n)
+	for i := 0; i < n; i++ {
+		v := float64(i) / (n - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		binary.BigEndian.PutUint16(b[12+2*i:], uint16(math.Round(v*65535)))
+	}
+	return b
+}
+
+func iccText(s string) []byte {
+	return append(append([]byte("text\x00\x00\x00\x00"), s...), 0)
+}
+
+// iccTextDescription encodes an ICC v2 textDescriptionType with an ASCII description only.
+func iccTextDescription(s string) []byte {
+	var b bytes.Buffer
+	b.WriteString("desc\x00\x00\x00\x00")
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(s)+1))
+	b.WriteString(s)
+	b.WriteByte(0)
+	b.Write(make([]byte, 4+4+2+1+67)) // no Unicode or ScriptCode description
+	return b.Bytes()
+}
@@ -0,0 +1,201 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Watermark positions.
+const (
+	PositionCenter      = "center"
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionTiled       = "tiled" // a grid covering the page
+)
+
+// positionAnchors maps positions onto pdfcpu anchors and the offset (in points, towards the page
+// center) that keeps corner stamps off the page edge.
+var positionAnchors = map[string]struct {
+	anchor string
+	dx, dy float64
+}{
+	PositionCenter:      {"c", 0, 0},
+	PositionTopLeft:     {"tl", cornerMargin, -cornerMargin},
+	PositionTopRight:    {"tr", -cornerMargin, -cornerMargin},
+	PositionBottomLeft:  {"bl", cornerMargin, cornerMargin},
+	PositionBottomRight: {"br", -cornerMargin, cornerMargin},
+	PositionTiled:       {"c", 0, 0},
+}
+
+const (
+	cornerMargin = 24 // points
+	tileColumns  = 3
+	tileRows     = 4
+)
+
+var pageRangePattern = regexp.MustCompile(`^\s*\d+(\s*-\s*\d+)?(\s*,\s*\d+(\s*-\s*\d+)?)*\s*$`)
+
+// Watermark is text or an image stamped over the selected pages, after rendering.
+type Watermark struct {
+	Text     string
+	FontSize int    // points
+	Color    string // #RRGGBB
+
+	// Image (PNG or JPEG) is stamped instead of Text, Scale times the page width wide.
+	Image []byte
+	Scale float64
+
+	Opacity  float64 // 0 (invisible) … 1
+	Rotation float64 // degrees counterclockwise, -180 … 180
+	Position string  // Position* constant
+	Pages    string  // page range such as "1-3,5"; empty for all pages
+}
+
+// IsZero reports whether w stamps nothing.
+func (w *Watermark) IsZero() bool {
+	return w == nil || (w.Text == "" && len(w.Image) == 0)
+}
+
+// ValidPosition reports whether p is one of the Position* constants.
+func ValidPosition(p string) bool {
+	_, ok := positionAnchors[p]
+	return ok
+}
+
+// ValidPageRange reports whether s is a page range such as "1-3,5": comma-separated page numbers
+// (from 1) or ascending ranges.
+func ValidPageRange(s string) bool {
+	if !pageRangePattern.MatchString(s) {
+		return false
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, err := parsePageRangePart(part)
+		if err != nil || from < 1 || to < from {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectPages returns the pages of a pageCount page document in the page range s (all for "").
+// Pages beyond the document are ignored.
+func SelectPages(s string, pageCount int) ([]int, error) {
+	var pages []int
+	if strings.TrimSpace(s) == "" {
+		for p := 1; p <= pageCount; p++ {
+			pages = append(pages, p)
+		}
+		return pages, nil
+	}
+	if !ValidPageRange(s) {
+		return nil, fmt.Errorf("pdf: invalid page range %q", s)
+	}
+	selected := make([]bool, pageCount+1)
+	for _, part := range strings.Split(s, ",") {
+		from, to, _ := parsePageRangePart(part)
+		for p := from; p <= to && p <= pageCount; p++ {
+			selected[p] = true
+		}
+	}
+	for p := 1; p <= pageCount; p++ {
+		if selected[p] {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
+
+func parsePageRangePart(part string) (from, to int, err error) {
+	bounds := strings.SplitN(part, "-", 2)
+	if from, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err != nil {
+		return 0, 0, err
+	}
+	to = from
+	if len(bounds) == 2 {
+		to, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+	}
+	return from, to, err
+}
+
+// applyWatermark stamps w on the selected pages. Stamps go on top of the content: Chrome paints
+// page backgrounds, which would hide anything underneath.
+func applyWatermark(ctx *model.Context, w *Watermark) error {
+	pages, err := SelectPages(w.Pages, ctx.PageCount)
+	if err != nil || len(pages) == 0 {
+		return err
+	}
+	dims, err := ctx.PageDims()
+	if err != nil {
+		return err
+	}
+
+	m := map[int][]*model.Watermark{}
+	for _, p := range pages {
+		// pdfcpu fills in the stamps' resources page by page, so pages cannot share them.
+		if m[p], err = w.stamps(dims[p-1]); err != nil {
+			return err
+		}
+	}
+	if err := pdfcpu.AddWatermarksSliceMap(ctx, m); err != nil {
+		return fmt.Errorf("pdf: watermark: %w", err)
+	}
+	if len(w.Image) > 0 {
+		// Every stamp embedded its own copy of the image; keep one.
+		if err := pdfcpu.OptimizeXRefTable(ctx); err != nil {
+			return fmt.Errorf("pdf: watermark: %w", err)
+		}
+	}
+	return nil
+}
+
+// stamps returns the pdfcpu stamps drawing w on a page of the given size.
+func (w *Watermark) stamps(page types.Dim) ([]*model.Watermark, error) {
+	pos := positionAnchors[w.Position]
+	if w.Position == "" {
+		pos = positionAnchors[PositionCenter]
+	}
+	offsets := [][2]float64{{pos.dx, pos.dy}}
+	if w.Position == PositionTiled {
+		offsets = offsets[:0]
+		for row := 0; row < tileRows; row++ {
+			for col := 0; col < tileColumns; col++ {
+				offsets = append(offsets, [2]float64{
+					(float64(col) - float64(tileColumns-1)/2) * page.Width / tileColumns,
+					(float64(row) - float64(tileRows-1)/2) * page.Height / tileRows,
+				})
+			}
+		}
+	}
+
+	stamps := make([]*model.Watermark, 0, len(offsets))
+	for _, off := range offsets {
+		desc := fmt.Sprintf("position:%s, offset:%g %g, rotation:%g, opacity:%g", pos.anchor, off[0], off[1], w.Rotation, w.Opacity)
+		var (
+			wm  *model.Watermark
+			err error
+		)
+		if len(w.Image) > 0 {
+			wm, err = pdfcpu.ParseImageWatermarkDetails("", desc+fmt.Sprintf(", scalefactor:%g rel", w.Scale), true, types.POINTS)
+			if err == nil {
+				wm.Image = bytes.NewReader(w.Image)
+			}
+		} else {
+			desc += fmt.Sprintf(", fontname:Helvetica, points:%d, scalefactor:1 abs, fillcolor:%s", w.FontSize, w.Color)
+			wm, err = pdfcpu.ParseTextWatermarkDetails(w.Text, desc, true, types.POINTS)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pdf: watermark: %w", err)
+		}
+		stamps = append(stamps, wm)
+	}
+	return stamps, nil
+}
@@ -0,0 +1,122 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func textWatermark() *Watermark {
+	return &Watermark{Text: "CONFIDENTIAL", FontSize: 48, Color: "#808080", Opacity: 0.5, Rotation: 45, Position: PositionCenter}
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(1, 1, color.RGBA{R: 0xcc, A: 0xff})
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, img))
+	return b.Bytes()
+}
+
+// stampCounts returns the number of form XObjects drawn by each page of data.
+func stampCounts(t *testing.T, data []byte) []int {
+	t.Helper()
+	ctx, err := api.ReadContext(bytes.NewReader(data), config())
+	require.NoError(t, err)
+	require.NoError(t, api.ValidateContext(ctx))
+
+	counts := make([]int, ctx.PageCount)
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		page, _, inh, err := ctx.PageDict(pageNr, false)
+		require.NoError(t, err)
+		require.NotNil(t, page)
+		if xobjects := inh.Resources.DictEntry("XObject"); xobjects != nil {
+			counts[pageNr-1] = len(xobjects)
+		}
+	}
+	return counts
+}
+
+func TestProcess_TextWatermark(t *testing.T) {
+	out, err := Process(buildPDF(3), Options{Watermark: textWatermark()})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 1}, stampCounts(t, out))
+	assert.Contains(t, string(out), "/Helvetica")
+}
+
+func TestProcess_WatermarkPageRange(t *testing.T) {
+	w := textWatermark()
+	w.Pages = "2-3,9"
+	out, err := Process(buildPDF(4), Options{Watermark: w})
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 1, 0}, stampCounts(t, out), "pages beyond the document are ignored")
+}
+
+func TestProcess_TiledWatermark(t *testing.T) {
+	w := textWatermark()
+	w.Position = PositionTiled
+	out, err := Process(buildPDF(2), Options{Watermark: w})
+	require.NoError(t, err)
+	assert.Equal(t, []int{tileColumns * tileRows, tileColumns * tileRows}, stampCounts(t, out))
+}
+
+func TestProcess_ImageWatermark(t *testing.T) {
+	for _, position := range []string{PositionBottomRight, PositionTiled} {
+		w := &Watermark{Image: pngImage(t), Scale: 0.25, Opacity: 1, Position: position}
+		out, err := Process(buildPDF(2), Options{Watermark: w})
+		require.NoError(t, err, position)
+		counts := stampCounts(t, out)
+		assert.Len(t, counts, 2)
+		assert.Positive(t, counts[1], position)
+		assert.Equal(t, 1, strings.Count(string(out), "/Subtype/Image"), "%s: the image is embedded once", position)
+	}
+}
+
+func TestProcess_WatermarkPDFA2B(t *testing.T) {
+	w := &Watermark{Image: pngImage(t), Scale: 0.5, Opacity: 0.3, Position: PositionCenter}
+	out, err := Process(chromePDF(embeddedFont), Options{Watermark: w, PDFA: PDFA2B})
+	require.NoError(t, err)
+	validatePDFA2B(t, out)
+
+	// Text watermarks draw with Helvetica, which is not embedded.
+	_, err = Process(chromePDF(embeddedFont), Options{Watermark: textWatermark(), PDFA: PDFA2B})
+	assert.ErrorIs(t, err, ErrFontNotEmbedded)
+}
+
+func TestWatermark_InvalidImage(t *testing.T) {
+	_, err := Process(buildPDF(1), Options{Watermark: &Watermark{Image: []byte("not an image"), Scale: 0.5, Opacity: 1}})
+	assert.Error(t, err)
+}
+
+func TestValidPageRange(t *testing.T) {
+	for _, s := range []string{"1", "1-3", "1-3,5", " 2 - 4 , 7 ", "3-3"} {
+		assert.True(t, ValidPageRange(s), s)
+	}
+	for _, s := range []string{"", "0", "3-1", "1,", "-2", "a", "1-2-3", "1;2"} {
+		assert.False(t, ValidPageRange(s), s)
+	}
+}
+
+func TestSelectPages(t *testing.T) {
+	pages, err := SelectPages("", 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, pages)
+
+	pages, err = SelectPages("3,1-2,2", 5)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, pages, "sorted without duplicates")
+
+	_, err = SelectPages("x", 5)
+	assert.Error(t, err)
+}